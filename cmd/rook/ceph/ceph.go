@@ -39,17 +39,19 @@ var (
 )
 
 type config struct {
-	devices            string
-	directories        string
-	metadataDevice     string
-	dataDir            string
-	forceFormat        bool
-	location           string
-	cephConfigOverride string
-	storeConfig        osdconfig.StoreConfig
-	networkInfo        clusterd.NetworkInfo
-	monEndpoints       string
-	nodeName           string
+	devices             string
+	deviceClasses       string
+	directoryCapacities string
+	directories         string
+	metadataDevice      string
+	dataDir             string
+	forceFormat         bool
+	location            string
+	cephConfigOverride  string
+	storeConfig         osdconfig.StoreConfig
+	networkInfo         clusterd.NetworkInfo
+	monEndpoints        string
+	nodeName            string
 }
 
 func init() {
@@ -64,6 +66,8 @@ func AddCommands(command *cobra.Command) {
 	command.AddCommand(mgrCmd)
 	command.AddCommand(rgwCmd)
 	command.AddCommand(mdsCmd)
+	command.AddCommand(rbdMirrorCmd)
+	command.AddCommand(cleanupCmd)
 }
 
 func createContext() *clusterd.Context {
@@ -0,0 +1,77 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package ceph
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/rook/rook/cmd/rook/rook"
+	"github.com/rook/rook/pkg/daemon/ceph/cleanup"
+	"github.com/rook/rook/pkg/util/flags"
+	"github.com/spf13/cobra"
+)
+
+var cleanupCmd = &cobra.Command{
+	Use:    "cleanup",
+	Short:  "Removes the data of a deleted cluster from the node",
+	Hidden: true,
+}
+
+var (
+	cleanupClusterName string
+	cleanupDevices     string
+	cleanupOSDIDs      string
+	cleanupZeroHeaders bool
+)
+
+func init() {
+	cleanupCmd.Flags().StringVar(&cfg.dataDir, "config-dir", "", "the data dir of the cluster to remove")
+	cleanupCmd.Flags().StringVar(&cleanupClusterName, "cluster-name", "", "the name of the cluster, only its data is removed from the data dir")
+	cleanupCmd.Flags().StringVar(&cleanupDevices, "devices", "", "comma separated list of the persistent paths of the devices to wipe")
+	cleanupCmd.Flags().StringVar(&cleanupOSDIDs, "osd-ids", "", "comma separated list of the osds of the cluster on the node, only the devices with their partitions are wiped")
+	cleanupCmd.Flags().BoolVar(&cleanupZeroHeaders, "zero-headers", false, "overwrite the start of the devices with zeros after removing the partitions")
+	flags.SetFlagsFromEnv(cleanupCmd.Flags(), rook.RookEnvVarPrefix)
+
+	cleanupCmd.RunE = startCleanup
+}
+
+func startCleanup(cmd *cobra.Command, args []string) error {
+	rook.SetLogLevel()
+
+	rook.LogStartupInfo(cleanupCmd.Flags())
+
+	config := &cleanup.Config{DataDir: cfg.dataDir, ClusterName: cleanupClusterName, ZeroHeaders: cleanupZeroHeaders}
+	if cleanupDevices != "" {
+		config.Devices = strings.Split(cleanupDevices, ",")
+	}
+	if cleanupOSDIDs != "" {
+		for _, id := range strings.Split(cleanupOSDIDs, ",") {
+			osdID, err := strconv.Atoi(id)
+			if err != nil {
+				rook.TerminateFatal(fmt.Errorf("invalid osd id %s. %+v", id, err))
+			}
+			config.OSDIDs = append(config.OSDIDs, osdID)
+		}
+	}
+
+	if err := cleanup.Run(createContext(), config); err != nil {
+		rook.TerminateFatal(err)
+	}
+
+	return nil
+}
@@ -16,11 +16,14 @@ limitations under the License.
 package ceph
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/rook/rook/cmd/rook/rook"
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
 	"github.com/rook/rook/pkg/daemon/ceph/client"
 	"github.com/rook/rook/pkg/daemon/ceph/mon"
 	"github.com/rook/rook/pkg/daemon/ceph/osd"
@@ -38,14 +41,18 @@ var osdCmd = &cobra.Command{
 	Hidden: true,
 }
 var (
-	osdDataDeviceFilter string
-	ownerRefID          string
+	osdDataDeviceFilter   string
+	osdDataDeviceSelector string
+	ownerRefID            string
 )
 
 func addOSDFlags(command *cobra.Command) {
 	command.Flags().StringVar(&cfg.devices, "data-devices", "", "comma separated list of devices to use for storage")
+	command.Flags().StringVar(&cfg.deviceClasses, "data-device-classes", "", "comma separated list of device=class pairs overriding the crush device class of the data devices")
+	command.Flags().StringVar(&cfg.directoryCapacities, "data-directory-capacities", "", "comma separated list of directory=MB pairs limiting the capacity of the OSDs on the data directories")
 	command.Flags().StringVar(&ownerRefID, "cluster-id", "", "the UID of the cluster CRD that owns this cluster")
 	command.Flags().StringVar(&osdDataDeviceFilter, "data-device-filter", "", "a regex filter for the device names to use, or \"all\"")
+	command.Flags().StringVar(&osdDataDeviceSelector, "data-device-selector", "", "json device selector narrowing down the filtered devices by their properties")
 	command.Flags().StringVar(&cfg.directories, "data-directories", "", "comma separated list of directory paths to use for storage")
 	command.Flags().StringVar(&cfg.metadataDevice, "metadata-device", "", "device to use for metadata (e.g. a high performance SSD/NVMe device)")
 	command.Flags().StringVar(&cfg.location, "location", "", "location of this node for CRUSH placement")
@@ -58,6 +65,13 @@ func addOSDFlags(command *cobra.Command) {
 	command.Flags().IntVar(&cfg.storeConfig.DatabaseSizeMB, "osd-database-size", osdcfg.DBDefaultSizeMB, "default size (MB) for OSD database (bluestore)")
 	command.Flags().IntVar(&cfg.storeConfig.JournalSizeMB, "osd-journal-size", osdcfg.JournalDefaultSizeMB, "default size (MB) for OSD journal (filestore)")
 	command.Flags().StringVar(&cfg.storeConfig.StoreType, "osd-store", "", "type of backing OSD store to use (bluestore or filestore)")
+	command.Flags().StringVar(&cfg.storeConfig.DeviceClass, "osd-device-class", "", "crush device class of the OSDs (e.g. hdd, ssd, nvme). Detected from the device if not set")
+	command.Flags().IntVar(&cfg.storeConfig.WeightRampUpSteps, "osd-weight-ramp-up-steps", 0, "number of steps to increase the crush weight of new OSDs to their full weight")
+	command.Flags().StringVar(&cfg.storeConfig.MetadataSizePolicy, "osd-metadata-size-policy", "", "policy to size the bluestore WAL and DB of new OSDs (fixed, percent or evenSplit)")
+	command.Flags().IntVar(&cfg.storeConfig.DatabaseSizePercent, "osd-database-size-percent", 0, "size of the bluestore DB as a percent of the data device size (percent policy)")
+	command.Flags().BoolVar(&cfg.storeConfig.ConvertToBluestore, "osd-convert-to-bluestore", false, "convert the filestore OSDs on devices to bluestore one at a time")
+	command.Flags().IntVar(&cfg.storeConfig.DirectoryCapacityMB, "osd-directory-capacity", 0, "capacity limit (MB) of OSDs on directories")
+	command.Flags().IntVar(&cfg.storeConfig.DirectoryMinFreePercent, "osd-directory-min-free-percent", osdcfg.DefaultDirectoryMinFreePercent, "free space (percent) of the host filesystem below which OSDs on directories are marked out")
 }
 
 func init() {
@@ -106,20 +120,35 @@ func startOSD(cmd *cobra.Command, args []string) error {
 	}
 	crushLocation := strings.Join(locArgs, " ")
 
+	deviceClasses, err := parseDeviceClasses(cfg.deviceClasses)
+	if err != nil {
+		rook.TerminateFatal(fmt.Errorf("invalid device classes. %+v\n", err))
+	}
+
+	dirCapacities, err := parseDirectoryCapacities(cfg.directoryCapacities)
+	if err != nil {
+		rook.TerminateFatal(fmt.Errorf("invalid directory capacities. %+v\n", err))
+	}
+
+	var deviceSelector *rookalpha.DeviceSelector
+	if osdDataDeviceSelector != "" {
+		deviceSelector = &rookalpha.DeviceSelector{}
+		if err := json.Unmarshal([]byte(osdDataDeviceSelector), deviceSelector); err != nil {
+			rook.TerminateFatal(fmt.Errorf("invalid device selector. %+v\n", err))
+		}
+	}
+
 	forceFormat := false
 	clusterInfo.Monitors = mon.ParseMonEndpoints(cfg.monEndpoints)
 	ownerRef := cluster.ClusterOwnerRef(clusterInfo.Name, ownerRefID)
 	kv := k8sutil.NewConfigMapKVStore(clusterInfo.Name, clientset, ownerRef)
-	agent := osd.NewAgent(context, dataDevices, usingDeviceFilter, cfg.metadataDevice, cfg.directories, forceFormat,
-		crushLocation, cfg.storeConfig, &clusterInfo, cfg.nodeName, kv)
+	agent := osd.NewAgent(context, dataDevices, usingDeviceFilter, deviceSelector, cfg.metadataDevice, cfg.directories, forceFormat,
+		crushLocation, cfg.storeConfig, deviceClasses, dirCapacities, &clusterInfo, cfg.nodeName, kv)
 
 	err = osd.Run(context, agent, nil)
 	if err != nil {
 		// something failed in the OSD orchestration, update the status map with failure details
-		status := oposd.OrchestrationStatus{
-			Status:  oposd.OrchestrationStatusFailed,
-			Message: err.Error(),
-		}
+		status := agent.FailedStatus(err.Error())
 		oposd.UpdateOrchestrationStatusMap(clientset, clusterInfo.Name, cfg.nodeName, status)
 
 		rook.TerminateFatal(err)
@@ -127,3 +156,43 @@ func startOSD(cmd *cobra.Command, args []string) error {
 
 	return nil
 }
+
+// parseDeviceClasses parses a list of device=class pairs into a map of device to device class
+func parseDeviceClasses(raw string) (map[string]string, error) {
+	deviceClasses := map[string]string{}
+	if raw == "" {
+		return deviceClasses, nil
+	}
+
+	for _, pair := range strings.Split(raw, ",") {
+		kv := strings.Split(pair, "=")
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return nil, fmt.Errorf("device class %s is not in the format device=class", pair)
+		}
+		deviceClasses[kv[0]] = kv[1]
+	}
+
+	return deviceClasses, nil
+}
+
+// parseDirectoryCapacities parses a list of directory=MB pairs into a map of directory to capacity in MB
+func parseDirectoryCapacities(raw string) (map[string]int, error) {
+	capacities := map[string]int{}
+	if raw == "" {
+		return capacities, nil
+	}
+
+	for _, pair := range strings.Split(raw, ",") {
+		kv := strings.Split(pair, "=")
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, fmt.Errorf("directory capacity %s is not in the format directory=MB", pair)
+		}
+		capacity, err := strconv.Atoi(kv[1])
+		if err != nil || capacity <= 0 {
+			return nil, fmt.Errorf("capacity of directory %s is not a positive number of MB", kv[0])
+		}
+		capacities[kv[0]] = capacity
+	}
+
+	return capacities, nil
+}
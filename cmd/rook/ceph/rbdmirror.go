@@ -0,0 +1,73 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package ceph
+
+import (
+	"github.com/rook/rook/cmd/rook/rook"
+	"github.com/rook/rook/pkg/daemon/ceph/mon"
+	"github.com/rook/rook/pkg/daemon/ceph/rbd"
+	"github.com/rook/rook/pkg/util/flags"
+	"github.com/spf13/cobra"
+)
+
+var (
+	rbdMirrorName     string
+	rbdMirrorKeyring  string
+	rbdMirrorPeersDir string
+)
+
+var rbdMirrorCmd = &cobra.Command{
+	Use:    "rbd-mirror",
+	Short:  "Generates rbd-mirror config and runs the rbd-mirror daemon",
+	Hidden: true,
+}
+
+func init() {
+	rbdMirrorCmd.Flags().StringVar(&rbdMirrorName, "rbd-mirror-name", "", "the rbd-mirror name")
+	rbdMirrorCmd.Flags().StringVar(&rbdMirrorKeyring, "rbd-mirror-keyring", "", "the rbd-mirror keyring")
+	rbdMirrorCmd.Flags().StringVar(&rbdMirrorPeersDir, "rbd-mirror-peers-dir", "", "the dir with the config and keyring files of the peer clusters")
+	addCephFlags(rbdMirrorCmd)
+
+	flags.SetFlagsFromEnv(rbdMirrorCmd.Flags(), rook.RookEnvVarPrefix)
+
+	rbdMirrorCmd.RunE = startRBDMirror
+}
+
+func startRBDMirror(cmd *cobra.Command, args []string) error {
+	required := []string{"mon-endpoints", "cluster-name", "mon-secret", "admin-secret", "public-ipv4", "private-ipv4"}
+	if err := flags.VerifyRequiredFlags(rbdMirrorCmd, required); err != nil {
+		return err
+	}
+
+	rook.SetLogLevel()
+
+	rook.LogStartupInfo(rbdMirrorCmd.Flags())
+
+	clusterInfo.Monitors = mon.ParseMonEndpoints(cfg.monEndpoints)
+	config := &rbd.Config{
+		Name:        rbdMirrorName,
+		Keyring:     rbdMirrorKeyring,
+		PeersDir:    rbdMirrorPeersDir,
+		ClusterInfo: &clusterInfo,
+	}
+
+	err := rbd.Run(createContext(), config)
+	if err != nil {
+		rook.TerminateFatal(err)
+	}
+
+	return nil
+}
@@ -20,9 +20,10 @@ import (
 )
 
 const (
-	PlacementKeyMgr = "mgr"
-	PlacementKeyMon = "mon"
-	PlacementKeyOSD = "osd"
+	PlacementKeyMgr       = "mgr"
+	PlacementKeyMon       = "mon"
+	PlacementKeyOSD       = "osd"
+	PlacementKeyRBDMirror = "rbdmirror"
 )
 
 // GetMgrPlacement returns the placement for the MGR service
@@ -39,3 +40,8 @@ func GetMonPlacement(p rook.PlacementSpec) rook.Placement {
 func GetOSDPlacement(p rook.PlacementSpec) rook.Placement {
 	return p.All().Merge(p[PlacementKeyOSD])
 }
+
+// GetRBDMirrorPlacement returns the placement for the rbd-mirror daemons
+func GetRBDMirrorPlacement(p rook.PlacementSpec) rook.Placement {
+	return p.All().Merge(p[PlacementKeyRBDMirror])
+}
@@ -18,7 +18,7 @@ package v1alpha1
 import "github.com/rook/rook/pkg/daemon/ceph/model"
 
 func (p *PoolSpec) ToModel(name string) *model.Pool {
-	pool := &model.Pool{Name: name, FailureDomain: p.FailureDomain, CrushRoot: p.CrushRoot}
+	pool := &model.Pool{Name: name, FailureDomain: p.FailureDomain, CrushRoot: p.CrushRoot, DeviceClass: p.DeviceClass, PgNum: p.PgNum}
 	r := p.Replication()
 	if r != nil {
 		pool.ReplicatedConfig.Size = r.Size
@@ -28,6 +28,7 @@ func (p *PoolSpec) ToModel(name string) *model.Pool {
 		if ec != nil {
 			pool.ErasureCodedConfig.CodingChunkCount = ec.CodingChunks
 			pool.ErasureCodedConfig.DataChunkCount = ec.DataChunks
+			pool.ErasureCodedConfig.ProfileName = ec.Profile
 			pool.Type = model.ErasureCoded
 		}
 	}
@@ -43,7 +44,7 @@ func (p *PoolSpec) Replication() *ReplicatedSpec {
 
 func (p *PoolSpec) ErasureCode() *ErasureCodedSpec {
 	ec := &p.ErasureCoded
-	if ec.CodingChunks > 0 || ec.DataChunks > 0 {
+	if ec.CodingChunks > 0 || ec.DataChunks > 0 || ec.Profile != "" {
 		return ec
 	}
 	return nil
@@ -21,9 +21,10 @@ import (
 )
 
 const (
-	ResourcesKeyMgr = "mgr"
-	ResourcesKeyMon = "mon"
-	ResourcesKeyOSD = "osd"
+	ResourcesKeyMgr       = "mgr"
+	ResourcesKeyMon       = "mon"
+	ResourcesKeyOSD       = "osd"
+	ResourcesKeyRBDMirror = "rbdmirror"
 )
 
 // GetMgrResources returns the placement for the MGR service
@@ -40,3 +41,8 @@ func GetMonResources(p rook.ResourceSpec) v1.ResourceRequirements {
 func GetOSDResources(p rook.ResourceSpec) v1.ResourceRequirements {
 	return p[ResourcesKeyOSD]
 }
+
+// GetRBDMirrorResources returns the resources for the rbd-mirror daemons
+func GetRBDMirrorResources(p rook.ResourceSpec) v1.ResourceRequirements {
+	return p[ResourcesKeyRBDMirror]
+}
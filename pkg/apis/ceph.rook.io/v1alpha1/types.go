@@ -68,6 +68,170 @@ type ClusterSpec struct {
 
 	// A spec for mon releated options
 	Mon MonSpec `json:"mon"`
+
+	// How the OSDs on the storage nodes are orchestrated
+	OSDOrchestration OrchestrationSpec `json:"osdOrchestration,omitempty"`
+
+	// Reweighting of the OSDs by their utilization
+	OSDReweight OSDReweightSpec `json:"osdReweight,omitempty"`
+
+	// How the operator reacts to devices that report failing health
+	DeviceHealth DeviceHealthSpec `json:"deviceHealth,omitempty"`
+
+	// When and how much the OSDs scrub the placement groups
+	Scrub ScrubSpec `json:"scrub,omitempty"`
+
+	// What is cleaned up on the nodes when the cluster is deleted
+	CleanupPolicy CleanupPolicySpec `json:"cleanupPolicy,omitempty"`
+
+	// How the CRUSH location of the OSDs is derived from the topology labels of their nodes
+	CrushTopology CrushTopologySpec `json:"crushTopology,omitempty"`
+
+	// The tunables and the custom buckets and rules of the CRUSH map
+	Crush CrushSpec `json:"crush,omitempty"`
+
+	// The rbd-mirror daemons that mirror the pools to their peer clusters
+	RBDMirroring RBDMirroringSpec `json:"rbdMirroring,omitempty"`
+
+	// The adoption of the existing pools that are not backed by a pool CRD
+	PoolAdoption PoolAdoptionSpec `json:"poolAdoption,omitempty"`
+}
+
+// PoolAdoptionSpec represents the settings for creating pool CRDs for the existing pools of the cluster
+type PoolAdoptionSpec struct {
+	// Whether pool CRDs are created for the existing pools that are not backed by a CRD
+	Enabled bool `json:"enabled,omitempty"`
+	// The pools that are not adopted
+	ExcludedPools []string `json:"excludedPools,omitempty"`
+}
+
+// RBDMirroringSpec represents the settings of the rbd-mirror daemons
+type RBDMirroringSpec struct {
+	// The number of rbd-mirror daemons to run. No daemons are started if zero.
+	Workers int `json:"workers,omitempty"`
+}
+
+// OrchestrationSpec represents the settings for orchestrating the OSDs on the storage nodes
+type OrchestrationSpec struct {
+	// The maximum number of nodes that are orchestrated at the same time. Defaults to one node at a time.
+	MaxParallelNodes int `json:"maxParallelNodes,omitempty"`
+	// The CRUSH location type (e.g., rack or zone) from the node locations to orchestrate one at a time. Nodes in
+	// different failure domains will never be orchestrated at the same time.
+	FailureDomain string `json:"failureDomain,omitempty"`
+	// The time to wait for the orchestration of a node to complete before reporting it as failed. Defaults to no timeout.
+	NodeTimeoutSeconds int `json:"nodeTimeoutSeconds,omitempty"`
+}
+
+// OSDReweightSpec represents the settings for reweighting the OSDs by their utilization
+type OSDReweightSpec struct {
+	// Whether the OSDs are reweighted when their utilization deviates from the average utilization
+	Enabled bool `json:"enabled,omitempty"`
+	// The maximum difference in percentage points between the utilization of an OSD and the average utilization
+	// of all OSDs before the OSD is reweighted. Defaults to 5.
+	MaxDeviationPercent int `json:"maxDeviationPercent,omitempty"`
+	// How often the utilization of the OSDs is checked. Defaults to 300 seconds.
+	IntervalSeconds int `json:"intervalSeconds,omitempty"`
+}
+
+// DeviceHealthSpec represents the settings for reacting to the SMART health of the devices reported by rook-discover
+type DeviceHealthSpec struct {
+	// Whether the OSDs on a device that reports failing health are marked out before the device fails
+	MarkOutFailing bool `json:"markOutFailing,omitempty"`
+	// How often the health of the devices is checked. Defaults to 600 seconds.
+	IntervalSeconds int `json:"intervalSeconds,omitempty"`
+}
+
+// ScrubSpec represents the scheduling and throttling of the scrubs of the placement groups by the OSDs
+type ScrubSpec struct {
+	// The hour of the day (0-23) from which scrubs may start. Defaults to 0.
+	BeginHour int `json:"beginHour,omitempty"`
+	// The hour of the day (0-23) until which scrubs may start. Defaults to the end of the day. The window spans midnight
+	// if the end hour is lower than the begin hour.
+	EndHour int `json:"endHour,omitempty"`
+	// The day of the week (0-6, Sunday is 0) from which scrubs may start. Defaults to 0.
+	BeginWeekDay int `json:"beginWeekDay,omitempty"`
+	// The day of the week (0-6) until which scrubs may start. Defaults to the end of the week.
+	EndWeekDay int `json:"endWeekDay,omitempty"`
+	// The maximum number of scrubs running at the same time on each OSD. Defaults to 1.
+	MaxScrubs int `json:"maxScrubs,omitempty"`
+	// How often each placement group is deep scrubbed. Defaults to 7 days.
+	DeepScrubIntervalDays int `json:"deepScrubIntervalDays,omitempty"`
+	// The load average per CPU in percent above which no scrubs are started. Defaults to 50.
+	LoadThresholdPercent int `json:"loadThresholdPercent,omitempty"`
+	// How often the scrub settings are applied to the OSDs and the scrub status is reported. Defaults to 600 seconds.
+	IntervalSeconds int `json:"intervalSeconds,omitempty"`
+}
+
+// CleanupPolicySpec represents the cleanup of the nodes when the cluster is deleted
+type CleanupPolicySpec struct {
+	// What is cleaned up: none, removeData or wipeDevices. Defaults to none.
+	Mode CleanupMode `json:"mode,omitempty"`
+	// Must be set to yes-really-destroy-data for the cleanup to run
+	Confirmation string `json:"confirmation,omitempty"`
+	// Whether the start of the wiped devices is also overwritten with zeros
+	ZeroHeaders bool `json:"zeroHeaders,omitempty"`
+}
+
+type CleanupMode string
+
+const (
+	// CleanupModeNone leaves the data of the cluster on the nodes
+	CleanupModeNone CleanupMode = "none"
+	// CleanupModeRemoveData removes the data dir of the cluster on the nodes
+	CleanupModeRemoveData CleanupMode = "removeData"
+	// CleanupModeWipeDevices removes the data dir and the partitions of the OSD devices on the nodes
+	CleanupModeWipeDevices CleanupMode = "wipeDevices"
+	// CleanupConfirmation confirms that the data of the cluster is to be destroyed
+	CleanupConfirmation = "yes-really-destroy-data"
+)
+
+// CrushSpec represents the tunables and the custom buckets and rules of the CRUSH map
+type CrushSpec struct {
+	// The CRUSH tunables profile (e.g., firefly, hammer, jewel or optimal). New clusters use firefly if not set.
+	Tunables string `json:"tunables,omitempty"`
+	// Must be set to the same profile as the tunables to confirm the data movement of changing the tunables
+	ConfirmTunables string `json:"confirmTunables,omitempty"`
+	// The oldest client release allowed to connect to the cluster (e.g., jewel or luminous)
+	RequireMinCompatClient string `json:"requireMinCompatClient,omitempty"`
+	// The buckets to add to the CRUSH map
+	Buckets []CrushBucketSpec `json:"buckets,omitempty"`
+	// The replicated rules to add to the CRUSH map
+	Rules []CrushRuleSpec `json:"rules,omitempty"`
+}
+
+// CrushBucketSpec represents a bucket of the CRUSH map
+type CrushBucketSpec struct {
+	// The name of the bucket
+	Name string `json:"name"`
+	// The CRUSH type of the bucket (e.g., datacenter or rack)
+	Type string `json:"type"`
+	// The location of the bucket as type=name pairs (e.g., root=default,datacenter=dc1)
+	Location string `json:"location,omitempty"`
+}
+
+// CrushRuleSpec represents a replicated rule of the CRUSH map
+type CrushRuleSpec struct {
+	// The name of the rule
+	Name string `json:"name"`
+	// The bucket the replicas are placed under. Default is the default root.
+	Root string `json:"root,omitempty"`
+	// The CRUSH type the replicas are spread across. Default is host.
+	FailureDomain string `json:"failureDomain,omitempty"`
+	// The device class the replicas are placed on
+	DeviceClass string `json:"deviceClass,omitempty"`
+}
+
+// CrushTopologySpec represents how the CRUSH location of the OSDs is derived from the labels of their nodes
+type CrushTopologySpec struct {
+	// Whether the region, zone, rack and other CRUSH location types of the OSDs are taken from the labels of their nodes
+	FromNodeLabels bool `json:"fromNodeLabels,omitempty"`
+	// The node label for each CRUSH type (e.g., rack), overriding the default labels. A type with an empty label is not used.
+	NodeLabels map[string]string `json:"nodeLabels,omitempty"`
+	// The interval in seconds between the checks of the node labels for changes
+	IntervalSeconds int `json:"intervalSeconds,omitempty"`
+	// The new CRUSH location (e.g., rack=rack2,root=default) of each host whose node labels changed, to confirm the data
+	// movement of moving the host
+	ConfirmHostMoves map[string]string `json:"confirmHostMoves,omitempty"`
 }
 
 // DashboardSpec represents the settings for the Ceph dashboard
@@ -79,6 +243,68 @@ type DashboardSpec struct {
 type ClusterStatus struct {
 	State   ClusterState `json:"state,omitempty"`
 	Message string       `json:"message,omitempty"`
+	// The result of the most recent OSD orchestration on each storage node
+	OSDNodes map[string]OSDNodeStatus `json:"osdNodes,omitempty"`
+	// The age of the most recent scrubs of the placement groups
+	Scrub *ScrubStatus `json:"scrub,omitempty"`
+}
+
+// ScrubStatus represents how long ago the placement groups were scrubbed
+type ScrubStatus struct {
+	// The number of placement groups by the age of their last scrub
+	LastScrub ScrubAgeDistribution `json:"lastScrub"`
+	// The number of placement groups by the age of their last deep scrub
+	LastDeepScrub ScrubAgeDistribution `json:"lastDeepScrub"`
+	// When the scrub ages were collected
+	UpdateTime *metav1.Time `json:"updateTime,omitempty"`
+}
+
+// ScrubAgeDistribution represents the number of placement groups by the age of a scrub
+type ScrubAgeDistribution struct {
+	LessThanOneDay     int `json:"lessThanOneDay"`
+	OneToSevenDays     int `json:"oneToSevenDays"`
+	SevenToThirtyDays  int `json:"sevenToThirtyDays"`
+	MoreThanThirtyDays int `json:"moreThanThirtyDays"`
+	// The age of the oldest scrub in hours
+	OldestHours int `json:"oldestHours"`
+}
+
+// OSDNodeStatus represents the progress and result of the OSD orchestration on a node
+type OSDNodeStatus struct {
+	// The orchestration state of the node: starting, computingDiff, orchestrating, completed or failed
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+	// The devices found on the node and whether they were used by an OSD
+	Devices []OSDDeviceStatus `json:"devices,omitempty"`
+	// The IDs of the OSDs created on the node
+	OSDsCreated []int `json:"osdsCreated,omitempty"`
+	// The IDs of the OSDs removed from the node
+	OSDsRemoved    []int        `json:"osdsRemoved,omitempty"`
+	StartTime      *metav1.Time `json:"startTime,omitempty"`
+	CompletionTime *metav1.Time `json:"completionTime,omitempty"`
+	// The progress of the conversion of the filestore OSDs on the node to bluestore
+	Conversion *OSDConversionStatus `json:"conversion,omitempty"`
+}
+
+// OSDConversionStatus represents the progress of the conversion of the filestore OSDs on a node to bluestore
+type OSDConversionStatus struct {
+	// The ID of the OSD that is being converted or was converted last
+	OSDID int `json:"osdID"`
+	// The data device of the OSD
+	Device string `json:"device"`
+	// The conversion phase of the OSD: draining, destroying, provisioning or completed
+	Phase string `json:"phase"`
+	// The IDs of the OSDs that have been converted
+	Converted []int `json:"converted,omitempty"`
+}
+
+// OSDDeviceStatus represents a device that was considered for an OSD
+type OSDDeviceStatus struct {
+	Name string `json:"name"`
+	// Whether the device is used for the data or metadata of OSDs
+	InUse bool `json:"inUse"`
+	// The reason the device was skipped if it is not in use
+	SkipReason string `json:"skipReason,omitempty"`
 }
 
 type ClusterState string
@@ -87,6 +313,7 @@ const (
 	ClusterStateCreating ClusterState = "Creating"
 	ClusterStateCreated  ClusterState = "Created"
 	ClusterStateUpdating ClusterState = "Updating"
+	ClusterStateDeleting ClusterState = "Deleting"
 	ClusterStateError    ClusterState = "Error"
 )
 
@@ -102,7 +329,8 @@ type MonSpec struct {
 type Pool struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata"`
-	Spec              PoolSpec `json:"spec"`
+	Spec              PoolSpec    `json:"spec"`
+	Status            *PoolStatus `json:"status,omitempty"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -121,11 +349,162 @@ type PoolSpec struct {
 	// The root of the crush hierarchy utilized by the pool
 	CrushRoot string `json:"crushRoot"`
 
+	// The device class the pool's crush rule is restricted to (e.g. hdd, ssd, nvme). If empty, all devices are used.
+	DeviceClass string `json:"deviceClass"`
+
 	// The replication settings
 	Replicated ReplicatedSpec `json:"replicated"`
 
 	// The erasure code settings
 	ErasureCoded ErasureCodedSpec `json:"erasureCoded"`
+
+	// The number of placement groups of the pool. If not set, the count is derived from the target size of the pool.
+	PgNum int `json:"pgNum,omitempty"`
+
+	// The percentage of the capacity of the cluster expected to be used by the pool, to compute its placement groups
+	TargetSizePercent int `json:"targetSizePercent,omitempty"`
+
+	// The number of bytes expected to be stored in the pool, to compute its placement groups
+	TargetSizeBytes uint64 `json:"targetSizeBytes,omitempty"`
+
+	// The minimum number of copies or chunks of an object that must be available for I/O. If not set, ceph's default is used.
+	MinSize uint `json:"minSize,omitempty"`
+
+	// The application the pool is tagged with (e.g. rbd, cephfs or rgw). If not set, the pool is tagged with its name.
+	Application string `json:"application,omitempty"`
+
+	// The quotas of the pool
+	Quotas QuotaSpec `json:"quotas,omitempty"`
+
+	// The bluestore compression settings of the pool
+	Compression CompressionSpec `json:"compression,omitempty"`
+
+	// The mirroring of the pool to peer clusters by the rbd-mirror daemons
+	Mirroring MirroringSpec `json:"mirroring,omitempty"`
+
+	// The cache tier in front of the pool
+	Tier TierSpec `json:"tier,omitempty"`
+
+	// Whether the ceph pool is deleted or retained when the pool CRD is deleted. Defaults to Retain.
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
+}
+
+// DeletionPolicy is whether the ceph resources of a CRD are deleted or retained when the CRD is deleted
+type DeletionPolicy string
+
+const (
+	// DeletionPolicyRetain leaves the ceph pools in the cluster when their CRD is deleted
+	DeletionPolicyRetain DeletionPolicy = "Retain"
+	// DeletionPolicyDelete deletes the ceph pools when their CRD is deleted, unless they are still in use
+	DeletionPolicyDelete DeletionPolicy = "Delete"
+)
+
+// QuotaSpec represents the quotas of a pool. A quota of zero is unlimited.
+type QuotaSpec struct {
+	// The maximum number of bytes stored in the pool
+	MaxBytes uint64 `json:"maxBytes,omitempty"`
+
+	// The maximum number of objects stored in the pool
+	MaxObjects uint64 `json:"maxObjects,omitempty"`
+}
+
+// CompressionSpec represents the bluestore compression settings of a pool
+type CompressionSpec struct {
+	// The compression mode: none, passive, aggressive or force
+	Mode string `json:"mode,omitempty"`
+
+	// The compression algorithm: snappy, zlib, zstd or lz4
+	Algorithm string `json:"algorithm,omitempty"`
+
+	// The percent of its original size that a compressed chunk must be below to be stored compressed
+	RequiredRatioPercent int `json:"requiredRatioPercent,omitempty"`
+}
+
+// MirroringSpec represents the mirroring settings of a pool
+type MirroringSpec struct {
+	// The mirroring mode: pool to mirror all the images with journaling, or image to mirror the images enabled
+	// explicitly. Mirroring is disabled if empty.
+	Mode string `json:"mode,omitempty"`
+
+	// The peer clusters the pool is mirrored from
+	Peers []MirroringPeerSpec `json:"peers,omitempty"`
+}
+
+// MirroringPeerSpec represents a peer cluster of a mirrored pool
+type MirroringPeerSpec struct {
+	// The secret with the bootstrap credentials of the peer cluster. The name of the secret is the name of the peer.
+	SecretName string `json:"secretName"`
+}
+
+// MirroringStatus represents the health of the mirroring of a pool
+type MirroringStatus struct {
+	// The overall health of the mirroring: OK, WARNING or ERROR
+	Health string `json:"health,omitempty"`
+
+	// The number of mirrored images in each state (e.g. replaying or syncing)
+	States map[string]int `json:"states,omitempty"`
+
+	// The peers the pool is mirrored from
+	Peers []string `json:"peers,omitempty"`
+}
+
+// TierSpec represents a cache pool in front of a pool. The cache settings are applied to the cache pool.
+type TierSpec struct {
+	// The pool used as the cache tier. There is no cache tier if empty.
+	CachePool string `json:"cachePool,omitempty"`
+
+	// The cache mode: writeback, readproxy or readonly. The default is writeback.
+	CacheMode string `json:"cacheMode,omitempty"`
+
+	// The hit sets tracking the accesses to the objects of the cache pool
+	HitSet HitSetSpec `json:"hitSet,omitempty"`
+
+	// The number of bytes in the cache pool at which objects are flushed and evicted
+	TargetMaxBytes uint64 `json:"targetMaxBytes,omitempty"`
+
+	// The number of objects in the cache pool at which objects are flushed and evicted
+	TargetMaxObjects uint64 `json:"targetMaxObjects,omitempty"`
+
+	// The percent of the target size of the cache pool with dirty objects at which they are flushed
+	DirtyRatioPercent int `json:"dirtyRatioPercent,omitempty"`
+
+	// The percent of the target size of the cache pool at which clean objects are evicted
+	FullRatioPercent int `json:"fullRatioPercent,omitempty"`
+}
+
+// HitSetSpec represents the hit sets of a cache pool
+type HitSetSpec struct {
+	// The hit set type: bloom, explicit_hash or explicit_object. The default is bloom.
+	Type string `json:"type,omitempty"`
+
+	// The number of hit sets kept
+	Count int `json:"count,omitempty"`
+
+	// The seconds covered by each hit set
+	PeriodSeconds int `json:"periodSeconds,omitempty"`
+}
+
+// PoolStatus represents the usage of a pool and the reconciliation of its settings
+type PoolStatus struct {
+	// The bytes stored in the pool
+	BytesUsed uint64 `json:"bytesUsed"`
+
+	// The objects stored in the pool
+	Objects uint64 `json:"objects"`
+
+	// The properties of the pool that were changed outside of the pool CRD and reset at the last check
+	CorrectedProperties []string `json:"correctedProperties,omitempty"`
+
+	// The error applying the settings of the pool at the last check
+	Message string `json:"message,omitempty"`
+
+	// The reason the last change of the pool CRD was rejected, if it cannot be applied to the pool
+	RejectedUpdate string `json:"rejectedUpdate,omitempty"`
+
+	// The health of the mirroring of the pool, if it is mirrored
+	Mirroring *MirroringStatus `json:"mirroring,omitempty"`
+
+	UpdateTime *metav1.Time `json:"updateTime,omitempty"`
 }
 
 // ReplicationSpec represents the spec for replication in a pool
@@ -144,6 +523,67 @@ type ErasureCodedSpec struct {
 
 	// The algorithm for erasure coding
 	Algorithm string `json:"algorithm"`
+
+	// The name of the ErasureCodeProfile CRD that defines the erasure coding of the pool, instead of the coding and
+	// data chunks
+	Profile string `json:"profile,omitempty"`
+}
+
+// +genclient
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type ErasureCodeProfile struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              ErasureCodeProfileSpec    `json:"spec"`
+	Status            *ErasureCodeProfileStatus `json:"status,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type ErasureCodeProfileList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+	Items           []ErasureCodeProfile `json:"items"`
+}
+
+// ErasureCodeProfileSpec represents the settings of an erasure code profile that pools can share
+type ErasureCodeProfileSpec struct {
+	// Number of data chunks per object
+	DataChunks uint `json:"dataChunks"`
+
+	// Number of coding chunks per object
+	CodingChunks uint `json:"codingChunks"`
+
+	// The erasure code plugin: jerasure, isa, lrc or shec. The plugin of the default profile if not set.
+	Plugin string `json:"plugin,omitempty"`
+
+	// The technique of the plugin (e.g., reed_sol_van or cauchy)
+	Technique string `json:"technique,omitempty"`
+
+	// The failure domain the chunks are spread across: osd or host (technically also any type in the crush map)
+	FailureDomain string `json:"failureDomain,omitempty"`
+
+	// The root in the crush map the chunks are placed under
+	CrushRoot string `json:"crushRoot,omitempty"`
+
+	// The device class the chunks are placed on
+	DeviceClass string `json:"deviceClass,omitempty"`
+
+	// The size of the stripe unit (e.g., 4K or 64K)
+	StripeUnit string `json:"stripeUnit,omitempty"`
+
+	// Other parameters of the plugin (e.g., l for lrc or c for shec)
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+// ErasureCodeProfileStatus represents the state of the erasure code profile in the cluster
+type ErasureCodeProfileStatus struct {
+	// The pools using the profile
+	Pools []string `json:"pools,omitempty"`
+
+	// Why the last change or deletion of the profile was not applied
+	Message string `json:"message,omitempty"`
 }
 
 // +genclient
@@ -174,6 +614,9 @@ type FilesystemSpec struct {
 
 	// The mds pod info
 	MetadataServer MetadataServerSpec `json:"metadataServer"`
+
+	// Whether the ceph file system and its pools are deleted or retained when the CRD is deleted. Defaults to Retain.
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
 }
 
 type MetadataServerSpec struct {
@@ -219,6 +662,9 @@ type ObjectStoreSpec struct {
 
 	// The rgw pod info
 	Gateway GatewaySpec `json:"gateway"`
+
+	// Whether the realm and pools of the object store are deleted or retained when the CRD is deleted. Defaults to Retain.
+	DeletionPolicy DeletionPolicy `json:"deletionPolicy,omitempty"`
 }
 
 type GatewaySpec struct {
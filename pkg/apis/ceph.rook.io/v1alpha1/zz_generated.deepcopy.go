@@ -25,13 +25,29 @@ import (
 	runtime "k8s.io/apimachinery/pkg/runtime"
 )
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CleanupPolicySpec) DeepCopyInto(out *CleanupPolicySpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CleanupPolicySpec.
+func (in *CleanupPolicySpec) DeepCopy() *CleanupPolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CleanupPolicySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Cluster) DeepCopyInto(out *Cluster) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -111,6 +127,15 @@ func (in *ClusterSpec) DeepCopyInto(out *ClusterSpec) {
 		}
 	}
 	out.Mon = in.Mon
+	out.OSDOrchestration = in.OSDOrchestration
+	out.OSDReweight = in.OSDReweight
+	out.DeviceHealth = in.DeviceHealth
+	out.Scrub = in.Scrub
+	out.CleanupPolicy = in.CleanupPolicy
+	in.CrushTopology.DeepCopyInto(&out.CrushTopology)
+	in.Crush.DeepCopyInto(&out.Crush)
+	out.RBDMirroring = in.RBDMirroring
+	in.PoolAdoption.DeepCopyInto(&out.PoolAdoption)
 	return
 }
 
@@ -127,6 +152,24 @@ func (in *ClusterSpec) DeepCopy() *ClusterSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ClusterStatus) DeepCopyInto(out *ClusterStatus) {
 	*out = *in
+	if in.OSDNodes != nil {
+		in, out := &in.OSDNodes, &out.OSDNodes
+		*out = make(map[string]OSDNodeStatus, len(*in))
+		for key, val := range *in {
+			newVal := new(OSDNodeStatus)
+			val.DeepCopyInto(newVal)
+			(*out)[key] = *newVal
+		}
+	}
+	if in.Scrub != nil {
+		in, out := &in.Scrub, &out.Scrub
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(ScrubStatus)
+			(*in).DeepCopyInto(*out)
+		}
+	}
 	return
 }
 
@@ -140,6 +183,110 @@ func (in *ClusterStatus) DeepCopy() *ClusterStatus {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CompressionSpec) DeepCopyInto(out *CompressionSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CompressionSpec.
+func (in *CompressionSpec) DeepCopy() *CompressionSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CompressionSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CrushBucketSpec) DeepCopyInto(out *CrushBucketSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CrushBucketSpec.
+func (in *CrushBucketSpec) DeepCopy() *CrushBucketSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CrushBucketSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CrushRuleSpec) DeepCopyInto(out *CrushRuleSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CrushRuleSpec.
+func (in *CrushRuleSpec) DeepCopy() *CrushRuleSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CrushRuleSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CrushSpec) DeepCopyInto(out *CrushSpec) {
+	*out = *in
+	if in.Buckets != nil {
+		in, out := &in.Buckets, &out.Buckets
+		*out = make([]CrushBucketSpec, len(*in))
+		copy(*out, *in)
+	}
+	if in.Rules != nil {
+		in, out := &in.Rules, &out.Rules
+		*out = make([]CrushRuleSpec, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CrushSpec.
+func (in *CrushSpec) DeepCopy() *CrushSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CrushSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CrushTopologySpec) DeepCopyInto(out *CrushTopologySpec) {
+	*out = *in
+	if in.NodeLabels != nil {
+		in, out := &in.NodeLabels, &out.NodeLabels
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.ConfirmHostMoves != nil {
+		in, out := &in.ConfirmHostMoves, &out.ConfirmHostMoves
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CrushTopologySpec.
+func (in *CrushTopologySpec) DeepCopy() *CrushTopologySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CrushTopologySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *DashboardSpec) DeepCopyInto(out *DashboardSpec) {
 	*out = *in
@@ -156,6 +303,137 @@ func (in *DashboardSpec) DeepCopy() *DashboardSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *DeviceHealthSpec) DeepCopyInto(out *DeviceHealthSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new DeviceHealthSpec.
+func (in *DeviceHealthSpec) DeepCopy() *DeviceHealthSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(DeviceHealthSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ErasureCodeProfile) DeepCopyInto(out *ErasureCodeProfile) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	if in.Status != nil {
+		in, out := &in.Status, &out.Status
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(ErasureCodeProfileStatus)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ErasureCodeProfile.
+func (in *ErasureCodeProfile) DeepCopy() *ErasureCodeProfile {
+	if in == nil {
+		return nil
+	}
+	out := new(ErasureCodeProfile)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ErasureCodeProfile) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	} else {
+		return nil
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ErasureCodeProfileList) DeepCopyInto(out *ErasureCodeProfileList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	out.ListMeta = in.ListMeta
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ErasureCodeProfile, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ErasureCodeProfileList.
+func (in *ErasureCodeProfileList) DeepCopy() *ErasureCodeProfileList {
+	if in == nil {
+		return nil
+	}
+	out := new(ErasureCodeProfileList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ErasureCodeProfileList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	} else {
+		return nil
+	}
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ErasureCodeProfileSpec) DeepCopyInto(out *ErasureCodeProfileSpec) {
+	*out = *in
+	if in.Parameters != nil {
+		in, out := &in.Parameters, &out.Parameters
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ErasureCodeProfileSpec.
+func (in *ErasureCodeProfileSpec) DeepCopy() *ErasureCodeProfileSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ErasureCodeProfileSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ErasureCodeProfileStatus) DeepCopyInto(out *ErasureCodeProfileStatus) {
+	*out = *in
+	if in.Pools != nil {
+		in, out := &in.Pools, &out.Pools
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ErasureCodeProfileStatus.
+func (in *ErasureCodeProfileStatus) DeepCopy() *ErasureCodeProfileStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ErasureCodeProfileStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ErasureCodedSpec) DeepCopyInto(out *ErasureCodedSpec) {
 	*out = *in
@@ -237,11 +515,13 @@ func (in *FilesystemList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *FilesystemSpec) DeepCopyInto(out *FilesystemSpec) {
 	*out = *in
-	out.MetadataPool = in.MetadataPool
+	in.MetadataPool.DeepCopyInto(&out.MetadataPool)
 	if in.DataPools != nil {
 		in, out := &in.DataPools, &out.DataPools
 		*out = make([]PoolSpec, len(*in))
-		copy(*out, *in)
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
 	}
 	in.MetadataServer.DeepCopyInto(&out.MetadataServer)
 	return
@@ -275,6 +555,22 @@ func (in *GatewaySpec) DeepCopy() *GatewaySpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *HitSetSpec) DeepCopyInto(out *HitSetSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new HitSetSpec.
+func (in *HitSetSpec) DeepCopy() *HitSetSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(HitSetSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MetadataServerSpec) DeepCopyInto(out *MetadataServerSpec) {
 	*out = *in
@@ -293,6 +589,71 @@ func (in *MetadataServerSpec) DeepCopy() *MetadataServerSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MirroringPeerSpec) DeepCopyInto(out *MirroringPeerSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MirroringPeerSpec.
+func (in *MirroringPeerSpec) DeepCopy() *MirroringPeerSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(MirroringPeerSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MirroringSpec) DeepCopyInto(out *MirroringSpec) {
+	*out = *in
+	if in.Peers != nil {
+		in, out := &in.Peers, &out.Peers
+		*out = make([]MirroringPeerSpec, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MirroringSpec.
+func (in *MirroringSpec) DeepCopy() *MirroringSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(MirroringSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *MirroringStatus) DeepCopyInto(out *MirroringStatus) {
+	*out = *in
+	if in.States != nil {
+		in, out := &in.States, &out.States
+		*out = make(map[string]int, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Peers != nil {
+		in, out := &in.Peers, &out.Peers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new MirroringStatus.
+func (in *MirroringStatus) DeepCopy() *MirroringStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(MirroringStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *MonSpec) DeepCopyInto(out *MonSpec) {
 	*out = *in
@@ -309,6 +670,115 @@ func (in *MonSpec) DeepCopy() *MonSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OSDConversionStatus) DeepCopyInto(out *OSDConversionStatus) {
+	*out = *in
+	if in.Converted != nil {
+		in, out := &in.Converted, &out.Converted
+		*out = make([]int, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OSDConversionStatus.
+func (in *OSDConversionStatus) DeepCopy() *OSDConversionStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(OSDConversionStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OSDDeviceStatus) DeepCopyInto(out *OSDDeviceStatus) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OSDDeviceStatus.
+func (in *OSDDeviceStatus) DeepCopy() *OSDDeviceStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(OSDDeviceStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OSDNodeStatus) DeepCopyInto(out *OSDNodeStatus) {
+	*out = *in
+	if in.Devices != nil {
+		in, out := &in.Devices, &out.Devices
+		*out = make([]OSDDeviceStatus, len(*in))
+		copy(*out, *in)
+	}
+	if in.OSDsCreated != nil {
+		in, out := &in.OSDsCreated, &out.OSDsCreated
+		*out = make([]int, len(*in))
+		copy(*out, *in)
+	}
+	if in.OSDsRemoved != nil {
+		in, out := &in.OSDsRemoved, &out.OSDsRemoved
+		*out = make([]int, len(*in))
+		copy(*out, *in)
+	}
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = (*in).DeepCopy()
+		}
+	}
+	if in.CompletionTime != nil {
+		in, out := &in.CompletionTime, &out.CompletionTime
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = (*in).DeepCopy()
+		}
+	}
+	if in.Conversion != nil {
+		in, out := &in.Conversion, &out.Conversion
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(OSDConversionStatus)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OSDNodeStatus.
+func (in *OSDNodeStatus) DeepCopy() *OSDNodeStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(OSDNodeStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OSDReweightSpec) DeepCopyInto(out *OSDReweightSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OSDReweightSpec.
+func (in *OSDReweightSpec) DeepCopy() *OSDReweightSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(OSDReweightSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ObjectStore) DeepCopyInto(out *ObjectStore) {
 	*out = *in
@@ -374,8 +844,8 @@ func (in *ObjectStoreList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ObjectStoreSpec) DeepCopyInto(out *ObjectStoreSpec) {
 	*out = *in
-	out.MetadataPool = in.MetadataPool
-	out.DataPool = in.DataPool
+	in.MetadataPool.DeepCopyInto(&out.MetadataPool)
+	in.DataPool.DeepCopyInto(&out.DataPool)
 	in.Gateway.DeepCopyInto(&out.Gateway)
 	return
 }
@@ -390,12 +860,37 @@ func (in *ObjectStoreSpec) DeepCopy() *ObjectStoreSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OrchestrationSpec) DeepCopyInto(out *OrchestrationSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OrchestrationSpec.
+func (in *OrchestrationSpec) DeepCopy() *OrchestrationSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(OrchestrationSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *Pool) DeepCopyInto(out *Pool) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
+	if in.Status != nil {
+		in, out := &in.Status, &out.Status
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(PoolStatus)
+			(*in).DeepCopyInto(*out)
+		}
+	}
 	return
 }
 
@@ -418,6 +913,27 @@ func (in *Pool) DeepCopyObject() runtime.Object {
 	}
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PoolAdoptionSpec) DeepCopyInto(out *PoolAdoptionSpec) {
+	*out = *in
+	if in.ExcludedPools != nil {
+		in, out := &in.ExcludedPools, &out.ExcludedPools
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PoolAdoptionSpec.
+func (in *PoolAdoptionSpec) DeepCopy() *PoolAdoptionSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PoolAdoptionSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *PoolList) DeepCopyInto(out *PoolList) {
 	*out = *in
@@ -457,6 +973,10 @@ func (in *PoolSpec) DeepCopyInto(out *PoolSpec) {
 	*out = *in
 	out.Replicated = in.Replicated
 	out.ErasureCoded = in.ErasureCoded
+	out.Quotas = in.Quotas
+	out.Compression = in.Compression
+	in.Mirroring.DeepCopyInto(&out.Mirroring)
+	out.Tier = in.Tier
 	return
 }
 
@@ -470,6 +990,76 @@ func (in *PoolSpec) DeepCopy() *PoolSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PoolStatus) DeepCopyInto(out *PoolStatus) {
+	*out = *in
+	if in.CorrectedProperties != nil {
+		in, out := &in.CorrectedProperties, &out.CorrectedProperties
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Mirroring != nil {
+		in, out := &in.Mirroring, &out.Mirroring
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = new(MirroringStatus)
+			(*in).DeepCopyInto(*out)
+		}
+	}
+	if in.UpdateTime != nil {
+		in, out := &in.UpdateTime, &out.UpdateTime
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = (*in).DeepCopy()
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PoolStatus.
+func (in *PoolStatus) DeepCopy() *PoolStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(PoolStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *QuotaSpec) DeepCopyInto(out *QuotaSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new QuotaSpec.
+func (in *QuotaSpec) DeepCopy() *QuotaSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(QuotaSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RBDMirroringSpec) DeepCopyInto(out *RBDMirroringSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RBDMirroringSpec.
+func (in *RBDMirroringSpec) DeepCopy() *RBDMirroringSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(RBDMirroringSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ReplicatedSpec) DeepCopyInto(out *ReplicatedSpec) {
 	*out = *in
@@ -485,3 +1075,78 @@ func (in *ReplicatedSpec) DeepCopy() *ReplicatedSpec {
 	in.DeepCopyInto(out)
 	return out
 }
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScrubAgeDistribution) DeepCopyInto(out *ScrubAgeDistribution) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScrubAgeDistribution.
+func (in *ScrubAgeDistribution) DeepCopy() *ScrubAgeDistribution {
+	if in == nil {
+		return nil
+	}
+	out := new(ScrubAgeDistribution)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScrubSpec) DeepCopyInto(out *ScrubSpec) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScrubSpec.
+func (in *ScrubSpec) DeepCopy() *ScrubSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ScrubSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ScrubStatus) DeepCopyInto(out *ScrubStatus) {
+	*out = *in
+	out.LastScrub = in.LastScrub
+	out.LastDeepScrub = in.LastDeepScrub
+	if in.UpdateTime != nil {
+		in, out := &in.UpdateTime, &out.UpdateTime
+		if *in == nil {
+			*out = nil
+		} else {
+			*out = (*in).DeepCopy()
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ScrubStatus.
+func (in *ScrubStatus) DeepCopy() *ScrubStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ScrubStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TierSpec) DeepCopyInto(out *TierSpec) {
+	*out = *in
+	out.HitSet = in.HitSet
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TierSpec.
+func (in *TierSpec) DeepCopy() *TierSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(TierSpec)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -53,6 +53,8 @@ func init() {
 // Adds the list of known types to api.Scheme.
 func addKnownTypes(scheme *runtime.Scheme) error {
 	scheme.AddKnownTypes(SchemeGroupVersion,
+		&DeviceInventory{},
+		&DeviceInventoryList{},
 		&Volume{},
 		&VolumeList{})
 	metav1.AddToGroupVersion(scheme, SchemeGroupVersion)
@@ -90,6 +90,10 @@ func (s *StorageScopeSpec) resolveNodeSelection(node *Node) {
 	if len(node.Selection.Directories) == 0 {
 		node.Selection.Directories = s.Directories
 	}
+
+	if node.Selection.DeviceSelector == nil {
+		node.Selection.DeviceSelector = s.DeviceSelector
+	}
 }
 
 func (s *StorageScopeSpec) resolveNodeConfig(node *Node) {
@@ -243,3 +243,21 @@ func TestClusterDirsDevsInherit(t *testing.T) {
 	assert.Equal(t, []Directory{{Path: "/rook/datadir4"}}, node.Directories)
 	assert.Equal(t, []Device{{Name: "device4"}}, node.Devices)
 }
+
+func TestResolveNodeDeviceSelector(t *testing.T) {
+	storageSpec := StorageScopeSpec{
+		Selection: Selection{DeviceSelector: &DeviceSelector{MinSize: "1Ti", Rotational: newBool(false)}},
+		Nodes: []Node{
+			{Name: "node1"},
+			{Name: "node2", Selection: Selection{DeviceSelector: &DeviceSelector{Model: "^SAMSUNG"}}},
+		},
+	}
+
+	// the node inherits the device selector of the cluster
+	node := storageSpec.ResolveNode("node1")
+	assert.Equal(t, &DeviceSelector{MinSize: "1Ti", Rotational: newBool(false)}, node.DeviceSelector)
+
+	// the device selector of the node overrides the cluster's
+	node = storageSpec.ResolveNode("node2")
+	assert.Equal(t, &DeviceSelector{Model: "^SAMSUNG"}, node.DeviceSelector)
+}
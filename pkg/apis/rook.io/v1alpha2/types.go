@@ -43,12 +43,18 @@ type Node struct {
 	Location  string                  `json:"location,omitempty"`
 	Resources v1.ResourceRequirements `json:"resources,omitempty"`
 	Config    map[string]string       `json:"config"`
+	// Whether the node is in maintenance. The storage on a node in maintenance is stopped until the node is taken out
+	// of maintenance, without the cluster moving its data to other nodes.
+	Maintenance bool `json:"maintenance,omitempty"`
 	Selection
 }
 
 type Device struct {
-	Name     string            `json:"name,omitempty"`
-	FullPath string            // TODO: FullPath to be supported for devices
+	// Name is the kernel name of the device (e.g., sdb). Kernel names are not guaranteed to be stable across reboots.
+	Name string `json:"name,omitempty"`
+	// FullPath is a persistent path to the device such as /dev/disk/by-id/..., /dev/disk/by-path/..., or the WWN of
+	// the device. When set, it takes precedence over the name.
+	FullPath string            `json:"fullPath,omitempty"`
 	Config   map[string]string `json:"config"`
 }
 
@@ -67,6 +73,25 @@ type Selection struct {
 	Devices []Device `json:"devices,omitempty"`
 
 	Directories []Directory `json:"directories,omitempty"`
+
+	// Select only the devices with the given properties. Without a device filter, all the devices with the properties
+	// are selected.
+	DeviceSelector *DeviceSelector `json:"deviceSelector,omitempty"`
+}
+
+// DeviceSelector selects devices by their properties. A device must match all the properties that are set.
+type DeviceSelector struct {
+	// The smallest size of the devices, such as 500Gi
+	MinSize string `json:"minSize,omitempty"`
+	// The largest size of the devices, such as 4Ti
+	MaxSize string `json:"maxSize,omitempty"`
+	// Whether the devices are rotational (hdd) or not (ssd and nvme)
+	Rotational *bool `json:"rotational,omitempty"`
+	// Regular expressions matching the vendor and model of the devices
+	Vendor string `json:"vendor,omitempty"`
+	Model  string `json:"model,omitempty"`
+	// The transports of the devices, such as nvme, sata or sas
+	Transports []string `json:"transports,omitempty"`
 }
 
 type PlacementSpec map[string]Placement
@@ -121,3 +146,79 @@ type VolumeList struct {
 	metav1.ListMeta `json:"metadata"`
 	Items           []Volume `json:"items"`
 }
+
+// +genclient
+// +genclient:noStatus
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+// DeviceInventory is the inventory of the devices discovered on a node by rook-discover
+type DeviceInventory struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata"`
+	Spec              DeviceInventorySpec `json:"spec"`
+}
+
+type DeviceInventorySpec struct {
+	// The node the devices were discovered on
+	NodeName string             `json:"nodeName"`
+	Devices  []DiscoveredDevice `json:"devices"`
+}
+
+// DiscoveredDevice is a disk found on a node and the storage using it
+type DiscoveredDevice struct {
+	Name               string            `json:"name"`
+	Parent             string            `json:"parent,omitempty"`
+	HasChildren        bool              `json:"hasChildren"`
+	DevLinks           string            `json:"devLinks,omitempty"`
+	Size               uint64            `json:"size"`
+	UUID               string            `json:"uuid,omitempty"`
+	Serial             string            `json:"serial,omitempty"`
+	Type               string            `json:"type"`
+	Rotational         bool              `json:"rotational"`
+	ReadOnly           bool              `json:"readOnly"`
+	Partitions         []DevicePartition `json:"partitions,omitempty"`
+	Filesystem         string            `json:"filesystem,omitempty"`
+	Vendor             string            `json:"vendor,omitempty"`
+	Model              string            `json:"model,omitempty"`
+	WWN                string            `json:"wwn,omitempty"`
+	WWNVendorExtension string            `json:"wwnVendorExtension,omitempty"`
+	Transport          string            `json:"transport,omitempty"`
+	Empty              bool              `json:"empty"`
+	// The SMART health of the device, if the device supports SMART
+	Health *DeviceHealth `json:"health,omitempty"`
+	// Whether the device can be used for new storage
+	Available bool `json:"available"`
+	// The reasons the device cannot be used for new storage
+	UnavailableReasons []string `json:"unavailableReasons,omitempty"`
+	// The cluster and OSDs using the device. Set by the operator.
+	Owner *DeviceOwner `json:"owner,omitempty"`
+}
+
+type DevicePartition struct {
+	Name       string `json:"name"`
+	Size       uint64 `json:"size"`
+	Label      string `json:"label,omitempty"`
+	Filesystem string `json:"filesystem,omitempty"`
+}
+
+type DeviceHealth struct {
+	Passed             bool `json:"passed"`
+	ReallocatedSectors int  `json:"reallocatedSectors"`
+	WearLevelPercent   int  `json:"wearLevelPercent,omitempty"`
+	Temperature        int  `json:"temperature"`
+}
+
+type DeviceOwner struct {
+	// The name of the cluster using the device
+	ClusterName string `json:"clusterName"`
+	// The IDs of the OSDs with data or metadata on the device
+	OSDIDs []int `json:"osdIDs,omitempty"`
+}
+
+// +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
+
+type DeviceInventoryList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata"`
+	Items           []DeviceInventory `json:"items"`
+}
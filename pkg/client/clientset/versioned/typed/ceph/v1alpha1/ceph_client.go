@@ -26,6 +26,7 @@ import (
 type CephV1alpha1Interface interface {
 	RESTClient() rest.Interface
 	ClustersGetter
+	ErasureCodeProfilesGetter
 	FilesystemsGetter
 	ObjectStoresGetter
 	PoolsGetter
@@ -40,6 +41,10 @@ func (c *CephV1alpha1Client) Clusters(namespace string) ClusterInterface {
 	return newClusters(c, namespace)
 }
 
+func (c *CephV1alpha1Client) ErasureCodeProfiles(namespace string) ErasureCodeProfileInterface {
+	return newErasureCodeProfiles(c, namespace)
+}
+
 func (c *CephV1alpha1Client) Filesystems(namespace string) FilesystemInterface {
 	return newFilesystems(c, namespace)
 }
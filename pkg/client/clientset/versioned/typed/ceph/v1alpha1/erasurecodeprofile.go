@@ -0,0 +1,155 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	v1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	scheme "github.com/rook/rook/pkg/client/clientset/versioned/scheme"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	rest "k8s.io/client-go/rest"
+)
+
+// ErasureCodeProfilesGetter has a method to return a ErasureCodeProfileInterface.
+// A group's client should implement this interface.
+type ErasureCodeProfilesGetter interface {
+	ErasureCodeProfiles(namespace string) ErasureCodeProfileInterface
+}
+
+// ErasureCodeProfileInterface has methods to work with ErasureCodeProfile resources.
+type ErasureCodeProfileInterface interface {
+	Create(*v1alpha1.ErasureCodeProfile) (*v1alpha1.ErasureCodeProfile, error)
+	Update(*v1alpha1.ErasureCodeProfile) (*v1alpha1.ErasureCodeProfile, error)
+	Delete(name string, options *v1.DeleteOptions) error
+	DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error
+	Get(name string, options v1.GetOptions) (*v1alpha1.ErasureCodeProfile, error)
+	List(opts v1.ListOptions) (*v1alpha1.ErasureCodeProfileList, error)
+	Watch(opts v1.ListOptions) (watch.Interface, error)
+	Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1alpha1.ErasureCodeProfile, err error)
+	ErasureCodeProfileExpansion
+}
+
+// erasureCodeProfiles implements ErasureCodeProfileInterface
+type erasureCodeProfiles struct {
+	client rest.Interface
+	ns     string
+}
+
+// newErasureCodeProfiles returns a ErasureCodeProfiles
+func newErasureCodeProfiles(c *CephV1alpha1Client, namespace string) *erasureCodeProfiles {
+	return &erasureCodeProfiles{
+		client: c.RESTClient(),
+		ns:     namespace,
+	}
+}
+
+// Get takes name of the erasureCodeProfile, and returns the corresponding erasureCodeProfile object, and an error if there is any.
+func (c *erasureCodeProfiles) Get(name string, options v1.GetOptions) (result *v1alpha1.ErasureCodeProfile, err error) {
+	result = &v1alpha1.ErasureCodeProfile{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("erasurecodeprofiles").
+		Name(name).
+		VersionedParams(&options, scheme.ParameterCodec).
+		Do().
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of ErasureCodeProfiles that match those selectors.
+func (c *erasureCodeProfiles) List(opts v1.ListOptions) (result *v1alpha1.ErasureCodeProfileList, err error) {
+	result = &v1alpha1.ErasureCodeProfileList{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("erasurecodeprofiles").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Do().
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested erasureCodeProfiles.
+func (c *erasureCodeProfiles) Watch(opts v1.ListOptions) (watch.Interface, error) {
+	opts.Watch = true
+	return c.client.Get().
+		Namespace(c.ns).
+		Resource("erasurecodeprofiles").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Watch()
+}
+
+// Create takes the representation of a erasureCodeProfile and creates it.  Returns the server's representation of the erasureCodeProfile, and an error, if there is any.
+func (c *erasureCodeProfiles) Create(erasureCodeProfile *v1alpha1.ErasureCodeProfile) (result *v1alpha1.ErasureCodeProfile, err error) {
+	result = &v1alpha1.ErasureCodeProfile{}
+	err = c.client.Post().
+		Namespace(c.ns).
+		Resource("erasurecodeprofiles").
+		Body(erasureCodeProfile).
+		Do().
+		Into(result)
+	return
+}
+
+// Update takes the representation of a erasureCodeProfile and updates it. Returns the server's representation of the erasureCodeProfile, and an error, if there is any.
+func (c *erasureCodeProfiles) Update(erasureCodeProfile *v1alpha1.ErasureCodeProfile) (result *v1alpha1.ErasureCodeProfile, err error) {
+	result = &v1alpha1.ErasureCodeProfile{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("erasurecodeprofiles").
+		Name(erasureCodeProfile.Name).
+		Body(erasureCodeProfile).
+		Do().
+		Into(result)
+	return
+}
+
+// Delete takes name of the erasureCodeProfile and deletes it. Returns an error if one occurs.
+func (c *erasureCodeProfiles) Delete(name string, options *v1.DeleteOptions) error {
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("erasurecodeprofiles").
+		Name(name).
+		Body(options).
+		Do().
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *erasureCodeProfiles) DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error {
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("erasurecodeprofiles").
+		VersionedParams(&listOptions, scheme.ParameterCodec).
+		Body(options).
+		Do().
+		Error()
+}
+
+// Patch applies the patch and returns the patched erasureCodeProfile.
+func (c *erasureCodeProfiles) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1alpha1.ErasureCodeProfile, err error) {
+	result = &v1alpha1.ErasureCodeProfile{}
+	err = c.client.Patch(pt).
+		Namespace(c.ns).
+		Resource("erasurecodeprofiles").
+		SubResource(subresources...).
+		Name(name).
+		Body(data).
+		Do().
+		Into(result)
+	return
+}
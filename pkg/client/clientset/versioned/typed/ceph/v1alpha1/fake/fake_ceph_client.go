@@ -30,6 +30,10 @@ func (c *FakeCephV1alpha1) Clusters(namespace string) v1alpha1.ClusterInterface
 	return &FakeClusters{c, namespace}
 }
 
+func (c *FakeCephV1alpha1) ErasureCodeProfiles(namespace string) v1alpha1.ErasureCodeProfileInterface {
+	return &FakeErasureCodeProfiles{c, namespace}
+}
+
 func (c *FakeCephV1alpha1) Filesystems(namespace string) v1alpha1.FilesystemInterface {
 	return &FakeFilesystems{c, namespace}
 }
@@ -0,0 +1,126 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	v1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labels "k8s.io/apimachinery/pkg/labels"
+	schema "k8s.io/apimachinery/pkg/runtime/schema"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	testing "k8s.io/client-go/testing"
+)
+
+// FakeErasureCodeProfiles implements ErasureCodeProfileInterface
+type FakeErasureCodeProfiles struct {
+	Fake *FakeCephV1alpha1
+	ns   string
+}
+
+var erasurecodeprofilesResource = schema.GroupVersionResource{Group: "ceph.rook.io", Version: "v1alpha1", Resource: "erasurecodeprofiles"}
+
+var erasurecodeprofilesKind = schema.GroupVersionKind{Group: "ceph.rook.io", Version: "v1alpha1", Kind: "ErasureCodeProfile"}
+
+// Get takes name of the erasureCodeProfile, and returns the corresponding erasureCodeProfile object, and an error if there is any.
+func (c *FakeErasureCodeProfiles) Get(name string, options v1.GetOptions) (result *v1alpha1.ErasureCodeProfile, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewGetAction(erasurecodeprofilesResource, c.ns, name), &v1alpha1.ErasureCodeProfile{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.ErasureCodeProfile), err
+}
+
+// List takes label and field selectors, and returns the list of ErasureCodeProfiles that match those selectors.
+func (c *FakeErasureCodeProfiles) List(opts v1.ListOptions) (result *v1alpha1.ErasureCodeProfileList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewListAction(erasurecodeprofilesResource, erasurecodeprofilesKind, c.ns, opts), &v1alpha1.ErasureCodeProfileList{})
+
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &v1alpha1.ErasureCodeProfileList{}
+	for _, item := range obj.(*v1alpha1.ErasureCodeProfileList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested erasureCodeProfiles.
+func (c *FakeErasureCodeProfiles) Watch(opts v1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewWatchAction(erasurecodeprofilesResource, c.ns, opts))
+
+}
+
+// Create takes the representation of a erasureCodeProfile and creates it.  Returns the server's representation of the erasureCodeProfile, and an error, if there is any.
+func (c *FakeErasureCodeProfiles) Create(erasureCodeProfile *v1alpha1.ErasureCodeProfile) (result *v1alpha1.ErasureCodeProfile, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewCreateAction(erasurecodeprofilesResource, c.ns, erasureCodeProfile), &v1alpha1.ErasureCodeProfile{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.ErasureCodeProfile), err
+}
+
+// Update takes the representation of a erasureCodeProfile and updates it. Returns the server's representation of the erasureCodeProfile, and an error, if there is any.
+func (c *FakeErasureCodeProfiles) Update(erasureCodeProfile *v1alpha1.ErasureCodeProfile) (result *v1alpha1.ErasureCodeProfile, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateAction(erasurecodeprofilesResource, c.ns, erasureCodeProfile), &v1alpha1.ErasureCodeProfile{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.ErasureCodeProfile), err
+}
+
+// Delete takes name of the erasureCodeProfile and deletes it. Returns an error if one occurs.
+func (c *FakeErasureCodeProfiles) Delete(name string, options *v1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewDeleteAction(erasurecodeprofilesResource, c.ns, name), &v1alpha1.ErasureCodeProfile{})
+
+	return err
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *FakeErasureCodeProfiles) DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error {
+	action := testing.NewDeleteCollectionAction(erasurecodeprofilesResource, c.ns, listOptions)
+
+	_, err := c.Fake.Invokes(action, &v1alpha1.ErasureCodeProfileList{})
+	return err
+}
+
+// Patch applies the patch and returns the patched erasureCodeProfile.
+func (c *FakeErasureCodeProfiles) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1alpha1.ErasureCodeProfile, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewPatchSubresourceAction(erasurecodeprofilesResource, c.ns, name, data, subresources...), &v1alpha1.ErasureCodeProfile{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha1.ErasureCodeProfile), err
+}
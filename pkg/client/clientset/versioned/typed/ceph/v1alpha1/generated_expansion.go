@@ -18,6 +18,8 @@ package v1alpha1
 
 type ClusterExpansion interface{}
 
+type ErasureCodeProfileExpansion interface{}
+
 type FilesystemExpansion interface{}
 
 type ObjectStoreExpansion interface{}
@@ -0,0 +1,155 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha2
+
+import (
+	v1alpha2 "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
+	scheme "github.com/rook/rook/pkg/client/clientset/versioned/scheme"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	rest "k8s.io/client-go/rest"
+)
+
+// DeviceInventoriesGetter has a method to return a DeviceInventoryInterface.
+// A group's client should implement this interface.
+type DeviceInventoriesGetter interface {
+	DeviceInventories(namespace string) DeviceInventoryInterface
+}
+
+// DeviceInventoryInterface has methods to work with DeviceInventory resources.
+type DeviceInventoryInterface interface {
+	Create(*v1alpha2.DeviceInventory) (*v1alpha2.DeviceInventory, error)
+	Update(*v1alpha2.DeviceInventory) (*v1alpha2.DeviceInventory, error)
+	Delete(name string, options *v1.DeleteOptions) error
+	DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error
+	Get(name string, options v1.GetOptions) (*v1alpha2.DeviceInventory, error)
+	List(opts v1.ListOptions) (*v1alpha2.DeviceInventoryList, error)
+	Watch(opts v1.ListOptions) (watch.Interface, error)
+	Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1alpha2.DeviceInventory, err error)
+	DeviceInventoryExpansion
+}
+
+// deviceInventories implements DeviceInventoryInterface
+type deviceInventories struct {
+	client rest.Interface
+	ns     string
+}
+
+// newDeviceInventories returns a DeviceInventories
+func newDeviceInventories(c *RookV1alpha2Client, namespace string) *deviceInventories {
+	return &deviceInventories{
+		client: c.RESTClient(),
+		ns:     namespace,
+	}
+}
+
+// Get takes name of the deviceInventory, and returns the corresponding deviceInventory object, and an error if there is any.
+func (c *deviceInventories) Get(name string, options v1.GetOptions) (result *v1alpha2.DeviceInventory, err error) {
+	result = &v1alpha2.DeviceInventory{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("deviceinventories").
+		Name(name).
+		VersionedParams(&options, scheme.ParameterCodec).
+		Do().
+		Into(result)
+	return
+}
+
+// List takes label and field selectors, and returns the list of DeviceInventories that match those selectors.
+func (c *deviceInventories) List(opts v1.ListOptions) (result *v1alpha2.DeviceInventoryList, err error) {
+	result = &v1alpha2.DeviceInventoryList{}
+	err = c.client.Get().
+		Namespace(c.ns).
+		Resource("deviceinventories").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Do().
+		Into(result)
+	return
+}
+
+// Watch returns a watch.Interface that watches the requested deviceInventories.
+func (c *deviceInventories) Watch(opts v1.ListOptions) (watch.Interface, error) {
+	opts.Watch = true
+	return c.client.Get().
+		Namespace(c.ns).
+		Resource("deviceinventories").
+		VersionedParams(&opts, scheme.ParameterCodec).
+		Watch()
+}
+
+// Create takes the representation of a deviceInventory and creates it.  Returns the server's representation of the deviceInventory, and an error, if there is any.
+func (c *deviceInventories) Create(deviceInventory *v1alpha2.DeviceInventory) (result *v1alpha2.DeviceInventory, err error) {
+	result = &v1alpha2.DeviceInventory{}
+	err = c.client.Post().
+		Namespace(c.ns).
+		Resource("deviceinventories").
+		Body(deviceInventory).
+		Do().
+		Into(result)
+	return
+}
+
+// Update takes the representation of a deviceInventory and updates it. Returns the server's representation of the deviceInventory, and an error, if there is any.
+func (c *deviceInventories) Update(deviceInventory *v1alpha2.DeviceInventory) (result *v1alpha2.DeviceInventory, err error) {
+	result = &v1alpha2.DeviceInventory{}
+	err = c.client.Put().
+		Namespace(c.ns).
+		Resource("deviceinventories").
+		Name(deviceInventory.Name).
+		Body(deviceInventory).
+		Do().
+		Into(result)
+	return
+}
+
+// Delete takes name of the deviceInventory and deletes it. Returns an error if one occurs.
+func (c *deviceInventories) Delete(name string, options *v1.DeleteOptions) error {
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("deviceinventories").
+		Name(name).
+		Body(options).
+		Do().
+		Error()
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *deviceInventories) DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error {
+	return c.client.Delete().
+		Namespace(c.ns).
+		Resource("deviceinventories").
+		VersionedParams(&listOptions, scheme.ParameterCodec).
+		Body(options).
+		Do().
+		Error()
+}
+
+// Patch applies the patch and returns the patched deviceInventory.
+func (c *deviceInventories) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1alpha2.DeviceInventory, err error) {
+	result = &v1alpha2.DeviceInventory{}
+	err = c.client.Patch(pt).
+		Namespace(c.ns).
+		Resource("deviceinventories").
+		SubResource(subresources...).
+		Name(name).
+		Body(data).
+		Do().
+		Into(result)
+	return
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2018 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package fake
+
+import (
+	v1alpha2 "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	labels "k8s.io/apimachinery/pkg/labels"
+	schema "k8s.io/apimachinery/pkg/runtime/schema"
+	types "k8s.io/apimachinery/pkg/types"
+	watch "k8s.io/apimachinery/pkg/watch"
+	testing "k8s.io/client-go/testing"
+)
+
+// FakeDeviceInventories implements DeviceInventoryInterface
+type FakeDeviceInventories struct {
+	Fake *FakeRookV1alpha2
+	ns   string
+}
+
+var deviceinventoriesResource = schema.GroupVersionResource{Group: "rook.io", Version: "v1alpha2", Resource: "deviceinventories"}
+
+var deviceinventoriesKind = schema.GroupVersionKind{Group: "rook.io", Version: "v1alpha2", Kind: "DeviceInventory"}
+
+// Get takes name of the deviceInventory, and returns the corresponding deviceInventory object, and an error if there is any.
+func (c *FakeDeviceInventories) Get(name string, options v1.GetOptions) (result *v1alpha2.DeviceInventory, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewGetAction(deviceinventoriesResource, c.ns, name), &v1alpha2.DeviceInventory{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha2.DeviceInventory), err
+}
+
+// List takes label and field selectors, and returns the list of DeviceInventories that match those selectors.
+func (c *FakeDeviceInventories) List(opts v1.ListOptions) (result *v1alpha2.DeviceInventoryList, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewListAction(deviceinventoriesResource, deviceinventoriesKind, c.ns, opts), &v1alpha2.DeviceInventoryList{})
+
+	if obj == nil {
+		return nil, err
+	}
+
+	label, _, _ := testing.ExtractFromListOptions(opts)
+	if label == nil {
+		label = labels.Everything()
+	}
+	list := &v1alpha2.DeviceInventoryList{}
+	for _, item := range obj.(*v1alpha2.DeviceInventoryList).Items {
+		if label.Matches(labels.Set(item.Labels)) {
+			list.Items = append(list.Items, item)
+		}
+	}
+	return list, err
+}
+
+// Watch returns a watch.Interface that watches the requested deviceInventories.
+func (c *FakeDeviceInventories) Watch(opts v1.ListOptions) (watch.Interface, error) {
+	return c.Fake.
+		InvokesWatch(testing.NewWatchAction(deviceinventoriesResource, c.ns, opts))
+
+}
+
+// Create takes the representation of a deviceInventory and creates it.  Returns the server's representation of the deviceInventory, and an error, if there is any.
+func (c *FakeDeviceInventories) Create(deviceInventory *v1alpha2.DeviceInventory) (result *v1alpha2.DeviceInventory, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewCreateAction(deviceinventoriesResource, c.ns, deviceInventory), &v1alpha2.DeviceInventory{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha2.DeviceInventory), err
+}
+
+// Update takes the representation of a deviceInventory and updates it. Returns the server's representation of the deviceInventory, and an error, if there is any.
+func (c *FakeDeviceInventories) Update(deviceInventory *v1alpha2.DeviceInventory) (result *v1alpha2.DeviceInventory, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewUpdateAction(deviceinventoriesResource, c.ns, deviceInventory), &v1alpha2.DeviceInventory{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha2.DeviceInventory), err
+}
+
+// Delete takes name of the deviceInventory and deletes it. Returns an error if one occurs.
+func (c *FakeDeviceInventories) Delete(name string, options *v1.DeleteOptions) error {
+	_, err := c.Fake.
+		Invokes(testing.NewDeleteAction(deviceinventoriesResource, c.ns, name), &v1alpha2.DeviceInventory{})
+
+	return err
+}
+
+// DeleteCollection deletes a collection of objects.
+func (c *FakeDeviceInventories) DeleteCollection(options *v1.DeleteOptions, listOptions v1.ListOptions) error {
+	action := testing.NewDeleteCollectionAction(deviceinventoriesResource, c.ns, listOptions)
+
+	_, err := c.Fake.Invokes(action, &v1alpha2.DeviceInventoryList{})
+	return err
+}
+
+// Patch applies the patch and returns the patched deviceInventory.
+func (c *FakeDeviceInventories) Patch(name string, pt types.PatchType, data []byte, subresources ...string) (result *v1alpha2.DeviceInventory, err error) {
+	obj, err := c.Fake.
+		Invokes(testing.NewPatchSubresourceAction(deviceinventoriesResource, c.ns, name, data, subresources...), &v1alpha2.DeviceInventory{})
+
+	if obj == nil {
+		return nil, err
+	}
+	return obj.(*v1alpha2.DeviceInventory), err
+}
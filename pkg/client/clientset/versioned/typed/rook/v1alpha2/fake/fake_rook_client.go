@@ -26,6 +26,10 @@ type FakeRookV1alpha2 struct {
 	*testing.Fake
 }
 
+func (c *FakeRookV1alpha2) DeviceInventories(namespace string) v1alpha2.DeviceInventoryInterface {
+	return &FakeDeviceInventories{c, namespace}
+}
+
 func (c *FakeRookV1alpha2) Volumes(namespace string) v1alpha2.VolumeInterface {
 	return &FakeVolumes{c, namespace}
 }
@@ -16,4 +16,6 @@ limitations under the License.
 
 package v1alpha2
 
+type DeviceInventoryExpansion interface{}
+
 type VolumeExpansion interface{}
@@ -25,6 +25,7 @@ import (
 
 type RookV1alpha2Interface interface {
 	RESTClient() rest.Interface
+	DeviceInventoriesGetter
 	VolumesGetter
 }
 
@@ -33,6 +34,10 @@ type RookV1alpha2Client struct {
 	restClient rest.Interface
 }
 
+func (c *RookV1alpha2Client) DeviceInventories(namespace string) DeviceInventoryInterface {
+	return newDeviceInventories(c, namespace)
+}
+
 func (c *RookV1alpha2Client) Volumes(namespace string) VolumeInterface {
 	return newVolumes(c, namespace)
 }
@@ -16,13 +16,18 @@ limitations under the License.
 package clusterd
 
 import (
+	"fmt"
+	"path/filepath"
 	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/coreos/pkg/capnslog"
 
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
 	"github.com/rook/rook/pkg/util/exec"
 	"github.com/rook/rook/pkg/util/sys"
+	"k8s.io/apimachinery/pkg/api/resource"
 )
 
 var (
@@ -49,6 +54,49 @@ func getDeviceEmpty(device *sys.LocalDisk) bool {
 	return device.Parent == "" && (device.Type == sys.DiskType || device.Type == sys.SSDType || device.Type == sys.CryptType) && device.Filesystem == ""
 }
 
+// MatchesDevice returns whether the given identifier refers to the given disk. The identifier can be the kernel name
+// (e.g. sdb), a /dev path, one of the persistent /dev/disk/by-* links of the disk, or the WWN of the disk.
+func MatchesDevice(device *sys.LocalDisk, id string) bool {
+	if device == nil || id == "" {
+		return false
+	}
+
+	if id == device.Name || id == filepath.Join("/dev", device.Name) {
+		return true
+	}
+	if device.WWN != "" && (id == device.WWN || id == device.WWNVendorExtension) {
+		return true
+	}
+
+	for _, link := range strings.Fields(device.DevLinks) {
+		if id == link {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetPersistentDeviceID returns an identifier for the disk that is stable across reboots, preferring the by-id link
+// over the by-path link. An empty string is returned if udev did not report any persistent links for the disk.
+func GetPersistentDeviceID(device *sys.LocalDisk) string {
+	if device == nil {
+		return ""
+	}
+
+	var byPath string
+	for _, link := range strings.Fields(device.DevLinks) {
+		if strings.HasPrefix(link, sys.DiskByIDPath) {
+			return link
+		}
+		if byPath == "" && strings.HasPrefix(link, sys.DiskByPathPath) {
+			byPath = link
+		}
+	}
+
+	return byPath
+}
+
 func ignoreDevice(d string) bool {
 	return isRBD.MatchString(d)
 }
@@ -120,6 +168,13 @@ func DiscoverDevices(executor exec.Executor) ([]*sys.LocalDisk, error) {
 		if val, ok := diskProps["PKNAME"]; ok {
 			disk.Parent = val
 		}
+		if val, ok := diskProps["TRAN"]; ok {
+			disk.Transport = val
+		}
+		if disk.Transport == "" && strings.HasPrefix(d, "nvme") {
+			// older versions of lsblk don't report the transport of nvme devices
+			disk.Transport = "nvme"
+		}
 
 		disk.Empty = getDeviceEmpty(disk)
 
@@ -161,3 +216,56 @@ func DiscoverDevices(executor exec.Executor) ([]*sys.LocalDisk, error) {
 
 	return disks, nil
 }
+
+// MatchesDeviceSelector returns whether the disk has all the properties set in the device selector. An error is
+// returned if the selector is not valid.
+func MatchesDeviceSelector(device *sys.LocalDisk, selector *rookalpha.DeviceSelector) (bool, error) {
+	if selector == nil {
+		return true, nil
+	}
+
+	if selector.MinSize != "" {
+		minSize, err := resource.ParseQuantity(selector.MinSize)
+		if err != nil {
+			return false, fmt.Errorf("invalid min size %s. %+v", selector.MinSize, err)
+		}
+		if device.Size < uint64(minSize.Value()) {
+			return false, nil
+		}
+	}
+	if selector.MaxSize != "" {
+		maxSize, err := resource.ParseQuantity(selector.MaxSize)
+		if err != nil {
+			return false, fmt.Errorf("invalid max size %s. %+v", selector.MaxSize, err)
+		}
+		if device.Size > uint64(maxSize.Value()) {
+			return false, nil
+		}
+	}
+	if selector.Rotational != nil && device.Rotational != *selector.Rotational {
+		return false, nil
+	}
+
+	for _, property := range []struct{ filter, value string }{{selector.Vendor, device.Vendor}, {selector.Model, device.Model}} {
+		if property.filter == "" {
+			continue
+		}
+		matched, err := regexp.MatchString(property.filter, strings.TrimSpace(property.value))
+		if err != nil {
+			return false, fmt.Errorf("invalid filter %s. %+v", property.filter, err)
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+
+	if len(selector.Transports) > 0 {
+		for _, transport := range selector.Transports {
+			if strings.EqualFold(transport, device.Transport) {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+	return true, nil
+}
@@ -18,6 +18,7 @@ package clusterd
 import (
 	"testing"
 
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
 	exectest "github.com/rook/rook/pkg/util/exec/test"
 	"github.com/rook/rook/pkg/util/sys"
 	"github.com/stretchr/testify/assert"
@@ -74,6 +75,77 @@ func TestDiscoverDevices(t *testing.T) {
 	assert.Equal(t, 0, len(devices))
 }
 
+func TestMatchesDevice(t *testing.T) {
+	d := &sys.LocalDisk{
+		Name:               "sdb",
+		WWN:                "0x600140577f462d99",
+		WWNVendorExtension: "0x600140577f462d9908b409d94114e042",
+		DevLinks: "/dev/disk/by-id/scsi-3600140577f462d9908b409d94114e042   /dev/disk/by-id/wwn-0x600140577f462d9908b409d94114e042 " +
+			"/dev/disk/by-path/ip-127.0.0.1:3260-iscsi-iqn.2016-06.world.srv:storage.target01-lun-3",
+	}
+
+	assert.True(t, MatchesDevice(d, "sdb"))
+	assert.True(t, MatchesDevice(d, "/dev/sdb"))
+	assert.True(t, MatchesDevice(d, "/dev/disk/by-id/wwn-0x600140577f462d9908b409d94114e042"))
+	assert.True(t, MatchesDevice(d, "/dev/disk/by-path/ip-127.0.0.1:3260-iscsi-iqn.2016-06.world.srv:storage.target01-lun-3"))
+	assert.True(t, MatchesDevice(d, "0x600140577f462d99"))
+	assert.True(t, MatchesDevice(d, "0x600140577f462d9908b409d94114e042"))
+	assert.False(t, MatchesDevice(d, "sdc"))
+	assert.False(t, MatchesDevice(d, "/dev/disk/by-id/wwn-0x600140568c0bd28d4ee43769387c9f02"))
+	assert.False(t, MatchesDevice(d, ""))
+	assert.False(t, MatchesDevice(nil, "sdb"))
+
+	// the by-id link is preferred over the by-path link
+	assert.Equal(t, "/dev/disk/by-id/scsi-3600140577f462d9908b409d94114e042", GetPersistentDeviceID(d))
+	d.DevLinks = "/dev/disk/by-path/pci-0000:00:1f.2-ata-1"
+	assert.Equal(t, "/dev/disk/by-path/pci-0000:00:1f.2-ata-1", GetPersistentDeviceID(d))
+	d.DevLinks = ""
+	assert.Equal(t, "", GetPersistentDeviceID(d))
+}
+
+func TestMatchesDeviceSelector(t *testing.T) {
+	ssd := &sys.LocalDisk{Name: "sdb", Size: 2 * 1024 * 1024 * 1024 * 1024, Rotational: false, Vendor: "ATA",
+		Model: "SAMSUNG_MZ7LM1T9 ", Transport: "sata"}
+	hdd := &sys.LocalDisk{Name: "sdc", Size: 500 * 1024 * 1024 * 1024, Rotational: true, Vendor: "SEAGATE", Model: "ST4000NM0023",
+		Transport: "sas"}
+	nonRotational := false
+
+	matches := func(device *sys.LocalDisk, selector *rookalpha.DeviceSelector) bool {
+		matched, err := MatchesDeviceSelector(device, selector)
+		assert.Nil(t, err)
+		return matched
+	}
+
+	// all devices match without a selector
+	assert.True(t, matches(hdd, nil))
+	assert.True(t, matches(hdd, &rookalpha.DeviceSelector{}))
+
+	// non-rotational devices larger than 1TiB
+	selector := &rookalpha.DeviceSelector{MinSize: "1Ti", Rotational: &nonRotational}
+	assert.True(t, matches(ssd, selector))
+	assert.False(t, matches(hdd, selector))
+
+	// size range
+	assert.True(t, matches(hdd, &rookalpha.DeviceSelector{MinSize: "100Gi", MaxSize: "1Ti"}))
+	assert.False(t, matches(ssd, &rookalpha.DeviceSelector{MaxSize: "1Ti"}))
+
+	// vendor and model
+	assert.True(t, matches(ssd, &rookalpha.DeviceSelector{Model: "^SAMSUNG_MZ7LM1T9$"}))
+	assert.False(t, matches(hdd, &rookalpha.DeviceSelector{Model: "^SAMSUNG"}))
+	assert.True(t, matches(hdd, &rookalpha.DeviceSelector{Vendor: "SEAGATE", Model: "^ST4000"}))
+	assert.False(t, matches(hdd, &rookalpha.DeviceSelector{Vendor: "SEAGATE", Model: "^ST8000"}))
+
+	// transports
+	assert.True(t, matches(hdd, &rookalpha.DeviceSelector{Transports: []string{"nvme", "sas"}}))
+	assert.False(t, matches(ssd, &rookalpha.DeviceSelector{Transports: []string{"nvme", "sas"}}))
+
+	// invalid selectors
+	_, err := MatchesDeviceSelector(hdd, &rookalpha.DeviceSelector{MinSize: "big"})
+	assert.NotNil(t, err)
+	_, err = MatchesDeviceSelector(hdd, &rookalpha.DeviceSelector{Model: "("})
+	assert.NotNil(t, err)
+}
+
 func TestIgnoreDevice(t *testing.T) {
 	cases := map[string]bool{
 		"rbd0":    true,
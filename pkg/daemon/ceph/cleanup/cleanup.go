@@ -0,0 +1,174 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cleanup removes the data of a deleted cluster from a node.
+package cleanup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/util/sys"
+)
+
+const (
+	// the size of the start of the devices that is overwritten with zeros
+	zeroHeadersMB = 100
+)
+
+var (
+	logger = capnslog.NewPackageLogger("github.com/rook/rook", "cephcleanup")
+
+	// the dirs and files the rook daemons create in the data dir besides the dir named after the cluster. Other
+	// entries in the data dir were not created by rook and are kept.
+	daemonDataPattern = regexp.MustCompile(`^(rook-ceph-mon[0-9]+|mgr-.+|rbd-mirror-.+|osd[0-9]+|bootstrap-osd|mds|rgw)$`)
+)
+
+// Config for the cleanup of a node
+type Config struct {
+	// the data dir of the cluster on the node
+	DataDir string
+	// the name of the cluster, which is also the name of its config dir in the data dir
+	ClusterName string
+	// the persistent paths (/dev/disk/by-id/..., /dev/disk/by-path/...) of the devices with osd partitions to wipe
+	Devices []string
+	// the osds of the cluster on the node. The devices without partitions of these osds are not wiped.
+	OSDIDs []int
+	// whether the start of the devices is overwritten with zeros after the partitions are removed
+	ZeroHeaders bool
+}
+
+// Run removes the data of the cluster from the data dir and wipes the devices. All the devices are wiped even if some of them fail.
+// A device is skipped if it does not have the partitions of the osds of the cluster anymore since it might have been
+// reused since the osds were created.
+func Run(context *clusterd.Context, config *Config) error {
+	var failures []string
+	if config.DataDir != "" {
+		if err := removeClusterData(config.DataDir, config.ClusterName); err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+
+	var wiped []string
+	for _, devicePath := range config.Devices {
+		device, err := resolveDevice(devicePath)
+		if err != nil {
+			failures = append(failures, err.Error())
+			continue
+		}
+		owned, err := hasOSDPartitions(context, device, config.OSDIDs)
+		if err != nil {
+			failures = append(failures, err.Error())
+			continue
+		}
+		if !owned {
+			logger.Warningf("not wiping device %s (%s) since it has no partitions of osds %v", devicePath, device, config.OSDIDs)
+			continue
+		}
+		if err := wipeDevice(context, device, config.ZeroHeaders); err != nil {
+			failures = append(failures, err.Error())
+			continue
+		}
+		wiped = append(wiped, device)
+	}
+
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to clean up the node: %s", strings.Join(failures, ". "))
+	}
+	logger.Infof("cleaned up data dir %s and devices %v", config.DataDir, wiped)
+	return nil
+}
+
+// removeClusterData removes the config dir of the cluster and the data of the rook daemons from the data dir. The dir
+// itself is kept since it is the mount point of the host path.
+func removeClusterData(dir, clusterName string) error {
+	if clusterName == "" {
+		return fmt.Errorf("not removing the data in %s without the name of the cluster", dir)
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read data dir %s: %+v", dir, err)
+	}
+
+	for _, entry := range entries {
+		p := path.Join(dir, entry.Name())
+		if entry.Name() != clusterName && !daemonDataPattern.MatchString(entry.Name()) {
+			logger.Infof("keeping %s since it was not created by rook", p)
+			continue
+		}
+		logger.Infof("removing %s", p)
+		if err := os.RemoveAll(p); err != nil {
+			return fmt.Errorf("failed to remove %s: %+v", p, err)
+		}
+	}
+	return nil
+}
+
+// resolveDevice returns the kernel name of the device the persistent path links to
+func resolveDevice(devicePath string) (string, error) {
+	target, err := os.Readlink(devicePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("device %s not found", devicePath)
+		}
+		return "", fmt.Errorf("failed to resolve device %s: %+v", devicePath, err)
+	}
+	return filepath.Base(target), nil
+}
+
+// hasOSDPartitions returns whether the device has a partition labelled for one of the osds
+func hasOSDPartitions(context *clusterd.Context, device string, osdIDs []int) (bool, error) {
+	partitions, _, err := sys.GetDevicePartitions(device, context.Executor)
+	if err != nil {
+		return false, err
+	}
+	for _, partition := range partitions {
+		for _, id := range osdIDs {
+			if strings.HasPrefix(partition.Label, fmt.Sprintf("ROOK-OSD%d-", id)) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+func wipeDevice(context *clusterd.Context, device string, zeroHeaders bool) error {
+	logger.Infof("removing the partitions of device %s", device)
+	if err := sys.RemovePartitions(device, context.Executor); err != nil {
+		return err
+	}
+
+	if zeroHeaders {
+		logger.Infof("zeroing the first %d MB of device %s", zeroHeadersMB, device)
+		cmd := fmt.Sprintf("zero %s", device)
+		err := context.Executor.ExecuteCommand(false, cmd, "dd", "if=/dev/zero", "of=/dev/"+device, "bs=1M",
+			fmt.Sprintf("count=%d", zeroHeadersMB), "oflag=direct")
+		if err != nil {
+			return fmt.Errorf("failed to zero the headers of /dev/%s: %+v", device, err)
+		}
+	}
+	return nil
+}
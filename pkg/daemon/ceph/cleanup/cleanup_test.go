@@ -0,0 +1,131 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cleanup
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanup(t *testing.T) {
+	dataDir, err := ioutil.TempDir("", "cleanup")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dataDir)
+	assert.Nil(t, os.MkdirAll(path.Join(dataDir, "rook-ceph-mon0", "data"), 0755))
+	assert.Nil(t, os.MkdirAll(path.Join(dataDir, "osd1"), 0755))
+	assert.Nil(t, os.MkdirAll(path.Join(dataDir, "rook-ceph"), 0755))
+	assert.Nil(t, ioutil.WriteFile(path.Join(dataDir, "rook-ceph", "rook-ceph.config"), []byte("config"), 0644))
+	// the data of another application in the same dir
+	assert.Nil(t, ioutil.WriteFile(path.Join(dataDir, "other"), []byte("other"), 0644))
+
+	// the persistent links of the devices as created by udev
+	byID, err := ioutil.TempDir("", "by-id")
+	assert.Nil(t, err)
+	defer os.RemoveAll(byID)
+	devicePath := func(name string) string {
+		p := path.Join(byID, "wwn-"+name)
+		os.Symlink("../../"+name, p)
+		return p
+	}
+
+	commands := []string{}
+	executor := &exectest.MockExecutor{
+		MockExecuteCommand: func(debug bool, actionName string, command string, args ...string) error {
+			commands = append(commands, command+" "+strings.Join(args, " "))
+			if strings.Contains(actionName, "sdc") {
+				return errors.New("mock failure")
+			}
+			return nil
+		},
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			if command == "lsblk" {
+				device := path.Base(args[0])
+				return fmt.Sprintf(`NAME="%s" SIZE="100000" TYPE="disk" PKNAME=""
+NAME="%s1" SIZE="50000" TYPE="part" PKNAME="%s"`, device, device, device), nil
+			}
+			if command == "udevadm" {
+				// sde was reused by another application after the osd was created
+				if strings.HasPrefix(path.Base(args[2]), "sde") {
+					return "ID_PART_ENTRY_NAME=data", nil
+				}
+				return "ID_PART_ENTRY_NAME=ROOK-OSD1-BLOCK", nil
+			}
+			return "", nil
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+
+	// the data is not removed without the name of the cluster
+	err = Run(context, &Config{DataDir: dataDir})
+	assert.NotNil(t, err)
+	entries, err := ioutil.ReadDir(dataDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(entries))
+
+	// the data of the cluster is removed and the partitions of the devices are zapped
+	err = Run(context, &Config{DataDir: dataDir, ClusterName: "rook-ceph", Devices: []string{devicePath("sda"), devicePath("sdb")}, OSDIDs: []int{0, 1}})
+	assert.Nil(t, err)
+	entries, err = ioutil.ReadDir(dataDir)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, "other", entries[0].Name())
+	assert.Equal(t, []string{
+		"sgdisk --zap-all /dev/sda",
+		"sgdisk --clear --mbrtogpt /dev/sda",
+		"sgdisk --zap-all /dev/sdb",
+		"sgdisk --clear --mbrtogpt /dev/sdb"}, commands)
+
+	// the headers are zeroed
+	commands = []string{}
+	err = Run(context, &Config{DataDir: dataDir, ClusterName: "rook-ceph", Devices: []string{devicePath("sda")}, OSDIDs: []int{1}, ZeroHeaders: true})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(commands))
+	assert.Equal(t, "dd if=/dev/zero of=/dev/sda bs=1M count=100 oflag=direct", commands[2])
+
+	// a failing device doesn't prevent the other devices from being wiped
+	commands = []string{}
+	err = Run(context, &Config{Devices: []string{devicePath("sdc"), devicePath("sdd")}, OSDIDs: []int{1}})
+	assert.NotNil(t, err)
+	assert.Equal(t, 3, len(commands))
+	assert.Equal(t, "sgdisk --clear --mbrtogpt /dev/sdd", commands[2])
+
+	// the devices without the partitions of the osds of the cluster are not wiped
+	commands = []string{}
+	err = Run(context, &Config{Devices: []string{devicePath("sda"), devicePath("sde")}, OSDIDs: []int{0}})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(commands))
+	err = Run(context, &Config{Devices: []string{devicePath("sde")}, OSDIDs: []int{1}})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(commands))
+
+	// a device that is not found is a failure
+	err = Run(context, &Config{Devices: []string{path.Join(byID, "missing")}, OSDIDs: []int{1}})
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, len(commands))
+
+	// a missing data dir is already clean
+	err = Run(context, &Config{DataDir: path.Join(dataDir, "missing"), ClusterName: "rook-ceph"})
+	assert.Nil(t, err)
+}
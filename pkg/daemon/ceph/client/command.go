@@ -31,6 +31,7 @@ const (
 	AdminUsername     = "client.admin"
 	CephTool          = "ceph"
 	RBDTool           = "rbd"
+	RadosTool         = "rados"
 	Kubectl           = "kubectl"
 	CrushTool         = "crushtool"
 	cmdExecuteTimeout = 1 * time.Minute
@@ -20,13 +20,38 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
 	"github.com/rook/rook/pkg/clusterd"
 )
 
+// DefaultCrushTunables is the crush tunables profile of new clusters if no profile is given
+const DefaultCrushTunables = "firefly"
+
+// crushTunablesValues are the values of the tunables that change the mappings of the placement groups for each
+// tunables profile. The hammer profile only adds the straw2 bucket algorithm.
+var crushTunablesValues = map[string]map[string]int{
+	"argonaut": {"choose-local-tries": 2, "choose-local-fallback-tries": 5, "choose-total-tries": 19, "chooseleaf-descend-once": 0,
+		"chooseleaf-vary-r": 0, "chooseleaf-stable": 0},
+	"bobtail": {"choose-local-tries": 0, "choose-local-fallback-tries": 0, "choose-total-tries": 50, "chooseleaf-descend-once": 1,
+		"chooseleaf-vary-r": 0, "chooseleaf-stable": 0},
+	"firefly": {"choose-local-tries": 0, "choose-local-fallback-tries": 0, "choose-total-tries": 50, "chooseleaf-descend-once": 1,
+		"chooseleaf-vary-r": 1, "chooseleaf-stable": 0},
+	"hammer": {"choose-local-tries": 0, "choose-local-fallback-tries": 0, "choose-total-tries": 50, "chooseleaf-descend-once": 1,
+		"chooseleaf-vary-r": 1, "chooseleaf-stable": 0},
+	"jewel": {"choose-local-tries": 0, "choose-local-fallback-tries": 0, "choose-total-tries": 50, "chooseleaf-descend-once": 1,
+		"chooseleaf-vary-r": 1, "chooseleaf-stable": 1},
+}
+
+// crushTunablesAliases are the tunables profiles that are named after another profile
+var crushTunablesAliases = map[string]string{"legacy": "argonaut", "optimal": "jewel", "default": "jewel"}
+
+var mismatchedMappingsRegex = regexp.MustCompile(`had (\d+)/(\d+) mismatched mappings`)
+
 const defaultCrushMap = `# begin crush map
 tunable choose_local_tries 0
 tunable choose_local_fallback_tries 0
@@ -47,8 +72,9 @@ type 5 pdu
 type 6 pod
 type 7 room
 type 8 datacenter
-type 9 region
-type 10 root
+type 9 zone
+type 10 region
+type 11 root
 
 # default bucket
 root default {
@@ -111,7 +137,8 @@ type CrushMap struct {
 		} `json:"steps"`
 	} `json:"rules"`
 	Tunables struct {
-		// Add if necessary
+		// add more tunables if needed
+		Profile string `json:"profile"`
 	} `json:"tunables"`
 }
 
@@ -162,7 +189,7 @@ func SetCrushTunables(context *clusterd.Context, clusterName, profile string) (s
 }
 
 func CrushReweight(context *clusterd.Context, clusterName string, id int, weight float64) (string, error) {
-	args := []string{"osd", "crush", "reweight", fmt.Sprintf("osd.%d", id), fmt.Sprintf("%.1f", weight)}
+	args := []string{"osd", "crush", "reweight", fmt.Sprintf("osd.%d", id), fmt.Sprintf("%.4f", weight)}
 	buf, err := ExecuteCephCommand(context, clusterName, args)
 	if err != nil {
 		return "", fmt.Errorf("failed to crush reweight: %+v, %s", err, string(buf))
@@ -181,6 +208,116 @@ func CrushRemove(context *clusterd.Context, clusterName, name string) (string, e
 	return string(buf), nil
 }
 
+// CrushAddBucket adds a bucket of the given type to the crush map, outside of any root
+func CrushAddBucket(context *clusterd.Context, clusterName, name, bucketType string) (string, error) {
+	args := []string{"osd", "crush", "add-bucket", name, bucketType}
+	buf, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return "", fmt.Errorf("failed to crush add-bucket %s: %+v, %s", name, err, string(buf))
+	}
+
+	return string(buf), nil
+}
+
+// CrushMove moves the bucket to the location given as type=name pairs, creating the missing buckets of the location
+func CrushMove(context *clusterd.Context, clusterName, name string, location []string) (string, error) {
+	args := append([]string{"osd", "crush", "move", name}, location...)
+	buf, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return "", fmt.Errorf("failed to crush move %s: %+v, %s", name, err, string(buf))
+	}
+
+	return string(buf), nil
+}
+
+// GetCrushBucketLocation returns the types and names of the buckets above the bucket in the crush map, or nil if the
+// bucket is not in the crush map
+func GetCrushBucketLocation(crush *CrushMap, name string) map[string]string {
+	parents := map[int]int{}
+	index := -1
+	for i, b := range crush.Buckets {
+		for _, item := range b.Items {
+			parents[item.ID] = i
+		}
+		if b.Name == name {
+			index = i
+		}
+	}
+	if index < 0 {
+		return nil
+	}
+
+	location := map[string]string{}
+	for {
+		parent, ok := parents[crush.Buckets[index].ID]
+		if !ok {
+			return location
+		}
+		location[crush.Buckets[parent].TypeName] = crush.Buckets[parent].Name
+		index = parent
+	}
+}
+
+// CrushLocationsEqual returns whether the crush locations have the same types and names
+func CrushLocationsEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// CrushListOSDsInDeviceClass returns the IDs of the OSDs assigned to the given device class
+func CrushListOSDsInDeviceClass(context *clusterd.Context, clusterName, deviceClass string) ([]int, error) {
+	args := []string{"osd", "crush", "class", "ls-osd", deviceClass}
+	buf, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list osds in device class %s: %+v, %s", deviceClass, err, string(buf))
+	}
+
+	var osds []int
+	if err := json.Unmarshal(buf, &osds); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal device class osds: %+v. raw: %s", err, string(buf))
+	}
+
+	return osds, nil
+}
+
+// CrushSetDeviceClass assigns the OSD to the given device class. Ceph refuses to change the class of an OSD
+// that already has one, so any existing class is removed first. Nothing is changed if the OSD is already
+// in the desired class.
+func CrushSetDeviceClass(context *clusterd.Context, clusterName string, osdID int, deviceClass string) error {
+	osds, err := CrushListOSDsInDeviceClass(context, clusterName, deviceClass)
+	if err != nil {
+		// the class may not exist yet, in which case the osd is certainly not in it
+		logger.Debugf("could not list osds in device class %s. %+v", deviceClass, err)
+	}
+	for _, id := range osds {
+		if id == osdID {
+			return nil
+		}
+	}
+
+	osdEntity := fmt.Sprintf("osd.%d", osdID)
+	args := []string{"osd", "crush", "rm-device-class", osdEntity}
+	buf, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return fmt.Errorf("failed to remove device class from %s: %+v, %s", osdEntity, err, string(buf))
+	}
+
+	args = []string{"osd", "crush", "set-device-class", deviceClass, osdEntity}
+	buf, err = ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return fmt.Errorf("failed to set device class %s on %s: %+v, %s", deviceClass, osdEntity, err, string(buf))
+	}
+
+	return nil
+}
+
 func FindOSDInCrushMap(context *clusterd.Context, clusterName string, osdID int) (*CrushFindResult, error) {
 	args := []string{"osd", "find", strconv.Itoa(osdID)}
 	buf, err := ExecuteCephCommand(context, clusterName, args)
@@ -205,10 +342,14 @@ func GetCrushHostName(context *clusterd.Context, clusterName string, osdID int)
 	return result.Location.Host, nil
 }
 
-func CreateDefaultCrushMap(context *clusterd.Context, clusterName string) (string, error) {
-	// first set crush tunables to a firefly profile in order to support older clients
-	// (e.g., hyperkube uses a firefly rbd tool)
-	crushTunablesProfile := "firefly"
+// CreateDefaultCrushMap sets the crush tunables profile and uploads the default crush map. The firefly profile is used
+// if no profile is given.
+func CreateDefaultCrushMap(context *clusterd.Context, clusterName, crushTunablesProfile string) (string, error) {
+	if crushTunablesProfile == "" {
+		// default to a firefly profile in order to support older clients
+		// (e.g., hyperkube uses a firefly rbd tool)
+		crushTunablesProfile = DefaultCrushTunables
+	}
 	logger.Infof("setting crush tunables to %s", crushTunablesProfile)
 	output, err := SetCrushTunables(context, clusterName, crushTunablesProfile)
 	if err != nil {
@@ -255,6 +396,87 @@ func CreateDefaultCrushMap(context *clusterd.Context, clusterName string) (strin
 	return "", nil
 }
 
+// CrushTunablesProfile returns the profile the given tunables profile is an alias of (e.g., jewel for optimal), or an
+// error if the profile is unknown
+func CrushTunablesProfile(profile string) (string, error) {
+	if alias, ok := crushTunablesAliases[profile]; ok {
+		profile = alias
+	}
+	if _, ok := crushTunablesValues[profile]; !ok {
+		return "", fmt.Errorf("unknown crush tunables profile %s", profile)
+	}
+	return profile, nil
+}
+
+// EstimateTunablesDataMovement returns the fraction of the placement group mappings of the current crush map that would
+// change with the given tunables profile, which is about the fraction of the data that would move
+func EstimateTunablesDataMovement(context *clusterd.Context, clusterName, profile string) (float64, error) {
+	profile, err := CrushTunablesProfile(profile)
+	if err != nil {
+		return 0, err
+	}
+
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create crush map temp dir: %+v", err)
+	}
+	defer os.RemoveAll(dir)
+	currentMap := path.Join(dir, "current")
+	newMap := path.Join(dir, "new")
+
+	args := []string{"osd", "getcrushmap", "-o", currentMap}
+	if output, err := ExecuteCephCommandPlainNoOutputFile(context, clusterName, args); err != nil {
+		return 0, fmt.Errorf("failed to get crush map: %+v, %s", err, string(output))
+	}
+
+	// the legacy tunables are only set by crushtool when they are explicitly allowed
+	args = []string{"-i", currentMap, "--enable-unsafe-tunables"}
+	values := crushTunablesValues[profile]
+	var tunables []string
+	for tunable := range values {
+		tunables = append(tunables, tunable)
+	}
+	sort.Strings(tunables)
+	for _, tunable := range tunables {
+		args = append(args, fmt.Sprintf("--set-%s", tunable), strconv.Itoa(values[tunable]))
+	}
+	args = append(args, "-o", newMap)
+	if output, err := context.Executor.ExecuteCommandWithOutput(false, "", CrushTool, args...); err != nil {
+		return 0, fmt.Errorf("failed to set tunables %s on crush map: %+v, %s", profile, err, output)
+	}
+
+	args = []string{"-i", currentMap, "--compare", newMap}
+	output, err := context.Executor.ExecuteCommandWithOutput(false, "", CrushTool, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to compare crush maps: %+v, %s", err, output)
+	}
+	return parseMismatchedMappings(output), nil
+}
+
+// parseMismatchedMappings returns the fraction of the mappings of all the rules that differ in the output of
+// crushtool --compare
+func parseMismatchedMappings(output string) float64 {
+	mismatched := 0
+	total := 0
+	for _, match := range mismatchedMappingsRegex.FindAllStringSubmatch(output, -1) {
+		m, _ := strconv.Atoi(match[1])
+		t, _ := strconv.Atoi(match[2])
+		mismatched += m
+		total += t
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(mismatched) / float64(total)
+}
+
+// CreateReplicatedCrushRule creates a rule that places the replicas in different failure domains under the crush root,
+// optionally only on the devices of the device class
+func CreateReplicatedCrushRule(context *clusterd.Context, clusterName, ruleName, crushRoot, failureDomain, deviceClass string) error {
+	rule := CephStoragePoolDetails{CrushRoot: crushRoot, FailureDomain: failureDomain, DeviceClass: deviceClass}
+	return createReplicationCrushRule(context, clusterName, rule, ruleName)
+}
+
 func FormatLocation(location, hostName string) ([]string, error) {
 	var pairs []string
 	if location == "" {
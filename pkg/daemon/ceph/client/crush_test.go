@@ -16,6 +16,7 @@ limitations under the License.
 package client
 
 import (
+	"encoding/json"
 	"fmt"
 	"testing"
 
@@ -245,6 +246,55 @@ func TestGetCrushMap(t *testing.T) {
 	assert.Equal(t, 2, len(crush.Rules))
 }
 
+func TestGetCrushBucketLocation(t *testing.T) {
+	var crush CrushMap
+	err := json.Unmarshal([]byte(testCrushMap), &crush)
+	assert.Nil(t, err)
+
+	assert.Equal(t, map[string]string{"root": "default"}, GetCrushBucketLocation(&crush, "minikube"))
+	assert.Equal(t, map[string]string{}, GetCrushBucketLocation(&crush, "default"))
+	assert.Nil(t, GetCrushBucketLocation(&crush, "othernode"))
+}
+
+func TestCrushTunablesProfile(t *testing.T) {
+	profile, err := CrushTunablesProfile("optimal")
+	assert.Nil(t, err)
+	assert.Equal(t, "jewel", profile)
+	profile, err = CrushTunablesProfile("hammer")
+	assert.Nil(t, err)
+	assert.Equal(t, "hammer", profile)
+	_, err = CrushTunablesProfile("newest")
+	assert.NotNil(t, err)
+}
+
+func TestEstimateTunablesDataMovement(t *testing.T) {
+	var setArgs []string
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName, command string, args ...string) (string, error) {
+			if command == CephTool && args[0] == "osd" && args[1] == "getcrushmap" {
+				return "", nil
+			}
+			if command == CrushTool && args[2] == "--compare" {
+				return "rule 0 had 100/1024 mismatched mappings (0.0976562)\nrule 1 had 28/1024 mismatched mappings (0.0273438)\n", nil
+			}
+			if command == CrushTool {
+				setArgs = args[2 : len(args)-2]
+				return "", nil
+			}
+			return "", fmt.Errorf("unexpected command '%s %v'", command, args)
+		},
+	}
+
+	movement, err := EstimateTunablesDataMovement(&clusterd.Context{Executor: executor}, "rook", "optimal")
+	assert.Nil(t, err)
+	assert.Equal(t, 0.0625, movement)
+	assert.Equal(t, []string{"--enable-unsafe-tunables", "--set-choose-local-fallback-tries", "0", "--set-choose-local-tries", "0",
+		"--set-choose-total-tries", "50", "--set-chooseleaf-descend-once", "1", "--set-chooseleaf-stable", "1",
+		"--set-chooseleaf-vary-r", "1"}, setArgs)
+
+	assert.Equal(t, float64(0), parseMismatchedMappings("maps appear equivalent"))
+}
+
 func TestCrushLocation(t *testing.T) {
 	loc := "dc=datacenter1"
 
@@ -273,3 +323,43 @@ func TestCrushLocation(t *testing.T) {
 	assert.NotNil(t, err)
 	assert.Contains(t, err.Error(), "is not in a valid format")
 }
+
+func TestCrushSetDeviceClass(t *testing.T) {
+	removed := false
+	set := false
+	executor := &exectest.MockExecutor{}
+	executor.MockExecuteCommandWithOutputFile = func(debug bool, actionName, command, outputFile string, args ...string) (string, error) {
+		logger.Infof("Command: %s %v", command, args)
+		if args[1] == "crush" {
+			switch args[2] {
+			case "class":
+				assert.Equal(t, "ls-osd", args[3])
+				assert.Equal(t, "ssd", args[4])
+				return "[1,2]", nil
+			case "rm-device-class":
+				assert.Equal(t, "osd.3", args[3])
+				removed = true
+				return "", nil
+			case "set-device-class":
+				assert.Equal(t, "ssd", args[3])
+				assert.Equal(t, "osd.3", args[4])
+				set = true
+				return "", nil
+			}
+		}
+		return "", fmt.Errorf("unexpected ceph command '%v'", args)
+	}
+	context := &clusterd.Context{Executor: executor}
+
+	// the osd is already in the class, nothing to do
+	err := CrushSetDeviceClass(context, "rook", 2, "ssd")
+	assert.Nil(t, err)
+	assert.False(t, removed)
+	assert.False(t, set)
+
+	// the osd needs its old class removed before the new class is set
+	err = CrushSetDeviceClass(context, "rook", 3, "ssd")
+	assert.Nil(t, err)
+	assert.True(t, removed)
+	assert.True(t, set)
+}
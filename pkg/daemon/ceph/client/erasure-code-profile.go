@@ -30,6 +30,7 @@ type CephErasureCodeProfile struct {
 	Technique        string `json:"technique"`
 	FailureDomain    string `json:"crush-failure-domain"`
 	CrushRoot        string `json:"crush-root"`
+	DeviceClass      string `json:"crush-device-class"`
 }
 
 func ListErasureCodeProfiles(context *clusterd.Context, clusterName string) ([]string, error) {
@@ -64,7 +65,7 @@ func GetErasureCodeProfileDetails(context *clusterd.Context, clusterName, name s
 	return ecProfileDetails, nil
 }
 
-func CreateErasureCodeProfile(context *clusterd.Context, clusterName string, config model.ErasureCodedPoolConfig, name, failureDomain, crushRoot string) error {
+func CreateErasureCodeProfile(context *clusterd.Context, clusterName string, config model.ErasureCodedPoolConfig, name, failureDomain, crushRoot, deviceClass string) error {
 	// look up the default profile so we can use the default plugin/technique
 	defaultProfile, err := GetErasureCodeProfileDetails(context, clusterName, "default")
 	if err != nil {
@@ -84,6 +85,9 @@ func CreateErasureCodeProfile(context *clusterd.Context, clusterName string, con
 	if crushRoot != "" {
 		profilePairs = append(profilePairs, fmt.Sprintf("crush-root=%s", crushRoot))
 	}
+	if deviceClass != "" {
+		profilePairs = append(profilePairs, fmt.Sprintf("crush-device-class=%s", deviceClass))
+	}
 
 	args := []string{"osd", "erasure-code-profile", "set", name}
 	args = append(args, profilePairs...)
@@ -95,6 +99,37 @@ func CreateErasureCodeProfile(context *clusterd.Context, clusterName string, con
 	return nil
 }
 
+// GetErasureCodeProfile returns all the settings of the erasure code profile, including the defaults of its plugin
+func GetErasureCodeProfile(context *clusterd.Context, clusterName, name string) (map[string]string, error) {
+	args := []string{"osd", "erasure-code-profile", "get", name}
+	buf, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get erasure-code-profile for '%s': %+v", name, err)
+	}
+
+	var settings map[string]string
+	if err := json.Unmarshal(buf, &settings); err != nil {
+		return nil, fmt.Errorf("unmarshal failed: %+v. raw buffer response: %s", err, string(buf))
+	}
+
+	return settings, nil
+}
+
+// SetErasureCodeProfile creates the erasure code profile with the key=value pairs. An existing profile is only
+// overwritten with force, which does not change the pools that already use the profile.
+func SetErasureCodeProfile(context *clusterd.Context, clusterName, name string, profilePairs []string, force bool) error {
+	args := []string{"osd", "erasure-code-profile", "set", name}
+	args = append(args, profilePairs...)
+	if force {
+		args = append(args, "--force")
+	}
+	if _, err := ExecuteCephCommand(context, clusterName, args); err != nil {
+		return fmt.Errorf("failed to set erasure-code-profile %s. %+v", name, err)
+	}
+
+	return nil
+}
+
 func DeleteErasureCodeProfile(context *clusterd.Context, clusterName string, erasureCodeProfile string) error {
 	args := []string{"osd", "erasure-code-profile", "rm", erasureCodeProfile}
 
@@ -112,12 +147,17 @@ func ModelPoolToCephPool(modelPool model.Pool) CephStoragePoolDetails {
 		Number:        modelPool.Number,
 		FailureDomain: modelPool.FailureDomain,
 		CrushRoot:     modelPool.CrushRoot,
+		DeviceClass:   modelPool.DeviceClass,
+		PgNum:         modelPool.PgNum,
 	}
 
 	if modelPool.Type == model.Replicated {
 		pool.Size = modelPool.ReplicatedConfig.Size
 	} else if modelPool.Type == model.ErasureCoded {
-		pool.ErasureCodeProfile = GetErasureCodeProfileForPool(modelPool.Name)
+		pool.ErasureCodeProfile = modelPool.ErasureCodedConfig.ProfileName
+		if pool.ErasureCodeProfile == "" {
+			pool.ErasureCodeProfile = GetErasureCodeProfileForPool(modelPool.Name)
+		}
 	}
 
 	return pool
@@ -0,0 +1,95 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/rook/rook/pkg/clusterd"
+)
+
+// cephReleases are the names of the ceph releases from the oldest to the newest
+var cephReleases = []string{"argonaut", "bobtail", "cuttlefish", "dumpling", "emperor", "firefly", "giant", "hammer",
+	"infernalis", "jewel", "kraken", "luminous", "mimic", "nautilus"}
+
+// FeatureGroup is a group of daemons or clients that connected with the same features
+type FeatureGroup struct {
+	Features string `json:"features"`
+	Release  string `json:"release"`
+	Num      int    `json:"num"`
+}
+
+// CephReleaseIndex returns the position of the release from the oldest ceph release, or -1 if the release is unknown
+func CephReleaseIndex(release string) int {
+	for i, r := range cephReleases {
+		if r == release {
+			return i
+		}
+	}
+	return -1
+}
+
+// GetClientFeatures returns the releases of the features of the clients connected to the mons
+func GetClientFeatures(context *clusterd.Context, clusterName string) ([]FeatureGroup, error) {
+	args := []string{"features"}
+	buf, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get features: %+v", err)
+	}
+
+	var features map[string]json.RawMessage
+	if err := json.Unmarshal(buf, &features); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal features: %+v. raw: %s", err, string(buf))
+	}
+	groups, err := parseFeatureGroups(features["client"])
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal client features: %+v. raw: %s", err, string(buf))
+	}
+	return groups, nil
+}
+
+// parseFeatureGroups reads the feature groups, which are a list in newer versions of ceph and an object with a "group"
+// key repeated for each group in older versions
+func parseFeatureGroups(raw json.RawMessage) ([]FeatureGroup, error) {
+	var groups []FeatureGroup
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 {
+		return groups, nil
+	}
+	if raw[0] == '[' {
+		err := json.Unmarshal(raw, &groups)
+		return groups, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	if _, err := decoder.Token(); err != nil {
+		return nil, err
+	}
+	for decoder.More() {
+		// skip the "group" key
+		if _, err := decoder.Token(); err != nil {
+			return nil, err
+		}
+		var group FeatureGroup
+		if err := decoder.Decode(&group); err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
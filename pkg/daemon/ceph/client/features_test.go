@@ -0,0 +1,64 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package client
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetClientFeatures(t *testing.T) {
+	// luminous repeats the group key for each group
+	features := `{"mon":{"group":{"features":"0x3ffddff8eeacfffb","release":"luminous","num":3}},
+		"client":{"group":{"features":"0x7010fb86aa42ada","release":"jewel","num":1},"group":{"features":"0x3ffddff8eeacfffb","release":"luminous","num":4}}}`
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outputFile string, args ...string) (string, error) {
+			if args[0] == "features" {
+				return features, nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+
+	groups, err := GetClientFeatures(context, "rook")
+	assert.Nil(t, err)
+	assert.Equal(t, []FeatureGroup{{Features: "0x7010fb86aa42ada", Release: "jewel", Num: 1},
+		{Features: "0x3ffddff8eeacfffb", Release: "luminous", Num: 4}}, groups)
+
+	// newer releases list the groups
+	features = `{"mon":[{"features":"0x3ffddff8ffacfffb","release":"luminous","num":3}],
+		"client":[{"features":"0x3ffddff8ffacfffb","release":"luminous","num":2}]}`
+	groups, err = GetClientFeatures(context, "rook")
+	assert.Nil(t, err)
+	assert.Equal(t, []FeatureGroup{{Features: "0x3ffddff8ffacfffb", Release: "luminous", Num: 2}}, groups)
+
+	// no clients are connected
+	features = `{"mon":[{"features":"0x3ffddff8ffacfffb","release":"luminous","num":3}]}`
+	groups, err = GetClientFeatures(context, "rook")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(groups))
+}
+
+func TestCephReleaseIndex(t *testing.T) {
+	assert.True(t, CephReleaseIndex("firefly") < CephReleaseIndex("jewel"))
+	assert.True(t, CephReleaseIndex("luminous") < CephReleaseIndex("mimic"))
+	assert.Equal(t, -1, CephReleaseIndex("unknown"))
+}
@@ -1,6 +1,7 @@
 package client
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"github.com/rook/rook/pkg/clusterd"
@@ -28,3 +29,44 @@ func enableModule(context *clusterd.Context, clusterName, name string, force boo
 
 	return nil
 }
+
+type mgrModules struct {
+	Enabled []string `json:"enabled_modules"`
+	// the disabled modules are names in luminous and objects with a name in later releases
+	Disabled []json.RawMessage `json:"disabled_modules"`
+}
+
+// MgrModuleAvailable returns whether the mgr module is enabled or can be enabled in the release of the cluster
+func MgrModuleAvailable(context *clusterd.Context, clusterName, name string) (bool, error) {
+	args := []string{"mgr", "module", "ls"}
+	buf, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return false, fmt.Errorf("failed to list mgr modules: %+v", err)
+	}
+
+	var modules mgrModules
+	if err := json.Unmarshal(buf, &modules); err != nil {
+		return false, fmt.Errorf("failed to unmarshal mgr modules response: %+v", err)
+	}
+	for _, module := range modules.Enabled {
+		if module == name {
+			return true, nil
+		}
+	}
+	for _, raw := range modules.Disabled {
+		var module string
+		if err := json.Unmarshal(raw, &module); err != nil {
+			var details struct {
+				Name string `json:"name"`
+			}
+			if err := json.Unmarshal(raw, &details); err != nil {
+				return false, fmt.Errorf("failed to unmarshal disabled mgr module %s: %+v", string(raw), err)
+			}
+			module = details.Name
+		}
+		if module == name {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,115 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/rook/rook/pkg/clusterd"
+)
+
+const (
+	// MirroringModeDisabled is the mode of a pool that is not mirrored
+	MirroringModeDisabled = "disabled"
+)
+
+// MirrorPoolInfo is the mirroring mode and the peers of a pool
+type MirrorPoolInfo struct {
+	Mode  string       `json:"mode"`
+	Peers []MirrorPeer `json:"peers"`
+}
+
+// MirrorPeer is a peer cluster a pool is mirrored from
+type MirrorPeer struct {
+	UUID        string `json:"uuid"`
+	ClusterName string `json:"cluster_name"`
+	ClientName  string `json:"client_name"`
+}
+
+// MirrorPoolStatus is the health of the mirroring of a pool
+type MirrorPoolStatus struct {
+	Summary struct {
+		Health string         `json:"health"`
+		States map[string]int `json:"states"`
+	} `json:"summary"`
+}
+
+// GetMirrorPoolInfo returns the mirroring mode and the peers of the pool
+func GetMirrorPoolInfo(context *clusterd.Context, clusterName, poolName string) (*MirrorPoolInfo, error) {
+	args := []string{"mirror", "pool", "info", poolName}
+	buf, err := ExecuteRBDCommand(context, clusterName, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mirroring info of pool %s. %+v. %s", poolName, err, string(buf))
+	}
+
+	var info MirrorPoolInfo
+	if err := json.Unmarshal(buf, &info); err != nil {
+		return nil, fmt.Errorf("unmarshal failed: %+v. raw buffer response: %s", err, string(buf))
+	}
+	return &info, nil
+}
+
+// GetMirrorPoolStatus returns the health of the mirroring of the pool
+func GetMirrorPoolStatus(context *clusterd.Context, clusterName, poolName string) (*MirrorPoolStatus, error) {
+	args := []string{"mirror", "pool", "status", poolName}
+	buf, err := ExecuteRBDCommand(context, clusterName, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get mirroring status of pool %s. %+v. %s", poolName, err, string(buf))
+	}
+
+	var status MirrorPoolStatus
+	if err := json.Unmarshal(buf, &status); err != nil {
+		return nil, fmt.Errorf("unmarshal failed: %+v. raw buffer response: %s", err, string(buf))
+	}
+	return &status, nil
+}
+
+// EnableMirroring enables the mirroring of the pool in the pool or image mode
+func EnableMirroring(context *clusterd.Context, clusterName, poolName, mode string) error {
+	args := []string{"mirror", "pool", "enable", poolName, mode}
+	if buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args); err != nil {
+		return fmt.Errorf("failed to enable %s mirroring of pool %s. %+v. %s", mode, poolName, err, string(buf))
+	}
+	return nil
+}
+
+// DisableMirroring disables the mirroring of the pool
+func DisableMirroring(context *clusterd.Context, clusterName, poolName string) error {
+	args := []string{"mirror", "pool", "disable", poolName}
+	if buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args); err != nil {
+		return fmt.Errorf("failed to disable mirroring of pool %s. %+v. %s", poolName, err, string(buf))
+	}
+	return nil
+}
+
+// AddMirrorPeer adds the peer cluster the pool is mirrored from with the client user of the peer
+func AddMirrorPeer(context *clusterd.Context, clusterName, poolName, peerClient, peerCluster string) error {
+	args := []string{"mirror", "pool", "peer", "add", poolName, fmt.Sprintf("%s@%s", peerClient, peerCluster)}
+	if buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args); err != nil {
+		return fmt.Errorf("failed to add mirror peer %s to pool %s. %+v. %s", peerCluster, poolName, err, string(buf))
+	}
+	return nil
+}
+
+// RemoveMirrorPeer removes the peer from the pool
+func RemoveMirrorPeer(context *clusterd.Context, clusterName, poolName, peerUUID string) error {
+	args := []string{"mirror", "pool", "peer", "remove", poolName, peerUUID}
+	if buf, err := ExecuteRBDCommandNoFormat(context, clusterName, args); err != nil {
+		return fmt.Errorf("failed to remove mirror peer %s from pool %s. %+v. %s", peerUUID, poolName, err, string(buf))
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package client
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMirrorPool(t *testing.T) {
+	var peerArgs []string
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName, command string, args ...string) (string, error) {
+			if command != RBDTool || args[0] != "mirror" || args[1] != "pool" {
+				return "", fmt.Errorf("unexpected command '%s %v'", command, args)
+			}
+			switch args[2] {
+			case "info":
+				return `{"mode":"pool","peers":[{"uuid":"f4c2a0ab","cluster_name":"site-b","client_name":"client.rbd-mirror-peer"}]}`, nil
+			case "status":
+				return `{"summary":{"health":"WARNING","states":{"replaying":2,"syncing":1}}}`, nil
+			case "peer":
+				peerArgs = args[3:6]
+				return "", nil
+			}
+			return "", fmt.Errorf("unexpected command '%s %v'", command, args)
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+
+	info, err := GetMirrorPoolInfo(context, "rook", "mypool")
+	assert.Nil(t, err)
+	assert.Equal(t, "pool", info.Mode)
+	assert.Equal(t, []MirrorPeer{{UUID: "f4c2a0ab", ClusterName: "site-b", ClientName: "client.rbd-mirror-peer"}}, info.Peers)
+
+	status, err := GetMirrorPoolStatus(context, "rook", "mypool")
+	assert.Nil(t, err)
+	assert.Equal(t, "WARNING", status.Summary.Health)
+	assert.Equal(t, map[string]int{"replaying": 2, "syncing": 1}, status.Summary.States)
+
+	err = AddMirrorPeer(context, "rook", "mypool", "client.rbd-mirror-peer", "site-b")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"add", "mypool", "client.rbd-mirror-peer@site-b"}, peerArgs)
+}
@@ -18,6 +18,8 @@ package client
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/rook/rook/pkg/clusterd"
 )
@@ -123,3 +125,23 @@ func GetMonTimeStatus(context *clusterd.Context, clusterName string) (*MonTimeSt
 
 	return &timeStatus, nil
 }
+
+// MonInjectArgs sets the config options of all the running mons
+func MonInjectArgs(context *clusterd.Context, clusterName string, options map[string]string) (string, error) {
+	var keys []string
+	for key := range options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var injected []string
+	for _, key := range keys {
+		injected = append(injected, fmt.Sprintf("--%s=%s", key, options[key]))
+	}
+
+	args := []string{"tell", "mon.*", "injectargs", strings.Join(injected, " ")}
+	buf, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return string(buf), fmt.Errorf("failed to inject args %v into mons: %+v", injected, err)
+	}
+	return string(buf), nil
+}
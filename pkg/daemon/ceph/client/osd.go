@@ -18,7 +18,9 @@ package client
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/rook/rook/pkg/clusterd"
 )
@@ -63,6 +65,7 @@ type OSDDump struct {
 		Up  json.Number `json:"up"`
 		In  json.Number `json:"in"`
 	} `json:"osds"`
+	RequireMinCompatClient string `json:"require_min_compat_client"`
 }
 
 // StatusByID returns status and inCluster states for given OSD id
@@ -136,12 +139,45 @@ func GetOSDDump(context *clusterd.Context, clusterName string) (*OSDDump, error)
 	return &osdDump, nil
 }
 
+// SetRequireMinCompatClient sets the oldest client release that is allowed to connect to the cluster. Ceph refuses the
+// change if older clients are connected.
+func SetRequireMinCompatClient(context *clusterd.Context, clusterName, release string) (string, error) {
+	args := []string{"osd", "set-require-min-compat-client", release}
+	buf, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return string(buf), fmt.Errorf("failed to set require min compat client %s: %+v", release, err)
+	}
+
+	return string(buf), nil
+}
+
 func OSDOut(context *clusterd.Context, clusterName string, osdID int) (string, error) {
 	args := []string{"osd", "out", strconv.Itoa(osdID)}
 	buf, err := ExecuteCephCommand(context, clusterName, args)
 	return string(buf), err
 }
 
+func OSDIn(context *clusterd.Context, clusterName string, osdID int) (string, error) {
+	args := []string{"osd", "in", strconv.Itoa(osdID)}
+	buf, err := ExecuteCephCommand(context, clusterName, args)
+	return string(buf), err
+}
+
+// OSDDestroy destroys the data and keys of an OSD, but keeps its ID and its position in the CRUSH map so the ID can be
+// reused by a new OSD
+func OSDDestroy(context *clusterd.Context, clusterName string, osdID int) (string, error) {
+	args := []string{"osd", "destroy", strconv.Itoa(osdID), "--yes-i-really-mean-it"}
+	buf, err := ExecuteCephCommand(context, clusterName, args)
+	return string(buf), err
+}
+
+// OSDNew creates an OSD with the given UUID. If the ID of a destroyed OSD is given, the new OSD reuses the ID.
+func OSDNew(context *clusterd.Context, clusterName, osdUUID string, osdID int) (string, error) {
+	args := []string{"osd", "new", osdUUID, strconv.Itoa(osdID)}
+	buf, err := ExecuteCephCommand(context, clusterName, args)
+	return string(buf), err
+}
+
 func OSDRemove(context *clusterd.Context, clusterName string, osdID int) (string, error) {
 	args := []string{"osd", "rm", strconv.Itoa(osdID)}
 	buf, err := ExecuteCephCommand(context, clusterName, args)
@@ -164,6 +200,26 @@ func DisableScrubbing(context *clusterd.Context, clusterName string) (string, er
 	return string(buf), nil
 }
 
+// OSDInjectArgs sets the config options of all the running OSDs
+func OSDInjectArgs(context *clusterd.Context, clusterName string, options map[string]string) (string, error) {
+	var keys []string
+	for key := range options {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var injected []string
+	for _, key := range keys {
+		injected = append(injected, fmt.Sprintf("--%s=%s", key, options[key]))
+	}
+
+	args := []string{"tell", "osd.*", "injectargs", strings.Join(injected, " ")}
+	buf, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return string(buf), fmt.Errorf("failed to inject args %v into osds: %+v", injected, err)
+	}
+	return string(buf), nil
+}
+
 func EnableScrubbing(context *clusterd.Context, clusterName string) (string, error) {
 	args := []string{"osd", "unset", "noscrub"}
 	buf, err := ExecuteCephCommand(context, clusterName, args)
@@ -180,6 +236,87 @@ func EnableScrubbing(context *clusterd.Context, clusterName string) (string, err
 	return string(buf), nil
 }
 
+// OSDReweight sets the override weight of the OSD, a value between 0.0 and 1.0 that reduces the share of data
+// the OSD receives relative to its crush weight
+func OSDReweight(context *clusterd.Context, clusterName string, osdID int, weight float64) (string, error) {
+	args := []string{"osd", "reweight", strconv.Itoa(osdID), fmt.Sprintf("%.4f", weight)}
+	buf, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return string(buf), fmt.Errorf("failed to reweight osd.%d to %.4f: %+v", osdID, weight, err)
+	}
+	return string(buf), nil
+}
+
+// OSDSetFlag sets a cluster-wide OSD flag such as norebalance
+func OSDSetFlag(context *clusterd.Context, clusterName, flag string) (string, error) {
+	args := []string{"osd", "set", flag}
+	buf, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return string(buf), fmt.Errorf("failed to set %s: %+v", flag, err)
+	}
+	return string(buf), nil
+}
+
+// OSDUnsetFlag clears a cluster-wide OSD flag
+func OSDUnsetFlag(context *clusterd.Context, clusterName, flag string) (string, error) {
+	args := []string{"osd", "unset", flag}
+	buf, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return string(buf), fmt.Errorf("failed to unset %s: %+v", flag, err)
+	}
+	return string(buf), nil
+}
+
+// OSDSetGroupFlags sets the flags (e.g., noout) on all the OSDs under the given CRUSH nodes. Ceph only supports the
+// noup, nodown, noin and noout flags on CRUSH nodes.
+func OSDSetGroupFlags(context *clusterd.Context, clusterName string, flags, crushNodes []string) (string, error) {
+	args := []string{"osd", "set-group", strings.Join(flags, ","), strings.Join(crushNodes, ",")}
+	buf, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return string(buf), fmt.Errorf("failed to set flags %v on %v: %+v", flags, crushNodes, err)
+	}
+	return string(buf), nil
+}
+
+// OSDUnsetGroupFlags clears the flags (e.g., noout) on all the OSDs under the given CRUSH nodes
+func OSDUnsetGroupFlags(context *clusterd.Context, clusterName string, flags, crushNodes []string) (string, error) {
+	args := []string{"osd", "unset-group", strings.Join(flags, ","), strings.Join(crushNodes, ",")}
+	buf, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return string(buf), fmt.Errorf("failed to unset flags %v on %v: %+v", flags, crushNodes, err)
+	}
+	return string(buf), nil
+}
+
+// OSDAddNoOut sets the noout flag on the given OSDs. Older versions of Ceph that do not support flags on CRUSH nodes
+// support the noout flag on individual OSDs.
+func OSDAddNoOut(context *clusterd.Context, clusterName string, osdIDs []int) (string, error) {
+	args := append([]string{"osd", "add-noout"}, osdIDArgs(osdIDs)...)
+	buf, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return string(buf), fmt.Errorf("failed to add noout to osds %v: %+v", osdIDs, err)
+	}
+	return string(buf), nil
+}
+
+// OSDRemoveNoOut clears the noout flag on the given OSDs
+func OSDRemoveNoOut(context *clusterd.Context, clusterName string, osdIDs []int) (string, error) {
+	args := append([]string{"osd", "rm-noout"}, osdIDArgs(osdIDs)...)
+	buf, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return string(buf), fmt.Errorf("failed to remove noout from osds %v: %+v", osdIDs, err)
+	}
+	return string(buf), nil
+}
+
+func osdIDArgs(osdIDs []int) []string {
+	args := make([]string, len(osdIDs))
+	for i, id := range osdIDs {
+		args[i] = strconv.Itoa(id)
+	}
+	return args
+}
+
 func (usage *OSDUsage) ByID(osdID int) *OSDNodeUsage {
 	for i := range usage.OSDNodes {
 		if usage.OSDNodes[i].ID == osdID {
@@ -45,3 +45,27 @@ func GetPGDumpBrief(context *clusterd.Context, clusterName string) ([]PGDumpBrie
 
 	return pgDump, nil
 }
+
+// PGStat is the state and the scrub stamps of a placement group
+type PGStat struct {
+	ID                 string `json:"pgid"`
+	State              string `json:"state"`
+	LastScrubStamp     string `json:"last_scrub_stamp"`
+	LastDeepScrubStamp string `json:"last_deep_scrub_stamp"`
+}
+
+// GetPGStats returns the state and the scrub stamps of all the placement groups in the cluster
+func GetPGStats(context *clusterd.Context, clusterName string) ([]PGStat, error) {
+	args := []string{"pg", "dump", "pgs"}
+	buf, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pg stats: %+v", err)
+	}
+
+	var pgStats []PGStat
+	if err := json.Unmarshal(buf, &pgStats); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal pg stats response: %+v", err)
+	}
+
+	return pgStats, nil
+}
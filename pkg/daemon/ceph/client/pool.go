@@ -18,8 +18,10 @@ package client
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/rook/rook/pkg/clusterd"
 	"github.com/rook/rook/pkg/daemon/ceph/model"
@@ -30,6 +32,9 @@ const (
 	reallyConfirmFlag = "--yes-i-really-really-mean-it"
 )
 
+// the pools are deleted one at a time so that a deletion does not disallow the pool deletions in progress
+var poolDeleteLock sync.Mutex
+
 type CephStoragePoolSummary struct {
 	Name   string `json:"poolname"`
 	Number int    `json:"poolnum"`
@@ -42,6 +47,42 @@ type CephStoragePoolDetails struct {
 	ErasureCodeProfile string `json:"erasure_code_profile"`
 	FailureDomain      string `json:"failureDomain"`
 	CrushRoot          string `json:"crushRoot"`
+	DeviceClass        string `json:"deviceClass"`
+	PgNum              int    `json:"pg_num"`
+	MinSize            uint   `json:"min_size"`
+	CrushRule          string `json:"crush_rule"`
+
+	// the compression properties are only returned once they are set on the pool
+	CompressionMode          string  `json:"compression_mode"`
+	CompressionAlgorithm     string  `json:"compression_algorithm"`
+	CompressionRequiredRatio float64 `json:"compression_required_ratio"`
+
+	// the cache properties are only returned for the cache tiers
+	HitSetType            string  `json:"hit_set_type"`
+	HitSetCount           int     `json:"hit_set_count"`
+	HitSetPeriod          int     `json:"hit_set_period"`
+	TargetMaxBytes        uint64  `json:"target_max_bytes"`
+	TargetMaxObjects      uint64  `json:"target_max_objects"`
+	CacheTargetDirtyRatio float64 `json:"cache_target_dirty_ratio"`
+	CacheTargetFullRatio  float64 `json:"cache_target_full_ratio"`
+}
+
+// CephStoragePoolListDetails is a pool in the detailed listing of all the pools. The tier ids are -1 when not set.
+type CephStoragePoolListDetails struct {
+	Name         string                     `json:"pool_name"`
+	Number       int                        `json:"pool"`
+	Tiers        []int                      `json:"tiers"`
+	TierOf       int                        `json:"tier_of"`
+	ReadTier     int                        `json:"read_tier"`
+	WriteTier    int                        `json:"write_tier"`
+	CacheMode    string                     `json:"cache_mode"`
+	Applications map[string]json.RawMessage `json:"application_metadata"`
+}
+
+type CephStoragePoolQuota struct {
+	Name       string `json:"pool_name"`
+	MaxObjects uint64 `json:"quota_max_objects"`
+	MaxBytes   uint64 `json:"quota_max_bytes"`
 }
 
 type CephStoragePoolStats struct {
@@ -125,10 +166,10 @@ func GetPoolDetails(context *clusterd.Context, clusterName, name string) (CephSt
 
 func CreatePoolWithProfile(context *clusterd.Context, clusterName string, newPoolReq model.Pool, appName string) error {
 	newPool := ModelPoolToCephPool(newPoolReq)
-	if newPoolReq.Type == model.ErasureCoded {
+	if newPoolReq.Type == model.ErasureCoded && newPoolReq.ErasureCodedConfig.ProfileName == "" {
 		// create a new erasure code profile for the new pool
 		if err := CreateErasureCodeProfile(context, clusterName, newPoolReq.ErasureCodedConfig, newPool.ErasureCodeProfile,
-			newPoolReq.FailureDomain, newPoolReq.CrushRoot); err != nil {
+			newPoolReq.FailureDomain, newPoolReq.CrushRoot, newPoolReq.DeviceClass); err != nil {
 
 			return fmt.Errorf("failed to create erasure code profile for pool '%s': %+v", newPoolReq.Name, err)
 		}
@@ -151,6 +192,18 @@ func DeletePool(context *clusterd.Context, clusterName string, name string) erro
 		return nil
 	}
 
+	// the mons only allow pools to be deleted while the operator deletes them
+	poolDeleteLock.Lock()
+	defer poolDeleteLock.Unlock()
+	if _, err := MonInjectArgs(context, clusterName, map[string]string{"mon_allow_pool_delete": "true"}); err != nil {
+		return fmt.Errorf("failed to allow the deletion of pool %s. %+v", name, err)
+	}
+	defer func() {
+		if _, err := MonInjectArgs(context, clusterName, map[string]string{"mon_allow_pool_delete": "false"}); err != nil {
+			logger.Warningf("failed to disallow the deletion of pools. %+v", err)
+		}
+	}()
+
 	logger.Infof("purging pool %s (id=%d)", name, pool.Number)
 	args := []string{"osd", "pool", "delete", name, name, reallyConfirmFlag}
 	_, err = ExecuteCephCommand(context, clusterName, args)
@@ -169,7 +222,8 @@ func DeletePool(context *clusterd.Context, clusterName string, name string) erro
 	return nil
 }
 
-func givePoolAppTag(context *clusterd.Context, clusterName string, poolName string, appName string) error {
+// GivePoolAppTag enables the application on the pool
+func GivePoolAppTag(context *clusterd.Context, clusterName string, poolName string, appName string) error {
 	args := []string{"osd", "pool", "application", "enable", poolName, appName, confirmFlag}
 	_, err := ExecuteCephCommand(context, clusterName, args)
 	if err != nil {
@@ -179,8 +233,53 @@ func givePoolAppTag(context *clusterd.Context, clusterName string, poolName stri
 	return nil
 }
 
+// DisablePoolAppTag disables the application on the pool
+func DisablePoolAppTag(context *clusterd.Context, clusterName string, poolName string, appName string) error {
+	args := []string{"osd", "pool", "application", "disable", poolName, appName, confirmFlag}
+	_, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return fmt.Errorf("failed to disable application %s on pool %s. %+v", appName, poolName, err)
+	}
+
+	return nil
+}
+
+// ListPoolDetails returns the tiering and the applications of all the pools
+func ListPoolDetails(context *clusterd.Context, clusterName string) ([]CephStoragePoolListDetails, error) {
+	args := []string{"osd", "pool", "ls", "detail"}
+	buf, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pool details: %+v", err)
+	}
+
+	var pools []CephStoragePoolListDetails
+	if err := json.Unmarshal(buf, &pools); err != nil {
+		return nil, fmt.Errorf("unmarshal failed: %+v. raw buffer response: %s", err, string(buf))
+	}
+	return pools, nil
+}
+
+// GetPoolApplications returns the applications each pool is tagged with
+func GetPoolApplications(context *clusterd.Context, clusterName string) (map[string][]string, error) {
+	pools, err := ListPoolDetails(context, clusterName)
+	if err != nil {
+		return nil, err
+	}
+
+	applications := map[string][]string{}
+	for _, pool := range pools {
+		var names []string
+		for name := range pool.Applications {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		applications[pool.Name] = names
+	}
+	return applications, nil
+}
+
 func CreateECPoolForApp(context *clusterd.Context, clusterName string, newPool CephStoragePoolDetails, appName string, enableECOverwrite bool) error {
-	args := []string{"osd", "pool", "create", newPool.Name, strconv.Itoa(newPool.Number), "erasure", newPool.ErasureCodeProfile}
+	args := []string{"osd", "pool", "create", newPool.Name, strconv.Itoa(newPool.PgNum), "erasure", newPool.ErasureCodeProfile}
 
 	buf, err := ExecuteCephCommand(context, clusterName, args)
 	if err != nil {
@@ -194,7 +293,7 @@ func CreateECPoolForApp(context *clusterd.Context, clusterName string, newPool C
 		}
 	}
 
-	err = givePoolAppTag(context, clusterName, newPool.Name, appName)
+	err = GivePoolAppTag(context, clusterName, newPool.Name, appName)
 	if err != nil {
 		return err
 	}
@@ -209,7 +308,7 @@ func CreateReplicatedPoolForApp(context *clusterd.Context, clusterName string, n
 		return err
 	}
 
-	args := []string{"osd", "pool", "create", newPool.Name, strconv.Itoa(newPool.Number), "replicated", newPool.Name}
+	args := []string{"osd", "pool", "create", newPool.Name, strconv.Itoa(newPool.PgNum), "replicated", newPool.Name}
 
 	buf, err := ExecuteCephCommand(context, clusterName, args)
 	if err != nil {
@@ -222,7 +321,7 @@ func CreateReplicatedPoolForApp(context *clusterd.Context, clusterName string, n
 	}
 
 	// ensure that the newly created pool gets an application tag
-	err = givePoolAppTag(context, clusterName, newPool.Name, appName)
+	err = GivePoolAppTag(context, clusterName, newPool.Name, appName)
 	if err != nil {
 		return err
 	}
@@ -246,6 +345,10 @@ func createReplicationCrushRule(context *clusterd.Context, clusterName string, n
 	}
 
 	args := []string{"osd", "crush", "rule", "create-simple", ruleName, crushRoot, failureDomain}
+	if newPool.DeviceClass != "" {
+		// only replicated rules created with create-replicated can be restricted to a device class
+		args = []string{"osd", "crush", "rule", "create-replicated", ruleName, crushRoot, failureDomain, newPool.DeviceClass}
+	}
 	_, err := ExecuteCephCommand(context, clusterName, args)
 	if err != nil {
 		return fmt.Errorf("failed to create crush rule %s. %+v", ruleName, err)
@@ -254,6 +357,94 @@ func createReplicationCrushRule(context *clusterd.Context, clusterName string, n
 	return nil
 }
 
+// SetPoolCrushRule creates a replicated crush rule for the failure domain, crush root and device class of the pool and
+// switches the pool to it, unless the rule of the pool already places the data there. The rule the pool used before is
+// removed if it was created for the pool.
+func SetPoolCrushRule(context *clusterd.Context, clusterName string, pool CephStoragePoolDetails) error {
+	current, err := GetPoolDetails(context, clusterName, pool.Name)
+	if err != nil {
+		return err
+	}
+
+	ruleName := poolCrushRuleName(pool)
+	if current.CrushRule == ruleName {
+		return nil
+	}
+	crush, err := GetCrushMap(context, clusterName)
+	if err != nil {
+		return err
+	}
+	crushRoot, failureDomain, deviceClass := crushRulePlacement(&crush, current.CrushRule)
+	if crushRoot == defaultCrushRoot(pool) && failureDomain == defaultFailureDomain(pool) && deviceClass == pool.DeviceClass {
+		return nil
+	}
+	if err := createReplicationCrushRule(context, clusterName, pool, ruleName); err != nil {
+		return err
+	}
+	logger.Infof("switching pool %s from crush rule %s to %s", pool.Name, current.CrushRule, ruleName)
+	if err := SetPoolProperty(context, clusterName, pool.Name, "crush_rule", ruleName); err != nil {
+		return err
+	}
+
+	if current.CrushRule == pool.Name || strings.HasPrefix(current.CrushRule, pool.Name+"_") {
+		// ignore the error in case the rule is still in use by another pool
+		args := []string{"osd", "crush", "rule", "rm", current.CrushRule}
+		if _, err := ExecuteCephCommand(context, clusterName, args); err != nil {
+			logger.Infof("did not delete crush rule %s. %+v", current.CrushRule, err)
+		}
+	}
+	return nil
+}
+
+// poolCrushRuleName returns the name of the crush rule of the pool after its placement is changed. The rule created
+// with the pool is named after the pool.
+func poolCrushRuleName(pool CephStoragePoolDetails) string {
+	name := fmt.Sprintf("%s_%s_%s", pool.Name, defaultCrushRoot(pool), defaultFailureDomain(pool))
+	if pool.DeviceClass != "" {
+		name = fmt.Sprintf("%s_%s", name, pool.DeviceClass)
+	}
+	return name
+}
+
+func defaultFailureDomain(pool CephStoragePoolDetails) string {
+	if pool.FailureDomain == "" {
+		return "host"
+	}
+	return pool.FailureDomain
+}
+
+func defaultCrushRoot(pool CephStoragePoolDetails) string {
+	if pool.CrushRoot == "" {
+		return "default"
+	}
+	return pool.CrushRoot
+}
+
+// crushRulePlacement returns the crush root, failure domain and device class a replicated crush rule places the data
+// on, or empty strings if the rule is not found. The rules restricted to a device class take the shadow root of the
+// class, which is named after the root and the class.
+func crushRulePlacement(crush *CrushMap, ruleName string) (string, string, string) {
+	for _, rule := range crush.Rules {
+		if rule.Name != ruleName {
+			continue
+		}
+		var crushRoot, failureDomain, deviceClass string
+		for _, step := range rule.Steps {
+			switch {
+			case step.Operation == "take":
+				crushRoot = step.ItemName
+				if i := strings.Index(step.ItemName, "~"); i >= 0 {
+					crushRoot, deviceClass = step.ItemName[:i], step.ItemName[i+1:]
+				}
+			case strings.HasPrefix(step.Operation, "choose"):
+				failureDomain = step.Type
+			}
+		}
+		return crushRoot, failureDomain, deviceClass
+	}
+	return "", "", ""
+}
+
 func SetPoolProperty(context *clusterd.Context, clusterName, name, propName string, propVal string) error {
 	args := []string{"osd", "pool", "set", name, propName, propVal}
 	_, err := ExecuteCephCommand(context, clusterName, args)
@@ -263,6 +454,30 @@ func SetPoolProperty(context *clusterd.Context, clusterName, name, propName stri
 	return nil
 }
 
+func GetPoolQuota(context *clusterd.Context, clusterName, name string) (CephStoragePoolQuota, error) {
+	args := []string{"osd", "pool", "get-quota", name}
+	buf, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return CephStoragePoolQuota{}, fmt.Errorf("failed to get pool %s quota: %+v", name, err)
+	}
+
+	var quota CephStoragePoolQuota
+	if err := json.Unmarshal(buf, &quota); err != nil {
+		return CephStoragePoolQuota{}, fmt.Errorf("failed to unmarshal pool quota response: %+v", err)
+	}
+	return quota, nil
+}
+
+// SetPoolQuota sets the max_bytes or max_objects quota of the pool. A value of zero removes the quota.
+func SetPoolQuota(context *clusterd.Context, clusterName, name, quotaName string, value uint64) error {
+	args := []string{"osd", "pool", "set-quota", name, quotaName, strconv.FormatUint(value, 10)}
+	_, err := ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return fmt.Errorf("failed to set quota %s on pool %s, %+v", quotaName, name, err)
+	}
+	return nil
+}
+
 func GetPoolStats(context *clusterd.Context, clusterName string) (*CephStoragePoolStats, error) {
 	args := []string{"df", "detail"}
 	buf, err := ExecuteCephCommand(context, clusterName, args)
@@ -339,6 +554,7 @@ func cephPoolToModelPool(cephPool CephStoragePoolDetails, ecpDetails map[string]
 	pool := model.Pool{
 		Name:   cephPool.Name,
 		Number: cephPool.Number,
+		PgNum:  cephPool.PgNum,
 	}
 
 	if cephPool.ErasureCodeProfile != "" {
@@ -351,6 +567,8 @@ func cephPoolToModelPool(cephPool CephStoragePoolDetails, ecpDetails map[string]
 		pool.ErasureCodedConfig.DataChunkCount = ecpDetails.DataChunkCount
 		pool.ErasureCodedConfig.CodingChunkCount = ecpDetails.CodingChunkCount
 		pool.ErasureCodedConfig.Algorithm = fmt.Sprintf("%s::%s", ecpDetails.Plugin, ecpDetails.Technique)
+		pool.ErasureCodedConfig.ProfileName = cephPool.ErasureCodeProfile
+		pool.DeviceClass = ecpDetails.DeviceClass
 	} else if cephPool.Size > 0 {
 		pool.Type = model.Replicated
 		pool.ReplicatedConfig.Size = cephPool.Size
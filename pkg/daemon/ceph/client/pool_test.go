@@ -17,6 +17,7 @@ package client
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 
 	exectest "github.com/rook/rook/pkg/util/exec/test"
@@ -86,13 +87,17 @@ func TestCreateECPoolWithoutOverwrites(t *testing.T) {
 }
 
 func TestCreateReplicaPool(t *testing.T) {
-	testCreateReplicaPool(t, "", "")
+	testCreateReplicaPool(t, "", "", "")
 }
 func TestCreateReplicaPoolWithFailureDomain(t *testing.T) {
-	testCreateReplicaPool(t, "osd", "mycrushroot")
+	testCreateReplicaPool(t, "osd", "mycrushroot", "")
 }
 
-func testCreateReplicaPool(t *testing.T, failureDomain, crushRoot string) {
+func TestCreateReplicaPoolWithDeviceClass(t *testing.T) {
+	testCreateReplicaPool(t, "osd", "mycrushroot", "ssd")
+}
+
+func testCreateReplicaPool(t *testing.T, failureDomain, crushRoot, deviceClass string) {
 	crushRuleCreated := false
 	executor := &exectest.MockExecutor{}
 	context := &clusterd.Context{Executor: executor}
@@ -120,7 +125,12 @@ func testCreateReplicaPool(t *testing.T, failureDomain, crushRoot string) {
 		if args[1] == "crush" {
 			crushRuleCreated = true
 			assert.Equal(t, "rule", args[2])
-			assert.Equal(t, "create-simple", args[3])
+			if deviceClass == "" {
+				assert.Equal(t, "create-simple", args[3])
+			} else {
+				assert.Equal(t, "create-replicated", args[3])
+				assert.Equal(t, deviceClass, args[7])
+			}
 			assert.Equal(t, "mypool", args[4])
 			if crushRoot == "" {
 				assert.Equal(t, "default", args[5])
@@ -137,8 +147,71 @@ func testCreateReplicaPool(t *testing.T, failureDomain, crushRoot string) {
 		return "", fmt.Errorf("unexpected ceph command '%v'", args)
 	}
 
-	p := CephStoragePoolDetails{Name: "mypool", Size: 12345, FailureDomain: failureDomain, CrushRoot: crushRoot}
+	p := CephStoragePoolDetails{Name: "mypool", Size: 12345, FailureDomain: failureDomain, CrushRoot: crushRoot, DeviceClass: deviceClass}
 	err := CreateReplicatedPoolForApp(context, "myns", p, "myapp")
 	assert.Nil(t, err)
 	assert.True(t, crushRuleCreated)
 }
+
+func TestDeletePool(t *testing.T) {
+	var commands []string
+	injectFails := false
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outputFile string, args ...string) (string, error) {
+			if args[1] == "pool" && args[2] == "get" {
+				if args[3] != "mypool" {
+					return "", fmt.Errorf("pool %s not found", args[3])
+				}
+				return `{"pool":"mypool","pool_id":1,"size":1}`, nil
+			}
+			if args[0] == "tell" && injectFails {
+				return "", fmt.Errorf("mons not reachable")
+			}
+			commands = append(commands, strings.Join(args[0:4], " "))
+			return "", nil
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+
+	// the mons only allow the deletion while the pool is deleted
+	err := DeletePool(context, "myns", "mypool")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"tell mon.* injectargs --mon_allow_pool_delete=true",
+		"osd pool delete mypool",
+		"osd crush rule rm",
+		"tell mon.* injectargs --mon_allow_pool_delete=false",
+	}, commands)
+
+	// the pool is not deleted when the mons do not allow it
+	commands = nil
+	injectFails = true
+	err = DeletePool(context, "myns", "mypool")
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, len(commands))
+	injectFails = false
+
+	// nothing is deleted if the pool does not exist
+	commands = nil
+	err = DeletePool(context, "myns", "otherpool")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(commands))
+}
+
+func TestGetPoolApplications(t *testing.T) {
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outputFile string, args ...string) (string, error) {
+			assert.Equal(t, []string{"osd", "pool", "ls", "detail"}, args[0:4])
+			return `[{"pool_name":"rbd","application_metadata":{"rbd":{}}},` +
+				`{"pool_name":"myfs-data0","application_metadata":{"cephfs":{"data":"myfs"},"rbd":{}}},` +
+				`{"pool_name":"untagged","application_metadata":{}}]`, nil
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+
+	applications, err := GetPoolApplications(context, "myns")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"rbd"}, applications["rbd"])
+	assert.Equal(t, []string{"cephfs", "rbd"}, applications["myfs-data0"])
+	assert.Equal(t, 0, len(applications["untagged"]))
+}
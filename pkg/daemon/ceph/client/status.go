@@ -18,6 +18,7 @@ package client
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/rook/rook/pkg/clusterd"
 )
@@ -38,6 +39,9 @@ const (
 	clusterStateActiveClean = "active+clean"
 )
 
+// the placement group states in which not all the copies of the data are available
+var unrecoveredPGStates = []string{"degraded", "undersized", "recovering", "recovery_wait", "peering", "down", "stale", "incomplete"}
+
 type CephStatus struct {
 	Health        HealthStatus `json:"health"`
 	FSID          string       `json:"fsid"`
@@ -159,3 +163,36 @@ func IsClusterClean(context *clusterd.Context, clusterName string) error {
 
 	return fmt.Errorf("cluster is not fully clean. PGs: %+v", status.PgMap.PgsByState)
 }
+
+// IsClusterRecovered returns an error if any placement group is inactive or does not have all the copies of its data,
+// such as after OSDs were restarted. Unlike IsClusterClean, the placement groups that are remapped or scrubbing count as
+// recovered.
+func IsClusterRecovered(context *clusterd.Context, clusterName string) error {
+	status, err := Status(context, clusterName)
+	if err != nil {
+		return err
+	}
+
+	for _, pg := range status.PgMap.PgsByState {
+		if !pgStateRecovered(pg.StateName) {
+			return fmt.Errorf("cluster is not recovered. PGs: %+v", status.PgMap.PgsByState)
+		}
+	}
+	return nil
+}
+
+func pgStateRecovered(stateName string) bool {
+	states := strings.Split(stateName, "+")
+	active := false
+	for _, state := range states {
+		if state == "active" {
+			active = true
+		}
+		for _, unrecovered := range unrecoveredPGStates {
+			if state == unrecovered {
+				return false
+			}
+		}
+	}
+	return active
+}
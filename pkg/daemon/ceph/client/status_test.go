@@ -57,3 +57,13 @@ func TestStatusMarshal(t *testing.T) {
 	assert.Equal(t, 101, status.PgMap.PgsByState[0].Count)
 	assert.Equal(t, "stale+active+clean", status.PgMap.PgsByState[0].StateName)
 }
+
+func TestPGStateRecovered(t *testing.T) {
+	assert.True(t, pgStateRecovered("active+clean"))
+	assert.True(t, pgStateRecovered("active+clean+scrubbing+deep"))
+	assert.True(t, pgStateRecovered("active+remapped+backfill_wait"))
+	assert.False(t, pgStateRecovered("active+undersized+degraded"))
+	assert.False(t, pgStateRecovered("active+recovering+degraded"))
+	assert.False(t, pgStateRecovered("stale+active+clean"))
+	assert.False(t, pgStateRecovered("peering"))
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package client
+
+import (
+	"fmt"
+
+	"github.com/rook/rook/pkg/clusterd"
+)
+
+const (
+	// CacheModeNone is the cache mode of a pool that is not a cache tier
+	CacheModeNone = "none"
+	// CacheModeReadOnly is the cache mode that only caches reads and is not flushed
+	CacheModeReadOnly = "readonly"
+)
+
+// AddTier adds the cache pool as a tier of the pool
+func AddTier(context *clusterd.Context, clusterName, poolName, cachePool string) error {
+	args := []string{"osd", "tier", "add", poolName, cachePool}
+	if _, err := ExecuteCephCommand(context, clusterName, args); err != nil {
+		return fmt.Errorf("failed to add cache pool %s as a tier of pool %s. %+v", cachePool, poolName, err)
+	}
+	return nil
+}
+
+// RemoveTier removes the cache pool from the tiers of the pool. The overlay must be removed first.
+func RemoveTier(context *clusterd.Context, clusterName, poolName, cachePool string) error {
+	args := []string{"osd", "tier", "remove", poolName, cachePool}
+	if _, err := ExecuteCephCommand(context, clusterName, args); err != nil {
+		return fmt.Errorf("failed to remove cache pool %s from the tiers of pool %s. %+v", cachePool, poolName, err)
+	}
+	return nil
+}
+
+// SetCacheMode sets the cache mode of the cache pool
+func SetCacheMode(context *clusterd.Context, clusterName, cachePool, mode string) error {
+	args := []string{"osd", "tier", "cache-mode", cachePool, mode}
+	if mode == CacheModeReadOnly {
+		// ceph requires the confirmation since readonly caches can return stale data
+		args = append(args, confirmFlag)
+	}
+	if _, err := ExecuteCephCommand(context, clusterName, args); err != nil {
+		return fmt.Errorf("failed to set cache mode %s on pool %s. %+v", mode, cachePool, err)
+	}
+	return nil
+}
+
+// SetTierOverlay directs the client I/O of the pool to the cache pool
+func SetTierOverlay(context *clusterd.Context, clusterName, poolName, cachePool string) error {
+	args := []string{"osd", "tier", "set-overlay", poolName, cachePool}
+	if _, err := ExecuteCephCommand(context, clusterName, args); err != nil {
+		return fmt.Errorf("failed to set cache pool %s as the overlay of pool %s. %+v", cachePool, poolName, err)
+	}
+	return nil
+}
+
+// RemoveTierOverlay directs the client I/O of the pool back to the pool
+func RemoveTierOverlay(context *clusterd.Context, clusterName, poolName string) error {
+	args := []string{"osd", "tier", "remove-overlay", poolName}
+	if _, err := ExecuteCephCommand(context, clusterName, args); err != nil {
+		return fmt.Errorf("failed to remove the overlay of pool %s. %+v", poolName, err)
+	}
+	return nil
+}
+
+// FlushCachePool flushes the dirty objects of the cache pool to the pool it caches and evicts all its objects
+func FlushCachePool(context *clusterd.Context, clusterName, cachePool string) error {
+	args := []string{"-p", cachePool, "cache-flush-evict-all"}
+	command, args := FinalizeCephCommandArgs(RadosTool, args, context.ConfigDir, clusterName)
+	if buf, err := executeCommand(context, command, args); err != nil {
+		return fmt.Errorf("failed to flush cache pool %s. %+v. %s", cachePool, err, string(buf))
+	}
+	return nil
+}
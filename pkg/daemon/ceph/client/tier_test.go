@@ -0,0 +1,69 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package client
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPoolTiers(t *testing.T) {
+	var cephArgs []string
+	var radosArgs []string
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outputFile string, args ...string) (string, error) {
+			if args[0] == "osd" && args[1] == "pool" && args[2] == "ls" {
+				return `[{"pool_name":"ecpool","pool":1,"tiers":[2],"tier_of":-1,"read_tier":2,"write_tier":2,"cache_mode":"none"},` +
+					`{"pool_name":"cache","pool":2,"tiers":[],"tier_of":1,"read_tier":-1,"write_tier":-1,"cache_mode":"writeback"}]`, nil
+			}
+			if args[0] == "osd" && args[1] == "tier" {
+				cephArgs = args[2:]
+				return "", nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+		MockExecuteCommandWithOutput: func(debug bool, actionName, command string, args ...string) (string, error) {
+			assert.Equal(t, RadosTool, command)
+			radosArgs = args[0:3]
+			return "", nil
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+
+	pools, err := ListPoolDetails(context, "rook")
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(pools))
+	assert.Equal(t, CephStoragePoolListDetails{Name: "ecpool", Number: 1, Tiers: []int{2}, TierOf: -1, ReadTier: 2, WriteTier: 2, CacheMode: "none"}, pools[0])
+	assert.Equal(t, 1, pools[1].TierOf)
+	assert.Equal(t, "writeback", pools[1].CacheMode)
+
+	// readonly caches require the confirmation
+	err = SetCacheMode(context, "rook", "cache", "writeback")
+	assert.Nil(t, err)
+	assert.Equal(t, "writeback", cephArgs[2])
+	assert.NotEqual(t, confirmFlag, cephArgs[3])
+	err = SetCacheMode(context, "rook", "cache", CacheModeReadOnly)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"cache-mode", "cache", "readonly", confirmFlag}, cephArgs[0:4])
+
+	err = FlushCachePool(context, "rook", "cache")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"-p", "cache", "cache-flush-evict-all"}, radosArgs)
+}
@@ -31,6 +31,8 @@ type ErasureCodedPoolConfig struct {
 	DataChunkCount   uint   `json:"dataChunkCount"`
 	CodingChunkCount uint   `json:"codingChunkCount"`
 	Algorithm        string `json:"algorithm"`
+	// the existing erasure code profile of the pool, instead of a profile created for the pool
+	ProfileName string `json:"profileName,omitempty"`
 }
 
 type Pool struct {
@@ -39,6 +41,8 @@ type Pool struct {
 	Type               PoolType               `json:"type"`
 	FailureDomain      string                 `json:"failureDomain"`
 	CrushRoot          string                 `json:"crushRoot"`
+	DeviceClass        string                 `json:"deviceClass"`
+	PgNum              int                    `json:"pgNum"`
 	ReplicatedConfig   ReplicatedPoolConfig   `json:"replicatedConfig"`
 	ErasureCodedConfig ErasureCodedPoolConfig `json:"erasureCodedConfig"`
 }
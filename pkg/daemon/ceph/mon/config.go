@@ -299,7 +299,7 @@ func CreateDefaultCephConfig(context *clusterd.Context, cluster *ClusterInfo, ru
 			ClusterAddr:            context.NetworkInfo.ClusterAddrIPv4,
 			ClusterNetwork:         context.NetworkInfo.ClusterNetwork,
 			MonKeyValueDb:          "rocksdb",
-			MonAllowPoolDelete:     true,
+			MonAllowPoolDelete:     false,
 			MaxPgsPerOsd:           1000,
 			DebugLogDefaultLevel:   cephLogLevel,
 			DebugLogRadosLevel:     cephLogLevel,
@@ -27,13 +27,16 @@ import (
 
 	"github.com/google/uuid"
 
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
 	"github.com/rook/rook/pkg/clusterd"
 	"github.com/rook/rook/pkg/daemon/ceph/client"
 	"github.com/rook/rook/pkg/daemon/ceph/mon"
+	oposd "github.com/rook/rook/pkg/operator/ceph/cluster/osd"
 	"github.com/rook/rook/pkg/operator/ceph/cluster/osd/config"
 	"github.com/rook/rook/pkg/operator/k8sutil"
 	"github.com/rook/rook/pkg/util"
 	"github.com/rook/rook/pkg/util/proc"
+	"github.com/rook/rook/pkg/util/sys"
 )
 
 const (
@@ -41,6 +44,7 @@ const (
 	deviceKey       = "device"
 	dirKey          = "dir"
 	unassignedOSDID = -1
+	bytesPerMB      = 1024 * 1024
 )
 
 type OsdAgent struct {
@@ -51,22 +55,29 @@ type OsdAgent struct {
 	osdProc           map[int]*proc.MonitoredProc
 	devices           string
 	usingDeviceFilter bool
+	deviceSelector    *rookalpha.DeviceSelector
 	metadataDevice    string
 	directories       string
 	procMan           *proc.ProcManager
 	storeConfig       config.StoreConfig
+	deviceClasses     map[string]string
+	dirCapacities     map[string]int
+	osdDirs           map[int]string
 	kv                *k8sutil.ConfigMapKVStore
 	configCounter     int32
 	osdsCompleted     chan struct{}
+	status            oposd.OrchestrationStatus
 }
 
-func NewAgent(context *clusterd.Context, devices string, usingDeviceFilter bool, metadataDevice, directories string, forceFormat bool,
-	location string, storeConfig config.StoreConfig, cluster *mon.ClusterInfo, nodeName string, kv *k8sutil.ConfigMapKVStore) *OsdAgent {
+func NewAgent(context *clusterd.Context, devices string, usingDeviceFilter bool, deviceSelector *rookalpha.DeviceSelector,
+	metadataDevice, directories string, forceFormat bool, location string, storeConfig config.StoreConfig,
+	deviceClasses map[string]string, dirCapacities map[string]int, cluster *mon.ClusterInfo, nodeName string,
+	kv *k8sutil.ConfigMapKVStore) *OsdAgent {
 
-	return &OsdAgent{devices: devices, usingDeviceFilter: usingDeviceFilter, metadataDevice: metadataDevice,
+	return &OsdAgent{devices: devices, usingDeviceFilter: usingDeviceFilter, deviceSelector: deviceSelector, metadataDevice: metadataDevice,
 		directories: directories, forceFormat: forceFormat, location: location, storeConfig: storeConfig,
-		cluster: cluster, nodeName: nodeName, kv: kv,
-		procMan: proc.New(context.Executor), osdProc: make(map[int]*proc.MonitoredProc),
+		deviceClasses: deviceClasses, dirCapacities: dirCapacities, cluster: cluster, nodeName: nodeName, kv: kv,
+		procMan: proc.New(context.Executor), osdProc: make(map[int]*proc.MonitoredProc), osdDirs: make(map[int]string),
 	}
 }
 
@@ -78,8 +89,14 @@ func (a *OsdAgent) configureDirs(context *clusterd.Context, dirs map[string]int)
 	succeeded := 0
 	var lastErr error
 	for dirPath, osdID := range dirs {
-		config := &osdConfig{id: osdID, configRoot: dirPath, dir: true, storeConfig: a.storeConfig,
-			kv: a.kv, storeName: config.GetConfigStoreName(a.nodeName)}
+		// a capacity configured for the directory overrides the capacity of all directories
+		storeConfig := a.storeConfig
+		if capacity, ok := a.dirCapacities[dirPath]; ok {
+			storeConfig.DirectoryCapacityMB = capacity
+		}
+
+		config := &osdConfig{id: osdID, configRoot: dirPath, dir: true, storeConfig: storeConfig,
+			deviceClass: a.storeConfig.DeviceClass, kv: a.kv, storeName: config.GetConfigStoreName(a.nodeName)}
 
 		if config.id == unassignedOSDID {
 			// the osd hasn't been registered with ceph yet, do so now to give it a cluster wide ID
@@ -98,6 +115,7 @@ func (a *OsdAgent) configureDirs(context *clusterd.Context, dirs map[string]int)
 			logger.Errorf("failed to config osd in path %s. %+v", dirPath, err)
 			lastErr = err
 		} else {
+			a.osdDirs[config.id] = config.rootPath
 			succeeded++
 		}
 	}
@@ -124,6 +142,7 @@ func (a *OsdAgent) removeDirs(context *clusterd.Context, removedDirs map[string]
 			errorMessages = append(errorMessages, errMsg)
 			continue
 		}
+		delete(a.osdDirs, osdID)
 	}
 
 	if len(errorMessages) > 0 {
@@ -158,6 +177,7 @@ func (a *OsdAgent) configureDevices(context *clusterd.Context, devices *DeviceOs
 	for _, entry := range scheme.Entries {
 		config := &osdConfig{id: entry.ID, uuid: entry.OsdUUID, configRoot: context.ConfigDir,
 			partitionScheme: entry, storeConfig: a.storeConfig, kv: a.kv, storeName: config.GetConfigStoreName(a.nodeName)}
+		config.deviceClass = a.getDeviceClass(context, config)
 		err := a.startOSD(context, config)
 		if err != nil {
 			return fmt.Errorf("failed to config osd %d. %+v", entry.ID, err)
@@ -170,6 +190,53 @@ func (a *OsdAgent) configureDevices(context *clusterd.Context, devices *DeviceOs
 	return nil
 }
 
+// getDeviceClass returns the crush device class for the OSD. A class configured for the data device takes
+// precedence over the class configured for the node. Otherwise the class is detected from the type of the device.
+func (a *OsdAgent) getDeviceClass(context *clusterd.Context, cfg *osdConfig) string {
+	dataDetails, err := getDataPartitionDetails(cfg)
+	if err != nil {
+		logger.Warningf("failed to get data partition details for osd %d. %+v", cfg.id, err)
+		return a.storeConfig.DeviceClass
+	}
+
+	var disk *sys.LocalDisk
+	for _, device := range context.Devices {
+		if device.Name == dataDetails.Device {
+			disk = device
+			break
+		}
+	}
+
+	if disk != nil {
+		for id, class := range a.deviceClasses {
+			if clusterd.MatchesDevice(disk, id) {
+				return class
+			}
+		}
+	}
+
+	if a.storeConfig.DeviceClass != "" {
+		return a.storeConfig.DeviceClass
+	}
+
+	if disk == nil {
+		// let ceph detect the class when the osd starts
+		return ""
+	}
+	return detectDeviceClass(disk)
+}
+
+// detectDeviceClass returns the default device class for the type of the given device
+func detectDeviceClass(disk *sys.LocalDisk) string {
+	if strings.HasPrefix(disk.Name, "nvme") {
+		return config.DeviceClassNVMe
+	}
+	if disk.Rotational {
+		return config.DeviceClassHDD
+	}
+	return config.DeviceClassSSD
+}
+
 func (a *OsdAgent) removeDevices(context *clusterd.Context, removedDevicesScheme *config.PerfScheme) error {
 	if removedDevicesScheme == nil || len(removedDevicesScheme.Entries) == 0 {
 		return nil
@@ -226,17 +293,25 @@ func (a *OsdAgent) getPartitionPerfScheme(context *clusterd.Context, devices *De
 		logger.Debugf("context.Device: %+v", device)
 	}
 
+	// the persistent IDs of the devices allow us to find devices in the scheme even after their kernel names changed
+	nameToPersistentID := map[string]string{}
+	for name, mapping := range devices.Entries {
+		if mapping.PersistentID != "" {
+			nameToPersistentID[name] = mapping.PersistentID
+		}
+	}
+
 	numDataNeeded := 0
 	var metadataEntry *DeviceOsdIDEntry
 
 	// enumerate the device to OSD mapping to see if we have any new data devices to create and any
 	// metadata devices to store their metadata on
 	for name, mapping := range devices.Entries {
-		if isDeviceInUse(name, nameToUUID, perfScheme) {
+		if isDeviceInUse(name, nameToUUID, nameToPersistentID, perfScheme) {
 			// device is already in use for either data or metadata, update the details for each of its partitions
 			// (i.e. device name could have changed)
 			logger.Infof("device %s (%s) is already in use", name, nameToUUID)
-			refreshDeviceInfo(name, nameToUUID, perfScheme)
+			refreshDeviceInfo(name, nameToUUID, nameToPersistentID, perfScheme)
 		} else if isDeviceDesiredForData(mapping) {
 			// device needs data partitioning
 			logger.Infof("configuring device %s (%s) for data", name, nameToUUID)
@@ -253,13 +328,21 @@ func (a *OsdAgent) getPartitionPerfScheme(context *clusterd.Context, devices *De
 
 			metadataEntry = mapping
 			perfScheme.Metadata = config.NewMetadataDeviceInfo(name)
+			perfScheme.Metadata.PersistentID = mapping.PersistentID
 		}
 	}
 
 	if numDataNeeded > 0 {
+		// compute the WAL and DB sizes of the new OSDs and validate that they fit before any OSD is registered
+		useMetadataDevice := metadataEntry != nil && perfScheme.Metadata != nil
+		metadataSizes, err := a.getMetadataSizes(context, devices, nameToUUID, nameToPersistentID, perfScheme, useMetadataDevice)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compute the metadata sizes of the new OSDs: %+v", err)
+		}
+
 		// register each data device and compute its desired partition scheme
 		for name, mapping := range devices.Entries {
-			if !isDeviceDesiredForData(mapping) || isDeviceInUse(name, nameToUUID, perfScheme) {
+			if !isDeviceDesiredForData(mapping) || isDeviceInUse(name, nameToUUID, nameToPersistentID, perfScheme) {
 				continue
 			}
 
@@ -273,13 +356,19 @@ func (a *OsdAgent) getPartitionPerfScheme(context *clusterd.Context, devices *De
 			schemeEntry.ID = *osdID
 			schemeEntry.OsdUUID = *osdUUID
 
-			if metadataEntry != nil && perfScheme.Metadata != nil {
+			storeConfig := a.storeConfig
+			if size, ok := metadataSizes[name]; ok {
+				storeConfig.WalSizeMB = size.WalSizeMB
+				storeConfig.DatabaseSizeMB = size.DatabaseSizeMB
+			}
+
+			if useMetadataDevice {
 				// we have a metadata device, so put the metadata partitions on it and the data partition on its own disk
 				metadataEntry.Metadata = append(metadataEntry.Metadata, *osdID)
 				mapping.Data = *osdID
 
 				// populate the perf partition scheme entry with distributed partition details
-				err := config.PopulateDistributedPerfSchemeEntry(schemeEntry, name, perfScheme.Metadata, a.storeConfig)
+				err := config.PopulateDistributedPerfSchemeEntry(schemeEntry, name, perfScheme.Metadata, storeConfig)
 				if err != nil {
 					return nil, fmt.Errorf("failed to create distributed perf scheme entry for %s: %+v", name, err)
 				}
@@ -291,12 +380,19 @@ func (a *OsdAgent) getPartitionPerfScheme(context *clusterd.Context, devices *De
 				mapping.Metadata = []int{*osdID}
 
 				// populate the perf partition scheme entry with collocated partition details
-				err := config.PopulateCollocatedPerfSchemeEntry(schemeEntry, name, a.storeConfig)
+				err := config.PopulateCollocatedPerfSchemeEntry(schemeEntry, name, storeConfig)
 				if err != nil {
 					return nil, fmt.Errorf("failed to create collocated perf scheme entry for %s: %+v", name, err)
 				}
 			}
 
+			// record the persistent ID of the data device so the OSD can be found again if the device name changes
+			for _, p := range schemeEntry.Partitions {
+				if p.Device == name {
+					p.PersistentID = mapping.PersistentID
+				}
+			}
+
 			perfScheme.Entries = append(perfScheme.Entries, schemeEntry)
 		}
 	}
@@ -304,9 +400,47 @@ func (a *OsdAgent) getPartitionPerfScheme(context *clusterd.Context, devices *De
 	return perfScheme, nil
 }
 
+// getMetadataSizes computes the WAL and DB sizes of the OSDs on the new data devices with the metadata size policy.
+// The sizes are based on the size of the data devices and the free space left on the metadata device.
+func (a *OsdAgent) getMetadataSizes(context *clusterd.Context, devices *DeviceOsdMapping, nameToUUID, nameToPersistentID map[string]string,
+	perfScheme *config.PerfScheme, useMetadataDevice bool) (map[string]config.MetadataSize, error) {
+
+	dataDevicesMB := map[string]int{}
+	for name, mapping := range devices.Entries {
+		if !isDeviceDesiredForData(mapping) || isDeviceInUse(name, nameToUUID, nameToPersistentID, perfScheme) {
+			continue
+		}
+		// the sizes are not validated against a device whose size is unknown
+		size, err := getDiskSize(context, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get size of data device %s. %+v", name, err)
+		}
+		dataDevicesMB[name] = int(size / bytesPerMB)
+	}
+
+	metadataAvailableMB := 0
+	if useMetadataDevice {
+		size, err := getDiskSize(context, perfScheme.Metadata.Device)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get size of metadata device %s. %+v", perfScheme.Metadata.Device, err)
+		}
+		offset := 1
+		if n := len(perfScheme.Metadata.Partitions); n > 0 {
+			last := perfScheme.Metadata.Partitions[n-1]
+			offset = last.OffsetMB + last.SizeMB
+		}
+		metadataAvailableMB = int(size/bytesPerMB) - offset
+		if metadataAvailableMB <= 0 {
+			return nil, fmt.Errorf("metadata device %s has no free space", perfScheme.Metadata.Device)
+		}
+	}
+
+	return config.ComputeMetadataSizes(a.storeConfig, dataDevicesMB, useMetadataDevice, metadataAvailableMB)
+}
+
 // determines if the given device name is already in use with existing/committed partitions
-func isDeviceInUse(name string, nameToUUID map[string]string, scheme *config.PerfScheme) bool {
-	parts := findPartitionsForDevice(name, nameToUUID, scheme)
+func isDeviceInUse(name string, nameToUUID, nameToPersistentID map[string]string, scheme *config.PerfScheme) bool {
+	parts := findPartitionsForDevice(name, nameToUUID, nameToPersistentID, scheme)
 	return len(parts) > 0
 }
 
@@ -324,21 +458,24 @@ func isDeviceDesiredForMetadata(mapping *DeviceOsdIDEntry, scheme *config.PerfSc
 	return mapping.Data == unassignedOSDID && mapping.Metadata != nil && len(mapping.Metadata) == 0
 }
 
-// finds all the partition details that are on the given device name
-func findPartitionsForDevice(name string, nameToUUID map[string]string, scheme *config.PerfScheme) []*config.PerfSchemePartitionDetails {
+// finds all the partition details that are on the given device name, matching on either the disk UUID or the
+// persistent ID of the device
+func findPartitionsForDevice(name string, nameToUUID, nameToPersistentID map[string]string,
+	scheme *config.PerfScheme) []*config.PerfSchemePartitionDetails {
 	if scheme == nil {
 		return nil
 	}
 
-	diskUUID, ok := nameToUUID[name]
-	if !ok {
+	diskUUID, hasUUID := nameToUUID[name]
+	persistentID := nameToPersistentID[name]
+	if !hasUUID && persistentID == "" {
 		return nil
 	}
 
 	parts := []*config.PerfSchemePartitionDetails{}
 	for _, e := range scheme.Entries {
 		for _, p := range e.Partitions {
-			if p.DiskUUID == diskUUID {
+			if (hasUUID && p.DiskUUID == diskUUID) || (persistentID != "" && p.PersistentID == persistentID) {
 				parts = append(parts, p)
 			}
 		}
@@ -347,24 +484,31 @@ func findPartitionsForDevice(name string, nameToUUID map[string]string, scheme *
 	return parts
 }
 
-// if a device name has changed, this function will find all partition entries with the device's static UUID and
-// then update the device name on them
-func refreshDeviceInfo(name string, nameToUUID map[string]string, scheme *config.PerfScheme) {
-	parts := findPartitionsForDevice(name, nameToUUID, scheme)
+// if a device name has changed, this function will find all partition entries with the device's static UUID or
+// persistent ID and then update the device name on them
+func refreshDeviceInfo(name string, nameToUUID, nameToPersistentID map[string]string, scheme *config.PerfScheme) {
+	parts := findPartitionsForDevice(name, nameToUUID, nameToPersistentID, scheme)
 	if len(parts) == 0 {
 		return
 	}
 
-	// make sure each partition that is using the given device has its most up to date name
+	// make sure each partition that is using the given device has its most up to date name. partitions created
+	// before persistent IDs were tracked will also have their persistent ID filled in.
+	persistentID := nameToPersistentID[name]
 	for _, p := range parts {
 		p.Device = name
+		if p.PersistentID == "" {
+			p.PersistentID = persistentID
+		}
 	}
 
 	// also update the device name if the given device is in use as the metadata device
 	if scheme.Metadata != nil {
-		if diskUUID, ok := nameToUUID[name]; ok {
-			if scheme.Metadata.DiskUUID == diskUUID {
-				scheme.Metadata.Device = name
+		diskUUID, ok := nameToUUID[name]
+		if (ok && scheme.Metadata.DiskUUID == diskUUID) || (persistentID != "" && scheme.Metadata.PersistentID == persistentID) {
+			scheme.Metadata.Device = name
+			if scheme.Metadata.PersistentID == "" {
+				scheme.Metadata.PersistentID = persistentID
 			}
 		}
 	}
@@ -432,6 +576,21 @@ func (a *OsdAgent) startOSD(context *clusterd.Context, cfg *osdConfig) error {
 		if err != nil {
 			return fmt.Errorf("failed to get OSD information from %s: %+v", cfg.rootPath, err)
 		}
+
+		if cfg.dir && cfg.storeConfig.DirectoryCapacityMB > 0 {
+			if err := a.capCrushWeight(context, cfg); err != nil {
+				logger.Warningf("failed to apply the capacity of osd %d to its crush weight. %+v", cfg.id, err)
+			}
+		}
+	}
+
+	if cfg.deviceClass != "" {
+		if err := client.CrushSetDeviceClass(context, a.cluster.Name, cfg.id, cfg.deviceClass); err != nil {
+			if newOSD {
+				return fmt.Errorf("failed to set device class of osd %d. %+v", cfg.id, err)
+			}
+			logger.Warningf("failed to update device class of osd %d. %+v", cfg.id, err)
+		}
 	}
 
 	// run the OSD in a child process now that it is fully initialized and ready to go
@@ -440,6 +599,37 @@ func (a *OsdAgent) startOSD(context *clusterd.Context, cfg *osdConfig) error {
 		return fmt.Errorf("failed to run osd %d: %+v", cfg.id, err)
 	}
 
+	if newOSD {
+		a.status.OSDsCreated = append(a.status.OSDsCreated, cfg.id)
+	}
+
+	return nil
+}
+
+// capCrushWeight lowers the crush weight of an existing OSD on a directory if the weight is more than its capacity
+func (a *OsdAgent) capCrushWeight(context *clusterd.Context, cfg *osdConfig) error {
+	weight, err := getOSDCrushWeight(context, cfg)
+	if err != nil {
+		return err
+	}
+
+	usage, err := client.GetOSDUsage(context, a.cluster.Name)
+	if err != nil {
+		return err
+	}
+	osd := usage.ByID(cfg.id)
+	if osd == nil {
+		return nil
+	}
+	current, err := osd.CrushWeight.Float64()
+	if err != nil || current <= weight {
+		return nil
+	}
+
+	logger.Infof("reducing the crush weight of osd %d from %.4f to %.4f for its capacity of %d MB", cfg.id, current, weight, cfg.storeConfig.DirectoryCapacityMB)
+	if o, err := client.CrushReweight(context, a.cluster.Name, cfg.id, weight); err != nil {
+		return fmt.Errorf("failed to reweight osd %d. %+v. %s", cfg.id, err, o)
+	}
 	return nil
 }
 
@@ -538,6 +728,7 @@ func (a *OsdAgent) removeOSD(context *clusterd.Context, config *osdConfig) error
 	if err := purgeOSD(context, a.cluster.Name, config.id); err != nil {
 		return fmt.Errorf("failed to purge osd.%d from the cluster: %+v", config.id, err)
 	}
+	a.status.OSDsRemoved = append(a.status.OSDsRemoved, config.id)
 
 	// delete any backups of the OSD filesystem
 	if err := deleteOSDFileSystem(config); err != nil {
@@ -234,10 +234,12 @@ func testOSDAgentWithDevicesHelper(t *testing.T, storeConfig config.StoreConfig)
 	assert.Equal(t, 2, len(agent.osdProc), fmt.Sprintf("procs=%+v", agent.osdProc))
 
 	if storeConfig.StoreType == config.Bluestore {
-		assert.Equal(t, 11, outputExecCount) // Bluestore has 2 extra output exec calls to get device properties of each device to determine CRUSH weight
-		assert.Equal(t, 5, execCount)        // 1 osd mkfs for sdx, 3 partition steps for sdy, 1 osd mkfs for sdy
+		// Bluestore has 2 extra output exec calls to get device properties of each device to determine CRUSH weight.
+		// Each device also has 3 calls to assign the detected device class.
+		assert.Equal(t, 17, outputExecCount)
+		assert.Equal(t, 5, execCount) // 1 osd mkfs for sdx, 3 partition steps for sdy, 1 osd mkfs for sdy
 	} else {
-		assert.Equal(t, 9, outputExecCount)
+		assert.Equal(t, 15, outputExecCount)
 		assert.Equal(t, 8, execCount) // 1 for remount sdx, 1 osd mkfs for sdx, 3 partition steps for sdy, 1 mkfs for sdy, 1 mount for sdy, 1 osd mkfs for sdy
 	}
 }
@@ -352,8 +354,8 @@ func createTestAgent(t *testing.T, devices, configDir, nodeName string, storeCon
 	}
 	cluster := &mon.ClusterInfo{Name: "myclust"}
 	context := &clusterd.Context{ConfigDir: configDir, Executor: executor, Clientset: testop.New(1)}
-	agent := NewAgent(context, devices, false, "", "", forceFormat, location, *storeConfig,
-		cluster, nodeName, mockKVStore())
+	agent := NewAgent(context, devices, false, nil, "", "", forceFormat, location, *storeConfig, map[string]string{},
+		map[string]int{}, cluster, nodeName, mockKVStore())
 
 	return agent, executor, context
 }
@@ -420,7 +422,7 @@ func TestGetPartitionPerfScheme(t *testing.T) {
 	}
 	context.Executor = executor
 
-	devices, err := getAvailableDevices(context, "sda,sdb", "sdc", false)
+	devices, err := getAvailableDevices(context, "sda,sdb", "sdc", false, nil)
 	assert.Nil(t, err)
 	scheme, err := a.getPartitionPerfScheme(context, devices)
 	assert.Nil(t, err)
@@ -497,7 +499,7 @@ func TestGetPartitionSchemeDiskInUse(t *testing.T) {
 
 	// get the partition scheme based on the available devices.  Since sda is already in use, the partition
 	// scheme returned should reflect that.
-	devices, err := getAvailableDevices(context, "sda", "", false)
+	devices, err := getAvailableDevices(context, "sda", "", false, nil)
 	scheme, err := a.getPartitionPerfScheme(context, devices)
 	assert.Nil(t, err)
 
@@ -565,7 +567,7 @@ func TestGetPartitionSchemeDiskNameChanged(t *testing.T) {
 
 	// get the current partition scheme.  This should notice that the device names changed and update the
 	// partition scheme to have the latest device names
-	devices, err := getAvailableDevices(context, "sda-changed", "nvme01", false)
+	devices, err := getAvailableDevices(context, "sda-changed", "nvme01", false, nil)
 	scheme, err := a.getPartitionPerfScheme(context, devices)
 	assert.Nil(t, err)
 	require.NotNil(t, scheme)
@@ -575,6 +577,101 @@ func TestGetPartitionSchemeDiskNameChanged(t *testing.T) {
 	assert.Equal(t, "nvme01", scheme.Entries[0].Partitions[config.DatabasePartitionType].Device)
 }
 
+func TestGetPartitionSchemePersistentID(t *testing.T) {
+	configDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temp config dir: %+v", err)
+	}
+	defer os.RemoveAll(configDir)
+
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			logger.Infof("Command: %s %v", command, args)
+			if command == "lsblk" || command == "udevadm" {
+				return "", nil
+			}
+			return "", fmt.Errorf("unexpected command %s %v", command, args)
+		},
+	}
+	context := &clusterd.Context{ConfigDir: configDir, Executor: executor}
+	persistentID := "/dev/disk/by-id/wwn-0x5000c500a1b2c3d4"
+	a := &OsdAgent{devices: persistentID, kv: mockKVStore()}
+
+	// setup an existing partition scheme for a device that was known as sda and record its persistent ID
+	entry, scheme, _ := mockPartitionSchemeEntry(t, 1, "sda", nil, a.kv, a.nodeName)
+	for _, p := range entry.Partitions {
+		p.PersistentID = persistentID
+	}
+	assert.Nil(t, scheme.SaveScheme(a.kv, config.GetConfigStoreName(a.nodeName)))
+
+	// after a reboot the device is known as sdc and its disk UUID is not available, but its by-id link is the same
+	context.Devices = []*sys.LocalDisk{
+		{Name: "sdc", Size: 107374182400, DevLinks: persistentID + " /dev/disk/by-path/pci-0000:00:1f.2-ata-3"},
+	}
+
+	devices, err := getAvailableDevices(context, persistentID, "", false, nil)
+	assert.Nil(t, err)
+	require.NotNil(t, devices.Entries["sdc"])
+	assert.Equal(t, persistentID, devices.Entries["sdc"].PersistentID)
+
+	// the OSD should be re-associated with the renamed device instead of a new OSD being created
+	scheme, err = a.getPartitionPerfScheme(context, devices)
+	assert.Nil(t, err)
+	require.NotNil(t, scheme)
+	assert.Equal(t, 1, len(scheme.Entries))
+	assert.Equal(t, 1, scheme.Entries[0].ID)
+	for _, p := range scheme.Entries[0].Partitions {
+		assert.Equal(t, "sdc", p.Device)
+		assert.Equal(t, persistentID, p.PersistentID)
+	}
+}
+
+func TestGetMetadataSizesUnknownSize(t *testing.T) {
+	a := &OsdAgent{storeConfig: config.StoreConfig{StoreType: config.Bluestore, MetadataSizePolicy: config.MetadataSizePolicyPercent, DatabaseSizePercent: 5}}
+	context := &clusterd.Context{Devices: []*sys.LocalDisk{{Name: "sda", Size: 107374182400}}}
+	devices := &DeviceOsdMapping{Entries: map[string]*DeviceOsdIDEntry{"sda": {Data: unassignedOSDID}}}
+
+	sizes, err := a.getMetadataSizes(context, devices, map[string]string{}, map[string]string{}, config.NewPerfScheme(), false)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(sizes))
+
+	// the sizes are not computed for a device whose size is unknown
+	devices.Entries["sdb"] = &DeviceOsdIDEntry{Data: unassignedOSDID}
+	_, err = a.getMetadataSizes(context, devices, map[string]string{}, map[string]string{}, config.NewPerfScheme(), false)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "sdb")
+}
+
+func TestGetDeviceClass(t *testing.T) {
+	context := &clusterd.Context{Devices: []*sys.LocalDisk{
+		{Name: "sda", Rotational: true, DevLinks: "/dev/disk/by-id/wwn-0x5000c500a1b2c3d4"},
+		{Name: "sdb", Rotational: false},
+		{Name: "nvme0n1", Rotational: false},
+	}}
+	a := &OsdAgent{deviceClasses: map[string]string{}}
+
+	newConfig := func(device string) *osdConfig {
+		entry := config.NewPerfSchemeEntry(config.Bluestore)
+		err := config.PopulateCollocatedPerfSchemeEntry(entry, device, config.StoreConfig{})
+		assert.Nil(t, err)
+		return &osdConfig{partitionScheme: entry}
+	}
+
+	// the class is detected from the type of the device
+	assert.Equal(t, "hdd", a.getDeviceClass(context, newConfig("sda")))
+	assert.Equal(t, "ssd", a.getDeviceClass(context, newConfig("sdb")))
+	assert.Equal(t, "nvme", a.getDeviceClass(context, newConfig("nvme0n1")))
+
+	// the node config overrides detection
+	a.storeConfig.DeviceClass = "fast"
+	assert.Equal(t, "fast", a.getDeviceClass(context, newConfig("sda")))
+
+	// the device config overrides the node config, matching the device by any of its names
+	a.deviceClasses["/dev/disk/by-id/wwn-0x5000c500a1b2c3d4"] = "archive"
+	assert.Equal(t, "archive", a.getDeviceClass(context, newConfig("sda")))
+	assert.Equal(t, "fast", a.getDeviceClass(context, newConfig("sdb")))
+}
+
 func TestPrepareOSDRoot(t *testing.T) {
 	configDir, _ := ioutil.TempDir("", "")
 	defer os.RemoveAll(configDir)
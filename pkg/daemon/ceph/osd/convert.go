@@ -0,0 +1,365 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	oposd "github.com/rook/rook/pkg/operator/ceph/cluster/osd"
+	"github.com/rook/rook/pkg/operator/ceph/cluster/osd/config"
+	"github.com/rook/rook/pkg/util/sys"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+var (
+	convertCleanInterval = 15 * time.Second
+	// the time an osd has to drain before its conversion is abandoned and the osd is marked in again
+	convertCleanTimeout = 6 * time.Hour
+)
+
+// loadConversionStatus returns the progress of the bluestore conversion saved in the orchestration status of the node
+// by a previous run of the agent, if any
+func (a *OsdAgent) loadConversionStatus(context *clusterd.Context) *cephv1alpha1.OSDConversionStatus {
+	statuses, err := oposd.GetOrchestrationStatus(context.Clientset, a.cluster.Name)
+	if err != nil {
+		logger.Warningf("failed to load the previous orchestration status of node %s. %+v", a.nodeName, err)
+		return nil
+	}
+	if status, ok := statuses[a.nodeName]; ok {
+		return status.Conversion
+	}
+	return nil
+}
+
+// resumeConversion finishes the conversion of an OSD that was interrupted after the OSD started to be destroyed. This
+// must be done before the devices are configured, otherwise the device of the OSD would look like a new device.
+func (a *OsdAgent) resumeConversion(context *clusterd.Context) error {
+	conversion := a.status.Conversion
+	if conversion == nil {
+		return nil
+	}
+
+	switch conversion.Phase {
+	case oposd.ConversionPhaseDraining:
+		if !a.storeConfig.ConvertToBluestore {
+			// the conversion was disabled before the osd was destroyed, bring it back in
+			logger.Infof("conversion to bluestore is disabled, marking osd %d in again", conversion.OSDID)
+			if o, err := client.OSDIn(context, a.cluster.Name, conversion.OSDID); err != nil {
+				return fmt.Errorf("failed to mark osd %d in. %+v. %s", conversion.OSDID, err, o)
+			}
+			conversion.Phase = ""
+		}
+		return nil
+	case oposd.ConversionPhaseDestroying:
+		logger.Infof("resuming the conversion of osd %d to bluestore", conversion.OSDID)
+		if err := a.destroyFilestoreOSD(context); err != nil {
+			return err
+		}
+		return a.provisionBluestoreOSD(context)
+	case oposd.ConversionPhaseProvisioning:
+		logger.Infof("resuming the conversion of osd %d to bluestore", conversion.OSDID)
+		return a.provisionBluestoreOSD(context)
+	}
+	return nil
+}
+
+// convertToBluestore converts the filestore OSDs on the devices of the node to bluestore, one OSD at a time. Each OSD
+// is drained before it is destroyed and re-provisioned as bluestore on the same device with the same ID.
+func (a *OsdAgent) convertToBluestore(context *clusterd.Context) error {
+	scheme, err := config.LoadScheme(a.kv, config.GetConfigStoreName(a.nodeName))
+	if err != nil {
+		return fmt.Errorf("failed to load the saved partition scheme: %+v", err)
+	}
+
+	for _, entry := range scheme.Entries {
+		if entry.StoreType != config.Filestore {
+			continue
+		}
+		dataDetails, ok := entry.Partitions[config.FilestoreDataPartitionType]
+		if !ok {
+			return fmt.Errorf("osd %d has no data partition", entry.ID)
+		}
+
+		if a.status.Conversion == nil {
+			a.status.Conversion = &cephv1alpha1.OSDConversionStatus{}
+		}
+		a.status.Conversion.OSDID = entry.ID
+		a.status.Conversion.Device = dataDetails.Device
+
+		logger.Infof("converting osd %d on device %s to bluestore", entry.ID, dataDetails.Device)
+		if err := a.drainOSD(context); err != nil {
+			return err
+		}
+		if err := a.destroyFilestoreOSD(context); err != nil {
+			return err
+		}
+		if err := a.provisionBluestoreOSD(context); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// drainOSD marks the OSD out and waits for its data to be moved to the other OSDs
+func (a *OsdAgent) drainOSD(context *clusterd.Context) error {
+	id := a.status.Conversion.OSDID
+	if err := a.setConversionPhase(context, oposd.ConversionPhaseDraining); err != nil {
+		return err
+	}
+
+	if err := markOSDOut(context, a.cluster.Name, id); err != nil {
+		return fmt.Errorf("failed to mark osd %d out: %+v", id, err)
+	}
+
+	err := wait.Poll(convertCleanInterval, convertCleanTimeout, func() (bool, error) {
+		if err := client.IsClusterClean(context, a.cluster.Name); err != nil {
+			logger.Infof("waiting for the data of osd %d to be moved. %+v", id, err)
+			a.reportDrainProgress(context, err)
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		// give up on the conversion of the osd rather than leaving it out indefinitely. the conversion is tried again
+		// by the next orchestration of the node.
+		if o, inErr := client.OSDIn(context, a.cluster.Name, id); inErr != nil {
+			logger.Warningf("failed to mark osd %d in after its conversion was abandoned. %+v. %s", id, inErr, o)
+		}
+		a.status.Conversion.Phase = ""
+		return fmt.Errorf("cluster did not become clean within %v after marking osd %d out, abandoned its conversion. %+v",
+			convertCleanTimeout, id, err)
+	}
+	return nil
+}
+
+// reportDrainProgress saves the state of the placement groups in the orchestration status while the OSD drains, so
+// the operator can tell that the conversion is making progress
+func (a *OsdAgent) reportDrainProgress(context *clusterd.Context, progress error) {
+	conversion := a.status.Conversion
+	message := fmt.Sprintf("converting osd %d on device %s to bluestore: %s. %+v", conversion.OSDID, conversion.Device, conversion.Phase, progress)
+	if message == a.status.Message {
+		return
+	}
+	a.status.Message = message
+	if err := a.updateStatus(context, oposd.OrchestrationStatusOrchestrating); err != nil {
+		logger.Warningf("failed to report the drain progress of osd %d. %+v", conversion.OSDID, err)
+	}
+}
+
+// destroyFilestoreOSD stops the OSD and destroys it, keeping its ID so it can be reused
+func (a *OsdAgent) destroyFilestoreOSD(context *clusterd.Context) error {
+	id := a.status.Conversion.OSDID
+	if err := a.setConversionPhase(context, oposd.ConversionPhaseDestroying); err != nil {
+		return err
+	}
+
+	if proc, ok := a.osdProc[id]; ok {
+		if err := proc.Stop(false); err != nil {
+			return fmt.Errorf("failed to stop osd %d: %+v", id, err)
+		}
+		delete(a.osdProc, id)
+	}
+
+	rootPath := getOSDRootDir(context.ConfigDir, id)
+	if err := sys.UnmountDevice(rootPath, context.Executor); err != nil {
+		logger.Warningf("failed to unmount the filestore data of osd %d at %s. %+v", id, rootPath, err)
+	}
+
+	if o, err := client.OSDDestroy(context, a.cluster.Name, id); err != nil {
+		return fmt.Errorf("failed to destroy osd %d: %+v. %s", id, err, o)
+	}
+
+	if err := os.RemoveAll(rootPath); err != nil {
+		logger.Warningf("failed to delete osd %d root dir at %s. %+v", id, rootPath, err)
+	}
+	return nil
+}
+
+// provisionBluestoreOSD partitions the device of a destroyed OSD for bluestore and starts the new OSD with the same ID
+func (a *OsdAgent) provisionBluestoreOSD(context *clusterd.Context) error {
+	conversion := a.status.Conversion
+	if err := a.setConversionPhase(context, oposd.ConversionPhaseProvisioning); err != nil {
+		return err
+	}
+
+	storeConfig := a.storeConfig
+	storeConfig.StoreType = config.Bluestore
+	storeName := config.GetConfigStoreName(a.nodeName)
+
+	scheme, err := config.LoadScheme(a.kv, storeName)
+	if err != nil {
+		return fmt.Errorf("failed to load the saved partition scheme: %+v", err)
+	}
+	var entry *config.PerfSchemeEntry
+	for _, e := range scheme.Entries {
+		if e.ID == conversion.OSDID {
+			entry = e
+			break
+		}
+	}
+
+	if entry == nil || entry.StoreType == config.Filestore {
+		// the bluestore osd is collocated on the data device, the partitions of the filestore osd on other devices
+		// would be leaked
+		if err := a.removeOtherDevicePartitions(context, scheme, entry, storeName); err != nil {
+			return err
+		}
+	}
+	if entry != nil && entry.StoreType == config.Filestore {
+		// the filestore partitions on the data device are replaced when the device is partitioned for bluestore
+		if err := config.RemoveFromScheme(entry, a.kv, storeName); err != nil {
+			return err
+		}
+		entry = nil
+	}
+	if entry == nil {
+		osdUUID, err := uuid.NewRandom()
+		if err != nil {
+			return fmt.Errorf("failed to generate UUID for osd: %+v", err)
+		}
+		entry = config.NewPerfSchemeEntry(config.Bluestore)
+		entry.ID = conversion.OSDID
+		entry.OsdUUID = osdUUID
+		if err := config.PopulateCollocatedPerfSchemeEntry(entry, conversion.Device, storeConfig); err != nil {
+			return fmt.Errorf("failed to create the bluestore partition scheme of osd %d: %+v", entry.ID, err)
+		}
+	}
+
+	// the new osd takes the place of the destroyed osd
+	if o, err := client.OSDNew(context, a.cluster.Name, entry.OsdUUID.String(), entry.ID); err != nil {
+		return fmt.Errorf("failed to create osd %d with uuid %s: %+v. %s", entry.ID, entry.OsdUUID.String(), err, o)
+	}
+
+	cfg := &osdConfig{id: entry.ID, uuid: entry.OsdUUID, configRoot: context.ConfigDir,
+		partitionScheme: entry, storeConfig: storeConfig, kv: a.kv, storeName: storeName}
+	cfg.deviceClass = a.getDeviceClass(context, cfg)
+	if err := a.startOSD(context, cfg); err != nil {
+		return fmt.Errorf("failed to start bluestore osd %d: %+v", entry.ID, err)
+	}
+
+	if o, err := client.OSDIn(context, a.cluster.Name, entry.ID); err != nil {
+		return fmt.Errorf("failed to mark osd %d in: %+v. %s", entry.ID, err, o)
+	}
+
+	logger.Infof("osd %d converted to bluestore", entry.ID)
+	conversion.Converted = append(conversion.Converted, entry.ID)
+	return a.setConversionPhase(context, oposd.ConversionPhaseCompleted)
+}
+
+// removeOtherDevicePartitions deletes the partitions of the OSD being converted that are not on its data device, such
+// as a journal on the metadata device, and removes them from the metadata device in the partition scheme
+func (a *OsdAgent) removeOtherDevicePartitions(context *clusterd.Context, scheme *config.PerfScheme, entry *config.PerfSchemeEntry,
+	storeName string) error {
+
+	conversion := a.status.Conversion
+	devices := map[string]bool{}
+	if entry != nil {
+		for _, details := range entry.Partitions {
+			if details.Device != conversion.Device {
+				devices[details.Device] = true
+			}
+		}
+	}
+	var metadataPartitions []*config.MetadataDevicePartition
+	if scheme.Metadata != nil {
+		for _, part := range scheme.Metadata.Partitions {
+			if part.ID == conversion.OSDID {
+				devices[scheme.Metadata.Device] = true
+			} else {
+				metadataPartitions = append(metadataPartitions, part)
+			}
+		}
+	}
+
+	labelPrefix := fmt.Sprintf("ROOK-OSD%d-", conversion.OSDID)
+	for device := range devices {
+		partitions, _, err := sys.GetDevicePartitions(device, context.Executor)
+		if err != nil {
+			return fmt.Errorf("failed to get the partitions of device %s: %+v", device, err)
+		}
+		for _, part := range partitions {
+			if !strings.HasPrefix(part.Label, labelPrefix) {
+				continue
+			}
+			number, err := partitionNumber(part.Name)
+			if err != nil {
+				return err
+			}
+			logger.Infof("deleting partition %s of osd %d on device %s", part.Label, conversion.OSDID, device)
+			if err := sys.DeletePartition(device, number, context.Executor); err != nil {
+				return err
+			}
+		}
+	}
+
+	if scheme.Metadata != nil && len(metadataPartitions) != len(scheme.Metadata.Partitions) {
+		scheme.Metadata.Partitions = metadataPartitions
+		if err := scheme.SaveScheme(a.kv, storeName); err != nil {
+			return fmt.Errorf("failed to save partition scheme: %+v", err)
+		}
+	}
+	return nil
+}
+
+// partitionNumber returns the number of a partition from its kernel name, such as 3 for sdc3 or nvme0n1p3
+func partitionNumber(name string) (int, error) {
+	i := len(name)
+	for i > 0 && unicode.IsDigit(rune(name[i-1])) {
+		i--
+	}
+	number, err := strconv.Atoi(name[i:])
+	if err != nil {
+		return 0, fmt.Errorf("failed to get the number of partition %s", name)
+	}
+	return number, nil
+}
+
+// finishConversion clears the conversion progress from the orchestration status once no OSD is being converted, so a
+// completed or abandoned conversion is not carried forward in the status of the node
+func (a *OsdAgent) finishConversion(context *clusterd.Context) error {
+	conversion := a.status.Conversion
+	if conversion == nil || (conversion.Phase != oposd.ConversionPhaseCompleted && conversion.Phase != "") {
+		return nil
+	}
+
+	if len(conversion.Converted) > 0 {
+		logger.Infof("osds %v were converted to bluestore", conversion.Converted)
+	}
+	a.status.Conversion = nil
+	return oposd.ClearConversionStatus(context.Clientset, a.cluster.Name, a.nodeName, a.status)
+}
+
+// setConversionPhase saves the conversion phase in the orchestration status so the conversion can be resumed
+func (a *OsdAgent) setConversionPhase(context *clusterd.Context, phase string) error {
+	conversion := a.status.Conversion
+	conversion.Phase = phase
+	if phase == oposd.ConversionPhaseCompleted {
+		a.status.Message = ""
+	} else {
+		a.status.Message = fmt.Sprintf("converting osd %d on device %s to bluestore: %s", conversion.OSDID, conversion.Device, phase)
+	}
+	return a.updateStatus(context, oposd.OrchestrationStatusOrchestrating)
+}
@@ -0,0 +1,264 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	oposd "github.com/rook/rook/pkg/operator/ceph/cluster/osd"
+	"github.com/rook/rook/pkg/operator/ceph/cluster/osd/config"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConvertToBluestore(t *testing.T) {
+	convertCleanInterval = time.Millisecond
+	defer func() { convertCleanInterval = 15 * time.Second }()
+
+	configDir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(configDir)
+
+	nodeName := "node3829"
+	agent, executor, context := createTestAgent(t, "sdx", configDir, nodeName,
+		&config.StoreConfig{StoreType: config.Filestore, ConvertToBluestore: true})
+	commands := mockConvertExecutor(t, executor, configDir)
+	mockPartitionSchemeEntry(t, 23, "sdx", &agent.storeConfig, agent.kv, nodeName)
+
+	err := agent.convertToBluestore(context)
+	assert.Nil(t, err)
+
+	// the osd is drained, destroyed and recreated with the same id
+	assert.Equal(t, 4, len(*commands))
+	assert.Equal(t, "osd out 23", (*commands)[0])
+	assert.Equal(t, "osd destroy 23 --yes-i-really-mean-it", (*commands)[1])
+	assert.True(t, strings.HasPrefix((*commands)[2], "osd new "))
+	assert.True(t, strings.HasSuffix((*commands)[2], " 23"))
+	assert.Equal(t, "osd in 23", (*commands)[3])
+	assert.Equal(t, 1, len(agent.osdProc))
+
+	scheme, err := config.LoadScheme(agent.kv, config.GetConfigStoreName(nodeName))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(scheme.Entries))
+	assert.Equal(t, 23, scheme.Entries[0].ID)
+	assert.Equal(t, config.Bluestore, scheme.Entries[0].StoreType)
+
+	// the progress is saved in the orchestration status
+	statuses, err := oposd.GetOrchestrationStatus(context.Clientset, agent.cluster.Name)
+	assert.Nil(t, err)
+	conversion := statuses[nodeName].Conversion
+	assert.NotNil(t, conversion)
+	assert.Equal(t, oposd.ConversionPhaseCompleted, conversion.Phase)
+	assert.Equal(t, []int{23}, conversion.Converted)
+
+	// there is nothing left to convert
+	*commands = nil
+	err = agent.convertToBluestore(context)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(*commands))
+
+	// the completed conversion is cleared from the status
+	assert.Nil(t, agent.finishConversion(context))
+	assert.Nil(t, agent.status.Conversion)
+	assert.Nil(t, oposd.UpdateOrchestrationStatusMap(context.Clientset, agent.cluster.Name, nodeName, agent.status))
+	statuses, err = oposd.GetOrchestrationStatus(context.Clientset, agent.cluster.Name)
+	assert.Nil(t, err)
+	assert.Nil(t, statuses[nodeName].Conversion)
+}
+
+func TestConvertDrainTimeout(t *testing.T) {
+	convertCleanInterval = time.Millisecond
+	convertCleanTimeout = 10 * time.Millisecond
+	defer func() {
+		convertCleanInterval = 15 * time.Second
+		convertCleanTimeout = 6 * time.Hour
+	}()
+
+	configDir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(configDir)
+
+	nodeName := "node3830"
+	agent, executor, context := createTestAgent(t, "sdx", configDir, nodeName,
+		&config.StoreConfig{StoreType: config.Filestore, ConvertToBluestore: true})
+	commands := mockConvertExecutor(t, executor, configDir)
+	mockPartitionSchemeEntry(t, 23, "sdx", &agent.storeConfig, agent.kv, nodeName)
+	status := executor.MockExecuteCommandWithOutputFile
+	executor.MockExecuteCommandWithOutputFile = func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+		if args[0] == "status" {
+			return `{"pgmap":{"num_pgs":100,"pgs_by_state":[{"state_name":"active+remapped+backfilling","count":100}]}}`, nil
+		}
+		return status(debug, actionName, command, outFileArg, args...)
+	}
+
+	// the osd that does not drain in time is marked in again and is not destroyed
+	err := agent.convertToBluestore(context)
+	assert.NotNil(t, err)
+	assert.Equal(t, []string{"osd out 23", "osd in 23"}, *commands)
+	assert.Equal(t, "", agent.status.Conversion.Phase)
+	assert.Equal(t, 0, len(agent.osdProc))
+
+	// the drain progress was reported in the orchestration status
+	statuses, err := oposd.GetOrchestrationStatus(context.Clientset, agent.cluster.Name)
+	assert.Nil(t, err)
+	assert.Contains(t, statuses[nodeName].Message, "active+remapped+backfilling")
+}
+
+func TestConvertRemovesMetadataPartitions(t *testing.T) {
+	convertCleanInterval = time.Millisecond
+	defer func() { convertCleanInterval = 15 * time.Second }()
+
+	configDir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(configDir)
+
+	nodeName := "node3831"
+	agent, executor, context := createTestAgent(t, "sdx", configDir, nodeName,
+		&config.StoreConfig{StoreType: config.Filestore, ConvertToBluestore: true})
+	mockConvertExecutor(t, executor, configDir)
+	_, scheme, _ := mockPartitionSchemeEntry(t, 23, "sdx", &agent.storeConfig, agent.kv, nodeName)
+
+	// the journal of the osd and a partition of another osd are on the metadata device
+	scheme.Metadata = config.NewMetadataDeviceInfo("sdm")
+	scheme.Metadata.Partitions = []*config.MetadataDevicePartition{{ID: 24, SizeMB: 1024, OffsetMB: 1}, {ID: 23, SizeMB: 1024, OffsetMB: 1025}}
+	assert.Nil(t, scheme.SaveScheme(agent.kv, config.GetConfigStoreName(nodeName)))
+
+	var deleted []string
+	executor.MockExecuteCommand = func(debug bool, name string, command string, args ...string) error {
+		if command == "sgdisk" && strings.HasPrefix(args[0], "--delete") {
+			deleted = append(deleted, strings.Join(args, " "))
+		}
+		if len(args) > 0 && args[0] == "--mkfs" {
+			createTestKeyring(t, configDir, args)
+		}
+		return nil
+	}
+	mockOutput := executor.MockExecuteCommandWithOutput
+	executor.MockExecuteCommandWithOutput = func(debug bool, actionName string, command string, args ...string) (string, error) {
+		switch actionName {
+		case "lsblk /dev/sdm":
+			return `NAME="sdm" SIZE="10000000000" TYPE="disk" PKNAME=""
+NAME="sdm1" SIZE="1073741824" TYPE="part" PKNAME="sdm"
+NAME="sdm2" SIZE="1073741824" TYPE="part" PKNAME="sdm"`, nil
+		case "udevadm /dev/sdm1":
+			return "ID_PART_ENTRY_NAME=ROOK-OSD24-WAL", nil
+		case "udevadm /dev/sdm2":
+			return "ID_PART_ENTRY_NAME=ROOK-OSD23-WAL", nil
+		}
+		return mockOutput(debug, actionName, command, args...)
+	}
+
+	assert.Nil(t, agent.convertToBluestore(context))
+
+	// only the partition of the converted osd is deleted
+	assert.Equal(t, []string{"--delete=2 /dev/sdm"}, deleted)
+	scheme, err := config.LoadScheme(agent.kv, config.GetConfigStoreName(nodeName))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(scheme.Metadata.Partitions))
+	assert.Equal(t, 24, scheme.Metadata.Partitions[0].ID)
+	assert.Equal(t, 1, len(scheme.Entries))
+	assert.Equal(t, config.Bluestore, scheme.Entries[0].StoreType)
+}
+
+func TestPartitionNumber(t *testing.T) {
+	number, err := partitionNumber("sdc3")
+	assert.Nil(t, err)
+	assert.Equal(t, 3, number)
+	number, err = partitionNumber("nvme0n1p12")
+	assert.Nil(t, err)
+	assert.Equal(t, 12, number)
+	_, err = partitionNumber("sdc")
+	assert.NotNil(t, err)
+}
+
+func TestResumeConversion(t *testing.T) {
+	configDir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(configDir)
+
+	nodeName := "node3830"
+	agent, executor, context := createTestAgent(t, "sdx", configDir, nodeName,
+		&config.StoreConfig{StoreType: config.Filestore, ConvertToBluestore: true})
+	commands := mockConvertExecutor(t, executor, configDir)
+	mockPartitionSchemeEntry(t, 23, "sdx", &agent.storeConfig, agent.kv, nodeName)
+
+	// nothing to resume
+	assert.Nil(t, agent.resumeConversion(context))
+	assert.Equal(t, 0, len(*commands))
+
+	// a draining osd is converted later with the other osds
+	agent.status.Conversion = &cephv1alpha1.OSDConversionStatus{OSDID: 23, Device: "sdx", Phase: oposd.ConversionPhaseDraining}
+	assert.Nil(t, agent.resumeConversion(context))
+	assert.Equal(t, 0, len(*commands))
+
+	// a draining osd is brought back in if the conversion was disabled
+	agent.storeConfig.ConvertToBluestore = false
+	assert.Nil(t, agent.resumeConversion(context))
+	assert.Equal(t, []string{"osd in 23"}, *commands)
+	assert.Equal(t, "", agent.status.Conversion.Phase)
+
+	// a destroyed osd is provisioned again even if the conversion was disabled
+	*commands = nil
+	agent.status.Conversion = &cephv1alpha1.OSDConversionStatus{OSDID: 23, Device: "sdx", Phase: oposd.ConversionPhaseProvisioning}
+	assert.Nil(t, agent.resumeConversion(context))
+	assert.Equal(t, 2, len(*commands))
+	assert.True(t, strings.HasPrefix((*commands)[0], "osd new "))
+	assert.Equal(t, "osd in 23", (*commands)[1])
+	assert.Equal(t, oposd.ConversionPhaseCompleted, agent.status.Conversion.Phase)
+
+	scheme, err := config.LoadScheme(agent.kv, config.GetConfigStoreName(nodeName))
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(scheme.Entries))
+	assert.Equal(t, config.Bluestore, scheme.Entries[0].StoreType)
+}
+
+// mockConvertExecutor mocks the commands to provision a bluestore osd and returns the osd state changes that were run
+func mockConvertExecutor(t *testing.T, executor *exectest.MockExecutor, configDir string) *[]string {
+	var commands []string
+	executor.MockStartExecuteCommand = func(debug bool, name string, command string, args ...string) (*exec.Cmd, error) {
+		return &exec.Cmd{Args: append([]string{command}, args...)}, nil
+	}
+	executor.MockExecuteCommand = func(debug bool, name string, command string, args ...string) error {
+		if len(args) > 0 && args[0] == "--mkfs" {
+			createTestKeyring(t, configDir, args)
+		}
+		return nil
+	}
+	executor.MockExecuteCommandWithOutput = func(debug bool, actionName string, command string, args ...string) (string, error) {
+		if strings.HasPrefix(actionName, "lsblk /dev/disk/by-partuuid") {
+			return `SIZE="1234567890" TYPE="part"`, nil
+		}
+		return "", nil
+	}
+	executor.MockExecuteCommandWithOutputFile = func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+		if args[0] == "status" {
+			return `{"pgmap":{"num_pgs":100,"pgs_by_state":[{"state_name":"active+clean","count":100}]}}`, nil
+		}
+		if args[0] == "auth" && args[1] == "get-or-create-key" {
+			return `{"key":"mysecurekey"}`, nil
+		}
+		if args[0] == "osd" {
+			switch args[1] {
+			case "out", "destroy", "new", "in":
+				commands = append(commands, strings.Join(args, " "))
+			}
+		}
+		return "", nil
+	}
+	return &commands
+}
@@ -71,3 +71,22 @@ func testCrushMapHelper(t *testing.T, storeConfig *config.StoreConfig) {
 	err := addOSDToCrushMap(context, cfg, "rook", location)
 	assert.Nil(t, err)
 }
+
+func TestCrushMapWeightRampUp(t *testing.T) {
+	kv := mockKVStore()
+	storeName := config.GetConfigStoreName("node1")
+	executor := &exectest.MockExecutor{}
+	executor.MockExecuteCommandWithOutput = func(debug bool, name string, command string, args ...string) (string, error) {
+		// the full weight is saved before the osd is added with a fraction of it
+		weights, err := config.LoadWeightRampUp(kv, storeName)
+		assert.Nil(t, err)
+		assert.NotEqual(t, 0.0, weights[23])
+		assert.Equal(t, "create-or-move", args[2])
+		return "", nil
+	}
+	context := &clusterd.Context{Executor: executor}
+
+	cfg := &osdConfig{id: 23, rootPath: "/", storeConfig: config.StoreConfig{WeightRampUpSteps: 4}, kv: kv, storeName: storeName}
+	err := addOSDToCrushMap(context, cfg, "rook", "root=default,host=node1")
+	assert.Nil(t, err)
+}
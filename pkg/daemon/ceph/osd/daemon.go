@@ -19,11 +19,14 @@ import (
 	"fmt"
 	"path"
 	"regexp"
+	"sort"
 	"time"
 
 	"strings"
 
 	"github.com/coreos/pkg/capnslog"
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
 	"github.com/rook/rook/pkg/clusterd"
 	"github.com/rook/rook/pkg/daemon/ceph/client"
 	"github.com/rook/rook/pkg/daemon/ceph/mon"
@@ -32,15 +35,26 @@ import (
 	"github.com/rook/rook/pkg/operator/k8sutil"
 	"github.com/rook/rook/pkg/util/sys"
 	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 var logger = capnslog.NewPackageLogger("github.com/rook/rook", "cephosd")
 
+// reasons reported in the orchestration status for devices that are not used by an OSD
+const (
+	skipReasonHasFilesystem = "device has a filesystem"
+	skipReasonHasPartitions = "device has partitions not created by rook"
+	skipReasonFiltered      = "device does not match the device filter or list"
+	skipReasonNotSelected   = "no devices were selected for the node"
+	skipReasonNotInSelector = "device does not have the properties of the device selector"
+)
+
 func Run(context *clusterd.Context, agent *OsdAgent, done chan struct{}) error {
 
-	// set the initial orchestration status
-	status := oposd.OrchestrationStatus{Status: oposd.OrchestrationStatusComputingDiff}
-	if err := oposd.UpdateOrchestrationStatusMap(context.Clientset, agent.cluster.Name, agent.nodeName, status); err != nil {
+	// set the initial orchestration status, keeping the progress of a conversion to bluestore
+	startTime := metav1.Now()
+	agent.status = oposd.OrchestrationStatus{StartTime: &startTime, Conversion: agent.loadConversionStatus(context)}
+	if err := agent.updateStatus(context, oposd.OrchestrationStatusComputingDiff); err != nil {
 		return err
 	}
 
@@ -63,10 +77,11 @@ func Run(context *clusterd.Context, agent *OsdAgent, done chan struct{}) error {
 	logger.Infof("creating and starting the osds")
 
 	// determine the set of devices that can/should be used for OSDs.
-	devices, err := getAvailableDevices(context, agent.devices, agent.metadataDevice, agent.usingDeviceFilter)
+	devices, err := getAvailableDevices(context, agent.devices, agent.metadataDevice, agent.usingDeviceFilter, agent.deviceSelector)
 	if err != nil {
 		return fmt.Errorf("failed to get available devices. %+v", err)
 	}
+	agent.status.Devices = getDeviceStatus(devices)
 
 	// determine the set of removed OSDs and the node's crush name (if needed)
 	removedDevicesScheme, removedDevicesMapping, err := getRemovedDevices(agent)
@@ -90,11 +105,15 @@ func Run(context *clusterd.Context, agent *OsdAgent, done chan struct{}) error {
 	}
 
 	// orchestration is about to start, update the status
-	status = oposd.OrchestrationStatus{Status: oposd.OrchestrationStatusOrchestrating}
-	if err := oposd.UpdateOrchestrationStatusMap(context.Clientset, agent.cluster.Name, agent.nodeName, status); err != nil {
+	if err := agent.updateStatus(context, oposd.OrchestrationStatusOrchestrating); err != nil {
 		return err
 	}
 
+	// finish the conversion of an osd to bluestore that was interrupted
+	if err := agent.resumeConversion(context); err != nil {
+		return fmt.Errorf("failed to resume the conversion to bluestore. %+v", err)
+	}
+
 	// start the desired OSDs on devices
 	logger.Infof("configuring osd devices: %+v", devices)
 	if err := agent.configureDevices(context, devices); err != nil {
@@ -138,6 +157,16 @@ func Run(context *clusterd.Context, agent *OsdAgent, done chan struct{}) error {
 		return fmt.Errorf("failed to save osd dir map. %+v", err)
 	}
 
+	if agent.storeConfig.ConvertToBluestore && !oposd.IsRemovingNode(agent.devices) {
+		logger.Info("converting filestore osds to bluestore")
+		if err := agent.convertToBluestore(context); err != nil {
+			return fmt.Errorf("failed to convert osds to bluestore. %+v", err)
+		}
+	}
+	if err := agent.finishConversion(context); err != nil {
+		return fmt.Errorf("failed to clear the conversion status. %+v", err)
+	}
+
 	if oposd.IsRemovingNode(agent.devices) {
 		if err := cleanUpNodeResources(context, agent, nodeCrushName); err != nil {
 			logger.Warningf("failed to clean up node resources, they may need to be cleaned up manually: %+v", err)
@@ -145,8 +174,7 @@ func Run(context *clusterd.Context, agent *OsdAgent, done chan struct{}) error {
 	}
 
 	// orchestration is completed, update the status
-	status = oposd.OrchestrationStatus{Status: oposd.OrchestrationStatusCompleted}
-	if err := oposd.UpdateOrchestrationStatusMap(context.Clientset, agent.cluster.Name, agent.nodeName, status); err != nil {
+	if err := agent.updateStatus(context, oposd.OrchestrationStatusCompleted); err != nil {
 		return err
 	}
 
@@ -154,6 +182,9 @@ func Run(context *clusterd.Context, agent *OsdAgent, done chan struct{}) error {
 	mon := NewMonitor(context, agent)
 	go mon.Run()
 
+	// increase the weight of new osds gradually
+	go agent.rampUpWeights(context)
+
 	// FIX
 	logger.Infof("sleeping a while to let the osds run...")
 	select {
@@ -166,14 +197,15 @@ func Run(context *clusterd.Context, agent *OsdAgent, done chan struct{}) error {
 	return nil
 }
 
-func getAvailableDevices(context *clusterd.Context, desiredDevices string, metadataDevice string, usingDeviceFilter bool) (*DeviceOsdMapping, error) {
+func getAvailableDevices(context *clusterd.Context, desiredDevices string, metadataDevice string, usingDeviceFilter bool,
+	selector *rookalpha.DeviceSelector) (*DeviceOsdMapping, error) {
 
 	var deviceList []string
 	if !usingDeviceFilter {
 		deviceList = strings.Split(desiredDevices, ",")
 	}
 
-	available := &DeviceOsdMapping{Entries: map[string]*DeviceOsdIDEntry{}}
+	available := &DeviceOsdMapping{Entries: map[string]*DeviceOsdIDEntry{}, Skipped: map[string]string{}}
 
 	if oposd.IsRemovingNode(desiredDevices) {
 		// the node is being removed, just return an empty set
@@ -192,15 +224,24 @@ func getAvailableDevices(context *clusterd.Context, desiredDevices string, metad
 		if fs != "" || !ownPartitions {
 			// not OK to use the device because it has a filesystem or rook doesn't own all its partitions
 			logger.Infof("skipping device %s that is in use (not by rook). fs: %s, ownPartitions: %t", device.Name, fs, ownPartitions)
+			if fs != "" {
+				available.Skipped[device.Name] = fmt.Sprintf("%s: %s", skipReasonHasFilesystem, fs)
+			} else {
+				available.Skipped[device.Name] = skipReasonHasPartitions
+			}
 			continue
 		}
 
-		if metadataDevice != "" && metadataDevice == device.Name {
+		persistentID := clusterd.GetPersistentDeviceID(device)
+		if metadataDevice != "" && clusterd.MatchesDevice(device, metadataDevice) {
 			// current device is desired as the metadata device
-			available.Entries[device.Name] = &DeviceOsdIDEntry{Data: unassignedOSDID, Metadata: []int{}}
+			available.Entries[device.Name] = &DeviceOsdIDEntry{Data: unassignedOSDID, Metadata: []int{}, PersistentID: persistentID}
+		} else if usingDeviceFilter && selector != nil && !matchesSelector(device, selector) {
+			// the device matches the filter (or all devices) but not the properties of the selector
+			available.Skipped[device.Name] = skipReasonNotInSelector
 		} else if desiredDevices == "all" {
 			// user has specified all devices, use the current one for data
-			available.Entries[device.Name] = &DeviceOsdIDEntry{Data: unassignedOSDID}
+			available.Entries[device.Name] = &DeviceOsdIDEntry{Data: unassignedOSDID, PersistentID: persistentID}
 		} else if desiredDevices != "" {
 			var matched bool
 			var err error
@@ -208,8 +249,9 @@ func getAvailableDevices(context *clusterd.Context, desiredDevices string, metad
 				// the desired devices is a regular expression
 				matched, err = regexp.Match(desiredDevices, []byte(device.Name))
 			} else {
+				// the device list can contain kernel names or persistent paths to the devices
 				for i := range deviceList {
-					if device.Name == deviceList[i] {
+					if clusterd.MatchesDevice(device, deviceList[i]) {
 						matched = true
 						break
 					}
@@ -218,18 +260,32 @@ func getAvailableDevices(context *clusterd.Context, desiredDevices string, metad
 
 			if err == nil && matched {
 				// the current device matches the user specifies filter/list, use it for data
-				available.Entries[device.Name] = &DeviceOsdIDEntry{Data: unassignedOSDID}
+				available.Entries[device.Name] = &DeviceOsdIDEntry{Data: unassignedOSDID, PersistentID: persistentID}
 			} else {
 				logger.Infof("skipping device %s that does not match the device filter/list `%s`. %+v", device.Name, desiredDevices, err)
+				available.Skipped[device.Name] = skipReasonFiltered
 			}
 		} else {
 			logger.Infof("skipping device %s until the admin specifies it can be used by an osd", device.Name)
+			available.Skipped[device.Name] = skipReasonNotSelected
 		}
 	}
 
 	return available, nil
 }
 
+func matchesSelector(device *sys.LocalDisk, selector *rookalpha.DeviceSelector) bool {
+	matched, err := clusterd.MatchesDeviceSelector(device, selector)
+	if err != nil {
+		logger.Warningf("skipping device %s. %+v", device.Name, err)
+		return false
+	}
+	if !matched {
+		logger.Infof("skipping device %s that does not have the properties of the device selector %+v", device.Name, *selector)
+	}
+	return matched
+}
+
 func getDataDirs(context *clusterd.Context, kv *k8sutil.ConfigMapKVStore, desiredDirs string,
 	devicesSpecified bool, nodeName string) (dirs, removedDirs map[string]int, err error) {
 
@@ -395,3 +451,43 @@ func cleanUpNodeResources(context *clusterd.Context, agent *OsdAgent, nodeCrushN
 
 	return nil
 }
+
+// updateStatus saves the orchestration status of the node with the given state
+func (a *OsdAgent) updateStatus(context *clusterd.Context, state string) error {
+	a.status.Status = state
+	if state == oposd.OrchestrationStatusCompleted || state == oposd.OrchestrationStatusFailed {
+		completionTime := metav1.Now()
+		a.status.CompletionTime = &completionTime
+	}
+	return oposd.UpdateOrchestrationStatusMap(context.Clientset, a.cluster.Name, a.nodeName, a.status)
+}
+
+// FailedStatus returns the orchestration status of the node after the orchestration failed with the given message.
+// The details gathered before the failure are kept to help troubleshoot the failure.
+func (a *OsdAgent) FailedStatus(message string) oposd.OrchestrationStatus {
+	status := a.status
+	status.Status = oposd.OrchestrationStatusFailed
+	status.Message = message
+	completionTime := metav1.Now()
+	status.CompletionTime = &completionTime
+	return status
+}
+
+// getDeviceStatus returns the status of all devices that were considered for OSDs, sorted by name
+func getDeviceStatus(devices *DeviceOsdMapping) []cephv1alpha1.OSDDeviceStatus {
+	names := []string{}
+	for name := range devices.Entries {
+		names = append(names, name)
+	}
+	for name := range devices.Skipped {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	status := make([]cephv1alpha1.OSDDeviceStatus, len(names))
+	for i, name := range names {
+		_, inUse := devices.Entries[name]
+		status[i] = cephv1alpha1.OSDDeviceStatus{Name: name, InUse: inUse, SkipReason: devices.Skipped[name]}
+	}
+	return status
+}
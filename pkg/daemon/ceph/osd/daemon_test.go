@@ -22,6 +22,7 @@ import (
 	"strings"
 	"testing"
 
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
 	"github.com/rook/rook/pkg/clusterd"
 	"github.com/rook/rook/pkg/operator/ceph/cluster/osd/config"
 	exectest "github.com/rook/rook/pkg/util/exec/test"
@@ -215,7 +216,7 @@ NAME="sdb1" SIZE="30" TYPE="part" PKNAME="sdb"`, nil
 	}
 
 	// select all devices, including nvme01 for metadata
-	mapping, err := getAvailableDevices(context, "all", "nvme01", true)
+	mapping, err := getAvailableDevices(context, "all", "nvme01", true, nil)
 	assert.Nil(t, err)
 	assert.Equal(t, 5, len(mapping.Entries))
 	assert.Equal(t, -1, mapping.Entries["sda"].Data)
@@ -226,35 +227,61 @@ NAME="sdb1" SIZE="30" TYPE="part" PKNAME="sdb"`, nil
 	assert.NotNil(t, mapping.Entries["nvme01"].Metadata)
 	assert.Equal(t, 0, len(mapping.Entries["nvme01"].Metadata))
 
+	// the devices in use by something other than rook are reported as skipped
+	assert.Equal(t, 2, len(mapping.Skipped))
+	assert.Equal(t, skipReasonHasPartitions, mapping.Skipped["sdb"])
+	assert.Contains(t, mapping.Skipped["sdc"], skipReasonHasFilesystem)
+
+	status := getDeviceStatus(mapping)
+	assert.Equal(t, 7, len(status))
+	assert.Equal(t, "nvme01", status[0].Name)
+	assert.True(t, status[0].InUse)
+	assert.Equal(t, "sdb", status[4].Name)
+	assert.False(t, status[4].InUse)
+	assert.Equal(t, skipReasonHasPartitions, status[4].SkipReason)
+
 	// select no devices both using and not using a filter
-	mapping, err = getAvailableDevices(context, "", "", false)
+	mapping, err = getAvailableDevices(context, "", "", false, nil)
 	assert.Nil(t, err)
 	assert.Equal(t, 0, len(mapping.Entries))
+	assert.Equal(t, skipReasonNotSelected, mapping.Skipped["sda"])
 
-	mapping, err = getAvailableDevices(context, "", "", true)
+	mapping, err = getAvailableDevices(context, "", "", true, nil)
 	assert.Nil(t, err)
 	assert.Equal(t, 0, len(mapping.Entries))
 
 	// select the sd* devices
-	mapping, err = getAvailableDevices(context, "^sd.$", "", true)
+	mapping, err = getAvailableDevices(context, "^sd.$", "", true, nil)
 	assert.Nil(t, err)
 	assert.Equal(t, 2, len(mapping.Entries))
 	assert.Equal(t, -1, mapping.Entries["sda"].Data)
 	assert.Equal(t, -1, mapping.Entries["sdd"].Data)
 
 	// select an exact device
-	mapping, err = getAvailableDevices(context, "sdd", "", false)
+	mapping, err = getAvailableDevices(context, "sdd", "", false, nil)
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(mapping.Entries))
 	assert.Equal(t, -1, mapping.Entries["sdd"].Data)
+	assert.Equal(t, skipReasonFiltered, mapping.Skipped["sda"])
 
 	// select all devices except those that have a prefix of "s"
-	mapping, err = getAvailableDevices(context, "^[^s]", "", true)
+	mapping, err = getAvailableDevices(context, "^[^s]", "", true, nil)
 	assert.Nil(t, err)
 	assert.Equal(t, 3, len(mapping.Entries))
 	assert.Equal(t, -1, mapping.Entries["rda"].Data)
 	assert.Equal(t, -1, mapping.Entries["rdb"].Data)
 	assert.Equal(t, -1, mapping.Entries["nvme01"].Data)
+
+	// select the rotational devices among all devices
+	context.Devices[5].Rotational = true
+	context.Devices[6].Rotational = true
+	rotational := true
+	mapping, err = getAvailableDevices(context, "all", "", true, &rookalpha.DeviceSelector{Rotational: &rotational})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(mapping.Entries))
+	assert.Equal(t, -1, mapping.Entries["rda"].Data)
+	assert.Equal(t, -1, mapping.Entries["rdb"].Data)
+	assert.Equal(t, skipReasonNotInSelector, mapping.Skipped["sda"])
 }
 
 func TestGetRemovedDevices(t *testing.T) {
@@ -46,6 +46,8 @@ const (
 	// ratio of disk space that will be used by bluestore on a dir.  This is an upper bound and it
 	// is not preallocated (it is thinly provisioned).
 	bluestoreDirBlockSizeRatio = 1.0
+	// the default ratio of a full filesystem at which an osd stops accepting writes
+	osdFailsafeFullRatio = 0.97
 )
 
 type osdConfig struct {
@@ -57,6 +59,8 @@ type osdConfig struct {
 	uuid            uuid.UUID
 	dir             bool
 	storeConfig     config.StoreConfig
+	deviceClass     string
+	crushWeight     float64
 	partitionScheme *config.PerfSchemeEntry
 	kv              *k8sutil.ConfigMapKVStore
 	storeName       string
@@ -70,11 +74,13 @@ type Device struct {
 
 type DeviceOsdMapping struct {
 	Entries map[string]*DeviceOsdIDEntry // device name to OSD ID mapping entry
+	Skipped map[string]string            // device name to the reason the device will not be used by an OSD
 }
 
 type DeviceOsdIDEntry struct {
-	Data     int   // OSD ID that has data stored here
-	Metadata []int // OSD IDs (multiple) that have metadata stored here
+	Data         int    // OSD ID that has data stored here
+	Metadata     []int  // OSD IDs (multiple) that have metadata stored here
+	PersistentID string // persistent identifier of the device (e.g. /dev/disk/by-id link) that is stable across reboots
 }
 
 func (m *DeviceOsdMapping) String() string {
@@ -360,6 +366,23 @@ func getStoreSettings(cfg *osdConfig) (map[string]string, error) {
 			journalSize = cfg.storeConfig.JournalSizeMB
 		}
 		settings["osd journal size"] = strconv.Itoa(journalSize)
+
+		if cfg.dir && cfg.storeConfig.DirectoryCapacityMB > 0 {
+			// the failsafe full ratio is compared with the usage of the whole host filesystem, which may be shared with
+			// other data. the osd stops accepting writes when it has used its capacity on top of the other data.
+			totalBytes, usedBytes, err := getUsageForPath(cfg.rootPath)
+			if err != nil {
+				return nil, err
+			}
+			otherBytes, err := getDirOtherUsage(cfg, usedBytes)
+			if err != nil {
+				return nil, err
+			}
+			ratio := dirFailsafeFullRatio(capDirSize(cfg, totalBytes), totalBytes, otherBytes)
+			if ratio < osdFailsafeFullRatio {
+				settings["osd failsafe full ratio"] = fmt.Sprintf("%.4f", ratio)
+			}
+		}
 		return settings, nil
 	}
 
@@ -405,7 +428,11 @@ func getStoreSettings(cfg *osdConfig) (map[string]string, error) {
 		}
 
 		logger.Infof("total bytes for %s: %d (%s)", cfg.rootPath, totalBytes, display.BytesToString(totalBytes))
-		settings["bluestore block size"] = strconv.Itoa(int(float64(totalBytes) * bluestoreDirBlockSizeRatio))
+		blockSize := uint64(float64(totalBytes) * bluestoreDirBlockSizeRatio)
+		if capacity := capDirSize(cfg, totalBytes); capacity < blockSize {
+			blockSize = capacity
+		}
+		settings["bluestore block size"] = strconv.FormatUint(blockSize, 10)
 	} else {
 		// devices are being used for bluestore, all we need is their paths
 		if cfg.partitionScheme == nil || cfg.partitionScheme.Partitions == nil {
@@ -447,6 +474,17 @@ func writeConfigFile(cfg *osdConfig, context *clusterd.Context, cluster *mon.Clu
 		return fmt.Errorf("failed to read store settings. %+v", err)
 	}
 
+	// the scrub settings of the cluster CRD apply from the start of the osd, before the operator injects any changes
+	if cfg.kv != nil {
+		scrubSettings, err := config.LoadScrubSettings(cfg.kv)
+		if err != nil {
+			logger.Warningf("failed to load the scrub settings for osd %d. %+v", cfg.id, err)
+		}
+		for k, v := range scrubSettings {
+			settings[k] = v
+		}
+	}
+
 	// write the OSD config file to disk
 	_, err = mon.GenerateConfigFile(context, cluster, cfg.rootPath, fmt.Sprintf("osd.%d", cfg.id),
 		getOSDKeyringPath(cfg.rootPath), cephConfig, settings)
@@ -534,6 +572,38 @@ func addOSDToCrushMap(context *clusterd.Context, config *osdConfig, clusterName,
 	osdID := config.id
 	osdDataPath := config.rootPath
 
+	weight, err := getOSDCrushWeight(context, config)
+	if err != nil {
+		return err
+	}
+	config.crushWeight = weight
+
+	// with a ramp up the OSD starts at a fraction of its weight, the rest is added gradually by the agent. the full
+	// weight is saved first so the ramp up resumes if the OSD is interrupted after it was added to the crush map.
+	if config.storeConfig.WeightRampUpSteps > 1 {
+		if err := addWeightRampUp(config); err != nil {
+			return fmt.Errorf("failed to save the weight ramp up of osd %d. %+v", osdID, err)
+		}
+		weight, _ = strconv.ParseFloat(fmt.Sprintf("%.4f", weight/float64(config.storeConfig.WeightRampUpSteps)), 64)
+	}
+
+	osdEntity := fmt.Sprintf("osd.%d", osdID)
+	logger.Infof("adding %s (%s), weight: %.4f, to crush map at '%s'", osdEntity, osdDataPath, weight, location)
+	args := []string{"osd", "crush", "create-or-move", strconv.Itoa(osdID), fmt.Sprintf("%.4f", weight)}
+	args = append(args, strings.Split(location, " ")...)
+	_, err = client.ExecuteCephCommand(context, clusterName, args)
+	if err != nil {
+		return fmt.Errorf("failed adding %s to crush map: %+v", osdEntity, err)
+	}
+
+	return nil
+}
+
+// getOSDCrushWeight returns the full crush weight of the OSD, which is the size of its data in TB
+func getOSDCrushWeight(context *clusterd.Context, config *osdConfig) (float64, error) {
+	osdID := config.id
+	osdDataPath := config.rootPath
+
 	var totalBytes uint64
 	var err error
 	if !isBluestoreDevice(config) {
@@ -541,19 +611,20 @@ func addOSDToCrushMap(context *clusterd.Context, config *osdConfig, clusterName,
 		// or device, this will be a mounted filesystem, so we can use Statfs
 		totalBytes, err = getSizeForPath(osdDataPath)
 		if err != nil {
-			return err
+			return 0, err
 		}
+		totalBytes = capDirSize(config, totalBytes)
 	} else {
 		// for bluestore devices, the data partition will be raw, so we can't use Statfs.  Get the
 		// full device properties of the data partition and then get the size from that.
 		dataPartDetails, err := getDataPartitionDetails(config)
 		if err != nil {
-			return fmt.Errorf("failed to get data partition details for osd %d (%s): %+v", osdID, osdDataPath, err)
+			return 0, fmt.Errorf("failed to get data partition details for osd %d (%s): %+v", osdID, osdDataPath, err)
 		}
 		dataPartPath := filepath.Join(diskByPartUUID, dataPartDetails.PartitionUUID)
 		devProps, err := sys.GetDevicePropertiesFromPath(dataPartPath, context.Executor)
 		if err != nil {
-			return fmt.Errorf("failed to get device properties for %s: %+v", dataPartPath, err)
+			return 0, fmt.Errorf("failed to get device properties for %s: %+v", dataPartPath, err)
 		}
 		if val, ok := devProps["SIZE"]; ok {
 			if size, err := strconv.ParseUint(val, 10, 64); err == nil {
@@ -562,25 +633,16 @@ func addOSDToCrushMap(context *clusterd.Context, config *osdConfig, clusterName,
 		}
 
 		if totalBytes == 0 {
-			return fmt.Errorf("failed to get size of %s: %+v.  Full properties: %+v", dataPartPath, err, devProps)
+			return 0, fmt.Errorf("failed to get size of %s: %+v.  Full properties: %+v", dataPartPath, err, devProps)
 		}
 	}
 
 	// weight is ratio of (size in KB) / (1 GB)
 	weight := float64(totalBytes/1024) / 1073741824.0
 	weight, _ = strconv.ParseFloat(fmt.Sprintf("%.4f", weight), 64)
+	logger.Debugf("osd.%d (%s) bytes: %d, weight: %.4f", osdID, osdDataPath, totalBytes, weight)
 
-	osdEntity := fmt.Sprintf("osd.%d", osdID)
-	logger.Infof("adding %s (%s), bytes: %d, weight: %.4f, to crush map at '%s'",
-		osdEntity, osdDataPath, totalBytes, weight, location)
-	args := []string{"osd", "crush", "create-or-move", strconv.Itoa(osdID), fmt.Sprintf("%.4f", weight)}
-	args = append(args, strings.Split(location, " ")...)
-	_, err = client.ExecuteCephCommand(context, clusterName, args)
-	if err != nil {
-		return fmt.Errorf("failed adding %s to crush map: %+v", osdEntity, err)
-	}
-
-	return nil
+	return weight, nil
 }
 
 func markOSDOut(context *clusterd.Context, clusterName string, id int) error {
@@ -645,6 +707,58 @@ func getBluestoreDirPaths(cfg *osdConfig) (string, string, string, error) {
 		nil
 }
 
+// capDirSize returns the given size limited to the capacity of the OSD if it is on a directory with a capacity limit
+func capDirSize(cfg *osdConfig, totalBytes uint64) uint64 {
+	if !cfg.dir || cfg.storeConfig.DirectoryCapacityMB <= 0 {
+		return totalBytes
+	}
+	capacity := uint64(cfg.storeConfig.DirectoryCapacityMB) * 1024 * 1024
+	if capacity < totalBytes {
+		return capacity
+	}
+	return totalBytes
+}
+
+// dirFailsafeFullRatio returns the usage ratio of the host filesystem at which an OSD on a directory has used its
+// capacity, given the size of the filesystem and the bytes used by other data
+func dirFailsafeFullRatio(capacity, totalBytes, otherBytes uint64) float64 {
+	return float64(otherBytes+capacity) / float64(totalBytes)
+}
+
+// getDirOtherUsage returns the bytes used by other data than the OSD on the host filesystem of an OSD on a directory.
+// Measuring the data of the OSD would mean walking all its files on every start, so the usage of the filesystem is
+// saved when the OSD is first configured, while its directory is still empty. The growth of the other data after that
+// is guarded by the minimum free space of the filesystem.
+func getDirOtherUsage(cfg *osdConfig, usedBytes uint64) (uint64, error) {
+	if cfg.kv == nil {
+		return usedBytes, nil
+	}
+
+	usage, err := config.LoadDirOtherUsage(cfg.kv, cfg.storeName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to load the other usage of the filesystem of osd %d. %+v", cfg.id, err)
+	}
+	if otherBytes, ok := usage[cfg.id]; ok {
+		return otherBytes, nil
+	}
+
+	usage[cfg.id] = usedBytes
+	if err := config.SaveDirOtherUsage(cfg.kv, cfg.storeName, usage); err != nil {
+		return 0, fmt.Errorf("failed to save the other usage of the filesystem of osd %d. %+v", cfg.id, err)
+	}
+	return usedBytes, nil
+}
+
+// getUsageForPath returns the size and the used bytes of the filesystem at the given path
+func getUsageForPath(path string) (uint64, uint64, error) {
+	s := syscall.Statfs_t{}
+	if err := syscall.Statfs(path, &s); err != nil {
+		return 0, 0, fmt.Errorf("failed to statfs on %s, %+v", path, err)
+	}
+
+	return s.Blocks * uint64(s.Bsize), (s.Blocks - s.Bfree) * uint64(s.Bsize), nil
+}
+
 // getSizeForPath returns the size of the filesystem at the given path.
 func getSizeForPath(path string) (uint64, error) {
 	s := syscall.Statfs_t{}
@@ -21,6 +21,7 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"testing"
 
@@ -333,3 +334,85 @@ func testPartitionOSDHelper(t *testing.T, storeConfig config.StoreConfig) {
 	assert.Nil(t, err)
 	assert.NotEqual(t, "", dataDetails.DiskUUID)
 }
+
+func TestDirCapacity(t *testing.T) {
+	configDir, _ := ioutil.TempDir("", "")
+	defer os.RemoveAll(configDir)
+
+	cfg := &osdConfig{id: 1, rootPath: configDir, dir: true, storeConfig: config.StoreConfig{StoreType: config.Filestore}}
+	totalBytes, err := getSizeForPath(configDir)
+	assert.Nil(t, err)
+
+	// no capacity limit
+	assert.Equal(t, totalBytes, capDirSize(cfg, totalBytes))
+	settings, err := getStoreSettings(cfg)
+	assert.Nil(t, err)
+	_, ok := settings["osd failsafe full ratio"]
+	assert.False(t, ok)
+	unlimitedWeight, err := getOSDCrushWeight(nil, cfg)
+	assert.Nil(t, err)
+
+	// the capacity limits the crush weight and the full ratio of a filestore dir
+	capacity := totalBytes / 100 / 1048576
+	cfg.storeConfig.DirectoryCapacityMB = int(capacity)
+	assert.Equal(t, capacity*1048576, capDirSize(cfg, totalBytes))
+	weight, err := getOSDCrushWeight(nil, cfg)
+	assert.Nil(t, err)
+	assert.True(t, weight < unlimitedWeight)
+	settings, err = getStoreSettings(cfg)
+	assert.Nil(t, err)
+	ratio, err := strconv.ParseFloat(settings["osd failsafe full ratio"], 64)
+	assert.Nil(t, err)
+	_, usedBytes, err := getUsageForPath(configDir)
+	assert.Nil(t, err)
+	assert.InDelta(t, float64(usedBytes+capacity*1048576)/float64(totalBytes), ratio, 0.01)
+
+	// the capacity limits the block size of a bluestore dir
+	cfg.storeConfig.StoreType = config.Bluestore
+	settings, err = getStoreSettings(cfg)
+	assert.Nil(t, err)
+	assert.Equal(t, strconv.FormatUint(capacity*1048576, 10), settings["bluestore block size"])
+
+	// a capacity larger than the filesystem has no effect
+	cfg.storeConfig.DirectoryCapacityMB = int(totalBytes/1048576) + 1
+	assert.Equal(t, totalBytes, capDirSize(cfg, totalBytes))
+
+	// devices are not limited
+	cfg.dir = false
+	cfg.storeConfig.DirectoryCapacityMB = 1
+	assert.Equal(t, totalBytes, capDirSize(cfg, totalBytes))
+}
+
+func TestDirFailsafeFullRatio(t *testing.T) {
+	gb := uint64(1024 * 1024 * 1024)
+
+	// a filesystem used only by the osd
+	assert.InDelta(t, 0.1, dirFailsafeFullRatio(10*gb, 100*gb, 0), 0.0001)
+
+	// a shared filesystem that is mostly used by other data leaves the osd its capacity
+	assert.InDelta(t, 0.9, dirFailsafeFullRatio(10*gb, 100*gb, 80*gb), 0.0001)
+
+	// the other data already fills the filesystem beyond the capacity of the osd
+	assert.True(t, dirFailsafeFullRatio(10*gb, 100*gb, 95*gb) > osdFailsafeFullRatio)
+}
+
+func TestDirOtherUsage(t *testing.T) {
+	gb := uint64(1024 * 1024 * 1024)
+	cfg := &osdConfig{id: 1, dir: true, kv: mockKVStore(), storeName: config.GetConfigStoreName("node1")}
+
+	// the usage of the filesystem is saved when the osd is first configured
+	otherBytes, err := getDirOtherUsage(cfg, 20*gb)
+	assert.Nil(t, err)
+	assert.Equal(t, 20*gb, otherBytes)
+
+	// the data written by the osd later on does not count as other data
+	otherBytes, err = getDirOtherUsage(cfg, 30*gb)
+	assert.Nil(t, err)
+	assert.Equal(t, 20*gb, otherBytes)
+
+	// each osd has its own usage
+	cfg.id = 2
+	otherBytes, err = getDirOtherUsage(cfg, 30*gb)
+	assert.Nil(t, err)
+	assert.Equal(t, 30*gb, otherBytes)
+}
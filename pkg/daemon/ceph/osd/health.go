@@ -16,14 +16,19 @@ limitations under the License.
 package osd
 
 import (
+	"syscall"
 	"time"
 
 	"github.com/rook/rook/pkg/clusterd"
 	"github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/ceph/cluster/osd/config"
 	"github.com/rook/rook/pkg/util/proc"
 )
 
-const upStatus = 1
+const (
+	upStatus = 1
+	inStatus = 1
+)
 
 var (
 	healthCheckInterval = 60 * time.Second
@@ -38,11 +43,14 @@ type Monitor struct {
 	// lastStatus keeps track of OSDs status
 	// key - OSD id; value: time of the status change.
 	lastStatus map[int]time.Time
+
+	// the OSDs on directories that were marked out because their host filesystem is almost full
+	markedOut map[int]bool
 }
 
 // NewMonitor instantiates OSD monitoring
 func NewMonitor(context *clusterd.Context, agent *OsdAgent) *Monitor {
-	return &Monitor{context, agent, make(map[int]time.Time)}
+	return &Monitor{context, agent, make(map[int]time.Time), make(map[int]bool)}
 }
 
 // Run runs monitoring logic for osds status at set intervals
@@ -54,6 +62,7 @@ func (m *Monitor) Run() {
 		if err != nil {
 			logger.Warningf("Failed OSD status check: %+v", err)
 		}
+		m.checkDirFreeSpace()
 	}
 }
 
@@ -110,3 +119,53 @@ func (m *Monitor) osdStatus() error {
 
 	return nil
 }
+
+// checkDirFreeSpace marks the OSDs on directories out when the free space of their host filesystem drops below the
+// minimum, before the filesystem fills up and takes down both the OSDs and the node. The OSDs are not marked in
+// again automatically since that would fill the filesystem again, but once an OSD is marked in again by the admin its
+// filesystem is watched again.
+func (m *Monitor) checkDirFreeSpace() {
+	minFreePercent := m.agent.storeConfig.DirectoryMinFreePercent
+	if minFreePercent <= 0 {
+		minFreePercent = config.DefaultDirectoryMinFreePercent
+	}
+
+	var osdDump *client.OSDDump
+	for id, rootPath := range m.agent.osdDirs {
+		if m.markedOut[id] {
+			if osdDump == nil {
+				var err error
+				if osdDump, err = client.GetOSDDump(m.context, m.agent.cluster.Name); err != nil {
+					logger.Warningf("failed to get the osd dump to check the osds that were marked out. %+v", err)
+					continue
+				}
+			}
+			if _, in, err := osdDump.StatusByID(int64(id)); err != nil || in != inStatus {
+				continue
+			}
+			logger.Infof("osd.%d was marked in again, watching the free space of its filesystem again", id)
+			delete(m.markedOut, id)
+		}
+
+		s := syscall.Statfs_t{}
+		if err := syscall.Statfs(rootPath, &s); err != nil {
+			logger.Warningf("failed to get free space of osd.%d at %s. %+v", id, rootPath, err)
+			continue
+		}
+		if s.Blocks == 0 {
+			continue
+		}
+		freePercent := float64(s.Bavail) * 100 / float64(s.Blocks)
+		if freePercent >= float64(minFreePercent) {
+			continue
+		}
+
+		logger.Warningf("filesystem of osd.%d at %s has %.1f%% free space, less than the minimum of %d%%. marking the osd out",
+			id, rootPath, freePercent, minFreePercent)
+		if err := markOSDOut(m.context, m.agent.cluster.Name, id); err != nil {
+			logger.Warningf("failed to mark osd.%d out. %+v", id, err)
+			continue
+		}
+		m.markedOut[id] = true
+	}
+}
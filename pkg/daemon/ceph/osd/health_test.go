@@ -16,6 +16,7 @@ limitations under the License.
 package osd
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"strings"
@@ -95,3 +96,41 @@ func TestOSDStatus(t *testing.T) {
 	// OSD monitor should stop tracking that process once the action is triggered
 	assert.Equal(t, 0, len(osdMon.lastStatus))
 }
+
+func TestCheckDirFreeSpace(t *testing.T) {
+	configDir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatalf("failed to create temp config dir: %+v", err)
+	}
+	defer os.RemoveAll(configDir)
+
+	agent, executor, context := createTestAgent(t, "", configDir, "node1272", &config.StoreConfig{DirectoryMinFreePercent: 1})
+	var outs []string
+	osdIn := 0
+	executor.MockExecuteCommandWithOutputFile = func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+		if args[0] == "osd" && args[1] == "out" {
+			outs = append(outs, args[2])
+		}
+		if args[0] == "osd" && args[1] == "dump" {
+			return fmt.Sprintf(`{"osds":[{"osd":2,"up":1,"in":%d}]}`, osdIn), nil
+		}
+		return "", nil
+	}
+	agent.osdDirs[2] = configDir
+	osdMon := NewMonitor(context, agent)
+
+	// the filesystem of the test dir is not almost full
+	osdMon.checkDirFreeSpace()
+	assert.Equal(t, 0, len(outs))
+
+	// the osd is marked out once when the free space is below the minimum
+	agent.storeConfig.DirectoryMinFreePercent = 101
+	osdMon.checkDirFreeSpace()
+	osdMon.checkDirFreeSpace()
+	assert.Equal(t, []string{"2"}, outs)
+
+	// the osd is marked out again after it was marked in while the free space is still below the minimum
+	osdIn = 1
+	osdMon.checkDirFreeSpace()
+	assert.Equal(t, []string{"2", "2"}, outs)
+}
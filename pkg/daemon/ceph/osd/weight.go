@@ -0,0 +1,127 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/ceph/cluster/osd/config"
+)
+
+var (
+	weightRampUpInterval = 60 * time.Second
+)
+
+// addWeightRampUp saves the full crush weight of a new OSD before it is added to the crush map with a fraction of it,
+// so the ramp up is resumed if the OSD is interrupted after it was added
+func addWeightRampUp(cfg *osdConfig) error {
+	weights, err := config.LoadWeightRampUp(cfg.kv, cfg.storeName)
+	if err != nil {
+		return err
+	}
+
+	weights[cfg.id] = cfg.crushWeight
+	return config.SaveWeightRampUp(cfg.kv, cfg.storeName, weights)
+}
+
+// rampUpWeights increases the crush weight of the new OSDs on the node one step at a time until they reach their
+// full weight. The next step is only taken when the cluster is clean so that the backfill to the new OSDs is spread
+// out. The remaining ramp up is saved so it continues if the agent restarts.
+func (a *OsdAgent) rampUpWeights(context *clusterd.Context) {
+	for {
+		done, err := a.rampUpWeightStep(context)
+		if err != nil {
+			logger.Warningf("failed to ramp up osd weights. %+v", err)
+		}
+		if done {
+			return
+		}
+		<-time.After(weightRampUpInterval)
+	}
+}
+
+// rampUpWeightStep increases the weight of the ramping up OSDs by one step if the cluster is clean. Returns true when
+// all OSDs on the node are at their full weight.
+func (a *OsdAgent) rampUpWeightStep(context *clusterd.Context) (bool, error) {
+	weights, err := config.LoadWeightRampUp(a.kv, config.GetConfigStoreName(a.nodeName))
+	if err != nil {
+		return false, fmt.Errorf("failed to load weight ramp up. %+v", err)
+	}
+	if len(weights) == 0 {
+		return true, nil
+	}
+
+	if err := client.IsClusterClean(context, a.cluster.Name); err != nil {
+		logger.Infof("waiting for the cluster to be clean before increasing the weight of osds %v. %+v", weightRampUpIDs(weights), err)
+		return false, nil
+	}
+
+	usage, err := client.GetOSDUsage(context, a.cluster.Name)
+	if err != nil {
+		return false, err
+	}
+
+	// if the ramp up was disabled in the meantime, the osds go to their full weight in one step
+	steps := a.storeConfig.WeightRampUpSteps
+	if steps < 1 {
+		steps = 1
+	}
+
+	for id, fullWeight := range weights {
+		osdUsage := usage.ByID(id)
+		if osdUsage == nil {
+			logger.Infof("osd %d no longer exists, stopping its weight ramp up", id)
+			delete(weights, id)
+			continue
+		}
+
+		current, err := osdUsage.CrushWeight.Float64()
+		if err != nil {
+			logger.Warningf("failed to get the crush weight of osd %d. %+v", id, err)
+			continue
+		}
+
+		weight := math.Min(fullWeight, current+fullWeight/float64(steps))
+		logger.Infof("increasing the crush weight of osd %d from %.4f to %.4f (full weight %.4f)", id, current, weight, fullWeight)
+		if _, err := client.CrushReweight(context, a.cluster.Name, id, weight); err != nil {
+			logger.Warningf("failed to increase the weight of osd %d. %+v", id, err)
+			continue
+		}
+		if weight >= fullWeight {
+			delete(weights, id)
+		}
+	}
+
+	if err := config.SaveWeightRampUp(a.kv, config.GetConfigStoreName(a.nodeName), weights); err != nil {
+		return false, fmt.Errorf("failed to save weight ramp up. %+v", err)
+	}
+
+	return len(weights) == 0, nil
+}
+
+func weightRampUpIDs(weights map[int]float64) []int {
+	ids := []int{}
+	for id := range weights {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
@@ -0,0 +1,98 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"github.com/rook/rook/pkg/operator/ceph/cluster/osd/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWeightRampUp(t *testing.T) {
+	agent, executor, context := createTestAgent(t, "", "", "node1", &config.StoreConfig{WeightRampUpSteps: 4})
+	storeName := config.GetConfigStoreName(agent.nodeName)
+
+	clean := true
+	crushWeights := map[int]float64{1: 0.5, 2: 0.25}
+	executor.MockExecuteCommandWithOutputFile = func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+		logger.Infof("ExecuteCommandWithOutputFile: %s %v", command, args)
+		if args[0] == "status" {
+			if clean {
+				return `{"pgmap":{"num_pgs":100,"pgs_by_state":[{"state_name":"active+clean","count":100}]}}`, nil
+			}
+			return `{"pgmap":{"num_pgs":100,"pgs_by_state":[{"state_name":"active+remapped+backfilling","count":100}]}}`, nil
+		}
+		if args[0] == "osd" && args[1] == "df" {
+			return fmt.Sprintf(`{"nodes":[{"id":1,"crush_weight":%.4f},{"id":2,"crush_weight":%.4f}]}`, crushWeights[1], crushWeights[2]), nil
+		}
+		if args[0] == "osd" && args[1] == "crush" && args[2] == "reweight" {
+			id, _ := strconv.Atoi(args[3][len("osd."):])
+			weight, _ := strconv.ParseFloat(args[4], 64)
+			crushWeights[id] = weight
+			return "", nil
+		}
+		return "", fmt.Errorf("unexpected command %v", args)
+	}
+
+	// nothing to ramp up
+	done, err := agent.rampUpWeightStep(context)
+	assert.Nil(t, err)
+	assert.True(t, done)
+
+	// two new osds with a full weight of 2.0 and 1.0
+	assert.Nil(t, addWeightRampUp(&osdConfig{id: 1, crushWeight: 2.0, kv: agent.kv, storeName: storeName}))
+	assert.Nil(t, addWeightRampUp(&osdConfig{id: 2, crushWeight: 1.0, kv: agent.kv, storeName: storeName}))
+
+	// the weight is not increased while the cluster is not clean
+	clean = false
+	done, err = agent.rampUpWeightStep(context)
+	assert.Nil(t, err)
+	assert.False(t, done)
+	assert.Equal(t, 0.5, crushWeights[1])
+
+	// the weight is increased one step at a time while the cluster is clean
+	clean = true
+	done, err = agent.rampUpWeightStep(context)
+	assert.Nil(t, err)
+	assert.False(t, done)
+	assert.Equal(t, 1.0, crushWeights[1])
+	assert.Equal(t, 0.5, crushWeights[2])
+
+	done, err = agent.rampUpWeightStep(context)
+	assert.Nil(t, err)
+	assert.False(t, done)
+	assert.Equal(t, 1.5, crushWeights[1])
+	assert.Equal(t, 0.75, crushWeights[2])
+
+	// the ramp up is done when the osds reach their full weight
+	done, err = agent.rampUpWeightStep(context)
+	assert.Nil(t, err)
+	assert.True(t, done)
+	assert.Equal(t, 2.0, crushWeights[1])
+	assert.Equal(t, 1.0, crushWeights[2])
+	weights, err := config.LoadWeightRampUp(agent.kv, storeName)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(weights))
+
+	// a removed osd stops its ramp up
+	assert.Nil(t, addWeightRampUp(&osdConfig{id: 5, crushWeight: 1.0, kv: agent.kv, storeName: storeName}))
+	done, err = agent.rampUpWeightStep(context)
+	assert.Nil(t, err)
+	assert.True(t, done)
+}
@@ -0,0 +1,184 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package rbd for the Ceph rbd-mirror daemon.
+package rbd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/coreos/pkg/capnslog"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/mon"
+	"github.com/rook/rook/pkg/util"
+)
+
+var (
+	logger          = capnslog.NewPackageLogger("github.com/rook/rook", "cephrbdmirror")
+	keyringTemplate = `
+[client.rbd-mirror.%s]
+	key = %s
+	caps mon = "profile rbd"
+	caps osd = "profile rbd"
+`
+	peerSyncInterval = 30 * time.Second
+)
+
+const (
+	rbdmirror = "rbd-mirror"
+	// PeerConfigDir is the directory rbd-mirror looks up the config and keyring of the peer clusters in
+	PeerConfigDir = "/etc/ceph"
+)
+
+// Config is the configuration of an rbd-mirror daemon
+type Config struct {
+	ClusterInfo *mon.ClusterInfo
+	Name        string
+	Keyring     string
+	// The directory with the config and keyring files of the peer clusters
+	PeersDir string
+}
+
+// Run generates the config of the rbd-mirror daemon and runs it in the foreground
+func Run(context *clusterd.Context, config *Config) error {
+	logger.Infof("Starting rbd-mirror %s", config.Name)
+	if err := generateConfigFiles(context, config); err != nil {
+		return fmt.Errorf("failed to generate rbd-mirror config files. %+v", err)
+	}
+
+	// the peers added after the daemon starts are found when their files are synced
+	synced := map[string]bool{}
+	if err := syncPeers(config.PeersDir, PeerConfigDir, synced); err != nil {
+		logger.Warningf("failed to sync the peer configs. %+v", err)
+	}
+	go func() {
+		for {
+			time.Sleep(peerSyncInterval)
+			if err := syncPeers(config.PeersDir, PeerConfigDir, synced); err != nil {
+				logger.Warningf("failed to sync the peer configs. %+v", err)
+			}
+		}
+	}()
+
+	if err := startRBDMirror(context, config); err != nil {
+		return fmt.Errorf("failed to run rbd-mirror. %+v", err)
+	}
+	return nil
+}
+
+func generateConfigFiles(context *clusterd.Context, config *Config) error {
+	keyringPath := getKeyringPath(context.ConfigDir, config.Name)
+	confDir := getConfDir(context.ConfigDir, config.Name)
+	username := fmt.Sprintf("client.rbd-mirror.%s", config.Name)
+	logger.Infof("Conf files: dir=%s keyring=%s", confDir, keyringPath)
+	_, err := mon.GenerateConfigFile(context, config.ClusterInfo, confDir, username, keyringPath, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create config file. %+v", err)
+	}
+
+	keyringEval := func(key string) string {
+		return fmt.Sprintf(keyringTemplate, config.Name, key)
+	}
+	if err := mon.WriteKeyring(keyringPath, config.Keyring, keyringEval); err != nil {
+		return fmt.Errorf("failed to create rbd-mirror keyring. %+v", err)
+	}
+	return nil
+}
+
+// syncPeers copies the config and keyring files of the peers to the config dir, and removes the files of the peers
+// that were removed. The synced files are tracked to leave the other files in the config dir alone.
+func syncPeers(peersDir, configDir string, synced map[string]bool) error {
+	files, err := ioutil.ReadDir(peersDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read peers dir %s. %+v", peersDir, err)
+	}
+
+	found := map[string]bool{}
+	for _, file := range files {
+		// skip the hidden data dirs of the mounted secret
+		if strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+		found[file.Name()] = true
+		contents, err := ioutil.ReadFile(path.Join(peersDir, file.Name()))
+		if err != nil {
+			return fmt.Errorf("failed to read peer file %s. %+v", file.Name(), err)
+		}
+		target := path.Join(configDir, file.Name())
+		if current, err := ioutil.ReadFile(target); err == nil && bytes.Equal(current, contents) {
+			synced[file.Name()] = true
+			continue
+		}
+		logger.Infof("writing peer file %s", target)
+		if err := ioutil.WriteFile(target, contents, 0600); err != nil {
+			return fmt.Errorf("failed to write peer file %s. %+v", target, err)
+		}
+		synced[file.Name()] = true
+	}
+
+	for name := range synced {
+		if !found[name] {
+			logger.Infof("removing peer file %s", name)
+			if err := os.Remove(path.Join(configDir, name)); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("failed to remove peer file %s. %+v", name, err)
+			}
+			delete(synced, name)
+		}
+	}
+	return nil
+}
+
+func startRBDMirror(context *clusterd.Context, config *Config) error {
+	logger.Infof("starting rbd-mirror")
+
+	confFile := getConfFilePath(context.ConfigDir, config.Name, config.ClusterInfo.Name)
+	util.WriteFileToLog(logger, confFile)
+
+	keyringPath := getKeyringPath(context.ConfigDir, config.Name)
+	args := []string{
+		"--foreground",
+		fmt.Sprintf("--cluster=%s", config.ClusterInfo.Name),
+		fmt.Sprintf("--conf=%s", confFile),
+		fmt.Sprintf("--keyring=%s", keyringPath),
+		"-i", fmt.Sprintf("rbd-mirror.%s", config.Name),
+	}
+
+	if err := context.Executor.ExecuteCommand(false, rbdmirror, rbdmirror, args...); err != nil {
+		return fmt.Errorf("failed to start rbd-mirror: %+v", err)
+	}
+	return nil
+}
+
+func getConfDir(dir, name string) string {
+	return path.Join(dir, fmt.Sprintf("rbd-mirror-%s", name))
+}
+
+func getConfFilePath(dir, name, clusterName string) string {
+	return path.Join(getConfDir(dir, name), fmt.Sprintf("%s.config", clusterName))
+}
+
+func getKeyringPath(dir, name string) string {
+	return path.Join(getConfDir(dir, name), "keyring")
+}
@@ -0,0 +1,59 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package rbd
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSyncPeers(t *testing.T) {
+	peersDir, err := ioutil.TempDir("", "peers")
+	assert.Nil(t, err)
+	defer os.RemoveAll(peersDir)
+	configDir, err := ioutil.TempDir("", "config")
+	assert.Nil(t, err)
+	defer os.RemoveAll(configDir)
+
+	// the files of the mounted secret are synced, and the other files are left alone
+	ioutil.WriteFile(path.Join(peersDir, "site-b.conf"), []byte("[global]"), 0600)
+	os.Mkdir(path.Join(peersDir, "..data"), 0700)
+	ioutil.WriteFile(path.Join(configDir, "ceph.conf"), []byte("[global]"), 0600)
+	synced := map[string]bool{}
+	err = syncPeers(peersDir, configDir, synced)
+	assert.Nil(t, err)
+	contents, err := ioutil.ReadFile(path.Join(configDir, "site-b.conf"))
+	assert.Nil(t, err)
+	assert.Equal(t, "[global]", string(contents))
+	assert.Equal(t, map[string]bool{"site-b.conf": true}, synced)
+
+	// the files of removed peers are removed
+	os.Remove(path.Join(peersDir, "site-b.conf"))
+	err = syncPeers(peersDir, configDir, synced)
+	assert.Nil(t, err)
+	_, err = os.Stat(path.Join(configDir, "site-b.conf"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(path.Join(configDir, "ceph.conf"))
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(synced))
+
+	// nothing is synced without the peers dir
+	assert.Nil(t, syncPeers(path.Join(peersDir, "missing"), configDir, synced))
+}
@@ -22,10 +22,12 @@ import (
 	"fmt"
 	"os"
 	"os/signal"
+	"reflect"
 	"syscall"
 	"time"
 
 	"github.com/coreos/pkg/capnslog"
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
 	"github.com/rook/rook/pkg/clusterd"
 	"github.com/rook/rook/pkg/operator/k8sutil"
 	"github.com/rook/rook/pkg/util/sys"
@@ -36,14 +38,23 @@ import (
 )
 
 var (
-	logger                                  = capnslog.NewPackageLogger("github.com/rook/rook", "rook-discover")
-	AppName                                 = "rook-discover"
-	NodeAttr                                = "rook.io/node"
-	LocalDiskCMData                         = "devices"
-	LocalDiskCMName                         = "local-device-"
-	probeInterval                           = 30 * time.Second
-	nodeName, namespace, lastDevice, cmName string
-	cm                                      *v1.ConfigMap
+	logger   = capnslog.NewPackageLogger("github.com/rook/rook", "rook-discover")
+	AppName  = "rook-discover"
+	NodeAttr = "rook.io/node"
+	// the config maps the devices were saved in before the device inventory. they are still updated for one release so
+	// the operator can be downgraded.
+	LocalDiskCMData     = "devices"
+	LocalDiskCMName     = "local-device-"
+	probeInterval       = 30 * time.Second
+	healthProbeInterval = 10 * time.Minute
+	// the devices are still polled while udev is monitored in case an event is missed
+	udevProbeInterval = 5 * time.Minute
+	// wait for a burst of udev events to settle (e.g. the partitions of a new device) before probing the devices
+	udevSettleDelay     = 2 * time.Second
+	nodeName, namespace string
+	// the smart health of the devices is probed less often than the devices since the smart data changes slowly
+	deviceHealth    = map[string]*sys.DeviceHealth{}
+	lastHealthProbe time.Time
 )
 
 func Run(context *clusterd.Context) error {
@@ -52,51 +63,124 @@ func Run(context *clusterd.Context) error {
 	}
 	nodeName = os.Getenv(k8sutil.NodeNameEnvVar)
 	namespace = os.Getenv(k8sutil.PodNamespaceEnvVar)
-	cmName = LocalDiskCMName + nodeName
-	tick := time.NewTicker(probeInterval).C
+	if err := updateDeviceInventory(context); err != nil {
+		logger.Infof("failed to update device inventory: %v", err)
+	}
+
+	// react to the devices added and removed on the node as soon as udev reports them
+	events := make(chan string, 100)
+	udevDone := make(chan error, 1)
+	go func() {
+		udevDone <- monitorUdevEvents(events)
+	}()
+	ticker := time.NewTicker(udevProbeInterval)
+	var settle <-chan time.Time
+
 	sigc := make(chan os.Signal, 1)
 	signal.Notify(sigc, syscall.SIGTERM)
 	for {
 		select {
 		case <-sigc:
 			logger.Infof("shutdown signal received, exiting...")
+			ticker.Stop()
 			return nil
-		case <-tick:
-			err := updateDeviceCM(context)
-			if err != nil {
-				logger.Infof("failed to update device configmap: %v", err)
+		case device := <-events:
+			logger.Debugf("udev event for device %s", device)
+			if settle == nil {
+				settle = time.After(udevSettleDelay)
+			}
+		case <-settle:
+			settle = nil
+			if err := updateDeviceInventory(context); err != nil {
+				logger.Infof("failed to update device inventory: %v", err)
+			}
+		case err := <-udevDone:
+			logger.Warningf("udev monitor exited, polling the devices every %v. %+v", probeInterval, err)
+			udevDone = nil
+			ticker.Stop()
+			ticker = time.NewTicker(probeInterval)
+		case <-ticker.C:
+			if err := updateDeviceInventory(context); err != nil {
+				logger.Infof("failed to update device inventory: %v", err)
 			}
 		}
 	}
 }
-func updateDeviceCM(context *clusterd.Context) error {
-	logger.Infof("updating device configmap")
+
+// updateDeviceInventory saves the devices found on the node in the device inventory of the node, keeping the owners
+// of the devices that were set by the operator
+func updateDeviceInventory(context *clusterd.Context) error {
+	logger.Infof("updating device inventory")
 	devices, err := probeDevices(context)
 	if err != nil {
 		logger.Infof("failed to probe devices: %v", err)
 		return err
 	}
-	deviceJson, err := json.Marshal(devices)
+	if err := updateLegacyDeviceCM(context, devices); err != nil {
+		logger.Warningf("failed to update legacy device configmap. %+v", err)
+	}
+
+	spec := rookalpha.DeviceInventorySpec{NodeName: nodeName, Devices: make([]rookalpha.DiscoveredDevice, len(devices))}
+	for i := range devices {
+		spec.Devices[i] = ToDiscoveredDevice(&devices[i])
+	}
+
+	inventories := context.RookClientset.RookV1alpha2().DeviceInventories(namespace)
+	inventory, err := inventories.Get(nodeName, metav1.GetOptions{})
 	if err != nil {
-		logger.Infof("failed to marshal: %v", err)
-		return err
+		if !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to get device inventory %s: %+v", nodeName, err)
+		}
+
+		// the inventory doesn't exist yet, create it now
+		inventory = &rookalpha.DeviceInventory{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      nodeName,
+				Namespace: namespace,
+				Labels: map[string]string{
+					k8sutil.AppAttr: AppName,
+					NodeAttr:        nodeName,
+				},
+			},
+			Spec: spec,
+		}
+		if _, err := inventories.Create(inventory); err != nil {
+			return fmt.Errorf("failed to create device inventory %s: %+v", nodeName, err)
+		}
+		return nil
+	}
+
+	for i := range spec.Devices {
+		if previous := findDiscoveredDevice(inventory.Spec.Devices, spec.Devices[i].Name); previous != nil {
+			spec.Devices[i].Owner = previous.Owner
+		}
+	}
+	if reflect.DeepEqual(spec, inventory.Spec) {
+		return nil
 	}
-	deviceStr := string(deviceJson)
-	if cm == nil {
-		cm, err = context.Clientset.CoreV1().ConfigMaps(namespace).Get(cmName, metav1.GetOptions{})
+	inventory.Spec = spec
+	if _, err := inventories.Update(inventory); err != nil {
+		return fmt.Errorf("failed to update device inventory %s: %+v", nodeName, err)
+	}
+	return nil
+}
+
+// updateLegacyDeviceCM saves the devices of the node in the config map they were saved in before the device
+// inventory, so a previous version of the operator still finds the devices of the node after a downgrade
+func updateLegacyDeviceCM(context *clusterd.Context, devices []sys.LocalDisk) error {
+	deviceJSON, err := json.Marshal(devices)
+	if err != nil {
+		return fmt.Errorf("failed to marshal devices. %+v", err)
 	}
-	if err == nil {
-		lastDevice = cm.Data[LocalDiskCMData]
-		logger.Debugf("last devices %s", lastDevice)
-	} else {
+
+	cmName := LocalDiskCMName + nodeName
+	configMaps := context.Clientset.CoreV1().ConfigMaps(namespace)
+	cm, err := configMaps.Get(cmName, metav1.GetOptions{})
+	if err != nil {
 		if !errors.IsNotFound(err) {
-			logger.Infof("failed to get configmap: %v", err)
-			return err
+			return fmt.Errorf("failed to get configmap %s. %+v", cmName, err)
 		}
 
-		data := make(map[string]string, 1)
-		data[LocalDiskCMData] = deviceStr
-		// the map doesn't exist yet, create it now
 		cm = &v1.ConfigMap{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      cmName,
@@ -106,24 +190,20 @@ func updateDeviceCM(context *clusterd.Context) error {
 					NodeAttr:        nodeName,
 				},
 			},
-			Data: data,
+			Data: map[string]string{LocalDiskCMData: string(deviceJSON)},
 		}
-		cm, err = context.Clientset.CoreV1().ConfigMaps(namespace).Create(cm)
-		if err != nil {
-			logger.Infof("failed to create configmap: %v", err)
-			return fmt.Errorf("failed to create local device map %s: %+v", cmName, err)
+		if _, err := configMaps.Create(cm); err != nil {
+			return fmt.Errorf("failed to create configmap %s. %+v", cmName, err)
 		}
-		lastDevice = deviceStr
+		return nil
 	}
-	if deviceStr != lastDevice {
-		data := make(map[string]string, 1)
-		data[LocalDiskCMData] = deviceStr
-		cm.Data = data
-		cm, err = context.Clientset.CoreV1().ConfigMaps(namespace).Update(cm)
-		if err != nil {
-			logger.Infof("failed to update configmap %s: %v", cmName, err)
-			return err
-		}
+
+	if cm.Data[LocalDiskCMData] == string(deviceJSON) {
+		return nil
+	}
+	cm.Data = map[string]string{LocalDiskCMData: string(deviceJSON)}
+	if _, err := configMaps.Update(cm); err != nil {
+		return fmt.Errorf("failed to update configmap %s. %+v", cmName, err)
 	}
 	return nil
 }
@@ -134,6 +214,11 @@ func probeDevices(context *clusterd.Context) ([]sys.LocalDisk, error) {
 	if err != nil {
 		return devices, fmt.Errorf("failed initial hardware discovery. %+v", err)
 	}
+	probeHealth := time.Since(lastHealthProbe) >= healthProbeInterval
+	if probeHealth {
+		deviceHealth = map[string]*sys.DeviceHealth{}
+		lastHealthProbe = time.Now()
+	}
 	for _, device := range localDevices {
 		if device == nil {
 			continue
@@ -156,6 +241,14 @@ func probeDevices(context *clusterd.Context) ([]sys.LocalDisk, error) {
 		}
 		device.Partitions = partitions
 		device.Filesystem = fs
+		if probeHealth {
+			health, err := sys.GetDeviceHealth(device.Name, context.Executor)
+			if err != nil {
+				logger.Debugf("no smart health for device %s: %v", device.Name, err)
+			}
+			deviceHealth[device.Name] = health
+		}
+		device.Health = deviceHealth[device.Name]
 		devices = append(devices, *device)
 	}
 
@@ -20,10 +20,14 @@ package discover
 import (
 	"testing"
 
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
+	rookfake "github.com/rook/rook/pkg/client/clientset/versioned/fake"
 	"github.com/rook/rook/pkg/clusterd"
 	exectest "github.com/rook/rook/pkg/util/exec/test"
 
 	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
 )
 
 const udevOutput = `DEVLINKS=/dev/disk/by-id/scsi-36001405d27e5d898829468b90ce4ef8c /dev/disk/by-id/wwn-0x6001405d27e5d898829468b90ce4ef8c /dev/disk/by-path/ip-127.0.0.1:3260-iscsi-iqn.2016-06.world.srv:storage.target01-lun-0 /dev/disk/by-uuid/f2d38cba-37da-411d-b7ba-9a6696c58174
@@ -60,7 +64,58 @@ USEC_INITIALIZED=15981915740802
 `
 
 func TestProbeDevices(t *testing.T) {
-	// set up mock execute so we can verify the partitioning happens on sda
+	context := &clusterd.Context{Executor: newMockExecutor()}
+
+	devices, err := probeDevices(context)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(devices))
+	assert.Equal(t, "ext2", devices[0].Filesystem)
+	assert.NotNil(t, devices[0].Health)
+	assert.False(t, devices[0].Health.Passed)
+	assert.Equal(t, 45, devices[0].Health.Temperature)
+}
+
+func TestUpdateDeviceInventory(t *testing.T) {
+	nodeName = "node1"
+	namespace = "rook-system"
+	rookClientset := rookfake.NewSimpleClientset()
+	clientset := fake.NewSimpleClientset()
+	context := &clusterd.Context{Executor: newMockExecutor(), Clientset: clientset, RookClientset: rookClientset}
+
+	// the inventory is created with the devices of the node
+	assert.Nil(t, updateDeviceInventory(context))
+	inventory, err := rookClientset.RookV1alpha2().DeviceInventories(namespace).Get(nodeName, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, nodeName, inventory.Spec.NodeName)
+	assert.Equal(t, nodeName, inventory.Labels[NodeAttr])
+	assert.Equal(t, 1, len(inventory.Spec.Devices))
+	device := inventory.Spec.Devices[0]
+	assert.Equal(t, "testa", device.Name)
+	assert.False(t, device.Available)
+	assert.Equal(t, []string{"has a ext2 filesystem", "failing smart health"}, device.UnavailableReasons)
+
+	// the devices are still saved in the legacy config map for a downgrade
+	cm, err := clientset.CoreV1().ConfigMaps(namespace).Get(LocalDiskCMName+nodeName, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Contains(t, cm.Data[LocalDiskCMData], `"name":"testa"`)
+
+	// the owner set by the operator is kept when the inventory is updated
+	inventory.Spec.Devices[0].Owner = &rookalpha.DeviceOwner{ClusterName: "rook-ceph", OSDIDs: []int{3}}
+	_, err = rookClientset.RookV1alpha2().DeviceInventories(namespace).Update(inventory)
+	assert.Nil(t, err)
+	assert.Nil(t, updateDeviceInventory(context))
+	inventory, err = rookClientset.RookV1alpha2().DeviceInventories(namespace).Get(nodeName, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "rook-ceph", inventory.Spec.Devices[0].Owner.ClusterName)
+
+	// the inventory can be converted back to the disks of the node
+	disk := ToLocalDisk(&inventory.Spec.Devices[0])
+	assert.Equal(t, "testa", disk.Name)
+	assert.Equal(t, "ext2", disk.Filesystem)
+	assert.False(t, disk.Health.Passed)
+}
+
+func newMockExecutor() *exectest.MockExecutor {
 	executor := &exectest.MockExecutor{}
 	executor.MockExecuteCommandWithOutput = func(debug bool, name string, command string, args ...string) (string, error) {
 		logger.Infof("RUN Command for '%s'. %s arg %+v", name, command, args)
@@ -85,16 +140,11 @@ testa2   centos_host13-home
 
 		case "get disk testa fs serial":
 			output = udevOutput
+		case "smartctl testa":
+			output = `{"smart_status":{"passed":false},"temperature":{"current":45}}`
 		}
 
 		return output, nil
 	}
-
-	context := &clusterd.Context{Executor: executor}
-
-	devices, err := probeDevices(context)
-	assert.Nil(t, err)
-	assert.Equal(t, 1, len(devices))
-	assert.Equal(t, "ext2", devices[0].Filesystem)
-
+	return executor
 }
@@ -0,0 +1,119 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package discover
+
+import (
+	"fmt"
+
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
+	"github.com/rook/rook/pkg/util/sys"
+)
+
+// ToDiscoveredDevice converts a disk found on the node to its entry in the device inventory, including whether the
+// disk can be used for new storage
+func ToDiscoveredDevice(disk *sys.LocalDisk) rookalpha.DiscoveredDevice {
+	device := rookalpha.DiscoveredDevice{
+		Name:               disk.Name,
+		Parent:             disk.Parent,
+		HasChildren:        disk.HasChildren,
+		DevLinks:           disk.DevLinks,
+		Size:               disk.Size,
+		UUID:               disk.UUID,
+		Serial:             disk.Serial,
+		Type:               disk.Type,
+		Rotational:         disk.Rotational,
+		ReadOnly:           disk.Readonly,
+		Filesystem:         disk.Filesystem,
+		Vendor:             disk.Vendor,
+		Model:              disk.Model,
+		WWN:                disk.WWN,
+		WWNVendorExtension: disk.WWNVendorExtension,
+		Transport:          disk.Transport,
+		Empty:              disk.Empty,
+	}
+	for _, p := range disk.Partitions {
+		device.Partitions = append(device.Partitions,
+			rookalpha.DevicePartition{Name: p.Name, Size: p.Size, Label: p.Label, Filesystem: p.Filesystem})
+	}
+	if disk.Health != nil {
+		device.Health = &rookalpha.DeviceHealth{
+			Passed:             disk.Health.Passed,
+			ReallocatedSectors: disk.Health.ReallocatedSectors,
+			WearLevelPercent:   disk.Health.WearLevelPercent,
+			Temperature:        disk.Health.Temperature,
+		}
+	}
+
+	if disk.Readonly {
+		device.UnavailableReasons = append(device.UnavailableReasons, "read-only")
+	}
+	if len(disk.Partitions) > 0 {
+		device.UnavailableReasons = append(device.UnavailableReasons, fmt.Sprintf("has %d partitions", len(disk.Partitions)))
+	}
+	if disk.Filesystem != "" {
+		device.UnavailableReasons = append(device.UnavailableReasons, fmt.Sprintf("has a %s filesystem", disk.Filesystem))
+	}
+	if disk.Health != nil && !disk.Health.Passed {
+		device.UnavailableReasons = append(device.UnavailableReasons, "failing smart health")
+	}
+	device.Available = len(device.UnavailableReasons) == 0
+
+	return device
+}
+
+// ToLocalDisk converts an entry of the device inventory to the disk found on the node
+func ToLocalDisk(device *rookalpha.DiscoveredDevice) sys.LocalDisk {
+	disk := sys.LocalDisk{
+		Name:               device.Name,
+		Parent:             device.Parent,
+		HasChildren:        device.HasChildren,
+		DevLinks:           device.DevLinks,
+		Size:               device.Size,
+		UUID:               device.UUID,
+		Serial:             device.Serial,
+		Type:               device.Type,
+		Rotational:         device.Rotational,
+		Readonly:           device.ReadOnly,
+		Filesystem:         device.Filesystem,
+		Vendor:             device.Vendor,
+		Model:              device.Model,
+		WWN:                device.WWN,
+		WWNVendorExtension: device.WWNVendorExtension,
+		Transport:          device.Transport,
+		Empty:              device.Empty,
+	}
+	for _, p := range device.Partitions {
+		disk.Partitions = append(disk.Partitions, sys.Partition{Name: p.Name, Size: p.Size, Label: p.Label, Filesystem: p.Filesystem})
+	}
+	if device.Health != nil {
+		disk.Health = &sys.DeviceHealth{
+			Passed:             device.Health.Passed,
+			ReallocatedSectors: device.Health.ReallocatedSectors,
+			WearLevelPercent:   device.Health.WearLevelPercent,
+			Temperature:        device.Health.Temperature,
+		}
+	}
+	return disk
+}
+
+func findDiscoveredDevice(devices []rookalpha.DiscoveredDevice, name string) *rookalpha.DiscoveredDevice {
+	for i := range devices {
+		if devices[i].Name == name {
+			return &devices[i]
+		}
+	}
+	return nil
+}
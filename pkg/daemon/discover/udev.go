@@ -0,0 +1,67 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package discover
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+)
+
+// monitorUdevEvents runs udevadm to monitor the block devices being added, removed or changed on the node and sends
+// the name of the device on the events channel for each event. It returns when udevadm exits.
+func monitorUdevEvents(events chan<- string) error {
+	cmd := exec.Command("udevadm", "monitor", "--udev", "--subsystem-match=block")
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to get udevadm output. %+v", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start udevadm. %+v", err)
+	}
+
+	readUdevEvents(stdout, events)
+	return cmd.Wait()
+}
+
+// readUdevEvents reads the output of udevadm monitor until the end of the output
+func readUdevEvents(output io.Reader, events chan<- string) {
+	scanner := bufio.NewScanner(output)
+	for scanner.Scan() {
+		device, ok := parseUdevEvent(scanner.Text())
+		if ok {
+			events <- device
+		}
+	}
+}
+
+// parseUdevEvent returns the device name of a udev event line such as
+// "UDEV  [8412.162014] add      /devices/pci0000:00/0000:00:01.1/ata1/host0/target0:0:0/0:0:0:0/block/sdb (block)"
+func parseUdevEvent(line string) (string, bool) {
+	fields := strings.Fields(line)
+	if len(fields) < 4 || fields[0] != "UDEV" {
+		return "", false
+	}
+	switch fields[2] {
+	case "add", "remove", "change":
+	default:
+		return "", false
+	}
+	path := fields[3]
+	return path[strings.LastIndex(path, "/")+1:], true
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package discover
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const udevMonitorOutput = `monitor will print the received events for:
+UDEV - the event which udev sends out after rule processing
+
+UDEV  [8412.162014] add      /devices/pci0000:00/0000:00:01.1/ata1/host0/target0:0:0/0:0:0:0/block/sdb (block)
+UDEV  [8412.171232] add      /devices/pci0000:00/0000:00:01.1/ata1/host0/target0:0:0/0:0:0:0/block/sdb/sdb1 (block)
+UDEV  [8420.000121] bind     /devices/pci0000:00/0000:00:01.1/ata1/host0/target0:0:0/0:0:0:0 (scsi)
+UDEV  [8433.519836] change   /devices/virtual/block/dm-0 (block)
+UDEV  [8501.730519] remove   /devices/pci0000:00/0000:00:01.1/ata1/host0/target0:0:0/0:0:0:0/block/sdb (block)
+`
+
+func TestParseUdevEvent(t *testing.T) {
+	device, ok := parseUdevEvent("UDEV  [8412.162014] add      /devices/pci0000:00/0000:00:01.1/block/sdb (block)")
+	assert.True(t, ok)
+	assert.Equal(t, "sdb", device)
+
+	_, ok = parseUdevEvent("UDEV  [8420.000121] bind     /devices/pci0000:00/0000:00:01.1 (scsi)")
+	assert.False(t, ok)
+	_, ok = parseUdevEvent("monitor will print the received events for:")
+	assert.False(t, ok)
+	_, ok = parseUdevEvent("")
+	assert.False(t, ok)
+}
+
+func TestReadUdevEvents(t *testing.T) {
+	events := make(chan string, 10)
+	readUdevEvents(strings.NewReader(udevMonitorOutput), events)
+	close(events)
+
+	var devices []string
+	for device := range events {
+		devices = append(devices, device)
+	}
+	assert.Equal(t, []string{"sdb", "sdb1", "dm-0", "sdb"}, devices)
+}
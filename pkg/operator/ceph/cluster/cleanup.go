@@ -0,0 +1,514 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cluster
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/operator/ceph/cluster/mon"
+	"github.com/rook/rook/pkg/operator/ceph/cluster/osd"
+	"github.com/rook/rook/pkg/operator/discover"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"github.com/rook/rook/pkg/util/sys"
+	batch "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/kubernetes/pkg/kubelet/apis"
+)
+
+const (
+	cleanupAppName     = "rook-ceph-cleanup"
+	cleanupJobNameFmt  = "rook-ceph-cleanup-%s-%s"
+	cleanupClusterAttr = "rook.io/cluster"
+	cleanupNodeAttr    = "rook.io/node"
+	// the label of the mon pods with the namespace of their cluster
+	cleanupMonClusterAttr = "mon_cluster"
+)
+
+var (
+	cleanupCheckInterval = 5 * time.Second
+	// how long to wait for the daemons of the cluster to stop before cleaning up the nodes
+	cleanupStopTimeout = 5 * time.Minute
+	// how long to wait for the cleanup jobs to complete
+	cleanupJobTimeout = 15 * time.Minute
+	// the host paths that are never cleaned up even if they are set as the data dir of a cluster
+	protectedHostPaths = []string{"/", "/bin", "/boot", "/dev", "/etc", "/home", "/lib", "/lib64", "/opt", "/proc",
+		"/root", "/run", "/sbin", "/srv", "/sys", "/tmp", "/usr", "/usr/local", "/var", "/var/lib", "/var/log"}
+)
+
+// nodeCleanup is the data of the cluster to remove from a node
+type nodeCleanup struct {
+	// the persistent paths of the devices with the osds of the cluster
+	devices []string
+	// the osds of the cluster on the node. A device is only wiped if it has partitions of these osds.
+	osdIDs []int
+}
+
+// cleanupCluster removes the data of the deleted cluster from its nodes according to the cleanup policy. The results
+// of each node are reported in the status of the cluster.
+func (c *ClusterController) cleanupCluster(clust *cephv1alpha1.Cluster) {
+	policy := clust.Spec.CleanupPolicy
+	if policy.Mode == "" || policy.Mode == cephv1alpha1.CleanupModeNone {
+		return
+	}
+	if policy.Mode != cephv1alpha1.CleanupModeRemoveData && policy.Mode != cephv1alpha1.CleanupModeWipeDevices {
+		logger.Warningf("unknown cleanup mode %s for cluster %s, not cleaning up the nodes", policy.Mode, clust.Namespace)
+		return
+	}
+	if policy.Confirmation != cephv1alpha1.CleanupConfirmation {
+		logger.Warningf("cleanup of cluster %s is not confirmed with %q, not cleaning up the nodes", clust.Namespace, cephv1alpha1.CleanupConfirmation)
+		return
+	}
+
+	// the events of the cluster queued during the cleanup are received after the finalizer was removed
+	latest, err := c.context.RookClientset.CephV1alpha1().Clusters(clust.Namespace).Get(clust.Name, metav1.GetOptions{})
+	if err != nil || !hasFinalizer(latest) {
+		logger.Infof("cluster %s is already cleaned up", clust.Namespace)
+		return
+	}
+	if err := c.checkDataDirHostPath(clust); err != nil {
+		c.reportCleanup(clust, fmt.Sprintf("not cleaning up the nodes. %+v", err))
+		return
+	}
+
+	nodes, err := c.cleanupNodes(clust)
+	if err != nil {
+		logger.Errorf("failed to get the nodes of cluster %s to clean up. %+v", clust.Namespace, err)
+		return
+	}
+	if len(nodes) == 0 {
+		logger.Infof("no nodes to clean up for cluster %s", clust.Namespace)
+		return
+	}
+
+	c.reportCleanup(clust, fmt.Sprintf("stopping the daemons to clean up nodes %s", strings.Join(sortedNodes(nodes), ",")))
+	if err := c.stopClusterDaemons(clust.Namespace); err != nil {
+		c.reportCleanup(clust, fmt.Sprintf("not cleaning up the nodes since the daemons did not stop. %+v", err))
+		return
+	}
+
+	results := c.runCleanupJobs(clust, nodes)
+
+	var failures []string
+	for _, node := range sortedNodes(nodes) {
+		result := results[node]
+		if result != "" {
+			failures = append(failures, fmt.Sprintf("%s: %s", node, result))
+			continue
+		}
+		if policy.Mode == cephv1alpha1.CleanupModeWipeDevices {
+			// the wiped devices are available for other clusters
+			if err := discover.SetDeviceOwners(c.context, node, clust.Namespace, map[string][]int{}); err != nil {
+				logger.Warningf("failed to release the devices of node %s. %+v", node, err)
+			}
+		}
+	}
+
+	message := fmt.Sprintf("cleaned up %d nodes", len(nodes)-len(failures))
+	if len(failures) > 0 {
+		message = fmt.Sprintf("%s, failed to clean up %s", message, strings.Join(failures, "; "))
+	}
+	c.reportCleanup(clust, message)
+}
+
+// checkDataDirHostPath returns an error if the data dir of the cluster is a system path or is shared with another
+// cluster, in which case the data of other applications or clusters might be removed with the data of the cluster
+func (c *ClusterController) checkDataDirHostPath(clust *cephv1alpha1.Cluster) error {
+	if clust.Spec.DataDirHostPath == "" {
+		return nil
+	}
+	dataDir := filepath.Clean(clust.Spec.DataDirHostPath)
+	if !filepath.IsAbs(dataDir) {
+		return fmt.Errorf("dataDirHostPath %s is not an absolute path", clust.Spec.DataDirHostPath)
+	}
+	for _, protected := range protectedHostPaths {
+		if dataDir == protected {
+			return fmt.Errorf("dataDirHostPath %s is a system path", clust.Spec.DataDirHostPath)
+		}
+	}
+
+	clusters, err := c.context.RookClientset.CephV1alpha1().Clusters(v1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list the clusters: %+v", err)
+	}
+	for _, other := range clusters.Items {
+		if other.Namespace != clust.Namespace && other.Spec.DataDirHostPath != "" && filepath.Clean(other.Spec.DataDirHostPath) == dataDir {
+			return fmt.Errorf("dataDirHostPath %s is also used by cluster %s", clust.Spec.DataDirHostPath, other.Namespace)
+		}
+	}
+	return nil
+}
+
+// cleanupNodes returns the nodes where the cluster ran with the devices of its OSDs on each node. The devices are
+// identified by their persistent paths since the kernel names might have changed since the OSDs were created.
+func (c *ClusterController) cleanupNodes(clust *cephv1alpha1.Cluster) (map[string]*nodeCleanup, error) {
+	nodes := map[string]*nodeCleanup{}
+	addNode := func(node string) {
+		if _, ok := nodes[node]; !ok && node != "" {
+			nodes[node] = &nodeCleanup{devices: []string{}, osdIDs: []int{}}
+		}
+	}
+
+	pods, err := c.context.Clientset.CoreV1().Pods(clust.Namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the pods of the cluster: %+v", err)
+	}
+	for _, pod := range pods.Items {
+		addNode(pod.Spec.NodeName)
+	}
+
+	osdStatus, err := osd.GetOrchestrationStatus(c.context.Clientset, clust.Namespace)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the osd nodes: %+v", err)
+	}
+	for node := range osdStatus {
+		addNode(node)
+	}
+
+	if clust.Spec.CleanupPolicy.Mode != cephv1alpha1.CleanupModeWipeDevices {
+		return nodes, nil
+	}
+
+	inventories, err := c.context.RookClientset.RookV1alpha2().DeviceInventories(os.Getenv(k8sutil.PodNamespaceEnvVar)).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the device inventories: %+v", err)
+	}
+	inventoryDevices := map[string]map[string]rookalpha.DiscoveredDevice{}
+	for _, inventory := range inventories.Items {
+		inventoryDevices[inventory.Spec.NodeName] = map[string]rookalpha.DiscoveredDevice{}
+		for _, device := range inventory.Spec.Devices {
+			inventoryDevices[inventory.Spec.NodeName][device.Name] = device
+		}
+	}
+
+	devices := map[string]map[string]bool{}
+	osdIDs := map[string]map[int]bool{}
+	addDevice := func(node, name, path string, ids []int) {
+		if path == "" {
+			logger.Warningf("not wiping device %s on node %s since it has no persistent path", name, node)
+			return
+		}
+		addNode(node)
+		if devices[node] == nil {
+			devices[node] = map[string]bool{}
+			osdIDs[node] = map[int]bool{}
+		}
+		devices[node][path] = true
+		for _, id := range ids {
+			osdIDs[node][id] = true
+		}
+	}
+
+	// the partition schemes of the osds are in the cluster namespace and might already be deleted with it, while
+	// the device inventories keep the devices owned by the cluster
+	for node := range nodes {
+		osdDevices, err := osd.GetOSDDevices(c.context.Clientset, clust.Namespace, node)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the osd devices of node %s: %+v", node, err)
+		}
+		for _, device := range osdDevices {
+			path := device.PersistentID
+			if path == "" {
+				if discovered, ok := inventoryDevices[node][device.Name]; ok {
+					path = persistentDevicePath(&discovered)
+				}
+			}
+			addDevice(node, device.Name, path, device.OSDIDs)
+		}
+	}
+	for node, discovered := range inventoryDevices {
+		for _, device := range discovered {
+			if device.Owner != nil && device.Owner.ClusterName == clust.Namespace {
+				addDevice(node, device.Name, persistentDevicePath(&device), device.Owner.OSDIDs)
+			}
+		}
+	}
+
+	for node, cleanup := range nodes {
+		for path := range devices[node] {
+			cleanup.devices = append(cleanup.devices, path)
+		}
+		sort.Strings(cleanup.devices)
+		for id := range osdIDs[node] {
+			cleanup.osdIDs = append(cleanup.osdIDs, id)
+		}
+		sort.Ints(cleanup.osdIDs)
+	}
+	return nodes, nil
+}
+
+// persistentDevicePath returns a path to the device that is stable across reboots, or an empty string if udev did not
+// report any persistent link or WWN for the device
+func persistentDevicePath(device *rookalpha.DiscoveredDevice) string {
+	if path := clusterd.GetPersistentDeviceID(&sys.LocalDisk{DevLinks: device.DevLinks}); path != "" {
+		return path
+	}
+	if device.WWN != "" {
+		return sys.DiskByIDPath + "wwn-" + device.WWN
+	}
+	return ""
+}
+
+// stopClusterDaemons deletes the daemons of the cluster and waits for their pods to stop so their data can be removed.
+// Only the resources with the labels of the cluster daemons are deleted, other workloads in the namespace are kept.
+func (c *ClusterController) stopClusterDaemons(namespace string) error {
+	propagation := metav1.DeletePropagationBackground
+	options := &metav1.DeleteOptions{PropagationPolicy: &propagation}
+	extensions := c.context.Clientset.ExtensionsV1beta1()
+
+	for _, selector := range clusterDaemonSelectors(namespace) {
+		listOptions := metav1.ListOptions{LabelSelector: selector}
+		deployments, err := extensions.Deployments(namespace).List(listOptions)
+		if err != nil {
+			return fmt.Errorf("failed to list deployments: %+v", err)
+		}
+		for _, d := range deployments.Items {
+			if err := extensions.Deployments(namespace).Delete(d.Name, options); err != nil && !errors.IsNotFound(err) {
+				return fmt.Errorf("failed to delete deployment %s: %+v", d.Name, err)
+			}
+		}
+		replicaSets, err := extensions.ReplicaSets(namespace).List(listOptions)
+		if err != nil {
+			return fmt.Errorf("failed to list replicasets: %+v", err)
+		}
+		for _, rs := range replicaSets.Items {
+			if err := extensions.ReplicaSets(namespace).Delete(rs.Name, options); err != nil && !errors.IsNotFound(err) {
+				return fmt.Errorf("failed to delete replicaset %s: %+v", rs.Name, err)
+			}
+		}
+		daemonSets, err := extensions.DaemonSets(namespace).List(listOptions)
+		if err != nil {
+			return fmt.Errorf("failed to list daemonsets: %+v", err)
+		}
+		for _, ds := range daemonSets.Items {
+			if err := extensions.DaemonSets(namespace).Delete(ds.Name, options); err != nil && !errors.IsNotFound(err) {
+				return fmt.Errorf("failed to delete daemonset %s: %+v", ds.Name, err)
+			}
+		}
+		// the pods that were orphaned by their controllers are deleted as well
+		pods, err := c.context.Clientset.CoreV1().Pods(namespace).List(listOptions)
+		if err != nil {
+			return fmt.Errorf("failed to list pods: %+v", err)
+		}
+		for _, pod := range pods.Items {
+			if err := c.context.Clientset.CoreV1().Pods(namespace).Delete(pod.Name, &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+				return fmt.Errorf("failed to delete pod %s: %+v", pod.Name, err)
+			}
+		}
+	}
+
+	return wait.Poll(cleanupCheckInterval, cleanupStopTimeout, func() (bool, error) {
+		running := 0
+		for _, selector := range clusterDaemonSelectors(namespace) {
+			pods, err := c.context.Clientset.CoreV1().Pods(namespace).List(metav1.ListOptions{LabelSelector: selector})
+			if err != nil {
+				logger.Warningf("failed to list the pods of cluster %s. %+v", namespace, err)
+				return false, nil
+			}
+			running += len(pods.Items)
+		}
+		if running > 0 {
+			logger.Infof("waiting for %d pods of cluster %s to stop", running, namespace)
+			return false, nil
+		}
+		return true, nil
+	})
+}
+
+// clusterDaemonSelectors returns the label selectors of the daemons of the cluster. The mons have their own cluster
+// label while the other daemons, including the mds and rgw daemons, have the rook cluster label.
+func clusterDaemonSelectors(namespace string) []string {
+	return []string{
+		fmt.Sprintf("%s=%s", cleanupMonClusterAttr, namespace),
+		fmt.Sprintf("%s=%s", k8sutil.ClusterAttr, namespace),
+	}
+}
+
+// runCleanupJobs runs a cleanup job on each node and returns the error message of the nodes that failed to be cleaned up.
+// The jobs run in the namespace of the operator since the namespace of the cluster might be terminating.
+func (c *ClusterController) runCleanupJobs(clust *cephv1alpha1.Cluster, nodes map[string]*nodeCleanup) map[string]string {
+	namespace := os.Getenv(k8sutil.PodNamespaceEnvVar)
+	jobs := c.context.Clientset.BatchV1().Jobs(namespace)
+	results := map[string]string{}
+	pending := map[string]string{}
+	for node, cleanup := range nodes {
+		job := c.cleanupJob(clust, node, cleanup)
+		if err := jobs.Delete(job.Name, &metav1.DeleteOptions{}); err != nil && !errors.IsNotFound(err) {
+			logger.Warningf("failed to delete old cleanup job %s. %+v", job.Name, err)
+		}
+		if _, err := jobs.Create(job); err != nil {
+			results[node] = fmt.Sprintf("failed to create cleanup job. %+v", err)
+			continue
+		}
+		logger.Infof("started cleanup job %s on node %s with devices %v", job.Name, node, cleanup.devices)
+		pending[node] = job.Name
+	}
+
+	err := wait.Poll(cleanupCheckInterval, cleanupJobTimeout, func() (bool, error) {
+		for node, name := range pending {
+			job, err := jobs.Get(name, metav1.GetOptions{})
+			if err != nil {
+				logger.Warningf("failed to get cleanup job %s. %+v", name, err)
+				continue
+			}
+			if job.Status.Succeeded > 0 {
+				logger.Infof("cleaned up node %s", node)
+			} else if job.Status.Failed > 0 {
+				results[node] = c.cleanupJobError(namespace, name)
+				logger.Errorf("failed to clean up node %s. %s", node, results[node])
+			} else {
+				continue
+			}
+			delete(pending, node)
+		}
+		return len(pending) == 0, nil
+	})
+	if err != nil {
+		for node := range pending {
+			results[node] = fmt.Sprintf("cleanup job did not complete within %s", cleanupJobTimeout)
+		}
+	}
+
+	propagation := metav1.DeletePropagationBackground
+	for node := range nodes {
+		name := cleanupJobName(clust.Namespace, node)
+		if err := jobs.Delete(name, &metav1.DeleteOptions{PropagationPolicy: &propagation}); err != nil && !errors.IsNotFound(err) {
+			logger.Warningf("failed to delete cleanup job %s. %+v", name, err)
+		}
+	}
+	return results
+}
+
+// cleanupJobError returns the termination message of the failed cleanup job
+func (c *ClusterController) cleanupJobError(namespace, jobName string) string {
+	opts := metav1.ListOptions{LabelSelector: fmt.Sprintf("job-name=%s", jobName)}
+	pods, err := c.context.Clientset.CoreV1().Pods(namespace).List(opts)
+	if err == nil {
+		for _, pod := range pods.Items {
+			for _, status := range pod.Status.ContainerStatuses {
+				if status.State.Terminated != nil && status.State.Terminated.Message != "" {
+					return status.State.Terminated.Message
+				}
+			}
+		}
+	}
+	return "cleanup job failed"
+}
+
+func (c *ClusterController) cleanupJob(clust *cephv1alpha1.Cluster, node string, cleanup *nodeCleanup) *batch.Job {
+	privileged := true
+	backoffLimit := int32(0)
+	policy := clust.Spec.CleanupPolicy
+
+	env := []v1.EnvVar{
+		{Name: "ROOK_ZERO_HEADERS", Value: fmt.Sprintf("%t", policy.ZeroHeaders)},
+	}
+	if policy.Mode == cephv1alpha1.CleanupModeWipeDevices && len(cleanup.devices) > 0 {
+		osdIDs := []string{}
+		for _, id := range cleanup.osdIDs {
+			osdIDs = append(osdIDs, strconv.Itoa(id))
+		}
+		env = append(env,
+			v1.EnvVar{Name: "ROOK_DEVICES", Value: strings.Join(cleanup.devices, ",")},
+			v1.EnvVar{Name: "ROOK_OSD_IDS", Value: strings.Join(osdIDs, ",")})
+	}
+	volumes := []v1.Volume{
+		{Name: "devices", VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: "/dev"}}},
+	}
+	mounts := []v1.VolumeMount{
+		{Name: "devices", MountPath: "/dev"},
+	}
+	if clust.Spec.DataDirHostPath != "" {
+		// the data dir is only on the host if the cluster was not running in empty dirs
+		env = append(env, k8sutil.ConfigDirEnvVar(), mon.ClusterNameEnvVar(clust.Namespace))
+		volumes = append(volumes, v1.Volume{Name: k8sutil.DataDirVolume,
+			VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: clust.Spec.DataDirHostPath}}})
+		mounts = append(mounts, v1.VolumeMount{Name: k8sutil.DataDirVolume, MountPath: k8sutil.DataDir})
+	}
+
+	labels := map[string]string{
+		k8sutil.AppAttr:    cleanupAppName,
+		cleanupClusterAttr: clust.Namespace,
+		cleanupNodeAttr:    node,
+	}
+	return &batch.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   cleanupJobName(clust.Namespace, node),
+			Labels: labels,
+		},
+		Spec: batch.JobSpec{
+			BackoffLimit: &backoffLimit,
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: labels},
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{
+						{
+							Name:            cleanupAppName,
+							Image:           k8sutil.MakeRookImage(c.rookImage),
+							Args:            []string{"ceph", "cleanup"},
+							Env:             env,
+							VolumeMounts:    mounts,
+							SecurityContext: &v1.SecurityContext{Privileged: &privileged},
+						},
+					},
+					RestartPolicy: v1.RestartPolicyNever,
+					NodeSelector:  map[string]string{apis.LabelHostname: node},
+					Volumes:       volumes,
+				},
+			},
+		},
+	}
+}
+
+func (c *ClusterController) reportCleanup(clust *cephv1alpha1.Cluster, message string) {
+	logger.Infof("cleanup of cluster %s: %s", clust.Namespace, message)
+	if err := c.updateClusterStatus(clust.Namespace, clust.Name, cephv1alpha1.ClusterStateDeleting, message); err != nil {
+		logger.Warningf("failed to update the status of cluster %s. %+v", clust.Namespace, err)
+	}
+}
+
+func cleanupJobName(clusterName, node string) string {
+	return fmt.Sprintf(cleanupJobNameFmt, clusterName, node)
+}
+
+func hasFinalizer(clust *cephv1alpha1.Cluster) bool {
+	for _, finalizer := range clust.Finalizers {
+		if finalizer == finalizerName {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedNodes(nodes map[string]*nodeCleanup) []string {
+	names := []string{}
+	for node := range nodes {
+		names = append(names, node)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cluster
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
+	rookfake "github.com/rook/rook/pkg/client/clientset/versioned/fake"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/kubernetes/pkg/kubelet/apis"
+)
+
+func TestCleanupCluster(t *testing.T) {
+	os.Setenv(k8sutil.PodNamespaceEnvVar, "rook-system")
+	defer os.Unsetenv(k8sutil.PodNamespaceEnvVar)
+	cleanupCheckInterval = 10 * time.Millisecond
+	cleanupStopTimeout = time.Second
+	cleanupJobTimeout = 5 * time.Second
+
+	clust := &cephv1alpha1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "mycluster", Namespace: "ns", Finalizers: []string{finalizerName}},
+		Spec: cephv1alpha1.ClusterSpec{
+			DataDirHostPath: "/var/lib/rook",
+			CleanupPolicy:   cephv1alpha1.CleanupPolicySpec{Mode: cephv1alpha1.CleanupModeWipeDevices},
+		},
+	}
+	inventory := &rookalpha.DeviceInventory{
+		ObjectMeta: metav1.ObjectMeta{Name: "node2", Namespace: "rook-system"},
+		Spec: rookalpha.DeviceInventorySpec{NodeName: "node2", Devices: []rookalpha.DiscoveredDevice{
+			{Name: "sda", DevLinks: "/dev/disk/by-path/pci-0000:00:1f.2-ata-1 /dev/disk/by-id/ata-SAMSUNG_1", Owner: &rookalpha.DeviceOwner{ClusterName: "ns", OSDIDs: []int{0}}},
+			{Name: "sdd", WWN: "0x5000c500", Owner: &rookalpha.DeviceOwner{ClusterName: "ns", OSDIDs: []int{1, 2}}},
+			{Name: "sde", Owner: &rookalpha.DeviceOwner{ClusterName: "ns", OSDIDs: []int{3}}},
+			{Name: "sdb", Owner: &rookalpha.DeviceOwner{ClusterName: "other", OSDIDs: []int{0}}},
+			{Name: "sdc", Available: true}}},
+	}
+	monPod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "mon-a", Namespace: "ns", Labels: map[string]string{cleanupMonClusterAttr: "ns"}},
+		Spec: v1.PodSpec{NodeName: "node1"}}
+	osdPod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "osd-0", Namespace: "ns", Labels: map[string]string{k8sutil.ClusterAttr: "ns"}},
+		Spec: v1.PodSpec{NodeName: "node2"}}
+	otherPod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "ns", Labels: map[string]string{"app": "other"}}}
+	clientset := fake.NewSimpleClientset(monPod, osdPod, otherPod)
+	rookClientset := rookfake.NewSimpleClientset(clust, inventory)
+	c := &ClusterController{context: &clusterd.Context{Clientset: clientset, RookClientset: rookClientset}, rookImage: "rook/ceph:test"}
+
+	// the cleanup is not run without the confirmation
+	c.cleanupCluster(clust)
+	jobs, err := clientset.BatchV1().Jobs("rook-system").List(metav1.ListOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(jobs.Items))
+
+	// the nodes where the cluster ran are found with the persistent paths of the devices owned by the cluster. The
+	// devices without a persistent path are not wiped.
+	clust.Spec.CleanupPolicy.Confirmation = cephv1alpha1.CleanupConfirmation
+	nodes, err := c.cleanupNodes(clust)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(nodes))
+	assert.Equal(t, []string{}, nodes["node1"].devices)
+	assert.Equal(t, []string{"/dev/disk/by-id/ata-SAMSUNG_1", "/dev/disk/by-id/wwn-0x5000c500"}, nodes["node2"].devices)
+	assert.Equal(t, []int{0, 1, 2}, nodes["node2"].osdIDs)
+
+	// the job wipes the devices of the node and removes the data dir
+	job := c.cleanupJob(clust, "node2", nodes["node2"])
+	assert.Equal(t, "rook-ceph-cleanup-ns-node2", job.Name)
+	assert.Equal(t, "node2", job.Spec.Template.Spec.NodeSelector[apis.LabelHostname])
+	assert.Equal(t, []string{"ceph", "cleanup"}, job.Spec.Template.Spec.Containers[0].Args)
+	assert.Equal(t, v1.RestartPolicyNever, job.Spec.Template.Spec.RestartPolicy)
+	env := map[string]string{}
+	for _, e := range job.Spec.Template.Spec.Containers[0].Env {
+		env[e.Name] = e.Value
+	}
+	assert.Equal(t, "/dev/disk/by-id/ata-SAMSUNG_1,/dev/disk/by-id/wwn-0x5000c500", env["ROOK_DEVICES"])
+	assert.Equal(t, "0,1,2", env["ROOK_OSD_IDS"])
+	assert.Equal(t, k8sutil.DataDir, env["ROOK_CONFIG_DIR"])
+	assert.Equal(t, "ns", env["ROOK_CLUSTER_NAME"])
+	assert.Equal(t, "/var/lib/rook", job.Spec.Template.Spec.Volumes[1].HostPath.Path)
+
+	// the nodes are not cleaned up if the data dir is a system path or is shared with another cluster
+	clust.Spec.DataDirHostPath = "/var/"
+	assert.NotNil(t, c.checkDataDirHostPath(clust))
+	clust.Spec.DataDirHostPath = "/var/lib/rook"
+	other := &cephv1alpha1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "other", Namespace: "other"},
+		Spec:       cephv1alpha1.ClusterSpec{DataDirHostPath: "/var/lib/rook/"},
+	}
+	_, err = rookClientset.CephV1alpha1().Clusters("other").Create(other)
+	assert.Nil(t, err)
+	c.cleanupCluster(clust)
+	jobs, err = clientset.BatchV1().Jobs("rook-system").List(metav1.ListOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(jobs.Items))
+	updated, err := rookClientset.CephV1alpha1().Clusters("ns").Get("mycluster", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "not cleaning up the nodes. dataDirHostPath /var/lib/rook is also used by cluster other", updated.Status.Message)
+	assert.Nil(t, rookClientset.CephV1alpha1().Clusters("other").Delete("other", &metav1.DeleteOptions{}))
+
+	// complete the jobs, failing the one on node1
+	go func() {
+		for i := 0; i < 100; i++ {
+			jobs, _ := clientset.BatchV1().Jobs("rook-system").List(metav1.ListOptions{})
+			if len(jobs.Items) == 2 {
+				for _, job := range jobs.Items {
+					if job.Name == "rook-ceph-cleanup-ns-node1" {
+						job.Status.Failed = 1
+						pod := &v1.Pod{
+							ObjectMeta: metav1.ObjectMeta{Name: "cleanup-node1", Namespace: "rook-system", Labels: map[string]string{"job-name": job.Name}},
+							Status: v1.PodStatus{ContainerStatuses: []v1.ContainerStatus{
+								{State: v1.ContainerState{Terminated: &v1.ContainerStateTerminated{Message: "failed to read data dir"}}}}},
+						}
+						clientset.CoreV1().Pods("rook-system").Create(pod)
+					} else {
+						job.Status.Succeeded = 1
+					}
+					clientset.BatchV1().Jobs("rook-system").Update(&job)
+				}
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	c.cleanupCluster(clust)
+
+	// the daemons were stopped while the other pods in the namespace are kept, and the results are reported
+	pods, err := clientset.CoreV1().Pods("ns").List(metav1.ListOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(pods.Items))
+	assert.Equal(t, "app", pods.Items[0].Name)
+	updated, err = rookClientset.CephV1alpha1().Clusters("ns").Get("mycluster", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, cephv1alpha1.ClusterStateDeleting, updated.Status.State)
+	assert.Equal(t, "cleaned up 1 nodes, failed to clean up node1: failed to read data dir", updated.Status.Message)
+
+	// the jobs are deleted and the wiped devices are released
+	jobs, err = clientset.BatchV1().Jobs("rook-system").List(metav1.ListOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(jobs.Items))
+	inventory, err = rookClientset.RookV1alpha2().DeviceInventories("rook-system").Get("node2", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Nil(t, inventory.Spec.Devices[0].Owner)
+	assert.Nil(t, inventory.Spec.Devices[1].Owner)
+	assert.Equal(t, "other", inventory.Spec.Devices[3].Owner.ClusterName)
+
+	// the cleanup is not run again once the finalizer is removed
+	_, err = clientset.CoreV1().Pods("ns").Create(monPod)
+	assert.Nil(t, err)
+	updated.Finalizers = nil
+	updated.Status.Message = "done"
+	_, err = rookClientset.CephV1alpha1().Clusters("ns").Update(updated)
+	assert.Nil(t, err)
+	c.cleanupCluster(clust)
+	pods, err = clientset.CoreV1().Pods("ns").List(metav1.ListOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(pods.Items))
+}
@@ -22,6 +22,7 @@ import (
 	"os"
 	"reflect"
 	"sort"
+	"sync"
 	"time"
 
 	"github.com/coreos/pkg/capnslog"
@@ -35,6 +36,7 @@ import (
 	"github.com/rook/rook/pkg/operator/ceph/cluster/mgr"
 	"github.com/rook/rook/pkg/operator/ceph/cluster/mon"
 	"github.com/rook/rook/pkg/operator/ceph/cluster/osd"
+	"github.com/rook/rook/pkg/operator/ceph/cluster/rbd"
 	"github.com/rook/rook/pkg/operator/ceph/file"
 	"github.com/rook/rook/pkg/operator/ceph/object"
 	"github.com/rook/rook/pkg/operator/ceph/pool"
@@ -64,6 +66,7 @@ const (
 	DefaultClusterName         = "rook"
 	clusterDeleteRetryInterval = 2 //seconds
 	clusterDeleteMaxRetries    = 15
+	statusUpdateRetries        = 5
 )
 
 var (
@@ -98,17 +101,22 @@ type ClusterController struct {
 	rookImage        string
 	watchLegacyTypes bool
 	stopCh           chan struct{}
+	// the namespaces of the clusters being finalized
+	finalizing     map[string]bool
+	finalizingLock sync.Mutex
 }
 
 type cluster struct {
-	context   *clusterd.Context
-	Namespace string
-	Spec      cephv1alpha1.ClusterSpec
-	mons      *mon.Cluster
-	mgrs      *mgr.Cluster
-	osds      *osd.Cluster
-	stopCh    chan struct{}
-	ownerRef  metav1.OwnerReference
+	context    *clusterd.Context
+	Namespace  string
+	Name       string
+	Spec       cephv1alpha1.ClusterSpec
+	mons       *mon.Cluster
+	mgrs       *mgr.Cluster
+	rbdMirrors *rbd.Mirroring
+	osds       *osd.Cluster
+	stopCh     chan struct{}
+	ownerRef   metav1.OwnerReference
 }
 
 // NewClusterController create controller for watching cluster custom resources created
@@ -178,6 +186,14 @@ func (c *ClusterController) onAdd(obj interface{}) {
 		return
 	}
 
+	if err := validateClusterSpec(&cluster.Spec); err != nil {
+		logger.Errorf("invalid cluster spec in namespace %s. %+v", cluster.Namespace, err)
+		if err := c.updateClusterStatus(clusterObj.Namespace, clusterObj.Name, cephv1alpha1.ClusterStateError, err.Error()); err != nil {
+			logger.Errorf("failed to update cluster status in namespace %s: %+v", cluster.Namespace, err)
+		}
+		return
+	}
+
 	if cluster.Spec.Storage.AnyUseAllDevices() {
 		c.devicesInUse = true
 	}
@@ -228,10 +244,23 @@ func (c *ClusterController) onAdd(obj interface{}) {
 	cluster.stopCh = make(chan struct{})
 	c.stopCh = cluster.stopCh
 
+	// Start erasure code profile CRD watcher before the pools that reference the profiles
+	ecProfileController := pool.NewErasureCodeProfileController(c.context)
+	ecProfileController.StartWatch(cluster.Namespace, cluster.stopCh)
+
 	// Start pool CRD watcher
 	poolController := pool.NewPoolController(c.context)
 	poolController.StartWatch(cluster.Namespace, cluster.stopCh, c.watchLegacyTypes)
 
+	// Start increasing the placement groups of the pools toward their settings
+	pgAdvisor := pool.NewPGAdvisor(c.context, cluster.Namespace)
+	go pgAdvisor.Run(cluster.stopCh)
+
+	// Start reconciling the pools with their settings and reporting their usage, and retrying the deletion of the
+	// file systems and object stores built on them
+	poolMonitor := pool.NewPoolMonitor(c.context, cluster.Namespace, file.RetryDeletions, object.RetryDeletions)
+	go poolMonitor.Run(cluster.stopCh)
+
 	// Start object store CRD watcher
 	objectStoreController := object.NewObjectStoreController(c.context, c.rookImage, cluster.Spec.Network.HostNetwork, cluster.ownerRef)
 	objectStoreController.StartWatch(cluster.Namespace, cluster.stopCh, c.watchLegacyTypes)
@@ -244,6 +273,35 @@ func (c *ClusterController) onAdd(obj interface{}) {
 	healthChecker := mon.NewHealthChecker(cluster.mons)
 	go healthChecker.Check(cluster.stopCh)
 
+	// Start reweighting the osds by their utilization if enabled in the cluster CRD
+	reweightMonitor := osd.NewReweightMonitor(c.context, clusterObj.Namespace, clusterObj.Name)
+	go reweightMonitor.Run(cluster.stopCh)
+
+	// Start applying the scrub settings of the cluster CRD to the osds and reporting the scrub ages
+	scrubMonitor := osd.NewScrubMonitor(c.context, clusterObj.Namespace, clusterObj.Name, cluster.ownerRef)
+	go scrubMonitor.Run(cluster.stopCh)
+
+	// Start moving the hosts in the crush map when the topology labels of their nodes change
+	topologyMonitor := osd.NewTopologyMonitor(c.context, clusterObj.Namespace, clusterObj.Name)
+	go topologyMonitor.Run(cluster.stopCh)
+
+	// Start retrying the crush settings that could not be applied, such as the rules of a device class without osds yet
+	go c.runCrushMonitor(clusterObj.Namespace, clusterObj.Name, cluster.stopCh)
+
+	// Start reporting the devices that are failing according to their SMART health
+	deviceHealthMonitor := osd.NewDeviceHealthMonitor(c.context, clusterObj.Namespace, clusterObj.Name)
+	go deviceHealthMonitor.Run(cluster.stopCh)
+
+	// Start osds on the devices added to the storage nodes as soon as they are discovered
+	deviceWatcher := osd.NewDeviceWatcher(c.context, func() (*osd.Cluster, error) {
+		current, err := c.context.RookClientset.CephV1alpha1().Clusters(clusterObj.Namespace).Get(clusterObj.Name, metav1.GetOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return newCluster(current, c.context).newOSDCluster(c.rookImage), nil
+	})
+	deviceWatcher.StartWatch(cluster.stopCh)
+
 	// add the finalizer to the crd
 	err = c.addFinalizer(clusterObj)
 	if err != nil {
@@ -292,13 +350,13 @@ func (c *ClusterController) onUpdate(oldObj, newObj interface{}) {
 	// K8s will only delete the crd and child resources when the finalizers have been removed from the crd.
 	if newClust.DeletionTimestamp != nil {
 		logger.Infof("cluster %s has a deletion timestamp", newClust.Namespace)
-		err := c.handleDelete(newClust, time.Duration(clusterDeleteRetryInterval)*time.Second)
-		if err != nil {
-			logger.Errorf("failed finalizer for cluster. %+v", err)
+		// the cleanup of the nodes can take several minutes, so the cluster is finalized in the background while the
+		// events of the other clusters are handled. The events of this cluster are ignored until it is finalized.
+		if !c.startFinalizing(newClust.Namespace) {
+			logger.Infof("cluster %s is already being finalized", newClust.Namespace)
 			return
 		}
-		// remove the finalizer from the crd, which indicates to k8s that the resource can safely be deleted
-		c.removeFinalizer(newClust)
+		go c.finalizeCluster(newClust)
 		return
 	}
 
@@ -307,6 +365,14 @@ func (c *ClusterController) onUpdate(oldObj, newObj interface{}) {
 		return
 	}
 
+	if err := validateClusterSpec(&newClust.Spec); err != nil {
+		logger.Errorf("invalid cluster spec in namespace %s, not updating the cluster. %+v", newClust.Namespace, err)
+		if err := c.updateClusterStatus(newClust.Namespace, newClust.Name, cephv1alpha1.ClusterStateError, err.Error()); err != nil {
+			logger.Errorf("failed to update cluster status in namespace %s: %+v", newClust.Namespace, err)
+		}
+		return
+	}
+
 	logger.Infof("update event for cluster %s is supported, orchestrating update now", newClust.Namespace)
 	logger.Debugf("old cluster: %+v", oldClust.Spec)
 	logger.Debugf("new cluster: %+v", newClust.Spec)
@@ -441,6 +507,68 @@ func isLegacyClusterObjectDeleted(obj interface{}) bool {
 // ************************************************************************************************
 // Finalizer functions
 // ************************************************************************************************
+// finalizeCluster deletes the resources of the cluster, cleans up its nodes and removes the finalizer of the cluster
+func (c *ClusterController) finalizeCluster(newClust *cephv1alpha1.Cluster) {
+	defer c.doneFinalizing(newClust.Namespace)
+
+	// the deletion is retried here since the update events of the cluster are ignored while it is finalized. Note the
+	// first attempt is done outside of wait.Poll because that function waits for the retry interval before trying.
+	deleteCluster := func() (bool, error) {
+		if err := c.handleDelete(newClust, time.Duration(clusterDeleteRetryInterval)*time.Second); err != nil {
+			logger.Errorf("failed finalizer for cluster %s, retrying in %s. %+v", newClust.Namespace, updateClusterInterval, err)
+			return false, nil
+		}
+		return true, nil
+	}
+	if done, _ := deleteCluster(); !done {
+		if err := wait.Poll(updateClusterInterval, updateClusterTimeout, deleteCluster); err != nil {
+			// the finalizer is kept, so the finalization is started again with the next update event of the cluster
+			logger.Errorf("giving up finalizing cluster %s after %s", newClust.Namespace, updateClusterTimeout)
+			return
+		}
+	}
+	c.cleanupCluster(newClust)
+
+	// the ceph resources are deleted with the cluster, so their finalizers must not block the namespace deletion
+	// after the controllers stop watching them
+	if err := pool.RemoveFinalizers(c.context, newClust.Namespace); err != nil {
+		logger.Warningf("failed to remove the pool finalizers of cluster %s. %+v", newClust.Namespace, err)
+	}
+	if err := file.RemoveFinalizers(c.context, newClust.Namespace); err != nil {
+		logger.Warningf("failed to remove the file system finalizers of cluster %s. %+v", newClust.Namespace, err)
+	}
+	if err := object.RemoveFinalizers(c.context, newClust.Namespace); err != nil {
+		logger.Warningf("failed to remove the object store finalizers of cluster %s. %+v", newClust.Namespace, err)
+	}
+
+	// get the latest cluster since its status may have been updated by the cleanup
+	if latest, err := c.context.RookClientset.CephV1alpha1().Clusters(newClust.Namespace).Get(newClust.Name, metav1.GetOptions{}); err == nil {
+		newClust = latest
+	}
+	// remove the finalizer from the crd, which indicates to k8s that the resource can safely be deleted
+	c.removeFinalizer(newClust)
+}
+
+// startFinalizing returns whether the finalization of the cluster can start, false if it is already in progress
+func (c *ClusterController) startFinalizing(namespace string) bool {
+	c.finalizingLock.Lock()
+	defer c.finalizingLock.Unlock()
+	if c.finalizing == nil {
+		c.finalizing = map[string]bool{}
+	}
+	if c.finalizing[namespace] {
+		return false
+	}
+	c.finalizing[namespace] = true
+	return true
+}
+
+func (c *ClusterController) doneFinalizing(namespace string) {
+	c.finalizingLock.Lock()
+	defer c.finalizingLock.Unlock()
+	delete(c.finalizing, namespace)
+}
+
 func (c *ClusterController) addFinalizer(clust *cephv1alpha1.Cluster) error {
 
 	// get the latest cluster object since we probably updated it before we got to this point (e.g. by updating its status)
@@ -548,7 +676,11 @@ func (c *ClusterController) updateClusterStatus(namespace, name string, state ce
 	}
 
 	// update the status on the retrieved cluster object
-	cluster.Status = cephv1alpha1.ClusterStatus{State: state, Message: message}
+	cluster.Status.State = state
+	cluster.Status.Message = message
+
+	setOSDNodesStatus(c.context, cluster)
+
 	if _, err := c.context.RookClientset.CephV1alpha1().Clusters(cluster.Namespace).Update(cluster); err != nil {
 		return fmt.Errorf("failed to update cluster %s status: %+v", cluster.Namespace, err)
 	}
@@ -556,8 +688,44 @@ func (c *ClusterController) updateClusterStatus(namespace, name string, state ce
 	return nil
 }
 
+// updateOSDNodesStatus reports the OSD orchestration status of each node in the cluster CRD after the OSDs are
+// orchestrated, since the state of the cluster may not change
+func (c *cluster) updateOSDNodesStatus() error {
+	// the controller updates the state of the cluster at the same time, retry if the CRD changed
+	var err error
+	for i := 0; i < statusUpdateRetries; i++ {
+		var cluster *cephv1alpha1.Cluster
+		cluster, err = c.context.RookClientset.CephV1alpha1().Clusters(c.Namespace).Get(c.Name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get cluster %s prior to updating its osd status: %+v", c.Namespace, err)
+		}
+		setOSDNodesStatus(c.context, cluster)
+		if _, err = c.context.RookClientset.CephV1alpha1().Clusters(c.Namespace).Update(cluster); err == nil || !errors.IsConflict(err) {
+			break
+		}
+		logger.Infof("conflict updating the osd status of cluster %s, will retry. %+v", c.Namespace, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update the osd status of cluster %s: %+v", c.Namespace, err)
+	}
+	return nil
+}
+
+// setOSDNodesStatus sets the latest OSD orchestration status of each node so it can be inspected from the cluster CRD
+func setOSDNodesStatus(context *clusterd.Context, cluster *cephv1alpha1.Cluster) {
+	osdStatus, err := osd.GetOrchestrationStatus(context.Clientset, cluster.Namespace)
+	if err != nil {
+		logger.Warningf("failed to get osd orchestration status in namespace %s. %+v", cluster.Namespace, err)
+		return
+	}
+	cluster.Status.OSDNodes = map[string]cephv1alpha1.OSDNodeStatus{}
+	for node, status := range osdStatus {
+		cluster.Status.OSDNodes[node] = cephv1alpha1.OSDNodeStatus(status)
+	}
+}
+
 func newCluster(c *cephv1alpha1.Cluster, context *clusterd.Context) *cluster {
-	return &cluster{Namespace: c.Namespace, Spec: c.Spec, context: context, ownerRef: ClusterOwnerRef(c.Namespace, string(c.UID))}
+	return &cluster{Namespace: c.Namespace, Name: c.Name, Spec: c.Spec, context: context, ownerRef: ClusterOwnerRef(c.Namespace, string(c.UID))}
 }
 
 func ClusterOwnerRef(namespace, clusterID string) metav1.OwnerReference {
@@ -611,18 +779,42 @@ func (c *cluster) createInstance(rookImage string) error {
 		return fmt.Errorf("failed to start the ceph mgr. %+v", err)
 	}
 
+	c.rbdMirrors = rbd.New(c.context, c.Namespace, rookImage, c.Spec.RBDMirroring.Workers, cephv1alpha1.GetRBDMirrorPlacement(c.Spec.Placement),
+		c.Spec.Network.HostNetwork, cephv1alpha1.GetRBDMirrorResources(c.Spec.Resources), c.ownerRef)
+	err = c.rbdMirrors.Start()
+	if err != nil {
+		return fmt.Errorf("failed to start the rbd-mirror daemons. %+v", err)
+	}
+
 	// Start the OSDs
-	c.osds = osd.New(c.context, c.Namespace, rookImage, c.Spec.Storage, c.Spec.DataDirHostPath,
-		cephv1alpha1.GetOSDPlacement(c.Spec.Placement), c.Spec.Network.HostNetwork, cephv1alpha1.GetOSDResources(c.Spec.Resources), c.ownerRef)
+	c.osds = c.newOSDCluster(rookImage)
 	err = c.osds.Start()
+	if statusErr := c.updateOSDNodesStatus(); statusErr != nil {
+		logger.Warningf("%+v", statusErr)
+	}
 	if err != nil {
 		return fmt.Errorf("failed to start the osds. %+v", err)
 	}
 
+	// the crush settings are applied after the osds are started since the rules of a device class need its osds. the
+	// other daemons do not need the settings, so failing to apply them does not fail the orchestration and the crush
+	// monitor retries them.
+	if err := c.reconcileCrush(); err != nil {
+		logger.Warningf("failed to apply the crush settings. %+v", err)
+	}
+
 	logger.Infof("Done creating rook instance in namespace %s", c.Namespace)
 	return nil
 }
 
+func (c *cluster) newOSDCluster(rookImage string) *osd.Cluster {
+	osds := osd.New(c.context, c.Namespace, rookImage, c.Spec.Storage, c.Spec.DataDirHostPath,
+		cephv1alpha1.GetOSDPlacement(c.Spec.Placement), c.Spec.Network.HostNetwork, cephv1alpha1.GetOSDResources(c.Spec.Resources),
+		c.Spec.OSDOrchestration, c.ownerRef)
+	osds.CrushTopology = c.Spec.CrushTopology
+	return osds
+}
+
 func (c *cluster) createInitialCrushMap() error {
 	configMapExists := false
 	createCrushMap := false
@@ -652,7 +844,7 @@ func (c *cluster) createInitialCrushMap() error {
 	}
 
 	logger.Info("creating initial crushmap")
-	out, err := client.CreateDefaultCrushMap(c.context, c.Namespace)
+	out, err := client.CreateDefaultCrushMap(c.context, c.Namespace, c.Spec.Crush.Tunables)
 	if err != nil {
 		return fmt.Errorf("failed to create initial crushmap: %+v. output: %s", err, out)
 	}
@@ -682,6 +874,26 @@ func (c *cluster) createInitialCrushMap() error {
 	return nil
 }
 
+// validateClusterSpec checks the settings of the cluster CRD that cannot be applied
+func validateClusterSpec(spec *cephv1alpha1.ClusterSpec) error {
+	if spec.Storage.UseAllNodes {
+		// the osds of all nodes run in a single daemon set, so the osds of a single node cannot be stopped
+		for _, n := range spec.Storage.Nodes {
+			if n.Maintenance {
+				return fmt.Errorf("node %s cannot be put in maintenance when useAllNodes is true", n.Name)
+			}
+		}
+	}
+	if spec.RBDMirroring.Workers > rbd.MaxWorkers {
+		return fmt.Errorf("cannot have more than %d rbd-mirror workers", rbd.MaxWorkers)
+	}
+	if err := osd.ValidateScrubSpec(&spec.Scrub); err != nil {
+		return err
+	}
+
+	return nil
+}
+
 func clusterChanged(oldCluster, newCluster cephv1alpha1.ClusterSpec) bool {
 	changeFound := false
 	oldStorage := oldCluster.Storage
@@ -700,5 +912,15 @@ func clusterChanged(oldCluster, newCluster cephv1alpha1.ClusterSpec) bool {
 		changeFound = true
 	}
 
+	if !reflect.DeepEqual(oldCluster.Crush, newCluster.Crush) {
+		logger.Infof("the crush settings have changed")
+		changeFound = true
+	}
+
+	if oldCluster.RBDMirroring.Workers != newCluster.RBDMirroring.Workers {
+		logger.Infof("rbd-mirror workers changed from %d to %d", oldCluster.RBDMirroring.Workers, newCluster.RBDMirroring.Workers)
+		changeFound = true
+	}
+
 	return changeFound
 }
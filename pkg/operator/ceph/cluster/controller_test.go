@@ -23,8 +23,10 @@ import (
 
 	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
 	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
+	rookfake "github.com/rook/rook/pkg/client/clientset/versioned/fake"
 	"github.com/rook/rook/pkg/clusterd"
 	"github.com/rook/rook/pkg/daemon/ceph/agent/flexvolume/attachment"
+	"github.com/rook/rook/pkg/operator/ceph/cluster/osd"
 	"github.com/rook/rook/pkg/operator/k8sutil"
 	testop "github.com/rook/rook/pkg/operator/test"
 	exectest "github.com/rook/rook/pkg/util/exec/test"
@@ -150,3 +152,54 @@ func TestClusterChanged(t *testing.T) {
 	}
 	assert.False(t, clusterChanged(old, new))
 }
+
+func TestValidateClusterSpec(t *testing.T) {
+	spec := cephv1alpha1.ClusterSpec{
+		Storage: rookalpha.StorageScopeSpec{
+			Nodes: []rookalpha.Node{{Name: "node1", Maintenance: true}},
+		},
+	}
+	assert.Nil(t, validateClusterSpec(&spec))
+
+	// maintenance is not supported for the nodes of the osd daemon set
+	spec.Storage.UseAllNodes = true
+	assert.NotNil(t, validateClusterSpec(&spec))
+	spec.Storage.Nodes[0].Maintenance = false
+	assert.Nil(t, validateClusterSpec(&spec))
+
+	// the number of rbd-mirror daemons is limited
+	spec.RBDMirroring.Workers = 6
+	assert.NotNil(t, validateClusterSpec(&spec))
+	spec.RBDMirroring.Workers = 5
+	assert.Nil(t, validateClusterSpec(&spec))
+
+	// the scrub window must be made of valid hours and week days
+	spec.Scrub.EndHour = 24
+	assert.NotNil(t, validateClusterSpec(&spec))
+	spec.Scrub.EndHour = 0
+	spec.Scrub.EndWeekDay = 7
+	assert.NotNil(t, validateClusterSpec(&spec))
+	spec.Scrub.EndWeekDay = 6
+	assert.Nil(t, validateClusterSpec(&spec))
+}
+
+func TestUpdateOSDNodesStatus(t *testing.T) {
+	clientset := testop.New(3)
+	clusterObj := &cephv1alpha1.Cluster{
+		ObjectMeta: metav1.ObjectMeta{Name: "mycluster", Namespace: "ns"},
+		Status:     cephv1alpha1.ClusterStatus{State: cephv1alpha1.ClusterStateCreated},
+	}
+	context := &clusterd.Context{Clientset: clientset, RookClientset: rookfake.NewSimpleClientset(clusterObj)}
+	c := newCluster(clusterObj, context)
+
+	// the status of the nodes is refreshed without changing the state of the cluster
+	err := osd.UpdateOrchestrationStatusMap(clientset, "ns", "node1", osd.OrchestrationStatus{Status: osd.OrchestrationStatusCompleted, OSDsCreated: []int{3}})
+	assert.Nil(t, err)
+	err = c.updateOSDNodesStatus()
+	assert.Nil(t, err)
+	updated, err := context.RookClientset.CephV1alpha1().Clusters("ns").Get("mycluster", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, cephv1alpha1.ClusterStateCreated, updated.Status.State)
+	assert.Equal(t, osd.OrchestrationStatusCompleted, updated.Status.OSDNodes["node1"].Status)
+	assert.Equal(t, []int{3}, updated.Status.OSDNodes["node1"].OSDsCreated)
+}
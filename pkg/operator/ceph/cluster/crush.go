@@ -0,0 +1,269 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cluster
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	crushSettingsReason = "CrushSettings"
+	crushCheckInterval  = 5 * time.Minute
+)
+
+// tunablesMinClient is the oldest client release that can connect to a cluster with each crush tunables profile
+var tunablesMinClient = map[string]string{
+	"argonaut": "argonaut",
+	"bobtail":  "bobtail",
+	"firefly":  "firefly",
+	"hammer":   "hammer",
+	"jewel":    "jewel",
+}
+
+// runCrushMonitor applies the crush settings of the cluster CRD periodically until the stop channel is closed, so that
+// the settings that failed to apply are retried
+func (c *ClusterController) runCrushMonitor(namespace, name string, stopCh chan struct{}) {
+	k8sutil.RunMonitor("crush monitor", namespace, stopCh, func() time.Duration { return crushCheckInterval }, func() {
+		current, err := c.context.RookClientset.CephV1alpha1().Clusters(namespace).Get(name, metav1.GetOptions{})
+		if err != nil {
+			logger.Warningf("failed to get the crush settings of cluster %s. %+v", namespace, err)
+			return
+		}
+		if err := newCluster(current, c.context).reconcileCrush(); err != nil {
+			logger.Warningf("failed to apply the crush settings. %+v", err)
+		}
+	})
+}
+
+// reconcileCrush applies the min compat client, the tunables and the custom buckets and rules of the crush settings.
+// The settings that would lock out the connected clients are not applied.
+func (c *cluster) reconcileCrush() error {
+	crush := c.Spec.Crush
+	if crush.RequireMinCompatClient != "" {
+		if err := c.setRequireMinCompatClient(crush.RequireMinCompatClient); err != nil {
+			return err
+		}
+	}
+	if crush.Tunables != "" {
+		if err := c.setCrushTunables(crush.Tunables, crush.ConfirmTunables); err != nil {
+			return err
+		}
+	}
+	if len(crush.Buckets) == 0 && len(crush.Rules) == 0 {
+		return nil
+	}
+
+	crushMap, err := client.GetCrushMap(c.context, c.Namespace)
+	if err != nil {
+		return err
+	}
+	for _, bucket := range crush.Buckets {
+		if err := c.addCrushBucket(&crushMap, bucket); err != nil {
+			return err
+		}
+	}
+	for _, rule := range crush.Rules {
+		if err := c.addCrushRule(&crushMap, rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *cluster) setRequireMinCompatClient(release string) error {
+	if client.CephReleaseIndex(release) < 0 {
+		return fmt.Errorf("unknown min compat client release %s", release)
+	}
+	dump, err := client.GetOSDDump(c.context, c.Namespace)
+	if err != nil {
+		return err
+	}
+	if dump.RequireMinCompatClient == release {
+		return nil
+	}
+
+	older, err := c.olderClientReleases(release)
+	if err != nil {
+		return err
+	}
+	if len(older) > 0 {
+		c.warn(fmt.Sprintf("not requiring min compat client %s since clients of releases %v are connected", release, older))
+		return nil
+	}
+
+	logger.Infof("changing the required min compat client from %s to %s", dump.RequireMinCompatClient, release)
+	if output, err := client.SetRequireMinCompatClient(c.context, c.Namespace, release); err != nil {
+		return fmt.Errorf("%+v. %s", err, output)
+	}
+	return nil
+}
+
+// setCrushTunables changes the crush tunables once the change is confirmed, since it moves much of the data of the cluster
+func (c *cluster) setCrushTunables(tunables, confirmation string) error {
+	profile, err := client.CrushTunablesProfile(tunables)
+	if err != nil {
+		return err
+	}
+	crushMap, err := client.GetCrushMap(c.context, c.Namespace)
+	if err != nil {
+		return err
+	}
+	if crushMap.Tunables.Profile == profile {
+		return nil
+	}
+
+	older, err := c.olderClientReleases(tunablesMinClient[profile])
+	if err != nil {
+		return err
+	}
+	if len(older) > 0 {
+		c.warn(fmt.Sprintf("not changing the crush tunables to %s since clients of releases %v are connected", tunables, older))
+		return nil
+	}
+
+	estimate := "an unknown part"
+	movement, err := client.EstimateTunablesDataMovement(c.context, c.Namespace, tunables)
+	if err != nil {
+		logger.Warningf("failed to estimate the data movement of crush tunables %s. %+v", tunables, err)
+	} else {
+		estimate = fmt.Sprintf("about %.1f%%", movement*100)
+	}
+	if confirmation != tunables {
+		c.warn(fmt.Sprintf("not changing the crush tunables from %s to %s until confirmed with confirmTunables %s. the change will move %s of the data",
+			crushMap.Tunables.Profile, tunables, tunables, estimate))
+		return nil
+	}
+
+	logger.Infof("changing the crush tunables from %s to %s, which will move %s of the data", crushMap.Tunables.Profile, tunables, estimate)
+	if output, err := client.SetCrushTunables(c.context, c.Namespace, tunables); err != nil {
+		return fmt.Errorf("failed to set crush tunables to profile %s: %+v. %s", tunables, err, output)
+	}
+	return nil
+}
+
+// olderClientReleases returns the releases of the connected clients that are older than the release
+func (c *cluster) olderClientReleases(release string) ([]string, error) {
+	groups, err := client.GetClientFeatures(c.context, c.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	minIndex := client.CephReleaseIndex(release)
+	older := map[string]bool{}
+	for _, group := range groups {
+		if group.Num > 0 && client.CephReleaseIndex(group.Release) < minIndex {
+			older[group.Release] = true
+		}
+	}
+
+	var releases []string
+	for r := range older {
+		releases = append(releases, r)
+	}
+	sort.Strings(releases)
+	return releases, nil
+}
+
+// addCrushBucket creates the bucket if it is not in the crush map and moves it to its location
+func (c *cluster) addCrushBucket(crushMap *client.CrushMap, bucket cephv1alpha1.CrushBucketSpec) error {
+	current := client.GetCrushBucketLocation(crushMap, bucket.Name)
+	if current == nil {
+		logger.Infof("adding %s bucket %s to the crush map", bucket.Type, bucket.Name)
+		if output, err := client.CrushAddBucket(c.context, c.Namespace, bucket.Name, bucket.Type); err != nil {
+			return fmt.Errorf("%+v. %s", err, output)
+		}
+		current = map[string]string{}
+	}
+	if bucket.Location == "" {
+		return nil
+	}
+
+	location := map[string]string{}
+	var pairs []string
+	for _, pair := range strings.Split(bucket.Location, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || kv[0] == "" || kv[1] == "" {
+			return fmt.Errorf("location %s of crush bucket %s is not in a valid format", bucket.Location, bucket.Name)
+		}
+		location[kv[0]] = kv[1]
+		pairs = append(pairs, pair)
+	}
+	if client.CrushLocationsEqual(current, location) {
+		return nil
+	}
+	logger.Infof("moving crush bucket %s to %s", bucket.Name, bucket.Location)
+	if output, err := client.CrushMove(c.context, c.Namespace, bucket.Name, pairs); err != nil {
+		return fmt.Errorf("%+v. %s", err, output)
+	}
+	return nil
+}
+
+// addCrushRule creates the rule if it is not in the crush map. Existing rules cannot be changed.
+func (c *cluster) addCrushRule(crushMap *client.CrushMap, rule cephv1alpha1.CrushRuleSpec) error {
+	root := rule.Root
+	if root == "" {
+		root = "default"
+	}
+	failureDomain := rule.FailureDomain
+	if failureDomain == "" {
+		failureDomain = "host"
+	}
+	// the rules restricted to a device class take the shadow bucket of the class
+	take := root
+	if rule.DeviceClass != "" {
+		take = fmt.Sprintf("%s~%s", root, rule.DeviceClass)
+	}
+
+	for _, r := range crushMap.Rules {
+		if r.Name != rule.Name {
+			continue
+		}
+		for _, step := range r.Steps {
+			if (step.Operation == "take" && step.ItemName != take) ||
+				(strings.HasPrefix(step.Operation, "chooseleaf") && step.Type != failureDomain) {
+				c.warn(fmt.Sprintf("crush rule %s already exists with a different root, failure domain or device class", rule.Name))
+				break
+			}
+		}
+		return nil
+	}
+
+	logger.Infof("adding crush rule %s", rule.Name)
+	return client.CreateReplicatedCrushRule(c.context, c.Namespace, rule.Name, root, failureDomain, rule.DeviceClass)
+}
+
+// warn logs the message and raises it as a warning event of the cluster CRD
+func (c *cluster) warn(message string) {
+	logger.Warning(message)
+	object := v1.ObjectReference{
+		Kind:       "Cluster",
+		APIVersion: cephv1alpha1.SchemeGroupVersion.String(),
+		Name:       c.Name,
+		Namespace:  c.Namespace,
+		UID:        c.ownerRef.UID,
+	}
+	if err := k8sutil.RaiseWarningEvent(c.context.Clientset, object, crushSettingsReason, message); err != nil {
+		logger.Warningf("failed to raise event for cluster %s. %+v", c.Namespace, err)
+	}
+}
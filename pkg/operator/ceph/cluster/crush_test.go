@@ -0,0 +1,140 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cluster
+
+import (
+	"fmt"
+	"testing"
+
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const crushSettingsMap = `{"types":[{"type_id":0,"name":"osd"},{"type_id":1,"name":"host"},{"type_id":8,"name":"datacenter"},
+	{"type_id":11,"name":"root"}],
+	"buckets":[{"id":-1,"name":"default","type_name":"root","items":[{"id":-2}]},{"id":-2,"name":"node1","type_name":"host","items":[{"id":0}]}],
+	"rules":[{"rule_id":0,"rule_name":"replicated_ruleset","steps":[{"op":"take","item":-1,"item_name":"default"},
+		{"op":"chooseleaf_firstn","num":0,"type":"host"},{"op":"emit"}]}],
+	"tunables":{"profile":"firefly"}}`
+
+// crushSettingsExecutor returns an executor for a cluster with the given connected clients that records the commands
+// changing the crush map
+func crushSettingsExecutor(clients string, commands *[]string) *exectest.MockExecutor {
+	return &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outputFile string, args ...string) (string, error) {
+			switch {
+			case args[0] == "features":
+				return fmt.Sprintf(`{"client":[%s]}`, clients), nil
+			case args[0] == "osd" && args[1] == "dump":
+				return `{"osds":[],"require_min_compat_client":"jewel"}`, nil
+			case args[0] == "osd" && args[1] == "crush" && args[2] == "dump":
+				return crushSettingsMap, nil
+			}
+			*commands = append(*commands, exectest.CephCommand(args...))
+			return "", nil
+		},
+		MockExecuteCommandWithOutput: func(debug bool, actionName, command string, args ...string) (string, error) {
+			if command == client.CrushTool && args[2] == "--compare" {
+				return "rule 0 had 256/1024 mismatched mappings (0.25)", nil
+			}
+			return "", nil
+		},
+	}
+}
+
+func TestReconcileCrushTunables(t *testing.T) {
+	var commands []string
+	clientset := fake.NewSimpleClientset()
+	c := &cluster{Namespace: "ns", Name: "mycluster", context: &clusterd.Context{Clientset: clientset,
+		Executor: crushSettingsExecutor(`{"features":"0x3ffddff8eeacfffb","release":"luminous","num":2}`, &commands)}}
+	c.Spec.Crush = cephv1alpha1.CrushSpec{Tunables: "optimal", RequireMinCompatClient: "luminous"}
+
+	// the tunables are not changed until confirmed, with a warning about the data movement
+	err := c.reconcileCrush()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"osd set-require-min-compat-client luminous"}, commands)
+	events, _ := clientset.CoreV1().Events("ns").List(metav1.ListOptions{})
+	assert.Equal(t, 1, len(events.Items))
+	assert.Contains(t, events.Items[0].Message, "will move about 25.0% of the data")
+
+	// the confirmation must name the tunables
+	commands = nil
+	c.Spec.Crush.ConfirmTunables = "jewel"
+	err = c.reconcileCrush()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"osd set-require-min-compat-client luminous"}, commands)
+
+	// the confirmed tunables are applied
+	commands = nil
+	c.Spec.Crush.ConfirmTunables = "optimal"
+	err = c.reconcileCrush()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"osd set-require-min-compat-client luminous", "osd crush tunables optimal"}, commands)
+	// the warning raised again bumped its event
+	events, _ = clientset.CoreV1().Events("ns").List(metav1.ListOptions{})
+	assert.Equal(t, 1, len(events.Items))
+	assert.Equal(t, int32(2), events.Items[0].Count)
+
+	// the settings are already applied
+	commands = nil
+	c.Spec.Crush = cephv1alpha1.CrushSpec{Tunables: "firefly", RequireMinCompatClient: "jewel"}
+	err = c.reconcileCrush()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(commands))
+
+	// the settings are not applied while older clients are connected
+	c.context.Executor = crushSettingsExecutor(`{"features":"0x7010fb86aa42ada","release":"hammer","num":1}`, &commands)
+	c.Spec.Crush = cephv1alpha1.CrushSpec{Tunables: "jewel", RequireMinCompatClient: "luminous"}
+	err = c.reconcileCrush()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(commands))
+	events, _ = clientset.CoreV1().Events("ns").List(metav1.ListOptions{})
+	assert.Equal(t, 3, len(events.Items))
+
+	// unknown settings are rejected
+	c.Spec.Crush = cephv1alpha1.CrushSpec{Tunables: "newest"}
+	assert.NotNil(t, c.reconcileCrush())
+}
+
+func TestReconcileCrushBucketsAndRules(t *testing.T) {
+	var commands []string
+	c := &cluster{Namespace: "ns", Name: "mycluster", context: &clusterd.Context{Clientset: fake.NewSimpleClientset(),
+		Executor: crushSettingsExecutor("", &commands)}}
+	c.Spec.Crush = cephv1alpha1.CrushSpec{
+		Buckets: []cephv1alpha1.CrushBucketSpec{
+			{Name: "dc1", Type: "datacenter", Location: "root=default"},
+			{Name: "node1", Type: "host", Location: "root=default"},
+			{Name: "archive", Type: "root"}},
+		Rules: []cephv1alpha1.CrushRuleSpec{
+			{Name: "replicated_ruleset"},
+			{Name: "fast", Root: "dc1", DeviceClass: "ssd"}},
+	}
+
+	// only the missing buckets and rules are added
+	err := c.reconcileCrush()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"osd crush add-bucket dc1 datacenter", "osd crush move dc1 root=default", "osd crush add-bucket archive root",
+		"osd crush rule create-replicated fast dc1 host ssd"}, commands)
+
+	// a bucket in an invalid location is rejected
+	c.Spec.Crush = cephv1alpha1.CrushSpec{Buckets: []cephv1alpha1.CrushBucketSpec{{Name: "dc1", Type: "datacenter", Location: "default"}}}
+	assert.NotNil(t, c.reconcileCrush())
+}
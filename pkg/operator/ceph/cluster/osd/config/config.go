@@ -25,8 +25,9 @@ import (
 )
 
 const (
-	configStoreNameFmt = "rook-ceph-osd-%s-config"
-	osdDirsKeyName     = "osd-dirs"
+	configStoreNameFmt      = "rook-ceph-osd-%s-config"
+	osdDirsKeyName          = "osd-dirs"
+	osdDirOtherUsageKeyName = "osd-dir-other-usage"
 )
 
 var logger = capnslog.NewPackageLogger("github.com/rook/rook", "osd-config")
@@ -41,6 +42,28 @@ const (
 	DatabaseSizeMBKey = "databaseSizeMB"
 	JournalSizeMBKey  = "journalSizeMB"
 	MetadataDeviceKey = "metadataDevice"
+	DeviceClassKey    = "deviceClass"
+	// The number of steps to increase the crush weight of new OSDs to their full weight
+	WeightRampUpStepsKey = "weightRampUpSteps"
+	// How the size of the bluestore WAL and DB of new OSDs is computed
+	MetadataSizePolicyKey  = "metadataSizePolicy"
+	DatabaseSizePercentKey = "databaseSizePercent"
+	// Whether the filestore OSDs on devices are converted to bluestore
+	ConvertToBluestoreKey = "convertToBluestore"
+	// The most space in MB that an OSD on a directory may use
+	DirectoryCapacityMBKey = "directoryCapacityMB"
+	// The free space in percent below which the OSDs on directories in a host filesystem are marked out
+	DirectoryMinFreePercentKey = "directoryMinFreePercent"
+)
+
+// DefaultDirectoryMinFreePercent is the default free space below which OSDs on directories are marked out
+const DefaultDirectoryMinFreePercent = 5
+
+// Device classes that are assigned to OSDs by default based on the type of the underlying device
+const (
+	DeviceClassHDD  = "hdd"
+	DeviceClassSSD  = "ssd"
+	DeviceClassNVMe = "nvme"
 )
 
 type StoreConfig struct {
@@ -48,6 +71,19 @@ type StoreConfig struct {
 	WalSizeMB      int    `json:"walSizeMB,omitempty"`
 	DatabaseSizeMB int    `json:"databaseSizeMB,omitempty"`
 	JournalSizeMB  int    `json:"journalSizeMB,omitempty"`
+	DeviceClass    string `json:"deviceClass,omitempty"`
+	// New OSDs start at 1/WeightRampUpSteps of their crush weight. Values of 0 or 1 add the OSDs at full weight.
+	WeightRampUpSteps int `json:"weightRampUpSteps,omitempty"`
+	// The policy for sizing the bluestore WAL and DB: fixed (the default), percent or evenSplit
+	MetadataSizePolicy string `json:"metadataSizePolicy,omitempty"`
+	// The size of the bluestore DB as a percentage of the data device with the percent policy
+	DatabaseSizePercent int `json:"databaseSizePercent,omitempty"`
+	// Convert the existing filestore OSDs on devices to bluestore, one OSD at a time
+	ConvertToBluestore bool `json:"convertToBluestore,omitempty"`
+	// The capacity limit of OSDs on directories, applied to their crush weight and full ratio. 0 means no limit.
+	DirectoryCapacityMB int `json:"directoryCapacityMB,omitempty"`
+	// OSDs on directories are marked out when the free space of the host filesystem drops below this percentage
+	DirectoryMinFreePercent int `json:"directoryMinFreePercent,omitempty"`
 }
 
 func ToStoreConfig(config map[string]string) StoreConfig {
@@ -62,6 +98,20 @@ func ToStoreConfig(config map[string]string) StoreConfig {
 			storeConfig.DatabaseSizeMB = convertToIntIgnoreErr(v)
 		case JournalSizeMBKey:
 			storeConfig.JournalSizeMB = convertToIntIgnoreErr(v)
+		case DeviceClassKey:
+			storeConfig.DeviceClass = v
+		case WeightRampUpStepsKey:
+			storeConfig.WeightRampUpSteps = convertToIntIgnoreErr(v)
+		case MetadataSizePolicyKey:
+			storeConfig.MetadataSizePolicy = v
+		case DatabaseSizePercentKey:
+			storeConfig.DatabaseSizePercent = convertToIntIgnoreErr(v)
+		case ConvertToBluestoreKey:
+			storeConfig.ConvertToBluestore, _ = strconv.ParseBool(v)
+		case DirectoryCapacityMBKey:
+			storeConfig.DirectoryCapacityMB = convertToIntIgnoreErr(v)
+		case DirectoryMinFreePercentKey:
+			storeConfig.DirectoryMinFreePercent = convertToIntIgnoreErr(v)
 		}
 	}
 
@@ -79,6 +129,16 @@ func MetadataDevice(config map[string]string) string {
 	return ""
 }
 
+// DeviceClass returns the device class configured for a single device, if any
+func DeviceClass(config map[string]string) string {
+	return config[DeviceClassKey]
+}
+
+// DirectoryCapacityMB returns the capacity limit configured for a single directory, if any
+func DirectoryCapacityMB(config map[string]string) int {
+	return convertToIntIgnoreErr(config[DirectoryCapacityMBKey])
+}
+
 func convertToIntIgnoreErr(raw string) int {
 	val, err := strconv.Atoi(raw)
 	if err != nil {
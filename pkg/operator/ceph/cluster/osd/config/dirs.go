@@ -21,6 +21,7 @@ import (
 	"encoding/json"
 
 	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/apimachinery/pkg/api/errors"
 )
 
 func LoadOSDDirMap(kv *k8sutil.ConfigMapKVStore, nodeName string) (map[string]int, error) {
@@ -55,3 +56,32 @@ func SaveOSDDirMap(kv *k8sutil.ConfigMapKVStore, nodeName string, dirMap map[str
 
 	return nil
 }
+
+// LoadDirOtherUsage loads the bytes used by other data on the host filesystem of each OSD on a directory, as measured
+// when the OSD was created
+func LoadDirOtherUsage(kv *k8sutil.ConfigMapKVStore, storeName string) (map[int]uint64, error) {
+	usage := map[int]uint64{}
+	raw, err := kv.GetValue(storeName, osdDirOtherUsageKeyName)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return usage, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(raw), &usage); err != nil {
+		return nil, err
+	}
+
+	return usage, nil
+}
+
+// SaveDirOtherUsage saves the bytes used by other data on the host filesystem of each OSD on a directory
+func SaveDirOtherUsage(kv *k8sutil.ConfigMapKVStore, storeName string, usage map[int]uint64) error {
+	b, err := json.Marshal(usage)
+	if err != nil {
+		return err
+	}
+
+	return kv.SetValue(storeName, osdDirOtherUsageKeyName, string(b))
+}
@@ -38,6 +38,25 @@ const (
 	BluestoreDirDBName    = "bluestore-db"
 )
 
+// The policies for sizing the bluestore WAL and DB of new OSDs
+const (
+	// MetadataSizePolicyFixed uses the configured (or default) WAL and DB sizes
+	MetadataSizePolicyFixed = "fixed"
+	// MetadataSizePolicyPercent sizes the DB as a percentage of the data device
+	MetadataSizePolicyPercent = "percent"
+	// MetadataSizePolicyEvenSplit splits the free space of the metadata device evenly between the new data devices
+	MetadataSizePolicyEvenSplit = "evenSplit"
+
+	// the smallest DB that a sizing policy will create
+	MinDatabaseSizeMB = 1024
+)
+
+// MetadataSize is the size of the bluestore WAL and DB partitions of an OSD
+type MetadataSize struct {
+	WalSizeMB      int
+	DatabaseSizeMB int
+}
+
 type PartitionType int
 
 const (
@@ -66,6 +85,7 @@ type PerfSchemeEntry struct {
 // details for 1 OSD partition
 type PerfSchemePartitionDetails struct {
 	Device        string `json:"device"`
+	PersistentID  string `json:"persistentId,omitempty"`
 	DiskUUID      string `json:"diskUuid"`
 	PartitionUUID string `json:"partitionUuid"`
 	SizeMB        int    `json:"sizeMB"`
@@ -74,9 +94,10 @@ type PerfSchemePartitionDetails struct {
 
 // represents a dedicated metadata device and all of the partitions stored on it
 type MetadataDeviceInfo struct {
-	Device     string                     `json:"device"`
-	DiskUUID   string                     `json:"diskUuid"`
-	Partitions []*MetadataDevicePartition `json:"partitions"`
+	Device       string                     `json:"device"`
+	PersistentID string                     `json:"persistentId,omitempty"`
+	DiskUUID     string                     `json:"diskUuid"`
+	Partitions   []*MetadataDevicePartition `json:"partitions"`
 }
 
 // representsa specific partition on a metadata device, including details about which OSD it belongs to
@@ -315,6 +336,7 @@ func PopulateDistributedPerfSchemeEntry(entry *PerfSchemeEntry, device string, m
 	// record information about the WAL partition
 	entry.Partitions[WalPartitionType] = &PerfSchemePartitionDetails{
 		Device:        metadataInfo.Device,
+		PersistentID:  metadataInfo.PersistentID,
 		DiskUUID:      metadataInfo.DiskUUID,
 		PartitionUUID: walUUID.String(),
 		SizeMB:        walSize,
@@ -334,6 +356,7 @@ func PopulateDistributedPerfSchemeEntry(entry *PerfSchemeEntry, device string, m
 	// record information about the DB partition
 	entry.Partitions[DatabasePartitionType] = &PerfSchemePartitionDetails{
 		Device:        metadataInfo.Device,
+		PersistentID:  metadataInfo.PersistentID,
 		DiskUUID:      metadataInfo.DiskUUID,
 		PartitionUUID: dbUUID.String(),
 		SizeMB:        dbSize,
@@ -513,3 +536,90 @@ func createFilestoreUUIDs() (*uuid.UUID, *uuid.UUID, *uuid.UUID, error) {
 
 	return &diskUUID, &dataUUID, &journalUUID, nil
 }
+
+// ComputeMetadataSizes computes the WAL and DB sizes for new bluestore OSDs on the given data devices (name to size in
+// MB, 0 if unknown) according to the sizing policy of the store config. If metadataDevice is true, the WAL and DB of
+// all the devices will be put on a metadata device with metadataAvailableMB of free space (0 if unknown), otherwise
+// they are collocated with the data. An error is returned if the requested layout does not fit on the devices.
+func ComputeMetadataSizes(storeConfig StoreConfig, dataDevicesMB map[string]int, metadataDevice bool,
+	metadataAvailableMB int) (map[string]MetadataSize, error) {
+
+	sizes := map[string]MetadataSize{}
+	if storeConfig.StoreType == Filestore || len(dataDevicesMB) == 0 {
+		return sizes, nil
+	}
+
+	walSize := WalDefaultSizeMB
+	if storeConfig.WalSizeMB > 0 {
+		walSize = storeConfig.WalSizeMB
+	}
+
+	switch storeConfig.MetadataSizePolicy {
+	case "", MetadataSizePolicyFixed:
+		dbSize := DBDefaultSizeMB
+		if storeConfig.DatabaseSizeMB > 0 {
+			dbSize = storeConfig.DatabaseSizeMB
+		}
+		for name := range dataDevicesMB {
+			sizes[name] = MetadataSize{WalSizeMB: walSize, DatabaseSizeMB: dbSize}
+		}
+
+	case MetadataSizePolicyPercent:
+		if storeConfig.DatabaseSizePercent <= 0 || storeConfig.DatabaseSizePercent >= 100 {
+			return nil, fmt.Errorf("%s must be between 1 and 99 for the %s metadata size policy, not %d",
+				DatabaseSizePercentKey, MetadataSizePolicyPercent, storeConfig.DatabaseSizePercent)
+		}
+		for name, sizeMB := range dataDevicesMB {
+			if sizeMB == 0 {
+				return nil, fmt.Errorf("size of data device %s is unknown", name)
+			}
+			dbSize := sizeMB * storeConfig.DatabaseSizePercent / 100
+			if dbSize < MinDatabaseSizeMB {
+				return nil, fmt.Errorf("database size of %d%% of data device %s (%d MB) is less than the minimum of %d MB",
+					storeConfig.DatabaseSizePercent, name, sizeMB, MinDatabaseSizeMB)
+			}
+			sizes[name] = MetadataSize{WalSizeMB: walSize, DatabaseSizeMB: dbSize}
+		}
+
+	case MetadataSizePolicyEvenSplit:
+		if !metadataDevice {
+			return nil, fmt.Errorf("the %s metadata size policy requires a metadata device", MetadataSizePolicyEvenSplit)
+		}
+		if metadataAvailableMB == 0 {
+			return nil, fmt.Errorf("size of the metadata device is unknown")
+		}
+		dbSize := metadataAvailableMB/len(dataDevicesMB) - walSize
+		if dbSize < MinDatabaseSizeMB {
+			return nil, fmt.Errorf("metadata device with %d MB available is too small for a %d MB WAL and a DB of at least %d MB for each of the %d data devices",
+				metadataAvailableMB, walSize, MinDatabaseSizeMB, len(dataDevicesMB))
+		}
+		for name := range dataDevicesMB {
+			sizes[name] = MetadataSize{WalSizeMB: walSize, DatabaseSizeMB: dbSize}
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown metadata size policy %s", storeConfig.MetadataSizePolicy)
+	}
+
+	// validate that the metadata fits on the devices before anything is partitioned
+	if metadataDevice {
+		requiredMB := 0
+		for _, size := range sizes {
+			requiredMB += size.WalSizeMB + size.DatabaseSizeMB
+		}
+		if metadataAvailableMB > 0 && requiredMB > metadataAvailableMB {
+			return nil, fmt.Errorf("metadata device is too small, %d MB are needed for the WAL and DB of %d data devices but only %d MB are available",
+				requiredMB, len(sizes), metadataAvailableMB)
+		}
+	} else if storeConfig.MetadataSizePolicy == MetadataSizePolicyPercent {
+		for name, size := range sizes {
+			sizeMB := dataDevicesMB[name]
+			if sizeMB > 0 && size.WalSizeMB+size.DatabaseSizeMB >= sizeMB {
+				return nil, fmt.Errorf("data device %s (%d MB) is too small for a %d MB WAL and a %d MB DB",
+					name, sizeMB, size.WalSizeMB, size.DatabaseSizeMB)
+			}
+		}
+	}
+
+	return sizes, nil
+}
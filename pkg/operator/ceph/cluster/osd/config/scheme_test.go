@@ -269,3 +269,63 @@ func mockKVStore() *k8sutil.ConfigMapKVStore {
 	clientset := testop.New(1)
 	return k8sutil.NewConfigMapKVStore("myns", clientset, metav1.OwnerReference{})
 }
+
+func TestComputeMetadataSizes(t *testing.T) {
+	devices := map[string]int{"sda": 100000, "sdb": 200000}
+
+	// filestore and no devices need no metadata sizes
+	sizes, err := ComputeMetadataSizes(StoreConfig{StoreType: Filestore}, devices, false, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(sizes))
+	sizes, err = ComputeMetadataSizes(StoreConfig{}, map[string]int{}, true, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(sizes))
+
+	// the fixed policy uses the configured or default sizes
+	sizes, err = ComputeMetadataSizes(StoreConfig{}, devices, false, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, MetadataSize{WalSizeMB: WalDefaultSizeMB, DatabaseSizeMB: DBDefaultSizeMB}, sizes["sda"])
+	sizes, err = ComputeMetadataSizes(StoreConfig{MetadataSizePolicy: MetadataSizePolicyFixed, WalSizeMB: 100, DatabaseSizeMB: 2000}, devices, true, 5000)
+	assert.Nil(t, err)
+	assert.Equal(t, MetadataSize{WalSizeMB: 100, DatabaseSizeMB: 2000}, sizes["sdb"])
+
+	// the fixed sizes don't fit on the metadata device
+	_, err = ComputeMetadataSizes(StoreConfig{WalSizeMB: 100, DatabaseSizeMB: 2000}, devices, true, 4000)
+	assert.NotNil(t, err)
+
+	// the percent policy sizes the db from each data device
+	cfg := StoreConfig{MetadataSizePolicy: MetadataSizePolicyPercent, DatabaseSizePercent: 4, WalSizeMB: 100}
+	sizes, err = ComputeMetadataSizes(cfg, devices, false, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, MetadataSize{WalSizeMB: 100, DatabaseSizeMB: 4000}, sizes["sda"])
+	assert.Equal(t, MetadataSize{WalSizeMB: 100, DatabaseSizeMB: 8000}, sizes["sdb"])
+	_, err = ComputeMetadataSizes(cfg, devices, true, 10000)
+	assert.NotNil(t, err)
+
+	// invalid percent, unknown device size, and a db below the minimum
+	_, err = ComputeMetadataSizes(StoreConfig{MetadataSizePolicy: MetadataSizePolicyPercent}, devices, false, 0)
+	assert.NotNil(t, err)
+	_, err = ComputeMetadataSizes(cfg, map[string]int{"sda": 0}, false, 0)
+	assert.NotNil(t, err)
+	_, err = ComputeMetadataSizes(cfg, map[string]int{"sda": 20000}, false, 0)
+	assert.NotNil(t, err)
+
+	// the even split policy shares the metadata device between the data devices
+	cfg = StoreConfig{MetadataSizePolicy: MetadataSizePolicyEvenSplit, WalSizeMB: 500}
+	sizes, err = ComputeMetadataSizes(cfg, devices, true, 20000)
+	assert.Nil(t, err)
+	assert.Equal(t, MetadataSize{WalSizeMB: 500, DatabaseSizeMB: 9500}, sizes["sda"])
+	assert.Equal(t, MetadataSize{WalSizeMB: 500, DatabaseSizeMB: 9500}, sizes["sdb"])
+
+	// even split requires a metadata device with a known size that is large enough
+	_, err = ComputeMetadataSizes(cfg, devices, false, 0)
+	assert.NotNil(t, err)
+	_, err = ComputeMetadataSizes(cfg, devices, true, 0)
+	assert.NotNil(t, err)
+	_, err = ComputeMetadataSizes(cfg, devices, true, 2000)
+	assert.NotNil(t, err)
+
+	// unknown policy
+	_, err = ComputeMetadataSizes(StoreConfig{MetadataSizePolicy: "foo"}, devices, false, 0)
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package config
+
+import (
+	"encoding/json"
+
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	settingsStoreName    = "rook-ceph-osd-settings"
+	scrubSettingsKeyName = "scrub"
+)
+
+// LoadScrubSettings loads the osd config options of the scrub settings of the cluster, which the OSDs add to their
+// config file when they start
+func LoadScrubSettings(kv *k8sutil.ConfigMapKVStore) (map[string]string, error) {
+	settings := map[string]string{}
+	raw, err := kv.GetValue(settingsStoreName, scrubSettingsKeyName)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return settings, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(raw), &settings); err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+// SaveScrubSettings saves the osd config options of the scrub settings of the cluster
+func SaveScrubSettings(kv *k8sutil.ConfigMapKVStore, settings map[string]string) error {
+	b, err := json.Marshal(settings)
+	if err != nil {
+		return err
+	}
+
+	return kv.SetValue(settingsStoreName, scrubSettingsKeyName, string(b))
+}
@@ -0,0 +1,57 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package config
+
+import (
+	"encoding/json"
+
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+const (
+	weightRampUpKeyName = "osd-weight-ramp-up"
+)
+
+// LoadWeightRampUp loads the full crush weights of the OSDs in the node's config store whose weight is still being
+// ramped up
+func LoadWeightRampUp(kv *k8sutil.ConfigMapKVStore, storeName string) (map[int]float64, error) {
+	weights := map[int]float64{}
+	raw, err := kv.GetValue(storeName, weightRampUpKeyName)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return weights, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal([]byte(raw), &weights); err != nil {
+		return nil, err
+	}
+
+	return weights, nil
+}
+
+// SaveWeightRampUp saves the full crush weights of the OSDs in the node's config store whose weight is still being
+// ramped up
+func SaveWeightRampUp(kv *k8sutil.ConfigMapKVStore, storeName string, weights map[int]float64) error {
+	b, err := json.Marshal(weights)
+	if err != nil {
+		return err
+	}
+
+	return kv.SetValue(storeName, weightRampUpKeyName, string(b))
+}
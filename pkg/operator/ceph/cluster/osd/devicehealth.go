@@ -0,0 +1,166 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/discover"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"github.com/rook/rook/pkg/util/sys"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	defaultDeviceHealthInterval = 600
+	deviceFailingReason         = "DeviceFailing"
+)
+
+// DeviceHealthMonitor raises events for the devices of the storage nodes that report failing SMART health, and
+// optionally marks out the OSDs on those devices before the devices fail
+type DeviceHealthMonitor struct {
+	context     *clusterd.Context
+	namespace   string
+	clusterName string
+	// the failing devices that were already reported, by node and device name
+	reported  map[string]bool
+	markedOut map[int]bool
+}
+
+// NewDeviceHealthMonitor creates a device health monitor for the given cluster CRD
+func NewDeviceHealthMonitor(context *clusterd.Context, namespace, clusterName string) *DeviceHealthMonitor {
+	return &DeviceHealthMonitor{context: context, namespace: namespace, clusterName: clusterName,
+		reported: map[string]bool{}, markedOut: map[int]bool{}}
+}
+
+// Run checks the health of the devices periodically until the stop channel is closed
+func (m *DeviceHealthMonitor) Run(stopCh chan struct{}) {
+	runClusterMonitor(m.context, m.namespace, m.clusterName, "device health monitor", stopCh, defaultDeviceHealthInterval*time.Second,
+		func(spec *cephv1alpha1.ClusterSpec) time.Duration {
+			if spec.DeviceHealth.IntervalSeconds > 0 {
+				return time.Duration(spec.DeviceHealth.IntervalSeconds) * time.Second
+			}
+			return defaultDeviceHealthInterval * time.Second
+		},
+		func(cluster *cephv1alpha1.Cluster) {
+			if err := m.checkDeviceHealth(cluster); err != nil {
+				logger.Warningf("failed to check device health. %+v", err)
+			}
+		})
+}
+
+// checkDeviceHealth reports the devices discovered on the storage nodes that are failing
+func (m *DeviceHealthMonitor) checkDeviceHealth(cluster *cephv1alpha1.Cluster) error {
+	// the devices are discovered in the namespace of the operator
+	devices, err := discover.ListDevices(m.context, os.Getenv(k8sutil.PodNamespaceEnvVar), "")
+	if err != nil {
+		return err
+	}
+	m.forgetOSDsMarkedIn()
+
+	for nodeName, disks := range devices {
+		for _, disk := range disks {
+			key := fmt.Sprintf("%s/%s", nodeName, disk.Name)
+			if disk.Health == nil || disk.Health.Passed {
+				delete(m.reported, key)
+				continue
+			}
+
+			osds, err := m.getOSDsOnDevice(nodeName, disk.Name)
+			if err != nil {
+				logger.Warningf("failed to get osds on device %s on node %s. %+v", disk.Name, nodeName, err)
+			}
+
+			if !m.reported[key] {
+				logger.Warningf("device %s on node %s is failing. health %+v, osds %v", disk.Name, nodeName, *disk.Health, osds)
+				if err := m.raiseEvent(cluster, nodeName, &disk, osds); err != nil {
+					logger.Warningf("failed to raise event for failing device %s on node %s. %+v", disk.Name, nodeName, err)
+				}
+				m.reported[key] = true
+			}
+
+			if cluster.Spec.DeviceHealth.MarkOutFailing {
+				m.markOut(osds)
+			}
+		}
+	}
+
+	return nil
+}
+
+// getOSDsOnDevice returns the OSDs with any partition on the device, as saved in the partition scheme of the node
+func (m *DeviceHealthMonitor) getOSDsOnDevice(nodeName, device string) ([]int, error) {
+	kv := k8sutil.NewConfigMapKVStore(m.namespace, m.context.Clientset, metav1.OwnerReference{})
+	osdsByDevice, err := getOSDsByDevice(kv, nodeName)
+	if err != nil {
+		return nil, err
+	}
+	return osdsByDevice[device], nil
+}
+
+// markOut marks the OSDs out so their data is moved to other OSDs before the device fails
+func (m *DeviceHealthMonitor) markOut(osds []int) {
+	for _, id := range osds {
+		if m.markedOut[id] {
+			continue
+		}
+		logger.Infof("marking osd %d out since its device is failing", id)
+		if o, err := client.OSDOut(m.context, m.namespace, id); err != nil {
+			logger.Warningf("failed to mark osd %d out. %+v. %s", id, err, o)
+			continue
+		}
+		m.markedOut[id] = true
+	}
+}
+
+// forgetOSDsMarkedIn stops tracking the OSDs that were marked in again since they were marked out, for example after
+// their device was replaced, so they are marked out again if their device fails
+func (m *DeviceHealthMonitor) forgetOSDsMarkedIn() {
+	if len(m.markedOut) == 0 {
+		return
+	}
+
+	osdDump, err := client.GetOSDDump(m.context, m.namespace)
+	if err != nil {
+		logger.Warningf("failed to get the osd dump to check the osds that were marked out. %+v", err)
+		return
+	}
+	for id := range m.markedOut {
+		if _, in, err := osdDump.StatusByID(int64(id)); err == nil && in == 1 {
+			logger.Infof("osd %d was marked in again", id)
+			delete(m.markedOut, id)
+		}
+	}
+}
+
+func (m *DeviceHealthMonitor) raiseEvent(cluster *cephv1alpha1.Cluster, nodeName string, disk *sys.LocalDisk, osds []int) error {
+	object := v1.ObjectReference{
+		Kind:       "Cluster",
+		APIVersion: cephv1alpha1.SchemeGroupVersion.String(),
+		Name:       cluster.Name,
+		Namespace:  cluster.Namespace,
+		UID:        cluster.UID,
+	}
+	message := fmt.Sprintf("device %s on node %s is failing (reallocated sectors %d, wear level %d%%, temperature %dC). osds on the device: %v",
+		disk.Name, nodeName, disk.Health.ReallocatedSectors, disk.Health.WearLevelPercent, disk.Health.Temperature, osds)
+	return k8sutil.RaiseWarningEvent(m.context.Clientset, object, deviceFailingReason, message)
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
+	rookfake "github.com/rook/rook/pkg/client/clientset/versioned/fake"
+	"github.com/rook/rook/pkg/clusterd"
+	discoverDaemon "github.com/rook/rook/pkg/daemon/discover"
+	"github.com/rook/rook/pkg/operator/ceph/cluster/osd/config"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCheckDeviceHealth(t *testing.T) {
+	os.Setenv(k8sutil.PodNamespaceEnvVar, "rook-system")
+	defer os.Unsetenv(k8sutil.PodNamespaceEnvVar)
+
+	var outs []string
+	osdIn := 0
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outputFile string, args ...string) (string, error) {
+			if args[0] == "osd" && args[1] == "out" {
+				outs = append(outs, strings.Join(args[2:], " "))
+			}
+			if args[0] == "osd" && args[1] == "dump" {
+				return fmt.Sprintf(`{"osds":[{"osd":3,"up":1,"in":%d}]}`, osdIn), nil
+			}
+			return "", nil
+		},
+	}
+	clientset := fake.NewSimpleClientset()
+
+	// the devices discovered on the node, sdb is failing
+	inventory := &rookalpha.DeviceInventory{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "node1",
+			Namespace: "rook-system",
+			Labels:    map[string]string{k8sutil.AppAttr: discoverDaemon.AppName, discoverDaemon.NodeAttr: "node1"},
+		},
+		Spec: rookalpha.DeviceInventorySpec{NodeName: "node1", Devices: []rookalpha.DiscoveredDevice{
+			{Name: "sda", Health: &rookalpha.DeviceHealth{Passed: true, Temperature: 30}},
+			{Name: "sdb", Health: &rookalpha.DeviceHealth{Passed: false, ReallocatedSectors: 120, Temperature: 45}},
+			{Name: "sdc"}}},
+	}
+	context := &clusterd.Context{Clientset: clientset, RookClientset: rookfake.NewSimpleClientset(inventory), Executor: executor}
+
+	// osd 3 is on the failing device
+	kv := k8sutil.NewConfigMapKVStore("ns", clientset, metav1.OwnerReference{})
+	scheme := config.NewPerfScheme()
+	for id, device := range map[int]string{2: "sda", 3: "sdb"} {
+		entry := config.NewPerfSchemeEntry(config.Bluestore)
+		entry.ID = id
+		assert.Nil(t, config.PopulateCollocatedPerfSchemeEntry(entry, device, config.StoreConfig{}))
+		scheme.Entries = append(scheme.Entries, entry)
+	}
+	assert.Nil(t, scheme.SaveScheme(kv, config.GetConfigStoreName("node1")))
+
+	cluster := &cephv1alpha1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "ns", Namespace: "ns"}}
+	m := NewDeviceHealthMonitor(context, "ns", "ns")
+
+	// an event is raised for the failing device, the osd is not marked out by default
+	assert.Nil(t, m.checkDeviceHealth(cluster))
+	events, err := clientset.CoreV1().Events("ns").List(metav1.ListOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(events.Items))
+	assert.Equal(t, deviceFailingReason, events.Items[0].Reason)
+	assert.Contains(t, events.Items[0].Message, "device sdb on node node1")
+	assert.Equal(t, 0, len(outs))
+
+	// the event is only raised once and the osd is marked out when enabled
+	cluster.Spec.DeviceHealth.MarkOutFailing = true
+	assert.Nil(t, m.checkDeviceHealth(cluster))
+	assert.Nil(t, m.checkDeviceHealth(cluster))
+	events, err = clientset.CoreV1().Events("ns").List(metav1.ListOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(events.Items))
+	assert.Equal(t, []string{"3"}, outs)
+
+	// the osd is marked out again after it was marked in while its device is still failing
+	osdIn = 1
+	assert.Nil(t, m.checkDeviceHealth(cluster))
+	assert.Equal(t, []string{"3", "3"}, outs)
+}
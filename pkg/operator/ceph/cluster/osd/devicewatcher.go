@@ -0,0 +1,153 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"os"
+	"sync"
+
+	opkit "github.com/rook/operator-kit"
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/operator/discover"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/client-go/tools/cache"
+)
+
+// DeviceWatcher watches the device inventories of the nodes and starts OSDs on the devices that are added to the
+// storage nodes of a cluster, without waiting for the cluster to be updated
+type DeviceWatcher struct {
+	context *clusterd.Context
+	// returns the osd cluster with the current settings of the cluster CRD
+	getCluster  func() (*Cluster, error)
+	orchestrate func(c *Cluster, n rookalpha.Node) error
+	// the available devices matching the storage settings of each node that were already seen
+	knownDevices map[string]map[string]bool
+	lock         sync.Mutex
+}
+
+// NewDeviceWatcher creates a device watcher for the cluster returned by getCluster
+func NewDeviceWatcher(context *clusterd.Context, getCluster func() (*Cluster, error)) *DeviceWatcher {
+	return &DeviceWatcher{
+		context:      context,
+		getCluster:   getCluster,
+		orchestrate:  (*Cluster).refreshNode,
+		knownDevices: map[string]map[string]bool{},
+	}
+}
+
+// StartWatch watches the device inventories in the namespace of the operator until the stop channel is closed
+func (w *DeviceWatcher) StartWatch(stopCh chan struct{}) {
+	resourceHandlerFuncs := cache.ResourceEventHandlerFuncs{
+		AddFunc: w.onAdd,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			w.onAdd(newObj)
+		},
+	}
+
+	namespace := os.Getenv(k8sutil.PodNamespaceEnvVar)
+	logger.Infof("start watching device inventories in namespace %s", namespace)
+	watcher := opkit.NewWatcher(discover.DeviceInventoryResource, namespace, resourceHandlerFuncs, w.context.RookClientset.RookV1alpha2().RESTClient())
+	go watcher.Watch(&rookalpha.DeviceInventory{}, stopCh)
+}
+
+func (w *DeviceWatcher) onAdd(obj interface{}) {
+	inventory, ok := obj.(*rookalpha.DeviceInventory)
+	if !ok {
+		return
+	}
+	c, err := w.getCluster()
+	if err != nil {
+		logger.Warningf("failed to get the cluster for the device inventory of node %s. %+v", inventory.Spec.NodeName, err)
+		return
+	}
+	w.checkNewDevices(c, inventory)
+}
+
+// checkNewDevices orchestrates the node of the inventory if the devices matching the storage settings of the node grew
+func (w *DeviceWatcher) checkNewDevices(c *Cluster, inventory *rookalpha.DeviceInventory) {
+	nodeName := inventory.Spec.NodeName
+	n := c.storageNode(nodeName)
+	if n == nil {
+		return
+	}
+
+	// the devices matching the node's device list or filter that are available for new osds
+	devices, err := discover.GetAvailableDevices(w.context, nodeName, c.Namespace, n.Devices, n.Selection.DeviceFilter, n.Selection.GetUseAllDevices(),
+		n.Selection.DeviceSelector)
+	if err != nil {
+		logger.Warningf("failed to get the devices of node %s. %+v", nodeName, err)
+		return
+	}
+	matching := map[string]bool{}
+	for _, device := range devices {
+		if d := findDevice(inventory, device.Name); d != nil && d.Available {
+			matching[device.Name] = true
+		}
+	}
+
+	newDevices := w.updateKnownDevices(nodeName, matching)
+	if len(newDevices) == 0 {
+		return
+	}
+
+	logger.Infof("devices %v were added to node %s, starting osds on them", newDevices, nodeName)
+	go func() {
+		if err := w.orchestrate(c, *n); err != nil {
+			logger.Warningf("failed to start osds on the new devices of node %s. %+v", nodeName, err)
+			// forget the new devices so the orchestration is tried again on the next change of the devices
+			w.forgetDevices(nodeName, newDevices)
+		}
+	}()
+}
+
+// updateKnownDevices saves the matching devices of the node and returns the devices that were not known before. All
+// devices are known when the node is seen for the first time since they were already handled by the orchestration.
+func (w *DeviceWatcher) updateKnownDevices(nodeName string, matching map[string]bool) []string {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	known, ok := w.knownDevices[nodeName]
+	w.knownDevices[nodeName] = matching
+	if !ok {
+		return nil
+	}
+
+	var newDevices []string
+	for device := range matching {
+		if !known[device] {
+			newDevices = append(newDevices, device)
+		}
+	}
+	return newDevices
+}
+
+func (w *DeviceWatcher) forgetDevices(nodeName string, devices []string) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	for _, device := range devices {
+		delete(w.knownDevices[nodeName], device)
+	}
+}
+
+func findDevice(inventory *rookalpha.DeviceInventory, name string) *rookalpha.DiscoveredDevice {
+	for i := range inventory.Spec.Devices {
+		if inventory.Spec.Devices[i].Name == name {
+			return &inventory.Spec.Devices[i]
+		}
+	}
+	return nil
+}
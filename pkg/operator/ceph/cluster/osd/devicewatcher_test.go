@@ -0,0 +1,96 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
+	rookfake "github.com/rook/rook/pkg/client/clientset/versioned/fake"
+	"github.com/rook/rook/pkg/clusterd"
+	discoverDaemon "github.com/rook/rook/pkg/daemon/discover"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCheckNewDevices(t *testing.T) {
+	os.Setenv(k8sutil.PodNamespaceEnvVar, "rook-system")
+	defer os.Unsetenv(k8sutil.PodNamespaceEnvVar)
+
+	inventory := &rookalpha.DeviceInventory{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "node1",
+			Namespace: "rook-system",
+			Labels:    map[string]string{k8sutil.AppAttr: discoverDaemon.AppName, discoverDaemon.NodeAttr: "node1"},
+		},
+		Spec: rookalpha.DeviceInventorySpec{NodeName: "node1", Devices: []rookalpha.DiscoveredDevice{
+			{Name: "sda", Available: true},
+			{Name: "sdb", Filesystem: "ext4", UnavailableReasons: []string{"has a ext4 filesystem"}}}},
+	}
+	rookClientset := rookfake.NewSimpleClientset(inventory)
+	context := &clusterd.Context{Clientset: fake.NewSimpleClientset(), RookClientset: rookClientset, Executor: &exectest.MockExecutor{}}
+	storageSpec := rookalpha.StorageScopeSpec{
+		Nodes:     []rookalpha.Node{{Name: "node1"}},
+		Selection: rookalpha.Selection{DeviceFilter: "^sd"},
+	}
+	c := New(context, "ns", "myversion", storageSpec, "", rookalpha.Placement{}, false, v1.ResourceRequirements{},
+		cephv1alpha1.OrchestrationSpec{}, metav1.OwnerReference{})
+
+	orchestrated := make(chan string, 10)
+	w := NewDeviceWatcher(context, func() (*Cluster, error) { return c, nil })
+	w.orchestrate = func(c *Cluster, n rookalpha.Node) error {
+		orchestrated <- n.Name
+		return nil
+	}
+	updateInventory := func(devices ...rookalpha.DiscoveredDevice) {
+		inventory.Spec.Devices = append(inventory.Spec.Devices, devices...)
+		_, err := rookClientset.RookV1alpha2().DeviceInventories("rook-system").Update(inventory)
+		assert.Nil(t, err)
+		w.checkNewDevices(c, inventory)
+	}
+
+	// the devices of the node are already handled when the node is first seen
+	w.checkNewDevices(c, inventory)
+	assert.Equal(t, 0, len(orchestrated))
+	assert.Equal(t, map[string]bool{"sda": true}, w.knownDevices["node1"])
+
+	// devices that are not available or don't match the filter don't trigger the orchestration
+	updateInventory(rookalpha.DiscoveredDevice{Name: "sdc", Filesystem: "xfs"}, rookalpha.DiscoveredDevice{Name: "nvme0n1", Available: true})
+	assert.Equal(t, 0, len(orchestrated))
+
+	// a new available device matching the filter triggers the orchestration of the node
+	updateInventory(rookalpha.DiscoveredDevice{Name: "sdd", Available: true})
+	select {
+	case node := <-orchestrated:
+		assert.Equal(t, "node1", node)
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "node was not orchestrated")
+	}
+	assert.Equal(t, map[string]bool{"sda": true, "sdd": true}, w.knownDevices["node1"])
+
+	// the devices of nodes that are not in the storage spec are ignored
+	other := inventory.DeepCopy()
+	other.Spec.NodeName = "node2"
+	w.checkNewDevices(c, other)
+	assert.Equal(t, 0, len(w.knownDevices["node2"]))
+}
@@ -0,0 +1,294 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	extensions "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/wait"
+)
+
+const (
+	// OrchestrationStatusMaintenance is the status of a node whose OSDs are stopped for maintenance
+	OrchestrationStatusMaintenance = "maintenance"
+
+	// the annotation on the replica set of a node in maintenance. The annotation is only removed after the OSDs of the
+	// node are running again and have recovered and the maintenance flags are cleared, so the operator can resume if it
+	// is restarted.
+	maintenanceAnnotation = "ceph.rook.io/maintenance"
+
+	// the flag set on the CRUSH host of a node in maintenance so its OSDs are not marked out. Ceph only supports the
+	// noup, nodown, noin and noout flags on CRUSH nodes.
+	maintenanceHostFlag = "noout"
+
+	// the cluster-wide flag set while any node is in maintenance so no data is moved
+	maintenanceClusterFlag = "norebalance"
+)
+
+var (
+	maintenanceRecoveryInterval = 10 * time.Second
+	maintenanceRecoveryTimeout  = 15 * time.Minute
+
+	// the nodes whose recovery after maintenance is being waited for
+	maintenanceRecoveries   = map[string]bool{}
+	maintenanceRecoveryLock sync.Mutex
+)
+
+// startMaintenance sets the maintenance flags on the node's CRUSH host and stops the OSDs on the node by scaling
+// its replica set to zero so they are not restarted until the maintenance is over.
+func (c *Cluster) startMaintenance(n rookalpha.Node) error {
+	rs, err := c.context.Clientset.Extensions().ReplicaSets(c.Namespace).Get(fmt.Sprintf(appNameFmt, n.Name), metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return fmt.Errorf("no osds have been started on node %s", n.Name)
+		}
+		return fmt.Errorf("failed to get osd replica set for node %s. %+v", n.Name, err)
+	}
+
+	if !isInMaintenance(rs) {
+		logger.Infof("starting maintenance on node %s", n.Name)
+		if err := c.setMaintenanceFlags(n); err != nil {
+			return err
+		}
+
+		if rs.Annotations == nil {
+			rs.Annotations = map[string]string{}
+		}
+		rs.Annotations[maintenanceAnnotation] = "true"
+		replicas := int32(0)
+		rs.Spec.Replicas = &replicas
+		if _, err := c.context.Clientset.Extensions().ReplicaSets(c.Namespace).Update(rs); err != nil {
+			return fmt.Errorf("failed to stop the osds on node %s. %+v", n.Name, err)
+		}
+		logger.Infof("osds stopped on node %s for maintenance", n.Name)
+	}
+
+	status := OrchestrationStatus{Status: OrchestrationStatusMaintenance, Message: "osds are stopped for maintenance"}
+	return UpdateOrchestrationStatusMap(c.context.Clientset, c.Namespace, n.Name, status)
+}
+
+// stopMaintenance restarts the OSDs on a node that was in maintenance and clears the cluster-wide norebalance flag so
+// the placement groups remapped during the maintenance can move back. The noout flag on the node is cleared in the
+// background once the restarted OSDs have recovered, without blocking the orchestration. Nodes that are not in
+// maintenance are left alone.
+func (c *Cluster) stopMaintenance(n rookalpha.Node) error {
+	rs, err := c.context.Clientset.Extensions().ReplicaSets(c.Namespace).Get(fmt.Sprintf(appNameFmt, n.Name), metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to get osd replica set for node %s. %+v", n.Name, err)
+	}
+	if !isInMaintenance(rs) {
+		return nil
+	}
+
+	logger.Infof("stopping maintenance on node %s", n.Name)
+	if rs.Spec.Replicas == nil || *rs.Spec.Replicas == 0 {
+		replicas := int32(1)
+		rs.Spec.Replicas = &replicas
+		if _, err = c.context.Clientset.Extensions().ReplicaSets(c.Namespace).Update(rs); err != nil {
+			return fmt.Errorf("failed to restart the osds on node %s. %+v", n.Name, err)
+		}
+		logger.Infof("osds restarted on node %s", n.Name)
+	}
+
+	if err := c.clearClusterMaintenanceFlag(n); err != nil {
+		return err
+	}
+
+	if !startMaintenanceRecovery(c.Namespace, n.Name) {
+		logger.Infof("already waiting for the osds on node %s to recover", n.Name)
+		return nil
+	}
+	go func() {
+		defer endMaintenanceRecovery(c.Namespace, n.Name)
+		if err := c.completeMaintenance(n); err != nil {
+			logger.Warningf("%+v. the maintenance will be completed by the next orchestration", err)
+		}
+	}()
+	return nil
+}
+
+// completeMaintenance waits for the restarted OSDs of the node to recover and then clears the noout flag on the node
+// and the maintenance annotation
+func (c *Cluster) completeMaintenance(n rookalpha.Node) error {
+	// the noout flag is kept until the restarted osds have caught up with the rest of the cluster
+	err := wait.Poll(maintenanceRecoveryInterval, maintenanceRecoveryTimeout, func() (bool, error) {
+		if err := client.IsClusterRecovered(c.context, c.Namespace); err != nil {
+			logger.Infof("waiting for the osds to recover before ending maintenance on node %s. %+v", n.Name, err)
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("osds did not recover after restarting the osds on node %s. %+v", n.Name, err)
+	}
+
+	if err := c.clearHostMaintenanceFlag(n); err != nil {
+		return err
+	}
+
+	rs, err := c.context.Clientset.Extensions().ReplicaSets(c.Namespace).Get(fmt.Sprintf(appNameFmt, n.Name), metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get osd replica set for node %s. %+v", n.Name, err)
+	}
+	delete(rs.Annotations, maintenanceAnnotation)
+	if _, err := c.context.Clientset.Extensions().ReplicaSets(c.Namespace).Update(rs); err != nil {
+		return fmt.Errorf("failed to remove the maintenance annotation from node %s. %+v", n.Name, err)
+	}
+
+	logger.Infof("maintenance completed on node %s", n.Name)
+	return nil
+}
+
+// startMaintenanceRecovery records that the recovery of the node is being waited for. Returns false if it already is.
+func startMaintenanceRecovery(namespace, node string) bool {
+	maintenanceRecoveryLock.Lock()
+	defer maintenanceRecoveryLock.Unlock()
+	key := namespace + "/" + node
+	if maintenanceRecoveries[key] {
+		return false
+	}
+	maintenanceRecoveries[key] = true
+	return true
+}
+
+func endMaintenanceRecovery(namespace, node string) {
+	maintenanceRecoveryLock.Lock()
+	defer maintenanceRecoveryLock.Unlock()
+	delete(maintenanceRecoveries, namespace+"/"+node)
+}
+
+// setMaintenanceFlags sets the noout flag on the node's CRUSH host and the cluster-wide norebalance flag. If the
+// version of Ceph does not support flags on CRUSH nodes, the noout flag is set on each of the node's OSDs instead.
+func (c *Cluster) setMaintenanceFlags(n rookalpha.Node) error {
+	if err := c.setHostMaintenanceFlag(n); err != nil {
+		return err
+	}
+
+	// setting the flag is idempotent, it is set for every node entering maintenance
+	if o, err := client.OSDSetFlag(c.context, c.Namespace, maintenanceClusterFlag); err != nil {
+		return fmt.Errorf("failed to set maintenance flags on node %s. %+v. %s", n.Name, err, o)
+	}
+	return nil
+}
+
+// setHostMaintenanceFlag sets the noout flag on the node's CRUSH host, or on its OSDs if the version of Ceph does not
+// support flags on CRUSH nodes
+func (c *Cluster) setHostMaintenanceFlag(n rookalpha.Node) error {
+	host := crushHostName(n)
+	o, err := client.OSDSetGroupFlags(c.context, c.Namespace, []string{maintenanceHostFlag}, []string{host})
+	if err == nil {
+		return nil
+	}
+	logger.Infof("failed to set %s on host %s, setting it on its osds instead. %+v. %s", maintenanceHostFlag, host, err, o)
+
+	osds, err := c.getOSDsForNode(n)
+	if err != nil {
+		return fmt.Errorf("failed to get osds for node %s. %+v", n.Name, err)
+	}
+	if len(osds) == 0 {
+		return nil
+	}
+	if o, err := client.OSDAddNoOut(c.context, c.Namespace, osds); err != nil {
+		return fmt.Errorf("failed to set maintenance flags on node %s. %+v. %s", n.Name, err, o)
+	}
+	return nil
+}
+
+// clearClusterMaintenanceFlag clears the cluster-wide norebalance flag if the OSDs of no other node are still stopped
+// for maintenance
+func (c *Cluster) clearClusterMaintenanceFlag(n rookalpha.Node) error {
+	others, err := c.otherNodesInMaintenance(n)
+	if err != nil {
+		return err
+	}
+	if len(others) > 0 {
+		logger.Infof("keeping %s set for nodes still in maintenance: %v", maintenanceClusterFlag, others)
+		return nil
+	}
+	if o, err := client.OSDUnsetFlag(c.context, c.Namespace, maintenanceClusterFlag); err != nil {
+		return fmt.Errorf("failed to clear maintenance flags on node %s. %+v. %s", n.Name, err, o)
+	}
+	return nil
+}
+
+// clearHostMaintenanceFlag clears the noout flag on the node's CRUSH host, or on its OSDs if the version of Ceph does
+// not support flags on CRUSH nodes
+func (c *Cluster) clearHostMaintenanceFlag(n rookalpha.Node) error {
+	host := crushHostName(n)
+	o, err := client.OSDUnsetGroupFlags(c.context, c.Namespace, []string{maintenanceHostFlag}, []string{host})
+	if err == nil {
+		return nil
+	}
+	logger.Infof("failed to clear %s on host %s, clearing it on its osds instead. %+v. %s", maintenanceHostFlag, host, err, o)
+
+	osds, err := c.getOSDsForNode(n)
+	if err != nil {
+		return fmt.Errorf("failed to get osds for node %s. %+v", n.Name, err)
+	}
+	if len(osds) == 0 {
+		return nil
+	}
+	if o, err := client.OSDRemoveNoOut(c.context, c.Namespace, osds); err != nil {
+		return fmt.Errorf("failed to clear maintenance flags on node %s. %+v. %s", n.Name, err, o)
+	}
+	return nil
+}
+
+// otherNodesInMaintenance returns the names of the osd replica sets other than the given node's whose OSDs are still
+// stopped for maintenance. These nodes hold a reference to the cluster-wide maintenance flag.
+func (c *Cluster) otherNodesInMaintenance(n rookalpha.Node) ([]string, error) {
+	opts := metav1.ListOptions{LabelSelector: fields.OneTermEqualSelector(k8sutil.AppAttr, appName).String()}
+	replicaSets, err := c.context.Clientset.Extensions().ReplicaSets(c.Namespace).List(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list osd replica sets. %+v", err)
+	}
+
+	var others []string
+	for i := range replicaSets.Items {
+		rs := &replicaSets.Items[i]
+		stopped := rs.Spec.Replicas != nil && *rs.Spec.Replicas == 0
+		if rs.Name != fmt.Sprintf(appNameFmt, n.Name) && isInMaintenance(rs) && stopped {
+			others = append(others, rs.Name)
+		}
+	}
+	return others, nil
+}
+
+func isInMaintenance(rs *extensions.ReplicaSet) bool {
+	return rs.Annotations[maintenanceAnnotation] == "true"
+}
+
+// crushHostName returns the name of the node's host in the CRUSH map, which is the node name unless the host is set
+// in the node's location
+func crushHostName(n rookalpha.Node) string {
+	if host := getLocationValue(n.Location, "host"); host != "" {
+		return host
+	}
+	return strings.Replace(n.Name, ".", "-", -1)
+}
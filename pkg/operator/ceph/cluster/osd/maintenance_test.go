@@ -0,0 +1,188 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
+	rookfake "github.com/rook/rook/pkg/client/clientset/versioned/fake"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/operator/ceph/cluster/osd/config"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestMaintenance(t *testing.T) {
+	maintenanceRecoveryInterval = time.Millisecond
+	maintenanceRecoveryTimeout = time.Second
+	defer func() {
+		maintenanceRecoveryInterval = 10 * time.Second
+		maintenanceRecoveryTimeout = 15 * time.Minute
+	}()
+
+	groupFlagsSupported := true
+	clean := false
+	var commands []string
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outputFile string, args ...string) (string, error) {
+			commands = append(commands, strings.Join(args, " "))
+			if args[0] == "status" {
+				if clean {
+					return `{"pgmap":{"num_pgs":100,"pgs_by_state":[{"state_name":"active+clean","count":100}]}}`, nil
+				}
+				clean = true
+				return `{"pgmap":{"num_pgs":100,"pgs_by_state":[{"state_name":"active+undersized+degraded","count":100}]}}`, nil
+			}
+			if args[1] == "set-group" || args[1] == "unset-group" {
+				if !groupFlagsSupported {
+					return "", fmt.Errorf("unrecognized command")
+				}
+				// ceph only supports these flags on crush nodes
+				for _, flag := range strings.Split(args[2], ",") {
+					if flag != "noup" && flag != "nodown" && flag != "noin" && flag != "noout" {
+						return "", fmt.Errorf("unrecognized flag '%s'", flag)
+					}
+				}
+				return "", nil
+			}
+			if args[1] == "set" || args[1] == "unset" || args[1] == "add-noout" || args[1] == "rm-noout" {
+				return "", nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+
+	clientset := fake.NewSimpleClientset()
+	c := New(&clusterd.Context{Clientset: clientset, RookClientset: rookfake.NewSimpleClientset(), ConfigDir: "/var/lib/rook", Executor: executor}, "ns", "myversion",
+		rookalpha.StorageScopeSpec{}, "", rookalpha.Placement{}, false, v1.ResourceRequirements{}, cephv1alpha1.OrchestrationSpec{}, metav1.OwnerReference{})
+	assert.Nil(t, makeOrchestrationStatusMap(clientset, c.Namespace, nil))
+	node := rookalpha.Node{Name: "node1.example.com", Maintenance: true}
+
+	// maintenance can't start on a node without osds
+	assert.NotNil(t, c.startMaintenance(node))
+
+	rs, err := c.makeReplicaSet(node.Name, nil, rookalpha.Selection{}, v1.ResourceRequirements{}, config.StoreConfig{}, "", "")
+	assert.Nil(t, err)
+	_, err = clientset.Extensions().ReplicaSets(c.Namespace).Create(rs)
+	assert.Nil(t, err)
+
+	// stopping maintenance on a node that is not in maintenance does nothing
+	assert.Nil(t, c.stopMaintenance(node))
+	assert.Equal(t, 0, len(commands))
+
+	// start maintenance sets the flags on the host and stops the osds
+	assert.Nil(t, c.startMaintenance(node))
+	assert.Equal(t, []string{"osd set-group noout node1-example-com", "osd set norebalance"}, commands)
+	rs, err = clientset.Extensions().ReplicaSets(c.Namespace).Get(rs.Name, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(0), *rs.Spec.Replicas)
+	assert.True(t, isInMaintenance(rs))
+	statuses, err := GetOrchestrationStatus(clientset, c.Namespace)
+	assert.Nil(t, err)
+	assert.Equal(t, OrchestrationStatusMaintenance, statuses[node.Name].Status)
+
+	// starting maintenance again does not set the flags again
+	commands = nil
+	assert.Nil(t, c.startMaintenance(node))
+	assert.Equal(t, 0, len(commands))
+
+	// stop maintenance restarts the osds and clears norebalance right away. the recovery is awaited by the test
+	// instead of in the background.
+	assert.True(t, startMaintenanceRecovery(c.Namespace, node.Name))
+	assert.Nil(t, c.stopMaintenance(node))
+	assert.Equal(t, []string{"osd unset norebalance"}, commands)
+	rs, err = clientset.Extensions().ReplicaSets(c.Namespace).Get(rs.Name, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), *rs.Spec.Replicas)
+	assert.True(t, isInMaintenance(rs))
+
+	// the noout flag on the host is cleared once the osds have recovered
+	commands = nil
+	assert.Nil(t, c.completeMaintenance(node))
+	endMaintenanceRecovery(c.Namespace, node.Name)
+	assert.Equal(t, []string{"status", "status", "osd unset-group noout node1-example-com"}, commands)
+	rs, err = clientset.Extensions().ReplicaSets(c.Namespace).Get(rs.Name, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.False(t, isInMaintenance(rs))
+
+	// norebalance stays set while the osds of another node are still stopped, but not while they are recovering
+	node2 := rookalpha.Node{Name: "node2", Maintenance: true}
+	rs2, err := c.makeReplicaSet(node2.Name, nil, rookalpha.Selection{}, v1.ResourceRequirements{}, config.StoreConfig{}, "", "")
+	assert.Nil(t, err)
+	_, err = clientset.Extensions().ReplicaSets(c.Namespace).Create(rs2)
+	assert.Nil(t, err)
+	assert.Nil(t, c.startMaintenance(node))
+	assert.Nil(t, c.startMaintenance(node2))
+	assert.True(t, startMaintenanceRecovery(c.Namespace, node.Name))
+	assert.True(t, startMaintenanceRecovery(c.Namespace, node2.Name))
+	commands = nil
+	assert.Nil(t, c.stopMaintenance(node))
+	assert.Equal(t, 0, len(commands))
+	assert.Nil(t, c.stopMaintenance(node2))
+	assert.Equal(t, []string{"osd unset norebalance"}, commands)
+	commands = nil
+	assert.Nil(t, c.completeMaintenance(node))
+	assert.Nil(t, c.completeMaintenance(node2))
+	endMaintenanceRecovery(c.Namespace, node.Name)
+	endMaintenanceRecovery(c.Namespace, node2.Name)
+	assert.Equal(t, []string{"status", "osd unset-group noout node1-example-com", "status", "osd unset-group noout node2"}, commands)
+
+	// the noout flag is set on the osds of the node if flags on crush nodes are not supported
+	kv := k8sutil.NewConfigMapKVStore(c.Namespace, clientset, metav1.OwnerReference{})
+	config.SaveOSDDirMap(kv, node.Name, map[string]int{"/rook/storage1": 3})
+	groupFlagsSupported = false
+	commands = nil
+	node.Location = "rack=rack1,host=myhost"
+	assert.Nil(t, c.startMaintenance(node))
+	assert.Equal(t, []string{"osd set-group noout myhost", "osd add-noout 3", "osd set norebalance"}, commands)
+
+	// the noout flag stays set if the osds do not recover, while remapped or scrubbing placement groups do not matter
+	maintenanceRecoveryTimeout = 10 * time.Millisecond
+	status := `{"pgmap":{"num_pgs":100,"pgs_by_state":[{"state_name":"active+undersized+degraded","count":100}]}}`
+	commands = nil
+	executor.MockExecuteCommandWithOutputFile = func(debug bool, actionName, command, outputFile string, args ...string) (string, error) {
+		commands = append(commands, strings.Join(args, " "))
+		if args[0] == "status" {
+			return status, nil
+		}
+		if args[1] == "unset-group" {
+			return "", fmt.Errorf("unrecognized command")
+		}
+		return "", nil
+	}
+	assert.True(t, startMaintenanceRecovery(c.Namespace, node.Name))
+	assert.Nil(t, c.stopMaintenance(node))
+	assert.NotNil(t, c.completeMaintenance(node))
+	rs, err = clientset.Extensions().ReplicaSets(c.Namespace).Get(rs.Name, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, int32(1), *rs.Spec.Replicas)
+	assert.True(t, isInMaintenance(rs))
+	assert.NotContains(t, commands, "osd rm-noout 3")
+
+	status = `{"pgmap":{"num_pgs":100,"pgs_by_state":[{"state_name":"active+remapped+backfilling","count":10},{"state_name":"active+clean+scrubbing","count":90}]}}`
+	assert.Nil(t, c.completeMaintenance(node))
+	endMaintenanceRecovery(c.Namespace, node.Name)
+	assert.Contains(t, commands, "osd rm-noout 3")
+}
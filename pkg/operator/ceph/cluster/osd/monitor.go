@@ -0,0 +1,48 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"time"
+
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// runClusterMonitor runs the check of a monitor with the latest cluster CRD until the stop channel is closed. The
+// interval is read from the cluster CRD before each wait. If the cluster CRD cannot be read, the default interval is
+// used and the check is skipped.
+func runClusterMonitor(context *clusterd.Context, namespace, clusterName, name string, stopCh chan struct{},
+	defaultInterval time.Duration, interval func(spec *cephv1alpha1.ClusterSpec) time.Duration, check func(cluster *cephv1alpha1.Cluster)) {
+
+	var cluster *cephv1alpha1.Cluster
+	k8sutil.RunMonitor(name, namespace, stopCh, func() time.Duration {
+		var err error
+		cluster, err = context.RookClientset.CephV1alpha1().Clusters(namespace).Get(clusterName, metav1.GetOptions{})
+		if err != nil {
+			logger.Warningf("failed to get the settings of the %s. %+v", name, err)
+			cluster = nil
+			return defaultInterval
+		}
+		return interval(&cluster.Spec)
+	}, func() {
+		if cluster != nil {
+			check(cluster)
+		}
+	})
+}
@@ -20,10 +20,13 @@ package osd
 import (
 	"encoding/json"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/coreos/pkg/capnslog"
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
 	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
 	"github.com/rook/rook/pkg/clusterd"
 	"github.com/rook/rook/pkg/daemon/ceph/client"
@@ -37,6 +40,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/util/wait"
 	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/kubernetes/pkg/api"
@@ -55,6 +59,23 @@ const (
 	appName                          = "rook-ceph-osd"
 	appNameFmt                       = "rook-ceph-osd-%s"
 	clusterAvailableSpaceReserve     = 0.05
+	statusUpdateRetries              = 5
+)
+
+// the phases of the conversion of an osd from filestore to bluestore by the osd pod
+const (
+	ConversionPhaseDraining     = "draining"
+	ConversionPhaseDestroying   = "destroying"
+	ConversionPhaseProvisioning = "provisioning"
+	ConversionPhaseCompleted    = "completed"
+)
+
+var (
+	orchestrationStatusCheckInterval = time.Minute
+	// the orchestration of the osds of a cluster by namespace, so the nodes are not orchestrated by the cluster
+	// update and the device watcher at the same time
+	orchestrationLocks     = map[string]*sync.Mutex{}
+	orchestrationLocksLock sync.Mutex
 )
 
 var clusterAccessRules = []v1beta1.PolicyRule{
@@ -76,13 +97,18 @@ type Cluster struct {
 	dataDirHostPath string
 	HostNetwork     bool
 	resources       v1.ResourceRequirements
+	orchestration   cephv1alpha1.OrchestrationSpec
 	ownerRef        metav1.OwnerReference
+	// How the crush location of the OSDs is taken from the labels of their nodes
+	CrushTopology cephv1alpha1.CrushTopologySpec
+	// the types of the crush map, read once per orchestration for the crush location of the nodes
+	crushTypes map[string]bool
 }
 
 // New creates an instance of the OSD manager
 func New(context *clusterd.Context, namespace, version string, storageSpec rookalpha.StorageScopeSpec,
 	dataDirHostPath string, placement rookalpha.Placement, hostNetwork bool,
-	resources v1.ResourceRequirements, ownerRef metav1.OwnerReference) *Cluster {
+	resources v1.ResourceRequirements, orchestration cephv1alpha1.OrchestrationSpec, ownerRef metav1.OwnerReference) *Cluster {
 
 	return &Cluster{
 		context:         context,
@@ -93,17 +119,20 @@ func New(context *clusterd.Context, namespace, version string, storageSpec rooka
 		dataDirHostPath: dataDirHostPath,
 		HostNetwork:     hostNetwork,
 		resources:       resources,
+		orchestration:   orchestration,
 		ownerRef:        ownerRef,
 	}
 }
 
-type OrchestrationStatus struct {
-	Status  string `json:"status"`
-	Message string `json:"message"`
-}
+// OrchestrationStatus is the orchestration status of a node that is saved in the orchestration status map. Besides the
+// state of the orchestration, the OSD pod on the node reports the devices it considered and the OSDs it created or removed.
+type OrchestrationStatus cephv1alpha1.OSDNodeStatus
 
 // Start the osd management
 func (c *Cluster) Start() error {
+	lock := orchestrationLock(c.Namespace)
+	lock.Lock()
+	defer lock.Unlock()
 	logger.Infof("start running osds in namespace %s", c.Namespace)
 
 	// create the artifacts for the osd to work with RBAC enabled
@@ -121,6 +150,8 @@ func (c *Cluster) Start() error {
 		return fmt.Errorf("failed to make OSD orchestration status config map: %+v", err)
 	}
 
+	c.loadCrushTypes()
+
 	// disable scrubbing during orchestration and ensure it gets enabled again afterwards
 	if o, err := client.DisableScrubbing(c.context, c.Namespace); err != nil {
 		logger.Warningf("failed to disable scrubbing: %+v. %s", err, o)
@@ -135,8 +166,11 @@ func (c *Cluster) Start() error {
 		// make a daemonset for all nodes in the cluster
 		storeConfig := config.ToStoreConfig(c.Storage.Config)
 		metadataDevice := config.MetadataDevice(c.Storage.Config)
-		ds := c.makeDaemonSet(c.Storage.Selection, storeConfig, metadataDevice, c.Storage.Location)
-		_, err := c.context.Clientset.Extensions().DaemonSets(c.Namespace).Create(ds)
+		ds, err := c.makeDaemonSet(c.Storage.Selection, storeConfig, metadataDevice, c.Storage.Location)
+		if err != nil {
+			return fmt.Errorf("failed to make osd daemon set. %+v", err)
+		}
+		_, err = c.context.Clientset.Extensions().DaemonSets(c.Namespace).Create(ds)
 		if err != nil {
 			if !errors.IsAlreadyExists(err) {
 				return fmt.Errorf("failed to create osd daemon set. %+v", err)
@@ -151,134 +185,393 @@ func (c *Cluster) Start() error {
 
 	// orchestrate individual nodes, starting with any that are still ongoing (in the case that we
 	// are resuming a previous orchestration attempt)
-	if inProgressNode, status := c.findInProgressNode(); inProgressNode != "" {
-		logger.Infof("resuming orchestration of in progress node %s, status: %+v", inProgressNode, status)
-		if err := c.waitForCompletion(inProgressNode); err != nil {
-			logger.Warningf("failed waiting for in progress node %s, will continue with orchestration.  %+v", inProgressNode, err)
-		}
+	errs := &orchestrationErrors{}
+	inProgressNodes := c.findInProgressNodes()
+	var wg sync.WaitGroup
+	for node, status := range inProgressNodes {
+		logger.Infof("resuming orchestration of in progress node %s, status: %+v", node, status)
+		wg.Add(1)
+		go func(node string) {
+			defer wg.Done()
+			if err := c.waitForCompletion(node); err != nil {
+				logger.Warningf("failed waiting for in progress node %s, will continue with orchestration.  %+v", node, err)
+			}
+		}(node)
 	}
+	wg.Wait()
 
-	errorMessages := make([]string, 0)
-
-	// start with nodes currently in the storage spec
+	// start with nodes currently in the storage spec. fully resolve the storage config and resources for each node.
+	nodes := make([]rookalpha.Node, len(c.Storage.Nodes))
 	for i := range c.Storage.Nodes {
-		// fully resolve the storage config and resources for this node
-		n := c.resolveNode(c.Storage.Nodes[i])
-		storeConfig := config.ToStoreConfig(n.Config)
-		metadataDevice := config.MetadataDevice(n.Config)
-
-		// update the orchestration status of this node to the starting state
-		status := OrchestrationStatus{Status: OrchestrationStatusStarting}
-		if err := UpdateOrchestrationStatusMap(c.context.Clientset, c.Namespace, n.Name, status); err != nil {
-			errorMessages = append(errorMessages, fmt.Sprintf("failed to set orchestration starting status for node %s: %+v", n.Name, err))
-			continue
-		}
-		devicesToUse := n.Devices
-		availDev, deviceErr := discover.GetAvailableDevices(c.context, n.Name, c.Namespace, n.Devices, n.Selection.DeviceFilter, n.Selection.GetUseAllDevices())
-		if deviceErr != nil {
-			logger.Warningf("failed to get devices for node %s cluster %s: %v", n.Name, c.Namespace, deviceErr)
+		nodes[i] = *c.resolveNode(c.Storage.Nodes[i])
+	}
+	c.orchestrateNodes(nodes, c.orchestration.MaxParallelNodes, func(n rookalpha.Node) {
+		c.addNode(n, errs)
+	})
+
+	// find all removed nodes (if any) and start orchestration to remove them from the cluster. removing a node migrates
+	// its data to the remaining nodes and the check for enough remaining capacity assumes the other nodes are staying,
+	// so the removed nodes are always orchestrated one at a time.
+	removedNodes, err := c.findRemovedNodes()
+	if err != nil {
+		return fmt.Errorf("failed to find removed nodes: %+v", err)
+	}
+	c.orchestrateNodes(removedNodes, 1, func(n rookalpha.Node) {
+		c.removeNode(n, errs)
+	})
+
+	errorMessages := errs.messages
+	if len(errorMessages) == 0 {
+		logger.Infof("completed running osds in namespace %s", c.Namespace)
+		return nil
+	}
+
+	return fmt.Errorf("%d failures encountered while running osds in namespace %s: %+v",
+		len(errorMessages), c.Namespace, strings.Join(errorMessages, "\n"))
+}
+
+// addNode starts the OSDs on a node in the storage spec and waits for the node's orchestration to complete
+func (c *Cluster) addNode(n rookalpha.Node, errs *orchestrationErrors) {
+	storeConfig := config.ToStoreConfig(n.Config)
+	metadataDevice := config.MetadataDevice(n.Config)
+
+	// the osds of a node in maintenance stay stopped until the node is taken out of maintenance
+	if n.Maintenance {
+		if err := c.startMaintenance(n); err != nil {
+			c.handleOrchestrationFailure(n, fmt.Sprintf("failed to start maintenance on node %s. %+v", n.Name, err), errs)
+		}
+		return
+	}
+	if err := c.stopMaintenance(n); err != nil {
+		c.handleOrchestrationFailure(n, fmt.Sprintf("failed to stop maintenance on node %s. %+v", n.Name, err), errs)
+		return
+	}
+
+	// update the orchestration status of this node to the starting state
+	status := OrchestrationStatus{Status: OrchestrationStatusStarting}
+	if err := UpdateOrchestrationStatusMap(c.context.Clientset, c.Namespace, n.Name, status); err != nil {
+		errs.add(fmt.Sprintf("failed to set orchestration starting status for node %s: %+v", n.Name, err))
+		return
+	}
+	devicesToUse := n.Devices
+	availDev, deviceErr := discover.GetAvailableDevices(c.context, n.Name, c.Namespace, n.Devices, n.Selection.DeviceFilter, n.Selection.GetUseAllDevices(),
+		n.Selection.DeviceSelector)
+	if deviceErr != nil {
+		logger.Warningf("failed to get devices for node %s cluster %s: %v", n.Name, c.Namespace, deviceErr)
+	} else {
+		devicesToUse = availDev
+		logger.Infof("avail devices for node %s: %+v", n.Name, availDev)
+	}
+	// create the replicaSet that will run the OSDs for this node
+	rs, err := c.makeReplicaSet(n.Name, devicesToUse, n.Selection, n.Resources, storeConfig, metadataDevice, c.nodeLocation(n))
+	if err != nil {
+		c.handleOrchestrationFailure(n, fmt.Sprintf("failed to make osd replica set for node %s. %+v", n.Name, err), errs)
+		return
+	}
+	_, err = c.context.Clientset.Extensions().ReplicaSets(c.Namespace).Create(rs)
+	if err != nil {
+		if !errors.IsAlreadyExists(err) {
+			// we failed to create the replica set, update the orchestration status for this node
+			message := fmt.Sprintf("failed to create osd replica set for node %s. %+v", n.Name, err)
+			c.handleOrchestrationFailure(n, message, errs)
+			return
 		} else {
-			devicesToUse = availDev
-			logger.Infof("avail devices for node %s: %+v", n.Name, availDev)
+			// TODO: if the replica set already exists, we may need to edit the pod template spec, for example if device filter has changed
+			message := fmt.Sprintf("osd replica set already exists for node %s", n.Name)
+			logger.Info(message)
+			status := OrchestrationStatus{Status: OrchestrationStatusCompleted, Message: message}
+			if err := UpdateOrchestrationStatusMap(c.context.Clientset, c.Namespace, n.Name, status); err != nil {
+				errs.add(fmt.Sprintf("failed to set orchestration status for node %s, status: %+v: %+v", n.Name, status, err))
+				return
+			}
 		}
-		// create the replicaSet that will run the OSDs for this node
-		rs := c.makeReplicaSet(n.Name, devicesToUse, n.Selection, n.Resources, storeConfig, metadataDevice, n.Location)
-		_, err := c.context.Clientset.Extensions().ReplicaSets(c.Namespace).Create(rs)
+	} else {
+		logger.Infof("osd replica set started for node %s", n.Name)
+	}
+
+	// wait for the current node's orchestration to be completed
+	if err := c.waitForCompletion(n.Name); err != nil {
+		errs.add(err.Error())
+		return
+	}
+	c.updateDeviceOwners(n.Name)
+}
+
+// refreshNode restarts the OSD pod of a node in the cluster so that it starts OSDs on the devices that were added to
+// the node since the node was orchestrated. All the OSDs of a node run in its OSD pod, so the existing OSDs of the node
+// are restarted as well. The OSDs are only restarted while the cluster is clean, and the noout flag is set on the node
+// until they have recovered so they are not marked out while they restart.
+func (c *Cluster) refreshNode(n rookalpha.Node) error {
+	lock := orchestrationLock(c.Namespace)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if n.Maintenance {
+		logger.Infof("not refreshing node %s in maintenance", n.Name)
+		return nil
+	}
+	if !c.Storage.UseAllNodes {
+		rs, err := c.context.Clientset.Extensions().ReplicaSets(c.Namespace).Get(fmt.Sprintf(appNameFmt, n.Name), metav1.GetOptions{})
 		if err != nil {
-			if !errors.IsAlreadyExists(err) {
-				// we failed to create the replica set, update the orchestration status for this node
-				message := fmt.Sprintf("failed to create osd replica set for node %s. %+v", n.Name, err)
-				c.handleOrchestrationFailure(*n, message, &errorMessages)
-				continue
-			} else {
-				// TODO: if the replica set already exists, we may need to edit the pod template spec, for example if device filter has changed
-				message := fmt.Sprintf("osd replica set already exists for node %s", n.Name)
-				logger.Info(message)
-				status := OrchestrationStatus{Status: OrchestrationStatusCompleted, Message: message}
-				if err := UpdateOrchestrationStatusMap(c.context.Clientset, c.Namespace, n.Name, status); err != nil {
-					errorMessages = append(errorMessages, fmt.Sprintf("failed to set orchestration status for node %s, status: %+v: %+v", n.Name, status, err))
-					continue
-				}
+			if errors.IsNotFound(err) {
+				logger.Infof("no osds were started on node %s yet, the next orchestration starts them", n.Name)
+				return nil
 			}
-		} else {
-			logger.Infof("osd replica set started for node %s", n.Name)
+			return fmt.Errorf("failed to get osd replica set for node %s. %+v", n.Name, err)
+		}
+		if isInMaintenance(rs) {
+			logger.Infof("not refreshing node %s while its maintenance is completed", n.Name)
+			return nil
+		}
+	}
+
+	if err := client.IsClusterClean(c.context, c.Namespace); err != nil {
+		return fmt.Errorf("not restarting the osds on node %s while the cluster is not clean. %+v", n.Name, err)
+	}
+	if err := c.setHostMaintenanceFlag(n); err != nil {
+		return err
+	}
+	defer func() {
+		if err := c.clearHostMaintenanceFlag(n); err != nil {
+			logger.Warningf("failed to clear the %s flag on node %s after restarting its osds. %+v", maintenanceHostFlag, n.Name, err)
 		}
+	}()
 
-		// wait for the current node's orchestration to be completed
-		if err := c.waitForCompletion(n.Name); err != nil {
-			errorMessages = append(errorMessages, err.Error())
-			continue
+	if c.Storage.UseAllNodes {
+		// the osd daemon set starts the osds on the devices of the node when its pod on the node is restarted
+		logger.Infof("restarting the osds on node %s to start osds on its new devices", n.Name)
+		restarted, err := c.restartDaemonSetPod(n.Name)
+		if err != nil || !restarted {
+			return err
+		}
+	} else {
+		c.loadCrushTypes()
+		if err := c.restartReplicaSetPod(n); err != nil {
+			return err
 		}
 	}
 
-	// find all removed nodes (if any) and start orchestration to remove them from the cluster
-	removedNodes, err := c.findRemovedNodes()
+	// the noout flag is kept until the restarted osds have caught up with the rest of the cluster
+	err := wait.Poll(maintenanceRecoveryInterval, maintenanceRecoveryTimeout, func() (bool, error) {
+		if err := client.IsClusterRecovered(c.context, c.Namespace); err != nil {
+			logger.Infof("waiting for the osds on node %s to recover after their restart. %+v", n.Name, err)
+			return false, nil
+		}
+		return true, nil
+	})
 	if err != nil {
-		return fmt.Errorf("failed to find removed nodes: %+v", err)
+		return fmt.Errorf("osds did not recover after restarting the osds on node %s. %+v", n.Name, err)
 	}
+	return nil
+}
 
-	for i := range removedNodes {
-		n := removedNodes[i]
-		storeConfig := config.ToStoreConfig(n.Config)
-		metadataDevice := config.MetadataDevice(n.Config)
+// restartReplicaSetPod updates the replica set of the node with its current devices and restarts its pod with the new
+// template
+func (c *Cluster) restartReplicaSetPod(n rookalpha.Node) error {
+	if err := UpdateOrchestrationStatusMap(c.context.Clientset, c.Namespace, n.Name, OrchestrationStatus{Status: OrchestrationStatusStarting}); err != nil {
+		return fmt.Errorf("failed to set orchestration starting status for node %s: %+v", n.Name, err)
+	}
+	devicesToUse := n.Devices
+	availDev, err := discover.GetAvailableDevices(c.context, n.Name, c.Namespace, n.Devices, n.Selection.DeviceFilter, n.Selection.GetUseAllDevices(),
+		n.Selection.DeviceSelector)
+	if err != nil {
+		logger.Warningf("failed to get devices for node %s cluster %s: %v", n.Name, c.Namespace, err)
+	} else {
+		devicesToUse = availDev
+		logger.Infof("avail devices for node %s: %+v", n.Name, availDev)
+	}
 
-		if err := c.isSafeToRemoveNode(n); err != nil {
-			message := fmt.Sprintf("skipping the removal of node %s because it is not safe to do so: %+v", n.Name, err)
-			c.handleOrchestrationFailure(n, message, &errorMessages)
-			continue
-		}
+	rs, err := c.makeReplicaSet(n.Name, devicesToUse, n.Selection, n.Resources, config.ToStoreConfig(n.Config), config.MetadataDevice(n.Config),
+		c.nodeLocation(n))
+	if err != nil {
+		return fmt.Errorf("failed to make osd replica set for node %s. %+v", n.Name, err)
+	}
+	rs, err = c.context.Clientset.Extensions().ReplicaSets(c.Namespace).Update(rs)
+	if err != nil {
+		return fmt.Errorf("failed to update osd replica set for node %s. %+v", n.Name, err)
+	}
+	if err := c.deleteOSDPod(rs); err != nil {
+		return fmt.Errorf("failed to find and delete OSD pod for replica set %s. %+v", rs.Name, err)
+	}
 
-		logger.Infof("removing node %s from the cluster", n.Name)
+	if err := c.waitForCompletion(n.Name); err != nil {
+		return err
+	}
+	c.updateDeviceOwners(n.Name)
+	return nil
+}
 
-		// update the orchestration status of this removed node to the starting state
-		if err := UpdateOrchestrationStatusMap(c.context.Clientset, c.Namespace, n.Name, OrchestrationStatus{Status: OrchestrationStatusStarting}); err != nil {
-			errorMessages = append(errorMessages, fmt.Sprintf("failed to set orchestration starting status for removed node %s: %+v", n.Name, err))
-			continue
-		}
+// removeNode removes the OSDs of a node that is no longer in the storage spec and then deletes the node's replica set
+func (c *Cluster) removeNode(n rookalpha.Node, errs *orchestrationErrors) {
+	storeConfig := config.ToStoreConfig(n.Config)
+	metadataDevice := config.MetadataDevice(n.Config)
 
-		// trigger orchestration on the removed node by telling it not to use any storage at all.  note that the directories are still passed in
-		// so that the pod will be able to mount them and migrate data from them.
-		rs := c.makeReplicaSet(n.Name, nil, rookalpha.Selection{DeviceFilter: "none", Directories: n.Directories},
-			v1.ResourceRequirements{}, storeConfig, metadataDevice, n.Location)
-		rs, err := c.context.Clientset.Extensions().ReplicaSets(c.Namespace).Update(rs)
-		if err != nil {
-			message := fmt.Sprintf("failed to update osd replica set for removed node %s. %+v", n.Name, err)
-			c.handleOrchestrationFailure(n, message, &errorMessages)
-			continue
-		} else {
-			logger.Infof("osd replica set updated for node %s", n.Name)
-		}
+	// the osds of the node must be running to migrate their data off the node
+	if err := c.stopMaintenance(n); err != nil {
+		c.handleOrchestrationFailure(n, fmt.Sprintf("failed to stop maintenance on removed node %s. %+v", n.Name, err), errs)
+		return
+	}
+
+	if err := c.isSafeToRemoveNode(n); err != nil {
+		message := fmt.Sprintf("skipping the removal of node %s because it is not safe to do so: %+v", n.Name, err)
+		c.handleOrchestrationFailure(n, message, errs)
+		return
+	}
+
+	logger.Infof("removing node %s from the cluster", n.Name)
+
+	// update the orchestration status of this removed node to the starting state
+	if err := UpdateOrchestrationStatusMap(c.context.Clientset, c.Namespace, n.Name, OrchestrationStatus{Status: OrchestrationStatusStarting}); err != nil {
+		errs.add(fmt.Sprintf("failed to set orchestration starting status for removed node %s: %+v", n.Name, err))
+		return
+	}
+
+	// trigger orchestration on the removed node by telling it not to use any storage at all.  note that the directories are still passed in
+	// so that the pod will be able to mount them and migrate data from them.
+	rs, err := c.makeReplicaSet(n.Name, nil, rookalpha.Selection{DeviceFilter: "none", Directories: n.Directories},
+		v1.ResourceRequirements{}, storeConfig, metadataDevice, n.Location)
+	if err != nil {
+		c.handleOrchestrationFailure(n, fmt.Sprintf("failed to make osd replica set for removed node %s. %+v", n.Name, err), errs)
+		return
+	}
+	rs, err = c.context.Clientset.Extensions().ReplicaSets(c.Namespace).Update(rs)
+	if err != nil {
+		message := fmt.Sprintf("failed to update osd replica set for removed node %s. %+v", n.Name, err)
+		c.handleOrchestrationFailure(n, message, errs)
+		return
+	} else {
+		logger.Infof("osd replica set updated for node %s", n.Name)
+	}
+
+	// delete the pod associated with the replica set so that it will be restarted with the new template
+	if err := c.deleteOSDPod(rs); err != nil {
+		message := fmt.Sprintf("failed to find and delete OSD pod for replica set %s. %+v", rs.Name, err)
+		c.handleOrchestrationFailure(n, message, errs)
+		return
+	}
 
-		// delete the pod associated with the replica set so that it will be restarted with the new template
-		if err := c.deleteOSDPod(rs); err != nil {
-			message := fmt.Sprintf("failed to find and delete OSD pod for replica set %s. %+v", rs.Name, err)
-			c.handleOrchestrationFailure(n, message, &errorMessages)
-			continue
+	// wait for the removed node's orchestration to be completed
+	if err := c.waitForCompletion(n.Name); err != nil {
+		errs.add(err.Error())
+		return
+	}
+	c.updateDeviceOwners(n.Name)
+
+	// orchestration of the removed node completed, we can delete the replica set now
+	if err := c.context.Clientset.Extensions().ReplicaSets(c.Namespace).Delete(rs.Name, &metav1.DeleteOptions{}); err != nil {
+		errs.add(fmt.Sprintf("failed to delete replica set %s: %+v", rs.Name, err))
+	}
+}
+
+// orchestrateNodes runs the orchestration of the given nodes with at most maxParallel nodes in progress at the same
+// time. If a failure domain is configured, the nodes of one failure domain are completed before the next one starts.
+func (c *Cluster) orchestrateNodes(nodes []rookalpha.Node, maxParallel int, orchestrate func(n rookalpha.Node)) {
+	if maxParallel < 1 {
+		maxParallel = 1
+	}
+
+	for _, group := range groupNodesByFailureDomain(nodes, c.orchestration.FailureDomain) {
+		var wg sync.WaitGroup
+		inProgress := make(chan struct{}, maxParallel)
+		for i := range group {
+			// wait for a free slot before starting the next node
+			inProgress <- struct{}{}
+			wg.Add(1)
+			go func(n rookalpha.Node) {
+				defer func() {
+					<-inProgress
+					wg.Done()
+				}()
+				orchestrate(n)
+			}(group[i])
 		}
+		wg.Wait()
+	}
+}
 
-		// wait for the removed node's orchestration to be completed
-		if err := c.waitForCompletion(n.Name); err != nil {
-			errorMessages = append(errorMessages, err.Error())
-			continue
+// groupNodesByFailureDomain splits the nodes into groups with the same value for the failure domain in their
+// location, in the order the failure domains are first seen. Without a failure domain all nodes are in one group.
+func groupNodesByFailureDomain(nodes []rookalpha.Node, failureDomain string) [][]rookalpha.Node {
+	if len(nodes) == 0 {
+		return nil
+	}
+	if failureDomain == "" {
+		return [][]rookalpha.Node{nodes}
+	}
+
+	var groups [][]rookalpha.Node
+	groupIndex := map[string]int{}
+	for _, n := range nodes {
+		domain := n.Name
+		if failureDomain != "host" {
+			domain = getLocationValue(n.Location, failureDomain)
 		}
 
-		// orchestration of the removed node completed, we can delete the replica set now
-		if err := c.context.Clientset.Extensions().ReplicaSets(c.Namespace).Delete(rs.Name, &metav1.DeleteOptions{}); err != nil {
-			errorMessages = append(errorMessages, fmt.Sprintf("failed to delete replica set %s: %+v", rs.Name, err))
-			continue
+		i, ok := groupIndex[domain]
+		if !ok {
+			i = len(groups)
+			groupIndex[domain] = i
+			groups = append(groups, []rookalpha.Node{})
 		}
+		groups[i] = append(groups[i], n)
 	}
 
-	if len(errorMessages) == 0 {
-		logger.Infof("completed running osds in namespace %s", c.Namespace)
-		return nil
+	return groups
+}
+
+// getLocationValue returns the value of the given type in a location such as "rack=rack1,zone=zone2"
+func getLocationValue(location, locationType string) string {
+	for _, pair := range strings.Split(location, ",") {
+		kv := strings.Split(strings.TrimSpace(pair), "=")
+		if len(kv) == 2 && kv[0] == locationType {
+			return kv[1]
+		}
 	}
+	return ""
+}
 
-	return fmt.Errorf("%d failures encountered while running osds in namespace %s: %+v",
-		len(errorMessages), c.Namespace, strings.Join(errorMessages, "\n"))
+// orchestrationErrors collects the errors of nodes that are orchestrated in parallel
+type orchestrationErrors struct {
+	sync.Mutex
+	messages []string
+}
+
+func (e *orchestrationErrors) add(message string) {
+	e.Lock()
+	defer e.Unlock()
+	e.messages = append(e.messages, message)
 }
 
+// UpdateOrchestrationStatusMap saves the orchestration status of the node. If the status has no conversion progress,
+// the conversion progress saved for the node is kept so an interrupted conversion to bluestore can be resumed.
 func UpdateOrchestrationStatusMap(clientset kubernetes.Interface, namespace string, node string, status OrchestrationStatus) error {
+	return updateOrchestrationStatusMapWithRetries(clientset, namespace, node, status, true)
+}
+
+// ClearConversionStatus saves the orchestration status of the node without any conversion progress, once the
+// conversion to bluestore is completed or abandoned
+func ClearConversionStatus(clientset kubernetes.Interface, namespace string, node string, status OrchestrationStatus) error {
+	status.Conversion = nil
+	return updateOrchestrationStatusMapWithRetries(clientset, namespace, node, status, false)
+}
+
+func updateOrchestrationStatusMapWithRetries(clientset kubernetes.Interface, namespace string, node string, status OrchestrationStatus, keepConversion bool) error {
+	// the status map is shared by all nodes, retry if another node updated it at the same time
+	var err error
+	for i := 0; i < statusUpdateRetries; i++ {
+		err = updateOrchestrationStatusMap(clientset, namespace, node, status, keepConversion)
+		if err == nil {
+			return nil
+		}
+		if !errors.IsConflict(err) {
+			return fmt.Errorf("failed to update OSD orchestration status for node %s. %+v", node, err)
+		}
+		logger.Infof("conflict updating orchestration status for node %s, will retry. %+v", node, err)
+	}
+	return fmt.Errorf("failed to update OSD orchestration status for node %s, status %+v.  %+v", node, status, err)
+}
+
+func updateOrchestrationStatusMap(clientset kubernetes.Interface, namespace string, node string, status OrchestrationStatus, keepConversion bool) error {
 	cm, err := clientset.CoreV1().ConfigMaps(namespace).Get(OrchestrationStatusMapName, metav1.GetOptions{})
 	if err != nil {
 		if !errors.IsNotFound(err) {
@@ -301,15 +594,18 @@ func UpdateOrchestrationStatusMap(clientset kubernetes.Interface, namespace stri
 		cm.Data = make(map[string]string)
 	}
 
+	// the progress of a conversion to bluestore is kept when the status is replaced so the conversion can be resumed
+	if status.Conversion == nil && keepConversion {
+		if previous := parseOrchestrationStatus(cm.Data, node); previous != nil {
+			status.Conversion = previous.Conversion
+		}
+	}
+
 	// update the status map with the given status now
 	s, _ := json.Marshal(status)
 	cm.Data[node] = string(s)
-	cm, err = clientset.CoreV1().ConfigMaps(namespace).Update(cm)
-	if err != nil {
-		return fmt.Errorf("failed to update OSD orchestration status for node %s, status %+v.  %+v", node, status, err)
-	}
-
-	return nil
+	_, err = clientset.CoreV1().ConfigMaps(namespace).Update(cm)
+	return err
 }
 
 func makeOrchestrationStatusMap(clientset kubernetes.Interface, namespace string, ownerRef *metav1.OwnerReference) error {
@@ -342,15 +638,16 @@ func makeOrchestrationStatusMap(clientset kubernetes.Interface, namespace string
 	return nil
 }
 
-func (c *Cluster) handleOrchestrationFailure(n rookalpha.Node, message string, errorMessages *[]string) {
+func (c *Cluster) handleOrchestrationFailure(n rookalpha.Node, message string, errs *orchestrationErrors) {
 	logger.Warning(message)
 	status := OrchestrationStatus{Status: OrchestrationStatusFailed, Message: message}
 	UpdateOrchestrationStatusMap(c.context.Clientset, c.Namespace, n.Name, status)
-	*errorMessages = append(*errorMessages, message)
+	errs.add(message)
 }
 
 func isStatusCompleted(status OrchestrationStatus) bool {
-	return status.Status == OrchestrationStatusCompleted || status.Status == OrchestrationStatusFailed
+	return status.Status == OrchestrationStatusCompleted || status.Status == OrchestrationStatusFailed ||
+		status.Status == OrchestrationStatusMaintenance
 }
 
 func parseOrchestrationStatus(data map[string]string, node string) *OrchestrationStatus {
@@ -373,35 +670,54 @@ func parseOrchestrationStatus(data map[string]string, node string) *Orchestratio
 	return &status
 }
 
-func (c *Cluster) findInProgressNode() (string, *OrchestrationStatus) {
-	cm, err := c.context.Clientset.CoreV1().ConfigMaps(c.Namespace).Get(OrchestrationStatusMapName, metav1.GetOptions{})
+// GetOrchestrationStatus returns the orchestration status of all nodes in the orchestration status map
+func GetOrchestrationStatus(clientset kubernetes.Interface, namespace string) (map[string]OrchestrationStatus, error) {
+	cm, err := clientset.CoreV1().ConfigMaps(namespace).Get(OrchestrationStatusMapName, metav1.GetOptions{})
 	if err != nil {
-		return "", nil
+		if errors.IsNotFound(err) {
+			return map[string]OrchestrationStatus{}, nil
+		}
+		return nil, fmt.Errorf("failed to get OSD orchestration status map %s: %+v", OrchestrationStatusMapName, err)
 	}
 
-	if len(cm.Data) == 0 {
-		// no orchestration status available, no in progress node
-		return "", nil
+	statuses := map[string]OrchestrationStatus{}
+	for node := range cm.Data {
+		if status := parseOrchestrationStatus(cm.Data, node); status != nil {
+			statuses[node] = *status
+		}
 	}
 
-	for node, statusRaw := range cm.Data {
-		var status OrchestrationStatus
-		if err := json.Unmarshal([]byte(statusRaw), &status); err != nil {
-			logger.Warningf("failed to unmarshal orchestration status for node %s. status: %s. %+v", node, statusRaw, err)
-			continue
-		}
+	return statuses, nil
+}
+
+// findInProgressNodes returns the nodes whose orchestration has not completed yet
+func (c *Cluster) findInProgressNodes() map[string]*OrchestrationStatus {
+	inProgress := map[string]*OrchestrationStatus{}
+	statuses, err := GetOrchestrationStatus(c.context.Clientset, c.Namespace)
+	if err != nil {
+		logger.Warningf("failed to find in progress nodes. %+v", err)
+		return inProgress
+	}
 
+	for node := range statuses {
+		status := statuses[node]
 		if !isStatusCompleted(status) {
-			// found an in progress node, return it
-			return node, &status
+			inProgress[node] = &status
 		}
 	}
 
-	// didn't find any in progress nodes
-	return "", nil
+	return inProgress
 }
 
+// waitForCompletion waits for the orchestration of the node to be completed. If a node timeout is configured and
+// the node does not complete in time, the node's orchestration is marked as failed.
 func (c *Cluster) waitForCompletion(node string) error {
+	var timeout <-chan time.Time
+	var lastConversion string
+	if c.orchestration.NodeTimeoutSeconds > 0 {
+		timeout = time.After(time.Duration(c.orchestration.NodeTimeoutSeconds) * time.Second)
+	}
+
 	// check the status map to see if the node is already completed before we start watching
 	cm, err := c.context.Clientset.CoreV1().ConfigMaps(c.Namespace).Get(OrchestrationStatusMapName, metav1.GetOptions{})
 	if err != nil {
@@ -411,13 +727,8 @@ func (c *Cluster) waitForCompletion(node string) error {
 		// the status map doesn't exist yet, watching below is still an OK thing to do
 	} else {
 		// the status map exists, check the current value for the node to see if it's completed
-		status := parseOrchestrationStatus(cm.Data, node)
-		if status != nil {
-			if status.Status == OrchestrationStatusCompleted {
-				return nil
-			} else if status.Status == OrchestrationStatusFailed {
-				return fmt.Errorf("orchestration for node %s failed: %+v", node, status)
-			}
+		if done, err := checkNodeCompletion(cm, node); done {
+			return err
 		}
 	}
 
@@ -450,27 +761,89 @@ func (c *Cluster) waitForCompletion(node string) error {
 				}
 
 				if e.Type == watch.Modified {
-					statusMap := e.Object.(*v1.ConfigMap)
-					status := parseOrchestrationStatus(statusMap.Data, node)
-					if status == nil {
-						continue
+					if done, err := checkNodeCompletion(e.Object.(*v1.ConfigMap), node); done {
+						return err
+					}
+				}
+
+			case <-time.After(orchestrationStatusCheckInterval):
+				// the watch can miss an update, for example while it is restarted after its channel was closed, so
+				// check the status map directly every so often while we are waiting
+				logger.Infof("waiting on orchestration status update from node %s", node)
+				cm, err := c.context.Clientset.CoreV1().ConfigMaps(c.Namespace).Get(OrchestrationStatusMapName, metav1.GetOptions{})
+				if err == nil {
+					if done, err := checkNodeCompletion(cm, node); done {
+						return err
 					}
+				}
 
-					if status.Status == OrchestrationStatusCompleted {
-						return nil
-					} else if status.Status == OrchestrationStatusFailed {
-						return fmt.Errorf("orchestration for node %s failed: %+v", node, status)
+			case <-timeout:
+				// draining an osd that is converted to bluestore can take much longer than the orchestration of a
+				// node. the node does not time out as long as the progress reported by the osd pod changed since the
+				// last timeout, while the osd pod gives up on an osd that does not drain in time.
+				message := fmt.Sprintf("timed out after %ds waiting for orchestration of node %s", c.orchestration.NodeTimeoutSeconds, node)
+				var conversion *cephv1alpha1.OSDConversionStatus
+				if status := c.getNodeStatus(node); status != nil && isConverting(status) {
+					progress := fmt.Sprintf("%d %s %s", status.Conversion.OSDID, status.Conversion.Phase, status.Message)
+					if progress != lastConversion {
+						logger.Infof("node %s is converting osd %d to bluestore (%s), extending the orchestration timeout",
+							node, status.Conversion.OSDID, status.Conversion.Phase)
+						lastConversion = progress
+						timeout = time.After(time.Duration(c.orchestration.NodeTimeoutSeconds) * time.Second)
+						continue
 					}
+					message = fmt.Sprintf("%s. the conversion of osd %d to bluestore made no progress: %s", message, status.Conversion.OSDID, status.Message)
+					// keep the phase of the conversion so the next orchestration of the node can resume it
+					conversion = status.Conversion
 				}
 
-			case <-time.After(time.Minute):
-				// log every so often while we are waiting
-				logger.Infof("waiting on orchestration status update from node %s", node)
+				status := OrchestrationStatus{Status: OrchestrationStatusFailed, Message: message, Conversion: conversion}
+				if err := UpdateOrchestrationStatusMap(c.context.Clientset, c.Namespace, node, status); err != nil {
+					logger.Warningf("failed to set timed out status for node %s. %+v", node, err)
+				}
+				return fmt.Errorf("%s", message)
 			}
 		}
 	}
 }
 
+// getNodeStatus returns the orchestration status of the node, or nil if the status cannot be read
+func (c *Cluster) getNodeStatus(node string) *OrchestrationStatus {
+	statuses, err := GetOrchestrationStatus(c.context.Clientset, c.Namespace)
+	if err != nil {
+		logger.Warningf("failed to get the orchestration status of node %s. %+v", node, err)
+		return nil
+	}
+	if status, ok := statuses[node]; ok {
+		return &status
+	}
+	return nil
+}
+
+// isConverting returns whether an osd of the node is being converted to bluestore
+func isConverting(status *OrchestrationStatus) bool {
+	if status.Conversion == nil || isStatusCompleted(*status) {
+		return false
+	}
+	return status.Conversion.Phase != "" && status.Conversion.Phase != ConversionPhaseCompleted
+}
+
+// checkNodeCompletion returns whether the orchestration of the node is done according to the status map, and an
+// error if the orchestration failed
+func checkNodeCompletion(statusMap *v1.ConfigMap, node string) (bool, error) {
+	status := parseOrchestrationStatus(statusMap.Data, node)
+	if status == nil {
+		return false, nil
+	}
+
+	if status.Status == OrchestrationStatusCompleted {
+		return true, nil
+	} else if status.Status == OrchestrationStatusFailed {
+		return true, fmt.Errorf("orchestration for node %s failed: %+v", node, status)
+	}
+	return false, nil
+}
+
 func IsRemovingNode(devices string) bool {
 	return devices == "none"
 }
@@ -638,6 +1011,52 @@ func (c *Cluster) deleteOSDPod(rs *extensions.ReplicaSet) error {
 	return err
 }
 
+// restartDaemonSetPod deletes the pod of the osd daemon set on the given node and waits for the daemon set to start
+// its new pod. Returns false if there is no osd pod on the node, in which case there is nothing to restart.
+func (c *Cluster) restartDaemonSetPod(nodeName string) (bool, error) {
+	pod, err := c.getDaemonSetPod(nodeName)
+	if err != nil {
+		return false, err
+	}
+	if pod == nil {
+		logger.Infof("no osd pod on node %s to restart", nodeName)
+		return false, nil
+	}
+
+	logger.Infof("restarting osd pod %s on node %s", pod.Name, nodeName)
+	if err := c.context.Clientset.CoreV1().Pods(c.Namespace).Delete(pod.Name, &metav1.DeleteOptions{}); err != nil {
+		return false, fmt.Errorf("failed to delete osd pod %s. %+v", pod.Name, err)
+	}
+
+	err = wait.Poll(maintenanceRecoveryInterval, maintenanceRecoveryTimeout, func() (bool, error) {
+		newPod, err := c.getDaemonSetPod(nodeName)
+		if err != nil {
+			logger.Infof("failed to get the new osd pod on node %s. %+v", nodeName, err)
+			return false, nil
+		}
+		return newPod != nil && newPod.Name != pod.Name && newPod.Status.Phase == v1.PodRunning, nil
+	})
+	if err != nil {
+		return true, fmt.Errorf("osd pod on node %s did not restart. %+v", nodeName, err)
+	}
+	return true, nil
+}
+
+// getDaemonSetPod returns the pod of the osd daemon set on the given node, or nil if there is none
+func (c *Cluster) getDaemonSetPod(nodeName string) (*v1.Pod, error) {
+	opts := metav1.ListOptions{LabelSelector: fields.OneTermEqualSelector(k8sutil.AppAttr, appName).String()}
+	pods, err := c.context.Clientset.CoreV1().Pods(c.Namespace).List(opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list osd pods. %+v", err)
+	}
+	for i := range pods.Items {
+		if pods.Items[i].Spec.NodeName == nodeName && pods.Items[i].DeletionTimestamp == nil {
+			return &pods.Items[i], nil
+		}
+	}
+	return nil, nil
+}
+
 func (c *Cluster) getOSDsForNode(node rookalpha.Node) ([]int, error) {
 	kv := k8sutil.NewConfigMapKVStore(c.Namespace, c.context.Clientset, c.ownerRef)
 
@@ -667,6 +1086,105 @@ func (c *Cluster) getOSDsForNode(node rookalpha.Node) ([]int, error) {
 	return osdsForNode, nil
 }
 
+// getOSDsByDevice returns the OSDs with any partition on each device of the node, as saved in the partition scheme of
+// the node
+func getOSDsByDevice(kv *k8sutil.ConfigMapKVStore, nodeName string) (map[string][]int, error) {
+	scheme, err := config.LoadScheme(kv, config.GetConfigStoreName(nodeName))
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+
+	osdsByDevice := map[string][]int{}
+	for _, entry := range scheme.Entries {
+		devices := map[string]bool{}
+		for _, partition := range entry.Partitions {
+			if !devices[partition.Device] {
+				devices[partition.Device] = true
+				osdsByDevice[partition.Device] = append(osdsByDevice[partition.Device], entry.ID)
+			}
+		}
+	}
+	return osdsByDevice, nil
+}
+
+// OSDDevice is a device with OSD partitions on a node
+type OSDDevice struct {
+	// the kernel name of the device when the partitions were created
+	Name string
+	// a path to the device that is stable across reboots, if udev reported one when the partitions were created
+	PersistentID string
+	// the OSDs with partitions on the device
+	OSDIDs []int
+}
+
+// GetOSDDevices returns the devices with OSD partitions on the node, as saved in the partition scheme of the node
+func GetOSDDevices(clientset kubernetes.Interface, namespace, nodeName string) ([]OSDDevice, error) {
+	kv := k8sutil.NewConfigMapKVStore(namespace, clientset, metav1.OwnerReference{})
+	scheme, err := config.LoadScheme(kv, config.GetConfigStoreName(nodeName))
+	if err != nil && !errors.IsNotFound(err) {
+		return nil, err
+	}
+
+	devices := map[string]*OSDDevice{}
+	for _, entry := range scheme.Entries {
+		for _, partition := range entry.Partitions {
+			device, ok := devices[partition.Device]
+			if !ok {
+				device = &OSDDevice{Name: partition.Device}
+				devices[partition.Device] = device
+			}
+			if device.PersistentID == "" {
+				device.PersistentID = partition.PersistentID
+			}
+			if len(device.OSDIDs) == 0 || device.OSDIDs[len(device.OSDIDs)-1] != entry.ID {
+				device.OSDIDs = append(device.OSDIDs, entry.ID)
+			}
+		}
+	}
+
+	result := []OSDDevice{}
+	for _, device := range devices {
+		result = append(result, *device)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+// updateDeviceOwners records the OSDs of the cluster on the devices of the node in the device inventory
+func (c *Cluster) updateDeviceOwners(nodeName string) {
+	kv := k8sutil.NewConfigMapKVStore(c.Namespace, c.context.Clientset, c.ownerRef)
+	osdsByDevice, err := getOSDsByDevice(kv, nodeName)
+	if err != nil {
+		logger.Warningf("failed to get the osds on the devices of node %s. %+v", nodeName, err)
+		return
+	}
+	if err := discover.SetDeviceOwners(c.context, nodeName, c.Namespace, osdsByDevice); err != nil {
+		logger.Warningf("failed to update the device owners of node %s. %+v", nodeName, err)
+	}
+}
+
+// storageNode returns the fully resolved storage settings of the node, or nil if the cluster doesn't store data on the node
+func (c *Cluster) storageNode(nodeName string) *rookalpha.Node {
+	if c.Storage.UseAllNodes {
+		return &rookalpha.Node{Name: nodeName, Config: c.Storage.Config, Location: c.Storage.Location, Selection: c.Storage.Selection}
+	}
+	if c.Storage.ResolveNode(nodeName) == nil {
+		return nil
+	}
+	return c.resolveNode(rookalpha.Node{Name: nodeName})
+}
+
+func orchestrationLock(namespace string) *sync.Mutex {
+	orchestrationLocksLock.Lock()
+	defer orchestrationLocksLock.Unlock()
+	lock, ok := orchestrationLocks[namespace]
+	if !ok {
+		lock = &sync.Mutex{}
+		orchestrationLocks[namespace] = lock
+	}
+	return lock
+}
+
 func (c *Cluster) resolveNode(storageNode rookalpha.Node) *rookalpha.Node {
 	// fully resolve the storage config and resources for this node
 	rookNode := c.Storage.ResolveNode(storageNode.Name)
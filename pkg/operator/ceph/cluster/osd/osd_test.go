@@ -18,10 +18,14 @@ package osd
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
 	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
+	rookfake "github.com/rook/rook/pkg/client/clientset/versioned/fake"
 	"github.com/rook/rook/pkg/clusterd"
 	"github.com/rook/rook/pkg/operator/ceph/cluster/osd/config"
 	"github.com/rook/rook/pkg/operator/k8sutil"
@@ -39,8 +43,8 @@ import (
 
 func TestStart(t *testing.T) {
 	clientset := fake.NewSimpleClientset()
-	c := New(&clusterd.Context{Clientset: clientset, ConfigDir: "/var/lib/rook", Executor: &exectest.MockExecutor{}}, "ns", "myversion",
-		rookalpha.StorageScopeSpec{}, "", rookalpha.Placement{}, false, v1.ResourceRequirements{}, metav1.OwnerReference{})
+	c := New(&clusterd.Context{Clientset: clientset, RookClientset: rookfake.NewSimpleClientset(), ConfigDir: "/var/lib/rook", Executor: &exectest.MockExecutor{}}, "ns", "myversion",
+		rookalpha.StorageScopeSpec{}, "", rookalpha.Placement{}, false, v1.ResourceRequirements{}, cephv1alpha1.OrchestrationSpec{}, metav1.OwnerReference{})
 
 	// Start the first time
 	err := c.Start()
@@ -51,6 +55,68 @@ func TestStart(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestRefreshNode(t *testing.T) {
+	maintenanceRecoveryInterval = time.Millisecond
+	defer func() { maintenanceRecoveryInterval = 10 * time.Second }()
+
+	clean := false
+	var commands []string
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outputFile string, args ...string) (string, error) {
+			if args[0] == "status" {
+				if clean {
+					return `{"pgmap":{"num_pgs":100,"pgs_by_state":[{"state_name":"active+clean","count":100}]}}`, nil
+				}
+				return `{"pgmap":{"num_pgs":100,"pgs_by_state":[{"state_name":"active+remapped+backfilling","count":100}]}}`, nil
+			}
+			commands = append(commands, strings.Join(args[:3], " "))
+			return "", nil
+		},
+	}
+	clientset := fake.NewSimpleClientset()
+	c := New(&clusterd.Context{Clientset: clientset, RookClientset: rookfake.NewSimpleClientset(), ConfigDir: "/var/lib/rook", Executor: executor}, "ns", "myversion",
+		rookalpha.StorageScopeSpec{UseAllNodes: true}, "", rookalpha.Placement{}, false, v1.ResourceRequirements{}, cephv1alpha1.OrchestrationSpec{}, metav1.OwnerReference{})
+	node := rookalpha.Node{Name: "node1"}
+
+	// the osds are not restarted while the cluster is not clean
+	assert.NotNil(t, c.refreshNode(node))
+	assert.Equal(t, 0, len(commands))
+
+	// a node without an osd pod has nothing to restart
+	clean = true
+	assert.Nil(t, c.refreshNode(node))
+	assert.Equal(t, []string{"osd set-group noout", "osd unset-group noout"}, commands)
+
+	// the osd pod is restarted with the noout flag set on the node
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: "osd1", Namespace: "ns", Labels: map[string]string{k8sutil.AppAttr: appName}},
+		Spec: v1.PodSpec{NodeName: node.Name}}
+	_, err := clientset.CoreV1().Pods("ns").Create(pod)
+	assert.Nil(t, err)
+	go func() {
+		for {
+			if _, err := clientset.CoreV1().Pods("ns").Get("osd1", metav1.GetOptions{}); errors.IsNotFound(err) {
+				break
+			}
+			<-time.After(time.Millisecond)
+		}
+		newPod := pod.DeepCopy()
+		newPod.Name = "osd2"
+		newPod.Status.Phase = v1.PodRunning
+		clientset.CoreV1().Pods("ns").Create(newPod)
+	}()
+	commands = nil
+	assert.Nil(t, c.refreshNode(node))
+	assert.Equal(t, []string{"osd set-group noout", "osd unset-group noout"}, commands)
+	_, err = clientset.CoreV1().Pods("ns").Get("osd2", metav1.GetOptions{})
+	assert.Nil(t, err)
+
+	// a node in maintenance is not refreshed
+	commands = nil
+	node.Maintenance = true
+	assert.Nil(t, c.refreshNode(node))
+	assert.Equal(t, 0, len(commands))
+}
+
 func TestAddRemoveNode(t *testing.T) {
 	// create a storage spec with the given nodes/devices/dirs
 	nodeName := "node8230"
@@ -71,8 +137,8 @@ func TestAddRemoveNode(t *testing.T) {
 	statusMapWatcher := watch.NewFake()
 	clientset.PrependWatchReactor("configmaps", k8stesting.DefaultWatchReactor(statusMapWatcher, nil))
 
-	c := New(&clusterd.Context{Clientset: clientset, ConfigDir: "/var/lib/rook", Executor: &exectest.MockExecutor{}}, "ns-add-remove", "myversion",
-		storageSpec, "", rookalpha.Placement{}, false, v1.ResourceRequirements{}, metav1.OwnerReference{})
+	c := New(&clusterd.Context{Clientset: clientset, RookClientset: rookfake.NewSimpleClientset(), ConfigDir: "/var/lib/rook", Executor: &exectest.MockExecutor{}}, "ns-add-remove", "myversion",
+		storageSpec, "", rookalpha.Placement{}, false, v1.ResourceRequirements{}, cephv1alpha1.OrchestrationSpec{}, metav1.OwnerReference{})
 
 	// kick off the start of the orchestration in a goroutine
 	var startErr error
@@ -127,8 +193,8 @@ func TestAddRemoveNode(t *testing.T) {
 
 	// modify the storage spec to remove the node from the cluster
 	storageSpec.Nodes = []rookalpha.Node{}
-	c = New(&clusterd.Context{Clientset: clientset, ConfigDir: "/var/lib/rook", Executor: mockExec}, "ns-add-remove", "myversion",
-		storageSpec, "", rookalpha.Placement{}, false, v1.ResourceRequirements{}, metav1.OwnerReference{})
+	c = New(&clusterd.Context{Clientset: clientset, RookClientset: rookfake.NewSimpleClientset(), ConfigDir: "/var/lib/rook", Executor: mockExec}, "ns-add-remove", "myversion",
+		storageSpec, "", rookalpha.Placement{}, false, v1.ResourceRequirements{}, cephv1alpha1.OrchestrationSpec{}, metav1.OwnerReference{})
 
 	// reset the orchestration status watcher
 	statusMapWatcher = watch.NewFake()
@@ -174,8 +240,8 @@ func TestAddNodeFailure(t *testing.T) {
 		return true, nil, fmt.Errorf("mock failed to create replica set")
 	})
 
-	c := New(&clusterd.Context{Clientset: clientset, ConfigDir: "/var/lib/rook", Executor: &exectest.MockExecutor{}}, "ns-add-remove", "myversion",
-		storageSpec, "", rookalpha.Placement{}, false, v1.ResourceRequirements{}, metav1.OwnerReference{})
+	c := New(&clusterd.Context{Clientset: clientset, RookClientset: rookfake.NewSimpleClientset(), ConfigDir: "/var/lib/rook", Executor: &exectest.MockExecutor{}}, "ns-add-remove", "myversion",
+		storageSpec, "", rookalpha.Placement{}, false, v1.ResourceRequirements{}, cephv1alpha1.OrchestrationSpec{}, metav1.OwnerReference{})
 
 	// kick off the start of the orchestration in a goroutine
 	var startErr error
@@ -195,8 +261,8 @@ func TestAddNodeFailure(t *testing.T) {
 
 func TestOrchestrationStatus(t *testing.T) {
 	clientset := fake.NewSimpleClientset()
-	c := New(&clusterd.Context{Clientset: clientset, ConfigDir: "/var/lib/rook", Executor: &exectest.MockExecutor{}}, "ns", "myversion",
-		rookalpha.StorageScopeSpec{}, "", rookalpha.Placement{}, false, v1.ResourceRequirements{}, metav1.OwnerReference{})
+	c := New(&clusterd.Context{Clientset: clientset, RookClientset: rookfake.NewSimpleClientset(), ConfigDir: "/var/lib/rook", Executor: &exectest.MockExecutor{}}, "ns", "myversion",
+		rookalpha.StorageScopeSpec{}, "", rookalpha.Placement{}, false, v1.ResourceRequirements{}, cephv1alpha1.OrchestrationSpec{}, metav1.OwnerReference{})
 
 	// status map should not exist yet
 	_, err := c.context.Clientset.CoreV1().ConfigMaps(c.Namespace).Get(OrchestrationStatusMapName, metav1.GetOptions{})
@@ -213,7 +279,12 @@ func TestOrchestrationStatus(t *testing.T) {
 
 	// update the status map with some status
 	nodeName := "node09238"
-	status := OrchestrationStatus{Status: OrchestrationStatusOrchestrating, Message: "doing work"}
+	status := OrchestrationStatus{
+		Status:      OrchestrationStatusOrchestrating,
+		Message:     "doing work",
+		Devices:     []cephv1alpha1.OSDDeviceStatus{{Name: "sda", InUse: true}, {Name: "sdb", SkipReason: "device has a filesystem"}},
+		OSDsCreated: []int{3},
+	}
 	err = UpdateOrchestrationStatusMap(c.context.Clientset, c.Namespace, nodeName, status)
 	assert.Nil(t, err)
 
@@ -224,6 +295,210 @@ func TestOrchestrationStatus(t *testing.T) {
 	retrievedStatus := parseOrchestrationStatus(statusMap.Data, nodeName)
 	assert.NotNil(t, retrievedStatus)
 	assert.Equal(t, status, *retrievedStatus)
+
+	// the status of all nodes can be retrieved
+	statuses, err := GetOrchestrationStatus(c.context.Clientset, c.Namespace)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(statuses))
+	assert.Equal(t, status, statuses[nodeName])
+
+	// the progress of a conversion to bluestore is kept when the status is replaced
+	status.Conversion = &cephv1alpha1.OSDConversionStatus{OSDID: 3, Device: "sda", Phase: "draining"}
+	err = UpdateOrchestrationStatusMap(c.context.Clientset, c.Namespace, nodeName, status)
+	assert.Nil(t, err)
+	err = UpdateOrchestrationStatusMap(c.context.Clientset, c.Namespace, nodeName, OrchestrationStatus{Status: OrchestrationStatusStarting})
+	assert.Nil(t, err)
+	statuses, err = GetOrchestrationStatus(c.context.Clientset, c.Namespace)
+	assert.Nil(t, err)
+	assert.Equal(t, OrchestrationStatusStarting, statuses[nodeName].Status)
+	assert.Equal(t, status.Conversion, statuses[nodeName].Conversion)
+
+	// the progress of a conversion can be cleared explicitly and stays cleared
+	err = ClearConversionStatus(c.context.Clientset, c.Namespace, nodeName, status)
+	assert.Nil(t, err)
+	err = UpdateOrchestrationStatusMap(c.context.Clientset, c.Namespace, nodeName, OrchestrationStatus{Status: OrchestrationStatusStarting})
+	assert.Nil(t, err)
+	statuses, err = GetOrchestrationStatus(c.context.Clientset, c.Namespace)
+	assert.Nil(t, err)
+	assert.Nil(t, statuses[nodeName].Conversion)
+}
+
+func TestFindInProgressNodes(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	c := New(&clusterd.Context{Clientset: clientset, RookClientset: rookfake.NewSimpleClientset(), ConfigDir: "/var/lib/rook", Executor: &exectest.MockExecutor{}}, "ns", "myversion",
+		rookalpha.StorageScopeSpec{}, "", rookalpha.Placement{}, false, v1.ResourceRequirements{}, cephv1alpha1.OrchestrationSpec{}, metav1.OwnerReference{})
+
+	// no status map yet
+	assert.Equal(t, 0, len(c.findInProgressNodes()))
+
+	err := makeOrchestrationStatusMap(c.context.Clientset, c.Namespace, nil)
+	assert.Nil(t, err)
+	UpdateOrchestrationStatusMap(clientset, c.Namespace, "node1", OrchestrationStatus{Status: OrchestrationStatusCompleted})
+	UpdateOrchestrationStatusMap(clientset, c.Namespace, "node2", OrchestrationStatus{Status: OrchestrationStatusOrchestrating})
+	UpdateOrchestrationStatusMap(clientset, c.Namespace, "node3", OrchestrationStatus{Status: OrchestrationStatusFailed})
+	UpdateOrchestrationStatusMap(clientset, c.Namespace, "node4", OrchestrationStatus{Status: OrchestrationStatusStarting})
+
+	inProgress := c.findInProgressNodes()
+	assert.Equal(t, 2, len(inProgress))
+	assert.Equal(t, OrchestrationStatusOrchestrating, inProgress["node2"].Status)
+	assert.Equal(t, OrchestrationStatusStarting, inProgress["node4"].Status)
+}
+
+func TestWaitForCompletionTimeout(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependWatchReactor("configmaps", k8stesting.DefaultWatchReactor(watch.NewFake(), nil))
+	c := New(&clusterd.Context{Clientset: clientset, RookClientset: rookfake.NewSimpleClientset(), ConfigDir: "/var/lib/rook", Executor: &exectest.MockExecutor{}}, "ns", "myversion",
+		rookalpha.StorageScopeSpec{}, "", rookalpha.Placement{}, false, v1.ResourceRequirements{},
+		cephv1alpha1.OrchestrationSpec{NodeTimeoutSeconds: 1}, metav1.OwnerReference{})
+
+	err := makeOrchestrationStatusMap(c.context.Clientset, c.Namespace, nil)
+	assert.Nil(t, err)
+	UpdateOrchestrationStatusMap(clientset, c.Namespace, "node1", OrchestrationStatus{Status: OrchestrationStatusOrchestrating})
+
+	// the node never completes, so the wait times out and the node is marked as failed
+	err = c.waitForCompletion("node1")
+	assert.NotNil(t, err)
+	statuses, err := GetOrchestrationStatus(clientset, c.Namespace)
+	assert.Nil(t, err)
+	assert.Equal(t, OrchestrationStatusFailed, statuses["node1"].Status)
+
+	// a node that completes is found on the periodic check of the status map even if no watch event is received
+	orchestrationStatusCheckInterval = 50 * time.Millisecond
+	defer func() { orchestrationStatusCheckInterval = time.Minute }()
+	UpdateOrchestrationStatusMap(clientset, c.Namespace, "node2", OrchestrationStatus{Status: OrchestrationStatusOrchestrating})
+	go func() {
+		<-time.After(100 * time.Millisecond)
+		UpdateOrchestrationStatusMap(clientset, c.Namespace, "node2", OrchestrationStatus{Status: OrchestrationStatusCompleted})
+	}()
+	err = c.waitForCompletion("node2")
+	assert.Nil(t, err)
+
+	// a node does not time out while it is converting an osd to bluestore
+	conversion := &cephv1alpha1.OSDConversionStatus{OSDID: 3, Device: "sda", Phase: "draining"}
+	UpdateOrchestrationStatusMap(clientset, c.Namespace, "node3", OrchestrationStatus{Status: OrchestrationStatusOrchestrating, Conversion: conversion})
+	go func() {
+		<-time.After(1500 * time.Millisecond)
+		UpdateOrchestrationStatusMap(clientset, c.Namespace, "node3", OrchestrationStatus{Status: OrchestrationStatusCompleted})
+	}()
+	err = c.waitForCompletion("node3")
+	assert.Nil(t, err)
+
+	// a conversion that makes no progress until the next timeout fails the node
+	UpdateOrchestrationStatusMap(clientset, c.Namespace, "node4", OrchestrationStatus{Status: OrchestrationStatusOrchestrating, Conversion: conversion})
+	err = c.waitForCompletion("node4")
+	assert.NotNil(t, err)
+	statuses, err = GetOrchestrationStatus(clientset, c.Namespace)
+	assert.Nil(t, err)
+	assert.Equal(t, OrchestrationStatusFailed, statuses["node4"].Status)
+	assert.Contains(t, statuses["node4"].Message, "made no progress")
+}
+
+func TestGroupNodesByFailureDomain(t *testing.T) {
+	nodes := []rookalpha.Node{
+		{Name: "a", Location: "rack=rack1,zone=z1"},
+		{Name: "b", Location: "rack=rack2,zone=z1"},
+		{Name: "c", Location: "rack=rack1, zone=z2"},
+		{Name: "d"},
+	}
+
+	// no failure domain puts all nodes in one group
+	groups := groupNodesByFailureDomain(nodes, "")
+	assert.Equal(t, 1, len(groups))
+	assert.Equal(t, 4, len(groups[0]))
+
+	// each node is its own host
+	groups = groupNodesByFailureDomain(nodes, "host")
+	assert.Equal(t, 4, len(groups))
+
+	// nodes in the same rack are grouped in the order the racks are first seen, nodes without a rack are grouped together
+	groups = groupNodesByFailureDomain(nodes, "rack")
+	assert.Equal(t, 3, len(groups))
+	assert.Equal(t, []rookalpha.Node{nodes[0], nodes[2]}, groups[0])
+	assert.Equal(t, []rookalpha.Node{nodes[1]}, groups[1])
+	assert.Equal(t, []rookalpha.Node{nodes[3]}, groups[2])
+
+	groups = groupNodesByFailureDomain(nodes, "zone")
+	assert.Equal(t, 3, len(groups))
+	assert.Equal(t, []rookalpha.Node{nodes[0], nodes[1]}, groups[0])
+
+	assert.Equal(t, 0, len(groupNodesByFailureDomain(nil, "rack")))
+	assert.Equal(t, "z2", getLocationValue("rack=rack1, zone=z2", "zone"))
+	assert.Equal(t, "", getLocationValue("rack=rack1", "zone"))
+}
+
+func TestOrchestrateNodes(t *testing.T) {
+	c := &Cluster{}
+	nodes := []rookalpha.Node{}
+	for i := 0; i < 10; i++ {
+		nodes = append(nodes, rookalpha.Node{Name: fmt.Sprintf("node%d", i), Location: fmt.Sprintf("rack=rack%d", i%2)})
+	}
+
+	// track the max number of nodes orchestrated at the same time and which racks were in progress together
+	var lock sync.Mutex
+	current := 0
+	maxCurrent := 0
+	racks := map[string]bool{}
+	mixedRacks := false
+	orchestrated := map[string]bool{}
+	orchestrate := func(n rookalpha.Node) {
+		lock.Lock()
+		current++
+		if current > maxCurrent {
+			maxCurrent = current
+		}
+		racks[getLocationValue(n.Location, "rack")] = true
+		if len(racks) > 1 {
+			mixedRacks = true
+		}
+		orchestrated[n.Name] = true
+		lock.Unlock()
+
+		<-time.After(20 * time.Millisecond)
+
+		lock.Lock()
+		current--
+		if current == 0 {
+			racks = map[string]bool{}
+		}
+		lock.Unlock()
+	}
+
+	// one node at a time by default
+	c.orchestrateNodes(nodes, 0, orchestrate)
+	assert.Equal(t, 1, maxCurrent)
+	assert.Equal(t, 10, len(orchestrated))
+
+	// up to three nodes at a time
+	maxCurrent = 0
+	orchestrated = map[string]bool{}
+	c.orchestrateNodes(nodes, 3, orchestrate)
+	assert.Equal(t, 3, maxCurrent)
+	assert.Equal(t, 10, len(orchestrated))
+	assert.True(t, mixedRacks)
+
+	// only nodes in the same rack at the same time
+	c.orchestration.FailureDomain = "rack"
+	maxCurrent = 0
+	mixedRacks = false
+	orchestrated = map[string]bool{}
+	c.orchestrateNodes(nodes, 3, orchestrate)
+	assert.Equal(t, 3, maxCurrent)
+	assert.Equal(t, 10, len(orchestrated))
+	assert.False(t, mixedRacks)
+}
+
+func TestOrchestrationErrors(t *testing.T) {
+	errs := &orchestrationErrors{}
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs.add(fmt.Sprintf("error %d", i))
+		}(i)
+	}
+	wg.Wait()
+	assert.Equal(t, 5, len(errs.messages))
 }
 
 func mockNodeOrchestrationCompletion(c *Cluster, nodeName string, statusMapWatcher *watch.FakeWatcher) {
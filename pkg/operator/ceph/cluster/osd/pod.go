@@ -18,6 +18,7 @@ limitations under the License.
 package osd
 
 import (
+	"encoding/json"
 	"fmt"
 	"strconv"
 	"strings"
@@ -33,16 +34,29 @@ import (
 )
 
 const (
-	dataDirsEnvVarName          = "ROOK_DATA_DIRECTORIES"
-	osdStoreEnvVarName          = "ROOK_OSD_STORE"
-	osdDatabaseSizeEnvVarName   = "ROOK_OSD_DATABASE_SIZE"
-	osdWalSizeEnvVarName        = "ROOK_OSD_WAL_SIZE"
-	osdJournalSizeEnvVarName    = "ROOK_OSD_JOURNAL_SIZE"
-	osdMetadataDeviceEnvVarName = "ROOK_METADATA_DEVICE"
+	dataDirsEnvVarName               = "ROOK_DATA_DIRECTORIES"
+	osdStoreEnvVarName               = "ROOK_OSD_STORE"
+	osdDatabaseSizeEnvVarName        = "ROOK_OSD_DATABASE_SIZE"
+	osdWalSizeEnvVarName             = "ROOK_OSD_WAL_SIZE"
+	osdJournalSizeEnvVarName         = "ROOK_OSD_JOURNAL_SIZE"
+	osdMetadataDeviceEnvVarName      = "ROOK_METADATA_DEVICE"
+	osdDeviceClassEnvVarName         = "ROOK_OSD_DEVICE_CLASS"
+	dataDeviceClassesEnvVarName      = "ROOK_DATA_DEVICE_CLASSES"
+	osdWeightRampUpEnvVarName        = "ROOK_OSD_WEIGHT_RAMP_UP_STEPS"
+	osdMetadataSizePolicyEnvVarName  = "ROOK_OSD_METADATA_SIZE_POLICY"
+	osdDatabaseSizePercentEnvVarName = "ROOK_OSD_DATABASE_SIZE_PERCENT"
+	osdConvertToBluestoreEnvVarName  = "ROOK_OSD_CONVERT_TO_BLUESTORE"
+	osdDirCapacityEnvVarName         = "ROOK_OSD_DIRECTORY_CAPACITY"
+	osdDirMinFreePercentEnvVarName   = "ROOK_OSD_DIRECTORY_MIN_FREE_PERCENT"
+	dataDirCapacitiesEnvVarName      = "ROOK_DATA_DIRECTORY_CAPACITIES"
+	dataDeviceSelectorEnvVarName     = "ROOK_DATA_DEVICE_SELECTOR"
 )
 
-func (c *Cluster) makeDaemonSet(selection rookalpha.Selection, storeConfig config.StoreConfig, metadataDevice, location string) *extensions.DaemonSet {
-	podSpec := c.podTemplateSpec(nil, selection, c.resources, storeConfig, metadataDevice, location)
+func (c *Cluster) makeDaemonSet(selection rookalpha.Selection, storeConfig config.StoreConfig, metadataDevice, location string) (*extensions.DaemonSet, error) {
+	podSpec, err := c.podTemplateSpec(nil, selection, c.resources, storeConfig, metadataDevice, location)
+	if err != nil {
+		return nil, err
+	}
 	return &extensions.DaemonSet{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:            appName,
@@ -59,13 +73,16 @@ func (c *Cluster) makeDaemonSet(selection rookalpha.Selection, storeConfig confi
 			},
 			Template: podSpec,
 		},
-	}
+	}, nil
 }
 
 func (c *Cluster) makeReplicaSet(nodeName string, devices []rookalpha.Device, selection rookalpha.Selection, resources v1.ResourceRequirements,
-	storeConfig config.StoreConfig, metadataDevice, location string) *extensions.ReplicaSet {
+	storeConfig config.StoreConfig, metadataDevice, location string) (*extensions.ReplicaSet, error) {
 
-	podSpec := c.podTemplateSpec(devices, selection, resources, storeConfig, metadataDevice, location)
+	podSpec, err := c.podTemplateSpec(devices, selection, resources, storeConfig, metadataDevice, location)
+	if err != nil {
+		return nil, err
+	}
 	podSpec.Spec.NodeSelector = map[string]string{apis.LabelHostname: nodeName}
 	replicaCount := int32(1)
 
@@ -83,11 +100,11 @@ func (c *Cluster) makeReplicaSet(nodeName string, devices []rookalpha.Device, se
 			Template: podSpec,
 			Replicas: &replicaCount,
 		},
-	}
+	}, nil
 }
 
 func (c *Cluster) podTemplateSpec(devices []rookalpha.Device, selection rookalpha.Selection, resources v1.ResourceRequirements,
-	storeConfig config.StoreConfig, metadataDevice, location string) v1.PodTemplateSpec {
+	storeConfig config.StoreConfig, metadataDevice, location string) (v1.PodTemplateSpec, error) {
 	// by default, the data/config dir will be an empty volume
 	dataDirSource := v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}
 	if c.dataDirHostPath != "" {
@@ -118,9 +135,13 @@ func (c *Cluster) podTemplateSpec(devices []rookalpha.Device, selection rookalph
 		volumes = append(volumes, dirVolume)
 	}
 
+	container, err := c.osdContainer(devices, selection, resources, storeConfig, metadataDevice, location)
+	if err != nil {
+		return v1.PodTemplateSpec{}, err
+	}
 	podSpec := v1.PodSpec{
 		ServiceAccountName: appName,
-		Containers:         []v1.Container{c.osdContainer(devices, selection, resources, storeConfig, metadataDevice, location)},
+		Containers:         []v1.Container{container},
 		RestartPolicy:      v1.RestartPolicyAlways,
 		Volumes:            volumes,
 		HostNetwork:        c.HostNetwork,
@@ -140,11 +161,11 @@ func (c *Cluster) podTemplateSpec(devices []rookalpha.Device, selection rookalph
 			Annotations: map[string]string{},
 		},
 		Spec: podSpec,
-	}
+	}, nil
 }
 
 func (c *Cluster) osdContainer(devices []rookalpha.Device, selection rookalpha.Selection, resources v1.ResourceRequirements,
-	storeConfig config.StoreConfig, metadataDevice, location string) v1.Container {
+	storeConfig config.StoreConfig, metadataDevice, location string) (v1.Container, error) {
 
 	envVars := []v1.EnvVar{
 		nodeNameEnvVar(),
@@ -164,18 +185,38 @@ func (c *Cluster) osdContainer(devices []rookalpha.Device, selection rookalpha.S
 	// only 1 of device list, device filter and use all devices can be specified.  We prioritize in that order.
 	if len(devices) > 0 {
 		deviceNames := make([]string, len(devices))
+		deviceClasses := []string{}
 		for i := range devices {
-			deviceNames[i] = devices[i].Name
+			// prefer the persistent path of the device since kernel names can change across reboots
+			if devices[i].FullPath != "" {
+				deviceNames[i] = devices[i].FullPath
+			} else {
+				deviceNames[i] = devices[i].Name
+			}
+			if class := config.DeviceClass(devices[i].Config); class != "" {
+				deviceClasses = append(deviceClasses, fmt.Sprintf("%s=%s", deviceNames[i], class))
+			}
 		}
 		envVars = append(envVars, dataDevicesEnvVar(strings.Join(deviceNames, ",")))
+		if len(deviceClasses) > 0 {
+			envVars = append(envVars, dataDeviceClassesEnvVar(strings.Join(deviceClasses, ",")))
+		}
 		devMountNeeded = true
 	} else if selection.DeviceFilter != "" {
 		envVars = append(envVars, deviceFilterEnvVar(selection.DeviceFilter))
 		devMountNeeded = true
-	} else if selection.GetUseAllDevices() {
+	} else if selection.GetUseAllDevices() || selection.DeviceSelector != nil {
 		envVars = append(envVars, deviceFilterEnvVar("all"))
 		devMountNeeded = true
 	}
+	if len(devices) == 0 && selection.DeviceSelector != nil {
+		// the filtered devices are further narrowed down by their properties on the node
+		selectorEnvVar, err := deviceSelectorEnvVar(selection.DeviceSelector)
+		if err != nil {
+			return v1.Container{}, err
+		}
+		envVars = append(envVars, selectorEnvVar)
+	}
 
 	if metadataDevice != "" {
 		envVars = append(envVars, metadataDeviceEnvVar(metadataDevice))
@@ -196,14 +237,21 @@ func (c *Cluster) osdContainer(devices []rookalpha.Device, selection rookalpha.S
 	if len(selection.Directories) > 0 {
 		// for each directory the user has specified, create a volume mount and pass it to the pod via cmd line arg
 		dirPaths := make([]string, len(selection.Directories))
+		dirCapacities := []string{}
 		for i := range selection.Directories {
 			dpath := selection.Directories[i].Path
 			dirPaths[i] = dpath
 			volumeMounts = append(volumeMounts, v1.VolumeMount{Name: k8sutil.PathToVolumeName(dpath), MountPath: dpath})
+			if capacity := config.DirectoryCapacityMB(selection.Directories[i].Config); capacity > 0 {
+				dirCapacities = append(dirCapacities, fmt.Sprintf("%s=%d", dpath, capacity))
+			}
 		}
 
 		if !IsRemovingNode(selection.DeviceFilter) {
 			envVars = append(envVars, dataDirectoriesEnvVar(strings.Join(dirPaths, ",")))
+			if len(dirCapacities) > 0 {
+				envVars = append(envVars, dataDirCapacitiesEnvVar(strings.Join(dirCapacities, ",")))
+			}
 		}
 	}
 
@@ -223,6 +271,34 @@ func (c *Cluster) osdContainer(devices []rookalpha.Device, selection rookalpha.S
 		envVars = append(envVars, osdJournalSizeEnvVar(storeConfig.JournalSizeMB))
 	}
 
+	if storeConfig.DeviceClass != "" {
+		envVars = append(envVars, osdDeviceClassEnvVar(storeConfig.DeviceClass))
+	}
+
+	if storeConfig.WeightRampUpSteps != 0 {
+		envVars = append(envVars, osdWeightRampUpEnvVar(storeConfig.WeightRampUpSteps))
+	}
+
+	if storeConfig.MetadataSizePolicy != "" {
+		envVars = append(envVars, osdMetadataSizePolicyEnvVar(storeConfig.MetadataSizePolicy))
+	}
+
+	if storeConfig.DatabaseSizePercent != 0 {
+		envVars = append(envVars, osdDatabaseSizePercentEnvVar(storeConfig.DatabaseSizePercent))
+	}
+
+	if storeConfig.ConvertToBluestore {
+		envVars = append(envVars, osdConvertToBluestoreEnvVar())
+	}
+
+	if storeConfig.DirectoryCapacityMB != 0 {
+		envVars = append(envVars, osdDirCapacityEnvVar(storeConfig.DirectoryCapacityMB))
+	}
+
+	if storeConfig.DirectoryMinFreePercent != 0 {
+		envVars = append(envVars, osdDirMinFreePercentEnvVar(storeConfig.DirectoryMinFreePercent))
+	}
+
 	if location != "" {
 		envVars = append(envVars, rookalpha.LocationEnvVar(location))
 	}
@@ -253,7 +329,7 @@ func (c *Cluster) osdContainer(devices []rookalpha.Device, selection rookalpha.S
 			ReadOnlyRootFilesystem: &readOnlyRootFilesystem,
 		},
 		Resources: resources,
-	}
+	}, nil
 }
 
 func nodeNameEnvVar() v1.EnvVar {
@@ -268,6 +344,18 @@ func deviceFilterEnvVar(filter string) v1.EnvVar {
 	return v1.EnvVar{Name: "ROOK_DATA_DEVICE_FILTER", Value: filter}
 }
 
+func deviceSelectorEnvVar(selector *rookalpha.DeviceSelector) (v1.EnvVar, error) {
+	selectorJSON, err := json.Marshal(selector)
+	if err != nil {
+		return v1.EnvVar{}, fmt.Errorf("failed to serialize device selector %+v. %+v", *selector, err)
+	}
+	return v1.EnvVar{Name: dataDeviceSelectorEnvVarName, Value: string(selectorJSON)}, nil
+}
+
+func dataDeviceClassesEnvVar(deviceClasses string) v1.EnvVar {
+	return v1.EnvVar{Name: dataDeviceClassesEnvVarName, Value: deviceClasses}
+}
+
 func metadataDeviceEnvVar(metadataDevice string) v1.EnvVar {
 	return v1.EnvVar{Name: osdMetadataDeviceEnvVarName, Value: metadataDevice}
 }
@@ -292,6 +380,38 @@ func osdJournalSizeEnvVar(journalSize int) v1.EnvVar {
 	return v1.EnvVar{Name: osdJournalSizeEnvVarName, Value: strconv.Itoa(journalSize)}
 }
 
+func osdDeviceClassEnvVar(deviceClass string) v1.EnvVar {
+	return v1.EnvVar{Name: osdDeviceClassEnvVarName, Value: deviceClass}
+}
+
+func osdWeightRampUpEnvVar(steps int) v1.EnvVar {
+	return v1.EnvVar{Name: osdWeightRampUpEnvVarName, Value: strconv.Itoa(steps)}
+}
+
+func osdMetadataSizePolicyEnvVar(policy string) v1.EnvVar {
+	return v1.EnvVar{Name: osdMetadataSizePolicyEnvVarName, Value: policy}
+}
+
+func osdDatabaseSizePercentEnvVar(percent int) v1.EnvVar {
+	return v1.EnvVar{Name: osdDatabaseSizePercentEnvVarName, Value: strconv.Itoa(percent)}
+}
+
+func osdConvertToBluestoreEnvVar() v1.EnvVar {
+	return v1.EnvVar{Name: osdConvertToBluestoreEnvVarName, Value: "true"}
+}
+
+func osdDirCapacityEnvVar(capacityMB int) v1.EnvVar {
+	return v1.EnvVar{Name: osdDirCapacityEnvVarName, Value: strconv.Itoa(capacityMB)}
+}
+
+func osdDirMinFreePercentEnvVar(percent int) v1.EnvVar {
+	return v1.EnvVar{Name: osdDirMinFreePercentEnvVarName, Value: strconv.Itoa(percent)}
+}
+
+func dataDirCapacitiesEnvVar(capacities string) v1.EnvVar {
+	return v1.EnvVar{Name: dataDirCapacitiesEnvVarName, Value: capacities}
+}
+
 func getDirectoriesFromContainer(osdContainer v1.Container) []rookalpha.Directory {
 	var dirsArg string
 	for _, envVar := range osdContainer.Env {
@@ -328,6 +448,20 @@ func getConfigFromContainer(osdContainer v1.Container) map[string]string {
 			cfg[config.JournalSizeMBKey] = envVar.Value
 		case osdMetadataDeviceEnvVarName:
 			cfg[config.MetadataDeviceKey] = envVar.Value
+		case osdDeviceClassEnvVarName:
+			cfg[config.DeviceClassKey] = envVar.Value
+		case osdWeightRampUpEnvVarName:
+			cfg[config.WeightRampUpStepsKey] = envVar.Value
+		case osdMetadataSizePolicyEnvVarName:
+			cfg[config.MetadataSizePolicyKey] = envVar.Value
+		case osdDatabaseSizePercentEnvVarName:
+			cfg[config.DatabaseSizePercentKey] = envVar.Value
+		case osdConvertToBluestoreEnvVarName:
+			cfg[config.ConvertToBluestoreKey] = envVar.Value
+		case osdDirCapacityEnvVarName:
+			cfg[config.DirectoryCapacityMBKey] = envVar.Value
+		case osdDirMinFreePercentEnvVarName:
+			cfg[config.DirectoryMinFreePercentKey] = envVar.Value
 		}
 	}
 
@@ -20,6 +20,7 @@ package osd
 import (
 	"testing"
 
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
 	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
 	"github.com/rook/rook/pkg/clusterd"
 	"github.com/rook/rook/pkg/operator/ceph/cluster/osd/config"
@@ -34,7 +35,8 @@ import (
 
 func TestPodContainer(t *testing.T) {
 	cluster := &Cluster{Namespace: "myosd", Version: "23"}
-	c := cluster.podTemplateSpec([]rookalpha.Device{}, rookalpha.Selection{}, v1.ResourceRequirements{}, config.StoreConfig{}, "", "")
+	c, err := cluster.podTemplateSpec([]rookalpha.Device{}, rookalpha.Selection{}, v1.ResourceRequirements{}, config.StoreConfig{}, "", "")
+	assert.Nil(t, err)
 	assert.NotNil(t, c)
 	assert.Equal(t, 1, len(c.Spec.Containers))
 	container := c.Spec.Containers[0]
@@ -57,12 +59,13 @@ func testPodDevices(t *testing.T, dataDir, deviceFilter string, allDevices bool)
 
 	clientset := fake.NewSimpleClientset()
 	c := New(&clusterd.Context{Clientset: clientset, ConfigDir: "/var/lib/rook", Executor: &exectest.MockExecutor{}}, "ns", "rook/rook:myversion",
-		storageSpec, dataDir, rookalpha.Placement{}, false, v1.ResourceRequirements{}, metav1.OwnerReference{})
+		storageSpec, dataDir, rookalpha.Placement{}, false, v1.ResourceRequirements{}, cephv1alpha1.OrchestrationSpec{}, metav1.OwnerReference{})
 
 	devMountNeeded := deviceFilter != "" || allDevices
 
 	n := c.resolveNode(storageSpec.Nodes[0])
-	replicaSet := c.makeReplicaSet(n.Name, n.Devices, n.Selection, v1.ResourceRequirements{}, config.StoreConfig{}, "", n.Location)
+	replicaSet, err := c.makeReplicaSet(n.Name, n.Devices, n.Selection, v1.ResourceRequirements{}, config.StoreConfig{}, "", n.Location)
+	assert.Nil(t, err)
 	assert.NotNil(t, replicaSet)
 	assert.Equal(t, "rook-ceph-osd-node1", replicaSet.Name)
 	assert.Equal(t, c.Namespace, replicaSet.Namespace)
@@ -140,7 +143,7 @@ func TestStorageSpecDevicesAndDirectories(t *testing.T) {
 			{
 				Name: "node1",
 				Selection: rookalpha.Selection{
-					Devices:     []rookalpha.Device{{Name: "sda"}},
+					Devices:     []rookalpha.Device{{Name: "sda"}, {FullPath: "/dev/disk/by-id/wwn-0x5000c500a1b2c3d4", Config: map[string]string{"deviceClass": "ssd"}}},
 					Directories: []rookalpha.Directory{{Path: "/rook/dir1"}},
 				},
 			},
@@ -149,10 +152,11 @@ func TestStorageSpecDevicesAndDirectories(t *testing.T) {
 
 	clientset := fake.NewSimpleClientset()
 	c := New(&clusterd.Context{Clientset: clientset, ConfigDir: "/var/lib/rook", Executor: &exectest.MockExecutor{}}, "ns", "rook/rook:myversion",
-		storageSpec, "", rookalpha.Placement{}, false, v1.ResourceRequirements{}, metav1.OwnerReference{})
+		storageSpec, "", rookalpha.Placement{}, false, v1.ResourceRequirements{}, cephv1alpha1.OrchestrationSpec{}, metav1.OwnerReference{})
 
 	n := c.resolveNode(storageSpec.Nodes[0])
-	replicaSet := c.makeReplicaSet(n.Name, n.Devices, n.Selection, v1.ResourceRequirements{}, config.StoreConfig{}, "", n.Location)
+	replicaSet, err := c.makeReplicaSet(n.Name, n.Devices, n.Selection, v1.ResourceRequirements{}, config.StoreConfig{}, "", n.Location)
+	assert.Nil(t, err)
 	assert.NotNil(t, replicaSet)
 
 	// pod spec should have a volume for the given dir
@@ -168,7 +172,8 @@ func TestStorageSpecDevicesAndDirectories(t *testing.T) {
 
 	// container command should have the given dir and device
 	verifyEnvVar(t, container.Env, "ROOK_DATA_DIRECTORIES", "/rook/dir1", true)
-	verifyEnvVar(t, container.Env, "ROOK_DATA_DEVICES", "sda", true)
+	verifyEnvVar(t, container.Env, "ROOK_DATA_DEVICES", "sda,/dev/disk/by-id/wwn-0x5000c500a1b2c3d4", true)
+	verifyEnvVar(t, container.Env, "ROOK_DATA_DEVICE_CLASSES", "/dev/disk/by-id/wwn-0x5000c500a1b2c3d4=ssd", true)
 }
 
 func TestStorageSpecConfig(t *testing.T) {
@@ -183,6 +188,7 @@ func TestStorageSpecConfig(t *testing.T) {
 					"walSizeMB":      "20",
 					"journalSizeMB":  "30",
 					"metadataDevice": "nvme093",
+					"deviceClass":    "hdd",
 				},
 				Selection: rookalpha.Selection{
 					Directories: []rookalpha.Directory{{Path: "/rook/storageDir472"}},
@@ -201,12 +207,13 @@ func TestStorageSpecConfig(t *testing.T) {
 
 	clientset := fake.NewSimpleClientset()
 	c := New(&clusterd.Context{Clientset: clientset, ConfigDir: "/var/lib/rook", Executor: &exectest.MockExecutor{}}, "ns", "rook/rook:myversion",
-		storageSpec, "", rookalpha.Placement{}, false, v1.ResourceRequirements{}, metav1.OwnerReference{})
+		storageSpec, "", rookalpha.Placement{}, false, v1.ResourceRequirements{}, cephv1alpha1.OrchestrationSpec{}, metav1.OwnerReference{})
 
 	n := c.resolveNode(storageSpec.Nodes[0])
 	storeConfig := config.ToStoreConfig(storageSpec.Nodes[0].Config)
 	metadataDevice := config.MetadataDevice(storageSpec.Nodes[0].Config)
-	replicaSet := c.makeReplicaSet(n.Name, n.Devices, n.Selection, c.Storage.Nodes[0].Resources, storeConfig, metadataDevice, n.Location)
+	replicaSet, err := c.makeReplicaSet(n.Name, n.Devices, n.Selection, c.Storage.Nodes[0].Resources, storeConfig, metadataDevice, n.Location)
+	assert.Nil(t, err)
 	assert.NotNil(t, replicaSet)
 
 	container := replicaSet.Spec.Template.Spec.Containers[0]
@@ -217,6 +224,7 @@ func TestStorageSpecConfig(t *testing.T) {
 	verifyEnvVar(t, container.Env, "ROOK_OSD_JOURNAL_SIZE", "30", true)
 	verifyEnvVar(t, container.Env, "ROOK_LOCATION", "rack=foo", true)
 	verifyEnvVar(t, container.Env, "ROOK_METADATA_DEVICE", "nvme093", true)
+	verifyEnvVar(t, container.Env, "ROOK_OSD_DEVICE_CLASS", "hdd", true)
 
 	assert.Equal(t, "100", container.Resources.Limits.Cpu().String())
 	assert.Equal(t, "1337", container.Resources.Requests.Memory().String())
@@ -228,6 +236,27 @@ func TestStorageSpecConfig(t *testing.T) {
 	assert.Equal(t, n.Directories, discoveredDirs)
 }
 
+func TestDeviceSelector(t *testing.T) {
+	nonRotational := false
+	selection := rookalpha.Selection{DeviceSelector: &rookalpha.DeviceSelector{MinSize: "1Ti", Rotational: &nonRotational}}
+	c := New(&clusterd.Context{Clientset: fake.NewSimpleClientset(), ConfigDir: "/var/lib/rook", Executor: &exectest.MockExecutor{}}, "ns", "myversion",
+		rookalpha.StorageScopeSpec{}, "", rookalpha.Placement{}, false, v1.ResourceRequirements{}, cephv1alpha1.OrchestrationSpec{}, metav1.OwnerReference{})
+
+	// the devices with the selected properties are selected among all the devices on the node
+	r, err := c.makeReplicaSet("node1", nil, selection, v1.ResourceRequirements{}, config.StoreConfig{}, "", "")
+	assert.Nil(t, err)
+	cont := r.Spec.Template.Spec.Containers[0]
+	verifyEnvVar(t, cont.Env, "ROOK_DATA_DEVICE_FILTER", "all", true)
+	verifyEnvVar(t, cont.Env, "ROOK_DATA_DEVICE_SELECTOR", `{"minSize":"1Ti","rotational":false}`, true)
+
+	// the selector was already applied by the operator when the devices are given
+	r, err = c.makeReplicaSet("node1", []rookalpha.Device{{Name: "sdb"}}, selection, v1.ResourceRequirements{}, config.StoreConfig{}, "", "")
+	assert.Nil(t, err)
+	cont = r.Spec.Template.Spec.Containers[0]
+	verifyEnvVar(t, cont.Env, "ROOK_DATA_DEVICES", "sdb", true)
+	verifyEnvVar(t, cont.Env, "ROOK_DATA_DEVICE_SELECTOR", "", false)
+}
+
 func TestHostNetwork(t *testing.T) {
 	storageSpec := rookalpha.StorageScopeSpec{
 		Nodes: []rookalpha.Node{
@@ -246,10 +275,11 @@ func TestHostNetwork(t *testing.T) {
 
 	clientset := fake.NewSimpleClientset()
 	c := New(&clusterd.Context{Clientset: clientset, ConfigDir: "/var/lib/rook", Executor: &exectest.MockExecutor{}}, "ns", "myversion",
-		storageSpec, "", rookalpha.Placement{}, true, v1.ResourceRequirements{}, metav1.OwnerReference{})
+		storageSpec, "", rookalpha.Placement{}, true, v1.ResourceRequirements{}, cephv1alpha1.OrchestrationSpec{}, metav1.OwnerReference{})
 
 	n := c.resolveNode(storageSpec.Nodes[0])
-	r := c.makeReplicaSet(n.Name, n.Devices, n.Selection, v1.ResourceRequirements{}, config.StoreConfig{}, "", n.Location)
+	r, err := c.makeReplicaSet(n.Name, n.Devices, n.Selection, v1.ResourceRequirements{}, config.StoreConfig{}, "", n.Location)
+	assert.Nil(t, err)
 	assert.NotNil(t, r)
 
 	assert.Equal(t, true, r.Spec.Template.Spec.HostNetwork)
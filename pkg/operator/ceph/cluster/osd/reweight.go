@@ -0,0 +1,157 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+)
+
+const (
+	defaultReweightMaxDeviation = 5
+	defaultReweightInterval     = 300
+	// the most the override weight of an OSD is changed at a time so the data movement stays small
+	maxReweightChange = 0.05
+	minReweight       = 0.1
+)
+
+var (
+	// the interval to check whether the reweight settings in the cluster CRD have been enabled
+	reweightDisabledCheckInterval = 60 * time.Second
+)
+
+// ReweightMonitor keeps the utilization of the OSDs close to the average utilization by adjusting the override weight
+// of the OSDs that are too full or too empty
+type ReweightMonitor struct {
+	context     *clusterd.Context
+	namespace   string
+	clusterName string
+}
+
+// NewReweightMonitor creates a reweight monitor for the given cluster CRD
+func NewReweightMonitor(context *clusterd.Context, namespace, clusterName string) *ReweightMonitor {
+	return &ReweightMonitor{context: context, namespace: namespace, clusterName: clusterName}
+}
+
+// Run reweights the OSDs periodically until the stop channel is closed. The reweight settings are read from the
+// cluster CRD each time so they can be changed at any time.
+func (m *ReweightMonitor) Run(stopCh chan struct{}) {
+	runClusterMonitor(m.context, m.namespace, m.clusterName, "osd reweight monitor", stopCh, reweightDisabledCheckInterval,
+		func(spec *cephv1alpha1.ClusterSpec) time.Duration {
+			if !spec.OSDReweight.Enabled {
+				return reweightDisabledCheckInterval
+			}
+			return time.Duration(reweightInterval(&spec.OSDReweight)) * time.Second
+		},
+		func(cluster *cephv1alpha1.Cluster) {
+			if !cluster.Spec.OSDReweight.Enabled {
+				return
+			}
+			if err := m.reweight(&cluster.Spec.OSDReweight); err != nil {
+				logger.Warningf("failed to reweight osds. %+v", err)
+			}
+		})
+}
+
+// reweight adjusts the override weight of the OSDs whose utilization is further from the average than allowed
+func (m *ReweightMonitor) reweight(spec *cephv1alpha1.OSDReweightSpec) error {
+	// wait for any data movement from a previous reweight to complete first
+	if err := client.IsClusterClean(m.context, m.namespace); err != nil {
+		logger.Infof("skipping osd reweight since the cluster is not clean. %+v", err)
+		return nil
+	}
+
+	usage, err := client.GetOSDUsage(m.context, m.namespace)
+	if err != nil {
+		return err
+	}
+
+	average, err := usage.Summary.AverageUtil.Float64()
+	if err != nil {
+		return fmt.Errorf("failed to get average utilization. %+v", err)
+	}
+	maxDeviation := float64(reweightMaxDeviation(spec))
+
+	for _, osd := range usage.OSDNodes {
+		current, err := osd.Reweight.Float64()
+		if err != nil || current == 0 {
+			// the osd is out
+			continue
+		}
+		utilization, err := osd.Utilization.Float64()
+		if err != nil {
+			logger.Warningf("failed to get utilization of osd %d. %+v", osd.ID, err)
+			continue
+		}
+
+		weight := computeReweight(current, utilization, average, maxDeviation)
+		if weight == current {
+			continue
+		}
+
+		logger.Infof("reweighting osd %d from %.4f to %.4f. utilization %.2f%%, average %.2f%%", osd.ID, current, weight, utilization, average)
+		if o, err := client.OSDReweight(m.context, m.namespace, osd.ID, weight); err != nil {
+			logger.Warningf("failed to reweight osd %d. %+v. %s", osd.ID, err, o)
+		}
+	}
+
+	return nil
+}
+
+// computeReweight returns the new override weight of an OSD given its utilization. The weight of an OSD that is
+// fuller than allowed is decreased, and the weight of an OSD that is emptier than allowed is increased up to 1.0.
+func computeReweight(current, utilization, average, maxDeviation float64) float64 {
+	if average <= 0 || math.Abs(utilization-average) <= maxDeviation {
+		return current
+	}
+	if utilization < average && current >= 1.0 {
+		// the osd already gets its full share of data
+		return current
+	}
+
+	var weight float64
+	if utilization <= 0 {
+		weight = current + maxReweightChange
+	} else {
+		weight = current * average / utilization
+	}
+	weight = math.Max(weight, current-maxReweightChange)
+	weight = math.Min(weight, current+maxReweightChange)
+	weight = math.Max(math.Min(weight, 1.0), minReweight)
+
+	weight, _ = strconv.ParseFloat(fmt.Sprintf("%.4f", weight), 64)
+	return weight
+}
+
+func reweightMaxDeviation(spec *cephv1alpha1.OSDReweightSpec) int {
+	if spec.MaxDeviationPercent > 0 {
+		return spec.MaxDeviationPercent
+	}
+	return defaultReweightMaxDeviation
+}
+
+func reweightInterval(spec *cephv1alpha1.OSDReweightSpec) int {
+	if spec.IntervalSeconds > 0 {
+		return spec.IntervalSeconds
+	}
+	return defaultReweightInterval
+}
@@ -0,0 +1,94 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComputeReweight(t *testing.T) {
+	// within the allowed deviation
+	assert.Equal(t, 1.0, computeReweight(1.0, 54, 50, 5))
+	assert.Equal(t, 0.8, computeReweight(0.8, 46, 50, 5))
+
+	// too full, the weight is decreased by at most one step
+	assert.Equal(t, 0.95, computeReweight(1.0, 80, 50, 5))
+	assert.Equal(t, 0.9615, computeReweight(1.0, 52, 50, 1))
+
+	// too empty, the weight is only increased if it is below 1.0
+	assert.Equal(t, 1.0, computeReweight(1.0, 20, 50, 5))
+	assert.Equal(t, 0.85, computeReweight(0.8, 20, 50, 5))
+	assert.Equal(t, 1.0, computeReweight(0.98, 20, 50, 5))
+	assert.Equal(t, 0.85, computeReweight(0.8, 0, 50, 5))
+
+	// the weight does not go below the minimum
+	assert.Equal(t, minReweight, computeReweight(0.12, 90, 50, 5))
+
+	// no data in the cluster yet
+	assert.Equal(t, 0.7, computeReweight(0.7, 0, 0, 5))
+}
+
+func TestReweight(t *testing.T) {
+	clean := true
+	var reweights []string
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outputFile string, args ...string) (string, error) {
+			if args[0] == "status" {
+				if clean {
+					return `{"pgmap":{"num_pgs":100,"pgs_by_state":[{"state_name":"active+clean","count":100}]}}`, nil
+				}
+				return `{"pgmap":{"num_pgs":100,"pgs_by_state":[{"state_name":"active+remapped+backfilling","count":100}]}}`, nil
+			}
+			if args[0] == "osd" && args[1] == "df" {
+				return `{"nodes":[
+					{"id":0,"reweight":1.0,"utilization":70.0},
+					{"id":1,"reweight":1.0,"utilization":50.0},
+					{"id":2,"reweight":0.9,"utilization":30.0},
+					{"id":3,"reweight":0,"utilization":0}],
+					"summary":{"average_utilization":50.0}}`, nil
+			}
+			if args[0] == "osd" && args[1] == "reweight" {
+				reweights = append(reweights, strings.Join(args[2:], " "))
+				return "", nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+	m := NewReweightMonitor(&clusterd.Context{Executor: executor}, "ns", "ns")
+
+	// nothing is reweighted while the cluster is not clean
+	clean = false
+	assert.Nil(t, m.reweight(&cephv1alpha1.OSDReweightSpec{Enabled: true}))
+	assert.Equal(t, 0, len(reweights))
+
+	// the full osd is reweighted down and the empty osd that was reweighted before is reweighted up. the osd that
+	// is out is left alone.
+	clean = true
+	assert.Nil(t, m.reweight(&cephv1alpha1.OSDReweightSpec{Enabled: true}))
+	assert.Equal(t, []string{"0 0.9500", "2 0.9500"}, reweights)
+
+	// nothing to do with a larger deviation
+	reweights = nil
+	assert.Nil(t, m.reweight(&cephv1alpha1.OSDReweightSpec{Enabled: true, MaxDeviationPercent: 25}))
+	assert.Equal(t, 0, len(reweights))
+}
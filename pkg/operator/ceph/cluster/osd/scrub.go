@@ -0,0 +1,242 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"time"
+
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/ceph/cluster/osd/config"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	defaultScrubInterval = 600
+	// the end of the day and of the week for the osds, which are used when the end hour or week day are not set
+	defaultScrubEndHour          = 24
+	defaultScrubEndWeekDay       = 7
+	defaultMaxScrubs             = 1
+	defaultDeepScrubIntervalDays = 7
+	defaultScrubLoadThreshold    = 50
+	// the format of the scrub stamps in the pg dump
+	scrubStampLayout = "2006-01-02 15:04:05"
+)
+
+// ScrubMonitor applies the scrub settings of the cluster CRD to the OSDs and reports how long ago the placement groups
+// were scrubbed
+type ScrubMonitor struct {
+	context     *clusterd.Context
+	namespace   string
+	clusterName string
+	ownerRef    metav1.OwnerReference
+	// the osd config options that were injected into the running osds, so they are only injected again when they change
+	injected map[string]string
+}
+
+// NewScrubMonitor creates a scrub monitor for the given cluster CRD
+func NewScrubMonitor(context *clusterd.Context, namespace, clusterName string, ownerRef metav1.OwnerReference) *ScrubMonitor {
+	return &ScrubMonitor{context: context, namespace: namespace, clusterName: clusterName, ownerRef: ownerRef}
+}
+
+// Run applies the scrub settings right away and reports the scrub status periodically until the stop channel is
+// closed. The settings are applied again when they change in the cluster CRD.
+func (m *ScrubMonitor) Run(stopCh chan struct{}) {
+	cluster, err := m.context.RookClientset.CephV1alpha1().Clusters(m.namespace).Get(m.clusterName, metav1.GetOptions{})
+	if err != nil {
+		logger.Warningf("failed to get scrub settings. %+v", err)
+	} else if err := m.applySettings(&cluster.Spec.Scrub); err != nil {
+		logger.Warningf("failed to apply scrub settings. %+v", err)
+	}
+
+	runClusterMonitor(m.context, m.namespace, m.clusterName, "scrub monitor", stopCh, defaultScrubInterval*time.Second,
+		func(spec *cephv1alpha1.ClusterSpec) time.Duration {
+			if spec.Scrub.IntervalSeconds > 0 {
+				return time.Duration(spec.Scrub.IntervalSeconds) * time.Second
+			}
+			return defaultScrubInterval * time.Second
+		},
+		func(cluster *cephv1alpha1.Cluster) {
+			if err := m.applySettings(&cluster.Spec.Scrub); err != nil {
+				logger.Warningf("failed to apply scrub settings. %+v", err)
+			}
+			if err := m.updateStatus(); err != nil {
+				logger.Warningf("failed to update scrub status. %+v", err)
+			}
+		})
+}
+
+// applySettings saves the scrub settings for the OSDs to add to their config file when they start, and injects them
+// into the running OSDs. Nothing is changed if scrub settings were never set, and the ceph defaults are restored when
+// the settings are removed.
+func (m *ScrubMonitor) applySettings(spec *cephv1alpha1.ScrubSpec) error {
+	if err := ValidateScrubSpec(spec); err != nil {
+		return err
+	}
+	kv := k8sutil.NewConfigMapKVStore(m.namespace, m.context.Clientset, m.ownerRef)
+	saved, err := config.LoadScrubSettings(kv)
+	if err != nil {
+		return fmt.Errorf("failed to load the saved scrub settings. %+v", err)
+	}
+	configured := *spec != cephv1alpha1.ScrubSpec{IntervalSeconds: spec.IntervalSeconds}
+	if !configured && len(saved) == 0 {
+		return nil
+	}
+
+	options, weekDayOptions := scrubOptions(spec)
+	settings := map[string]string{}
+	if configured {
+		for k, v := range options {
+			settings[k] = v
+		}
+		for k, v := range weekDayOptions {
+			settings[k] = v
+		}
+	}
+	if m.injected != nil && reflect.DeepEqual(settings, m.injected) && reflect.DeepEqual(settings, saved) {
+		return nil
+	}
+
+	if err := config.SaveScrubSettings(kv, settings); err != nil {
+		return fmt.Errorf("failed to save the scrub settings. %+v", err)
+	}
+	if o, err := client.OSDInjectArgs(m.context, m.namespace, options); err != nil {
+		return fmt.Errorf("%+v. %s", err, o)
+	}
+	// the week days are not supported by older releases of luminous
+	if o, err := client.OSDInjectArgs(m.context, m.namespace, weekDayOptions); err != nil {
+		logger.Warningf("failed to set the scrub week days. %+v. %s", err, o)
+	}
+	m.injected = settings
+	return nil
+}
+
+// ValidateScrubSpec returns an error if the scrub window of the settings is not made of valid hours and week days
+func ValidateScrubSpec(spec *cephv1alpha1.ScrubSpec) error {
+	if spec.BeginHour < 0 || spec.BeginHour > 23 || spec.EndHour < 0 || spec.EndHour > 23 {
+		return fmt.Errorf("the scrub begin and end hours must be between 0 and 23")
+	}
+	if spec.BeginWeekDay < 0 || spec.BeginWeekDay > 6 || spec.EndWeekDay < 0 || spec.EndWeekDay > 6 {
+		return fmt.Errorf("the scrub begin and end week days must be between 0 and 6")
+	}
+	return nil
+}
+
+// scrubOptions returns the osd config options for the scrub settings, with the ceph defaults for the settings not set
+func scrubOptions(spec *cephv1alpha1.ScrubSpec) (map[string]string, map[string]string) {
+	endHour := spec.EndHour
+	if endHour == 0 {
+		endHour = defaultScrubEndHour
+	}
+	endWeekDay := spec.EndWeekDay
+	if endWeekDay == 0 {
+		endWeekDay = defaultScrubEndWeekDay
+	}
+	maxScrubs := spec.MaxScrubs
+	if maxScrubs == 0 {
+		maxScrubs = defaultMaxScrubs
+	}
+	deepScrubIntervalDays := spec.DeepScrubIntervalDays
+	if deepScrubIntervalDays == 0 {
+		deepScrubIntervalDays = defaultDeepScrubIntervalDays
+	}
+	loadThreshold := spec.LoadThresholdPercent
+	if loadThreshold == 0 {
+		loadThreshold = defaultScrubLoadThreshold
+	}
+
+	options := map[string]string{
+		"osd_scrub_begin_hour":     strconv.Itoa(spec.BeginHour),
+		"osd_scrub_end_hour":       strconv.Itoa(endHour),
+		"osd_max_scrubs":           strconv.Itoa(maxScrubs),
+		"osd_deep_scrub_interval":  strconv.Itoa(deepScrubIntervalDays * 24 * 60 * 60),
+		"osd_scrub_load_threshold": strconv.FormatFloat(float64(loadThreshold)/100, 'f', -1, 64),
+	}
+	weekDayOptions := map[string]string{
+		"osd_scrub_begin_week_day": strconv.Itoa(spec.BeginWeekDay),
+		"osd_scrub_end_week_day":   strconv.Itoa(endWeekDay),
+	}
+	return options, weekDayOptions
+}
+
+// updateStatus reports the age distribution of the last scrubs of the placement groups in the cluster CRD
+func (m *ScrubMonitor) updateStatus() error {
+	pgStats, err := client.GetPGStats(m.context, m.namespace)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	status := scrubStatus(pgStats, now)
+	updateTime := metav1.NewTime(now)
+	status.UpdateTime = &updateTime
+
+	// the controller updates the status of the cluster at the same time, retry if the CRD changed
+	for i := 0; i < statusUpdateRetries; i++ {
+		var cluster *cephv1alpha1.Cluster
+		cluster, err = m.context.RookClientset.CephV1alpha1().Clusters(m.namespace).Get(m.clusterName, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		cluster.Status.Scrub = status
+		if _, err = m.context.RookClientset.CephV1alpha1().Clusters(m.namespace).Update(cluster); err == nil || !errors.IsConflict(err) {
+			break
+		}
+		logger.Infof("conflict updating the scrub status of cluster %s, will retry. %+v", m.namespace, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update cluster %s scrub status: %+v", m.namespace, err)
+	}
+	return nil
+}
+
+func scrubStatus(pgStats []client.PGStat, now time.Time) *cephv1alpha1.ScrubStatus {
+	status := &cephv1alpha1.ScrubStatus{}
+	for _, pg := range pgStats {
+		addScrubAge(&status.LastScrub, pg.LastScrubStamp, now)
+		addScrubAge(&status.LastDeepScrub, pg.LastDeepScrubStamp, now)
+	}
+	return status
+}
+
+func addScrubAge(distribution *cephv1alpha1.ScrubAgeDistribution, stamp string, now time.Time) {
+	scrubTime, err := time.Parse(scrubStampLayout, stamp)
+	if err != nil {
+		logger.Debugf("skipping invalid scrub stamp %q. %+v", stamp, err)
+		return
+	}
+
+	age := now.Sub(scrubTime)
+	day := 24 * time.Hour
+	switch {
+	case age < day:
+		distribution.LessThanOneDay++
+	case age < 7*day:
+		distribution.OneToSevenDays++
+	case age < 30*day:
+		distribution.SevenToThirtyDays++
+	default:
+		distribution.MoreThanThirtyDays++
+	}
+	if hours := int(age.Hours()); hours > distribution.OldestHours {
+		distribution.OldestHours = hours
+	}
+}
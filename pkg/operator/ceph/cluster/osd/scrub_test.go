@@ -0,0 +1,157 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	rookfake "github.com/rook/rook/pkg/client/clientset/versioned/fake"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/ceph/cluster/osd/config"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	testclient "k8s.io/client-go/testing"
+)
+
+func TestApplyScrubSettings(t *testing.T) {
+	var injected []string
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outputFile string, args ...string) (string, error) {
+			if args[0] == "tell" && args[1] == "osd.*" && args[2] == "injectargs" {
+				injected = append(injected, args[3])
+				return "", nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+	clientset := fake.NewSimpleClientset()
+	m := NewScrubMonitor(&clusterd.Context{Executor: executor, Clientset: clientset}, "ns", "ns", metav1.OwnerReference{Name: "ns"})
+	kv := k8sutil.NewConfigMapKVStore("ns", clientset, metav1.OwnerReference{})
+
+	// nothing is injected while no scrub settings are set
+	err := m.applySettings(&cephv1alpha1.ScrubSpec{IntervalSeconds: 60})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(injected))
+
+	// the settings are injected with the defaults for the settings not set and saved for the osd config
+	spec := &cephv1alpha1.ScrubSpec{BeginHour: 22, EndHour: 6, EndWeekDay: 5, MaxScrubs: 2, LoadThresholdPercent: 30}
+	err = m.applySettings(spec)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"--osd_deep_scrub_interval=604800 --osd_max_scrubs=2 --osd_scrub_begin_hour=22 --osd_scrub_end_hour=6 --osd_scrub_load_threshold=0.3",
+		"--osd_scrub_begin_week_day=0 --osd_scrub_end_week_day=5"}, injected)
+	saved, err := config.LoadScrubSettings(kv)
+	assert.Nil(t, err)
+	assert.Equal(t, 7, len(saved))
+	assert.Equal(t, "2", saved["osd_max_scrubs"])
+	assert.Equal(t, "5", saved["osd_scrub_end_week_day"])
+
+	// the same settings are not injected again
+	injected = nil
+	err = m.applySettings(spec)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(injected))
+
+	// the settings are injected again by a new monitor after the operator restarts
+	m = NewScrubMonitor(&clusterd.Context{Executor: executor, Clientset: clientset}, "ns", "ns", metav1.OwnerReference{Name: "ns"})
+	err = m.applySettings(spec)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(injected))
+
+	// the ceph defaults are restored once when the settings are removed
+	injected = nil
+	err = m.applySettings(&cephv1alpha1.ScrubSpec{})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(injected))
+	assert.True(t, strings.Contains(injected[0], "--osd_max_scrubs=1 --osd_scrub_begin_hour=0 --osd_scrub_end_hour=24 --osd_scrub_load_threshold=0.5"))
+	saved, err = config.LoadScrubSettings(kv)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(saved))
+	injected = nil
+	err = m.applySettings(&cephv1alpha1.ScrubSpec{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(injected))
+
+	// invalid hours and week days are rejected
+	err = m.applySettings(&cephv1alpha1.ScrubSpec{EndHour: 24})
+	assert.NotNil(t, err)
+	err = m.applySettings(&cephv1alpha1.ScrubSpec{BeginWeekDay: -1})
+	assert.NotNil(t, err)
+	err = m.applySettings(&cephv1alpha1.ScrubSpec{EndWeekDay: 7})
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, len(injected))
+}
+
+func TestScrubStatus(t *testing.T) {
+	now := time.Date(2018, 6, 30, 12, 0, 0, 0, time.UTC)
+	pgStats := []client.PGStat{
+		{ID: "1.0", LastScrubStamp: "2018-06-30 08:00:00.123456", LastDeepScrubStamp: "2018-06-27 12:00:00.000000"},
+		{ID: "1.1", LastScrubStamp: "2018-06-29 06:00:00.000000", LastDeepScrubStamp: "2018-06-20 12:00:00.000000"},
+		{ID: "1.2", LastScrubStamp: "2018-06-25 12:00:00.000000", LastDeepScrubStamp: "2018-05-01 12:00:00.000000"},
+		{ID: "1.3", LastScrubStamp: "invalid", LastDeepScrubStamp: ""},
+	}
+
+	status := scrubStatus(pgStats, now)
+	assert.Equal(t, cephv1alpha1.ScrubAgeDistribution{LessThanOneDay: 1, OneToSevenDays: 2, OldestHours: 120}, status.LastScrub)
+	assert.Equal(t, cephv1alpha1.ScrubAgeDistribution{OneToSevenDays: 1, SevenToThirtyDays: 1, MoreThanThirtyDays: 1, OldestHours: 1440},
+		status.LastDeepScrub)
+}
+
+func TestUpdateScrubStatus(t *testing.T) {
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outputFile string, args ...string) (string, error) {
+			if args[0] == "pg" && args[1] == "dump" && args[2] == "pgs" {
+				return `[{"pgid":"1.0","state":"active+clean","last_scrub_stamp":"2018-06-30 08:00:00.123456",
+					"last_deep_scrub_stamp":"2018-06-27 12:00:00.000000"}]`, nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+	clust := &cephv1alpha1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "ns", Namespace: "ns"}}
+	rookClientset := rookfake.NewSimpleClientset(clust)
+	m := NewScrubMonitor(&clusterd.Context{Executor: executor, RookClientset: rookClientset}, "ns", "ns", metav1.OwnerReference{})
+
+	// the status is updated again if the cluster was updated at the same time
+	conflicts := 0
+	rookClientset.PrependReactor("update", "clusters", func(action testclient.Action) (bool, runtime.Object, error) {
+		if conflicts == 0 {
+			conflicts++
+			return true, nil, errors.NewConflict(schema.GroupResource{Resource: "clusters"}, "ns", fmt.Errorf("mock conflict"))
+		}
+		return false, nil, nil
+	})
+
+	err := m.updateStatus()
+	assert.Equal(t, 1, conflicts)
+	assert.Nil(t, err)
+	updated, err := rookClientset.CephV1alpha1().Clusters("ns").Get("ns", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.NotNil(t, updated.Status.Scrub)
+	assert.NotNil(t, updated.Status.Scrub.UpdateTime)
+	assert.Equal(t, 1, updated.Status.Scrub.LastScrub.MoreThanThirtyDays+updated.Status.Scrub.LastScrub.SevenToThirtyDays+
+		updated.Status.Scrub.LastScrub.OneToSevenDays+updated.Status.Scrub.LastScrub.LessThanOneDay)
+}
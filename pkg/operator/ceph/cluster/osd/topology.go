@@ -0,0 +1,320 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/kubernetes/pkg/kubelet/apis"
+)
+
+const (
+	// the well-known kubernetes labels for the region and zone of a node
+	regionLabel = "failure-domain.beta.kubernetes.io/region"
+	zoneLabel   = "failure-domain.beta.kubernetes.io/zone"
+	// kubernetes has no well-known label for the rack of a node
+	rackLabel = "topology.rook.io/rack"
+
+	defaultTopologyInterval = 300
+)
+
+// TopologyMonitor moves the hosts of the OSDs in the crush map when the topology labels of their nodes change
+type TopologyMonitor struct {
+	context     *clusterd.Context
+	namespace   string
+	clusterName string
+}
+
+// NewTopologyMonitor creates a topology monitor for the given cluster CRD
+func NewTopologyMonitor(context *clusterd.Context, namespace, clusterName string) *TopologyMonitor {
+	return &TopologyMonitor{context: context, namespace: namespace, clusterName: clusterName}
+}
+
+// Run checks the topology of the nodes periodically until the stop channel is closed
+func (m *TopologyMonitor) Run(stopCh chan struct{}) {
+	runClusterMonitor(m.context, m.namespace, m.clusterName, "topology monitor", stopCh, defaultTopologyInterval*time.Second,
+		func(spec *cephv1alpha1.ClusterSpec) time.Duration {
+			if spec.CrushTopology.IntervalSeconds > 0 {
+				return time.Duration(spec.CrushTopology.IntervalSeconds) * time.Second
+			}
+			return defaultTopologyInterval * time.Second
+		},
+		func(cluster *cephv1alpha1.Cluster) {
+			if !cluster.Spec.CrushTopology.FromNodeLabels {
+				return
+			}
+			if err := m.moveHosts(&cluster.Spec); err != nil {
+				logger.Warningf("failed to update the crush location of the hosts. %+v", err)
+			}
+		})
+}
+
+// moveHosts moves the host of a storage node in the crush map to the location from the labels of the node. Moving a
+// host rebalances its data, so a host is only moved once its new location is confirmed in confirmHostMoves, and only one
+// host is moved at a time while the cluster is clean.
+func (m *TopologyMonitor) moveHosts(spec *cephv1alpha1.ClusterSpec) error {
+	crush, err := client.GetCrushMap(m.context, m.namespace)
+	if err != nil {
+		return err
+	}
+	crushTypes := crushTypeNames(&crush)
+
+	storageNodes, err := m.storageNodes(spec)
+	if err != nil {
+		return err
+	}
+	for _, n := range storageNodes {
+		node, err := getNode(m.context.Clientset, n.Name)
+		if err != nil {
+			logger.Warningf("failed to get node %s. %+v", n.Name, err)
+			continue
+		}
+
+		location := parseLocation(mergeLocation(n.Location, topologyLocation(node, &spec.CrushTopology, crushTypes)))
+		hostName := location["host"]
+		if hostName == "" {
+			// the osds name their host after the node, see client.FormatLocation
+			hostName = strings.Replace(node.Name, ".", "-", -1)
+		}
+		delete(location, "host")
+		if _, ok := location["root"]; !ok {
+			location["root"] = "default"
+		}
+
+		current := client.GetCrushBucketLocation(&crush, hostName)
+		if current == nil || client.CrushLocationsEqual(current, location) {
+			// the node has no osds yet, or its host is already at its location
+			continue
+		}
+		pairs := formatLocation(location)
+		confirmation := strings.Join(pairs, ",")
+		if spec.CrushTopology.ConfirmHostMoves[hostName] != confirmation {
+			logger.Warningf("not moving host %s in the crush map from %v to %v until confirmed with confirmHostMoves %s: %s",
+				hostName, formatLocation(current), pairs, hostName, confirmation)
+			continue
+		}
+		if err := client.IsClusterClean(m.context, m.namespace); err != nil {
+			logger.Infof("not moving host %s in the crush map while the cluster is not clean. %+v", hostName, err)
+			return nil
+		}
+
+		logger.Infof("moving host %s in the crush map from %v to %v", hostName, formatLocation(current), pairs)
+		if err := m.moveHost(&crush, hostName, pairs); err != nil {
+			return err
+		}
+		// the other hosts are moved in the next checks, once the data of this host is rebalanced
+		return nil
+	}
+	return nil
+}
+
+// moveHost moves the host in the crush map with noout set on the host, so its osds are not marked out if they are
+// reported down while their placement groups peer at the new location
+func (m *TopologyMonitor) moveHost(crush *client.CrushMap, hostName string, location []string) error {
+	osds := hostOSDs(crush, hostName)
+	if o, err := client.OSDSetGroupFlags(m.context, m.namespace, []string{maintenanceHostFlag}, []string{hostName}); err != nil {
+		logger.Infof("failed to set %s on host %s, setting it on its osds instead. %+v. %s", maintenanceHostFlag, hostName, err, o)
+		if o, err := client.OSDAddNoOut(m.context, m.namespace, osds); err != nil {
+			return fmt.Errorf("failed to set noout on the osds of host %s. %+v. %s", hostName, err, o)
+		}
+		defer func() {
+			if o, err := client.OSDRemoveNoOut(m.context, m.namespace, osds); err != nil {
+				logger.Warningf("failed to clear noout on the osds of host %s. %+v. %s", hostName, err, o)
+			}
+		}()
+	} else {
+		defer func() {
+			if o, err := client.OSDUnsetGroupFlags(m.context, m.namespace, []string{maintenanceHostFlag}, []string{hostName}); err != nil {
+				logger.Warningf("failed to clear %s on host %s. %+v. %s", maintenanceHostFlag, hostName, err, o)
+			}
+		}()
+	}
+
+	if o, err := client.CrushMove(m.context, m.namespace, hostName, location); err != nil {
+		return fmt.Errorf("failed to move host %s. %+v. %s", hostName, err, o)
+	}
+	return nil
+}
+
+// hostOSDs returns the ids of the osds under the host in the crush map
+func hostOSDs(crush *client.CrushMap, hostName string) []int {
+	var osds []int
+	for _, b := range crush.Buckets {
+		if b.Name != hostName {
+			continue
+		}
+		for _, item := range b.Items {
+			if item.ID >= 0 {
+				osds = append(osds, item.ID)
+			}
+		}
+	}
+	return osds
+}
+
+// storageNodes returns the resolved storage settings of the nodes of the cluster
+func (m *TopologyMonitor) storageNodes(spec *cephv1alpha1.ClusterSpec) ([]rookalpha.Node, error) {
+	if !spec.Storage.UseAllNodes {
+		var nodes []rookalpha.Node
+		for _, n := range spec.Storage.Nodes {
+			if resolved := spec.Storage.ResolveNode(n.Name); resolved != nil {
+				nodes = append(nodes, *resolved)
+			}
+		}
+		return nodes, nil
+	}
+
+	nodeList, err := m.context.Clientset.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list nodes. %+v", err)
+	}
+	var nodes []rookalpha.Node
+	for _, node := range nodeList.Items {
+		nodes = append(nodes, rookalpha.Node{Name: node.Name, Location: spec.Storage.Location})
+	}
+	return nodes, nil
+}
+
+// nodeLocation returns the crush location of the OSDs on the node. The location of the node in the storage spec is
+// completed with the location from the labels of the node if the crush topology is taken from the node labels.
+func (c *Cluster) nodeLocation(n rookalpha.Node) string {
+	if !c.CrushTopology.FromNodeLabels {
+		return n.Location
+	}
+	if c.crushTypes == nil {
+		// the crush map could not be read when the orchestration started
+		return n.Location
+	}
+	node, err := getNode(c.context.Clientset, n.Name)
+	if err != nil {
+		logger.Warningf("failed to get node %s for its topology labels. %+v", n.Name, err)
+		return n.Location
+	}
+	return mergeLocation(n.Location, topologyLocation(node, &c.CrushTopology, c.crushTypes))
+}
+
+// loadCrushTypes reads the types of the crush map once per orchestration for the locations of all the nodes
+func (c *Cluster) loadCrushTypes() {
+	c.crushTypes = nil
+	if !c.CrushTopology.FromNodeLabels {
+		return
+	}
+	crush, err := client.GetCrushMap(c.context, c.Namespace)
+	if err != nil {
+		logger.Warningf("failed to get crush map for the topology of the nodes. %+v", err)
+		return
+	}
+	c.crushTypes = crushTypeNames(&crush)
+}
+
+// getNode returns the node by its name, or by its hostname label if the node is named differently
+func getNode(clientset kubernetes.Interface, name string) (*v1.Node, error) {
+	node, err := clientset.CoreV1().Nodes().Get(name, metav1.GetOptions{})
+	if err == nil {
+		return node, nil
+	}
+	nodes, listErr := clientset.CoreV1().Nodes().List(metav1.ListOptions{LabelSelector: fmt.Sprintf("%s=%s", apis.LabelHostname, name)})
+	if listErr != nil || len(nodes.Items) == 0 {
+		return nil, err
+	}
+	return &nodes.Items[0], nil
+}
+
+// topologyLabels returns the node label for each crush type, with the labels of the topology settings overriding the
+// defaults
+func topologyLabels(spec *cephv1alpha1.CrushTopologySpec) map[string]string {
+	labels := map[string]string{"region": regionLabel, "zone": zoneLabel, "rack": rackLabel}
+	for crushType, label := range spec.NodeLabels {
+		if label == "" {
+			delete(labels, crushType)
+			continue
+		}
+		labels[crushType] = label
+	}
+	// the host is always named after the node
+	delete(labels, "host")
+	delete(labels, "osd")
+	return labels
+}
+
+// topologyLocation returns the crush location of the node from its labels, for the types that are in the crush map
+func topologyLocation(node *v1.Node, spec *cephv1alpha1.CrushTopologySpec, crushTypes map[string]bool) map[string]string {
+	location := map[string]string{}
+	for crushType, label := range topologyLabels(spec) {
+		value, ok := node.Labels[label]
+		if !ok || value == "" {
+			continue
+		}
+		if !crushTypes[crushType] {
+			logger.Warningf("ignoring label %s of node %s since there is no crush type %s", label, node.Name, crushType)
+			continue
+		}
+		// crush names cannot contain dots
+		location[crushType] = strings.Replace(value, ".", "-", -1)
+	}
+	return location
+}
+
+func crushTypeNames(crush *client.CrushMap) map[string]bool {
+	names := map[string]bool{}
+	for _, t := range crush.Types {
+		names[t.Name] = true
+	}
+	return names
+}
+
+// mergeLocation adds the types of the topology location that are not set in the location, such as
+// "rack=rack1,root=default"
+func mergeLocation(location string, topology map[string]string) string {
+	merged := parseLocation(location)
+	for crushType, name := range topology {
+		if _, ok := merged[crushType]; !ok {
+			merged[crushType] = name
+		}
+	}
+	return strings.Join(formatLocation(merged), ",")
+}
+
+func parseLocation(location string) map[string]string {
+	pairs := map[string]string{}
+	for _, pair := range strings.Split(location, ",") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) == 2 && kv[0] != "" && kv[1] != "" {
+			pairs[kv[0]] = kv[1]
+		}
+	}
+	return pairs
+}
+
+// formatLocation returns the type=name pairs of the location sorted by type
+func formatLocation(location map[string]string) []string {
+	var pairs []string
+	for crushType, name := range location {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", crushType, name))
+	}
+	sort.Strings(pairs)
+	return pairs
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package osd
+
+import (
+	"fmt"
+	"testing"
+
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const topologyCrushMap = `{"types":[{"type_id":0,"name":"osd"},{"type_id":1,"name":"host"},{"type_id":3,"name":"rack"},
+	{"type_id":9,"name":"zone"},{"type_id":11,"name":"root"}],
+	"buckets":[{"id":-1,"name":"default","type_name":"root","items":[{"id":-2},{"id":-4}]},
+	{"id":-2,"name":"node1","type_name":"host","items":[{"id":0}]},
+	{"id":-4,"name":"rack1","type_name":"rack","items":[{"id":-3}]},
+	{"id":-3,"name":"node2","type_name":"host","items":[{"id":1}]}]}`
+
+func topologyNode(name string, labels map[string]string) *v1.Node {
+	return &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+func TestTopologyLocation(t *testing.T) {
+	crushTypes := map[string]bool{"host": true, "rack": true, "zone": true, "root": true}
+	node := topologyNode("node1", map[string]string{zoneLabel: "us-east-1a", regionLabel: "us-east-1", rackLabel: "rack.1", "row": "row1"})
+
+	// the default labels are used for the types that are in the crush map
+	location := topologyLocation(node, &cephv1alpha1.CrushTopologySpec{FromNodeLabels: true}, crushTypes)
+	assert.Equal(t, map[string]string{"zone": "us-east-1a", "rack": "rack-1"}, location)
+
+	// the labels can be overridden and removed, but not for the host
+	spec := &cephv1alpha1.CrushTopologySpec{FromNodeLabels: true, NodeLabels: map[string]string{"rack": "row", "zone": "", "host": rackLabel}}
+	location = topologyLocation(node, spec, crushTypes)
+	assert.Equal(t, map[string]string{"rack": "row1"}, location)
+}
+
+func TestMergeLocation(t *testing.T) {
+	// the location of the storage spec takes precedence over the topology
+	assert.Equal(t, "rack=rack9,root=fast,zone=zone1", mergeLocation("root=fast,rack=rack9", map[string]string{"zone": "zone1", "rack": "rack1"}))
+	assert.Equal(t, "zone=zone1", mergeLocation("", map[string]string{"zone": "zone1"}))
+}
+
+func TestNodeLocation(t *testing.T) {
+	clientset := fake.NewSimpleClientset(topologyNode("node1", map[string]string{zoneLabel: "zone1", rackLabel: "rack1"}))
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outputFile string, args ...string) (string, error) {
+			if args[0] == "osd" && args[1] == "crush" && args[2] == "dump" {
+				return topologyCrushMap, nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+	c := &Cluster{context: &clusterd.Context{Clientset: clientset, Executor: executor}, Namespace: "ns"}
+
+	// the location of the storage spec is used as is without the node labels
+	n := rookalpha.Node{Name: "node1", Location: "root=default"}
+	assert.Equal(t, "root=default", c.nodeLocation(n))
+
+	// the crush map is read once for the locations of all the nodes
+	c.CrushTopology.FromNodeLabels = true
+	c.loadCrushTypes()
+	assert.Equal(t, "rack=rack1,root=default,zone=zone1", c.nodeLocation(n))
+	c.context.Executor = &exectest.MockExecutor{}
+	assert.Equal(t, "rack=rack1,root=default,zone=zone1", c.nodeLocation(n))
+
+	// the location of the storage spec is used if the crush map cannot be read
+	c.loadCrushTypes()
+	assert.Equal(t, "root=default", c.nodeLocation(n))
+}
+
+func TestMoveHosts(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		topologyNode("node1", map[string]string{rackLabel: "rack2"}),
+		topologyNode("node2", map[string]string{rackLabel: "rack3"}),
+		topologyNode("node3", map[string]string{rackLabel: "rack1"}))
+	clean := true
+	var commands []string
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outputFile string, args ...string) (string, error) {
+			if args[0] == "osd" && args[1] == "crush" && args[2] == "dump" {
+				return topologyCrushMap, nil
+			}
+			if args[0] == "status" {
+				if clean {
+					return `{"pgmap":{"num_pgs":100,"pgs_by_state":[{"state_name":"active+clean","count":100}]}}`, nil
+				}
+				return `{"pgmap":{"num_pgs":100,"pgs_by_state":[{"state_name":"active+remapped+backfilling","count":100}]}}`, nil
+			}
+			commands = append(commands, exectest.CephCommand(args...))
+			return "", nil
+		},
+	}
+	m := NewTopologyMonitor(&clusterd.Context{Clientset: clientset, Executor: executor}, "ns", "ns")
+	spec := &cephv1alpha1.ClusterSpec{CrushTopology: cephv1alpha1.CrushTopologySpec{FromNodeLabels: true}}
+	spec.Storage.UseAllNodes = true
+
+	// the hosts are not moved until their new location is confirmed
+	err := m.moveHosts(spec)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(commands))
+
+	// the hosts are not moved while the cluster is not clean
+	spec.CrushTopology.ConfirmHostMoves = map[string]string{"node1": "rack=rack2,root=default", "node2": "rack=rack3,root=default"}
+	clean = false
+	err = m.moveHosts(spec)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(commands))
+
+	// one confirmed host is moved with noout set on it. node3 has no osds in the crush map.
+	clean = true
+	err = m.moveHosts(spec)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"osd set-group noout node1", "osd crush move node1 rack=rack2 root=default", "osd unset-group noout node1"}, commands)
+
+	// a confirmation of another location does not move the host
+	commands = nil
+	spec.CrushTopology.ConfirmHostMoves = map[string]string{"node2": "rack=rack1,root=default"}
+	err = m.moveHosts(spec)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(commands))
+}
@@ -0,0 +1,219 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package rbd for the Ceph rbd-mirror daemons.
+package rbd
+
+import (
+	"fmt"
+
+	"github.com/coreos/pkg/capnslog"
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	opmon "github.com/rook/rook/pkg/operator/ceph/cluster/mon"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/api/core/v1"
+	extensions "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var logger = capnslog.NewPackageLogger("github.com/rook/rook", "op-rbd-mirror")
+
+const (
+	appName     = "rook-ceph-rbd-mirror"
+	keyringName = "keyring"
+	peersVolume = "rbd-mirror-peers"
+	peersDir    = "/etc/rook/rbd-mirror-peers"
+)
+
+var daemonNames = [...]string{"a", "b", "c", "d", "e"}
+
+// MaxWorkers is the most rbd-mirror daemons a cluster can run
+const MaxWorkers = len(daemonNames)
+
+// Mirroring is the ceph rbd-mirror manager
+type Mirroring struct {
+	Namespace   string
+	Version     string
+	Workers     int
+	placement   rookalpha.Placement
+	context     *clusterd.Context
+	HostNetwork bool
+	resources   v1.ResourceRequirements
+	ownerRef    metav1.OwnerReference
+}
+
+// New creates an instance of the rbd-mirror manager
+func New(context *clusterd.Context, namespace, version string, workers int, placement rookalpha.Placement, hostNetwork bool,
+	resources v1.ResourceRequirements, ownerRef metav1.OwnerReference) *Mirroring {
+	return &Mirroring{
+		context:     context,
+		Namespace:   namespace,
+		Version:     version,
+		Workers:     workers,
+		placement:   placement,
+		HostNetwork: hostNetwork,
+		resources:   resources,
+		ownerRef:    ownerRef,
+	}
+}
+
+// Start the rbd-mirror daemons and remove the daemons beyond the number of workers
+func (m *Mirroring) Start() error {
+	for i, daemonName := range daemonNames {
+		name := fmt.Sprintf("%s-%s", appName, daemonName)
+		if i >= m.Workers {
+			if err := m.removeDaemon(name); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := m.createKeyring(name, daemonName); err != nil {
+			return fmt.Errorf("failed to create %s keyring. %+v", name, err)
+		}
+		deployment := m.makeDeployment(name, daemonName)
+		if _, err := m.context.Clientset.ExtensionsV1beta1().Deployments(m.Namespace).Create(deployment); err != nil {
+			if !errors.IsAlreadyExists(err) {
+				return fmt.Errorf("failed to create %s deployment. %+v", name, err)
+			}
+			logger.Infof("%s deployment already exists", name)
+		} else {
+			logger.Infof("%s deployment started", name)
+		}
+	}
+	return nil
+}
+
+func (m *Mirroring) removeDaemon(name string) error {
+	err := m.context.Clientset.ExtensionsV1beta1().Deployments(m.Namespace).Delete(name, &metav1.DeleteOptions{})
+	if err == nil {
+		logger.Infof("removed %s deployment", name)
+	} else if !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete %s deployment. %+v", name, err)
+	}
+	err = m.context.Clientset.CoreV1().Secrets(m.Namespace).Delete(name, &metav1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to delete %s keyring. %+v", name, err)
+	}
+	return nil
+}
+
+func (m *Mirroring) makeDeployment(name, daemonName string) *extensions.Deployment {
+	// the peers are optional so the daemons start before any pool is mirrored
+	optional := true
+	podSpec := v1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   name,
+			Labels: m.getDaemonLabels(daemonName),
+		},
+		Spec: v1.PodSpec{
+			Containers:    []v1.Container{m.rbdMirrorContainer(name, daemonName)},
+			RestartPolicy: v1.RestartPolicyAlways,
+			Volumes: []v1.Volume{
+				{Name: k8sutil.DataDirVolume, VolumeSource: v1.VolumeSource{EmptyDir: &v1.EmptyDirVolumeSource{}}},
+				{Name: peersVolume, VolumeSource: v1.VolumeSource{Secret: &v1.SecretVolumeSource{SecretName: PeersSecretName, Optional: &optional}}},
+				k8sutil.ConfigOverrideVolume(),
+			},
+			HostNetwork: m.HostNetwork,
+		},
+	}
+	if m.HostNetwork {
+		podSpec.Spec.DNSPolicy = v1.DNSClusterFirstWithHostNet
+	}
+	m.placement.ApplyToPodSpec(&podSpec.Spec)
+
+	replicas := int32(1)
+	return &extensions.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       m.Namespace,
+			OwnerReferences: []metav1.OwnerReference{m.ownerRef},
+		},
+		Spec: extensions.DeploymentSpec{Template: podSpec, Replicas: &replicas},
+	}
+}
+
+func (m *Mirroring) rbdMirrorContainer(name, daemonName string) v1.Container {
+	return v1.Container{
+		Args: []string{
+			"ceph",
+			"rbd-mirror",
+			fmt.Sprintf("--config-dir=%s", k8sutil.DataDir),
+		},
+		Name:  name,
+		Image: k8sutil.MakeRookImage(m.Version),
+		VolumeMounts: []v1.VolumeMount{
+			{Name: k8sutil.DataDirVolume, MountPath: k8sutil.DataDir},
+			{Name: peersVolume, MountPath: peersDir, ReadOnly: true},
+			k8sutil.ConfigOverrideMount(),
+		},
+		Env: []v1.EnvVar{
+			{Name: "ROOK_RBD_MIRROR_NAME", Value: daemonName},
+			{Name: "ROOK_RBD_MIRROR_KEYRING", ValueFrom: &v1.EnvVarSource{SecretKeyRef: &v1.SecretKeySelector{LocalObjectReference: v1.LocalObjectReference{Name: name}, Key: keyringName}}},
+			{Name: "ROOK_RBD_MIRROR_PEERS_DIR", Value: peersDir},
+			k8sutil.PodIPEnvVar(k8sutil.PrivateIPEnvVar),
+			k8sutil.PodIPEnvVar(k8sutil.PublicIPEnvVar),
+			opmon.ClusterNameEnvVar(m.Namespace),
+			opmon.EndpointEnvVar(),
+			opmon.SecretEnvVar(),
+			opmon.AdminSecretEnvVar(),
+			k8sutil.ConfigOverrideEnvVar(),
+		},
+		Resources: m.resources,
+	}
+}
+
+func (m *Mirroring) getDaemonLabels(daemonName string) map[string]string {
+	return map[string]string{
+		k8sutil.AppAttr:     appName,
+		k8sutil.ClusterAttr: m.Namespace,
+		"instance":          daemonName,
+	}
+}
+
+func (m *Mirroring) createKeyring(name, daemonName string) error {
+	_, err := m.context.Clientset.CoreV1().Secrets(m.Namespace).Get(name, metav1.GetOptions{})
+	if err == nil {
+		logger.Infof("the rbd-mirror keyring was already generated")
+		return nil
+	}
+	if !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to get rbd-mirror secrets. %+v", err)
+	}
+
+	username := fmt.Sprintf("client.rbd-mirror.%s", daemonName)
+	keyring, err := client.AuthGetOrCreateKey(m.context, m.Namespace, username, rbdCaps)
+	if err != nil {
+		return fmt.Errorf("failed to get or create auth key for %s. %+v", username, err)
+	}
+
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            name,
+			Namespace:       m.Namespace,
+			OwnerReferences: []metav1.OwnerReference{m.ownerRef},
+		},
+		StringData: map[string]string{keyringName: keyring},
+		Type:       k8sutil.RookType,
+	}
+	if _, err := m.context.Clientset.CoreV1().Secrets(m.Namespace).Create(secret); err != nil {
+		return fmt.Errorf("failed to save rbd-mirror secrets. %+v", err)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package rbd
+
+import (
+	"testing"
+
+	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
+	"github.com/rook/rook/pkg/clusterd"
+	testop "github.com/rook/rook/pkg/operator/test"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestStartRBDMirror(t *testing.T) {
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			return `{"key":"mysecurekey"}`, nil
+		},
+	}
+	context := &clusterd.Context{Executor: executor, Clientset: testop.New(3)}
+	m := New(context, "ns", "myversion", 2, rookalpha.Placement{}, false, v1.ResourceRequirements{}, metav1.OwnerReference{})
+
+	// the daemons mount the peers secret
+	err := m.Start()
+	assert.Nil(t, err)
+	for _, name := range []string{"rook-ceph-rbd-mirror-a", "rook-ceph-rbd-mirror-b"} {
+		d, err := context.Clientset.ExtensionsV1beta1().Deployments("ns").Get(name, metav1.GetOptions{})
+		assert.Nil(t, err)
+		assert.Equal(t, PeersSecretName, d.Spec.Template.Spec.Volumes[1].Secret.SecretName)
+		_, err = context.Clientset.CoreV1().Secrets("ns").Get(name, metav1.GetOptions{})
+		assert.Nil(t, err)
+	}
+
+	// the daemons beyond the workers are removed
+	m.Workers = 1
+	err = m.Start()
+	assert.Nil(t, err)
+	_, err = context.Clientset.ExtensionsV1beta1().Deployments("ns").Get("rook-ceph-rbd-mirror-a", metav1.GetOptions{})
+	assert.Nil(t, err)
+	_, err = context.Clientset.ExtensionsV1beta1().Deployments("ns").Get("rook-ceph-rbd-mirror-b", metav1.GetOptions{})
+	assert.True(t, errors.IsNotFound(err))
+	_, err = context.Clientset.CoreV1().Secrets("ns").Get("rook-ceph-rbd-mirror-b", metav1.GetOptions{})
+	assert.True(t, errors.IsNotFound(err))
+}
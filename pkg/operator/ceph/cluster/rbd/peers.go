@@ -0,0 +1,135 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package rbd
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/daemon/ceph/client"
+	rbddaemon "github.com/rook/rook/pkg/daemon/ceph/rbd"
+	opmon "github.com/rook/rook/pkg/operator/ceph/cluster/mon"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// BootstrapSecretName is the secret with the credentials the peer clusters use to mirror the pools of this cluster
+	BootstrapSecretName = "rook-ceph-rbd-mirror-bootstrap"
+	// PeersSecretName is the secret with the config and keyring files of the peer clusters mounted by the daemons
+	PeersSecretName = "rook-ceph-rbd-mirror-peers"
+
+	bootstrapMonHostKey = "monHost"
+	bootstrapUserKey    = "user"
+	bootstrapKeyKey     = "key"
+	peerUser            = "rbd-mirror-peer"
+)
+
+var rbdCaps = []string{"mon", "profile rbd", "osd", "profile rbd"}
+
+// CreateBootstrapSecret creates or refreshes the secret with the mon endpoints and the credentials the peer clusters
+// use to connect to this cluster
+func CreateBootstrapSecret(context *clusterd.Context, namespace string) error {
+	clusterInfo, _, _, err := opmon.LoadClusterInfo(context, namespace)
+	if err != nil {
+		return fmt.Errorf("failed to load cluster info. %+v", err)
+	}
+	var endpoints []string
+	for _, m := range clusterInfo.Monitors {
+		endpoints = append(endpoints, m.Endpoint)
+	}
+	sort.Strings(endpoints)
+
+	key, err := client.AuthGetOrCreateKey(context, namespace, fmt.Sprintf("client.%s", peerUser), rbdCaps)
+	if err != nil {
+		return fmt.Errorf("failed to get or create auth key for %s. %+v", peerUser, err)
+	}
+
+	data := map[string][]byte{
+		bootstrapMonHostKey: []byte(strings.Join(endpoints, ",")),
+		bootstrapUserKey:    []byte(peerUser),
+		bootstrapKeyKey:     []byte(key),
+	}
+	return saveSecret(context, namespace, BootstrapSecretName, data)
+}
+
+// SyncPeers writes the config and keyring files of the peers to the secret mounted by the daemons, from the bootstrap
+// secrets of the peers. The name of the bootstrap secret is the name of the peer. Returns the client name of each peer.
+func SyncPeers(context *clusterd.Context, namespace string, peers []string) (map[string]string, error) {
+	clients := map[string]string{}
+	data := map[string][]byte{}
+	for _, peer := range peers {
+		if peer == "ceph" || peer == namespace {
+			return nil, fmt.Errorf("the name of peer %s conflicts with the name of the local cluster", peer)
+		}
+		secret, err := context.Clientset.CoreV1().Secrets(namespace).Get(peer, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get the bootstrap secret of peer %s. %+v", peer, err)
+		}
+		monHost := string(secret.Data[bootstrapMonHostKey])
+		user := string(secret.Data[bootstrapUserKey])
+		key := string(secret.Data[bootstrapKeyKey])
+		if monHost == "" || user == "" || key == "" {
+			return nil, fmt.Errorf("the bootstrap secret of peer %s requires the %s, %s and %s", peer, bootstrapMonHostKey, bootstrapUserKey, bootstrapKeyKey)
+		}
+
+		clientName := fmt.Sprintf("client.%s", user)
+		keyringFile := fmt.Sprintf("%s.%s.keyring", peer, clientName)
+		data[fmt.Sprintf("%s.conf", peer)] = []byte(fmt.Sprintf("[global]\nmon host = %s\nkeyring = %s/%s\n", monHost, rbddaemon.PeerConfigDir, keyringFile))
+		data[keyringFile] = []byte(fmt.Sprintf("[%s]\n\tkey = %s\n", clientName, key))
+		clients[peer] = clientName
+	}
+
+	if err := saveSecret(context, namespace, PeersSecretName, data); err != nil {
+		return nil, err
+	}
+	return clients, nil
+}
+
+// saveSecret creates the secret, or updates it if its data changed
+func saveSecret(context *clusterd.Context, namespace, name string, data map[string][]byte) error {
+	secret, err := context.Clientset.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return fmt.Errorf("failed to get secret %s. %+v", name, err)
+		}
+		secret = &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Data:       data,
+			Type:       k8sutil.RookType,
+		}
+		if _, err := context.Clientset.CoreV1().Secrets(namespace).Create(secret); err != nil {
+			return fmt.Errorf("failed to create secret %s. %+v", name, err)
+		}
+		logger.Infof("created secret %s", name)
+		return nil
+	}
+
+	if reflect.DeepEqual(secret.Data, data) || (len(secret.Data) == 0 && len(data) == 0) {
+		return nil
+	}
+	secret.Data = data
+	if _, err := context.Clientset.CoreV1().Secrets(namespace).Update(secret); err != nil {
+		return fmt.Errorf("failed to update secret %s. %+v", name, err)
+	}
+	logger.Infof("updated secret %s", name)
+	return nil
+}
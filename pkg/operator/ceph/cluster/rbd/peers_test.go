@@ -0,0 +1,79 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package rbd
+
+import (
+	"testing"
+
+	"github.com/rook/rook/pkg/clusterd"
+	opmon "github.com/rook/rook/pkg/operator/ceph/cluster/mon"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCreateBootstrapSecret(t *testing.T) {
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			assert.Equal(t, "client.rbd-mirror-peer", args[2])
+			return `{"key":"peerkey"}`, nil
+		},
+	}
+	clientset := fake.NewSimpleClientset(
+		&v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "rook-ceph-mon", Namespace: "ns"}, Data: map[string][]byte{"cluster-name": []byte("ns")}},
+		&v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: opmon.EndpointConfigMapName, Namespace: "ns"},
+			Data: map[string]string{opmon.EndpointDataKey: "rook-ceph-mon1=10.0.0.2:6790,rook-ceph-mon0=10.0.0.1:6790"}})
+	context := &clusterd.Context{Executor: executor, Clientset: clientset}
+
+	err := CreateBootstrapSecret(context, "ns")
+	assert.Nil(t, err)
+	secret, err := clientset.CoreV1().Secrets("ns").Get(BootstrapSecretName, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "10.0.0.1:6790,10.0.0.2:6790", string(secret.Data["monHost"]))
+	assert.Equal(t, "rbd-mirror-peer", string(secret.Data["user"]))
+	assert.Equal(t, "peerkey", string(secret.Data["key"]))
+}
+
+func TestSyncPeers(t *testing.T) {
+	clientset := fake.NewSimpleClientset(&v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "site-b", Namespace: "ns"},
+		Data: map[string][]byte{"monHost": []byte("10.1.0.1:6790"), "user": []byte("rbd-mirror-peer"), "key": []byte("peerkey")}})
+	context := &clusterd.Context{Clientset: clientset}
+
+	// the config and keyring of the peer are written to the peers secret
+	clients, err := SyncPeers(context, "ns", []string{"site-b"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"site-b": "client.rbd-mirror-peer"}, clients)
+	secret, err := clientset.CoreV1().Secrets("ns").Get(PeersSecretName, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "[global]\nmon host = 10.1.0.1:6790\nkeyring = /etc/ceph/site-b.client.rbd-mirror-peer.keyring\n",
+		string(secret.Data["site-b.conf"]))
+	assert.Equal(t, "[client.rbd-mirror-peer]\n\tkey = peerkey\n", string(secret.Data["site-b.client.rbd-mirror-peer.keyring"]))
+
+	// the files of the removed peers are removed
+	_, err = SyncPeers(context, "ns", nil)
+	assert.Nil(t, err)
+	secret, err = clientset.CoreV1().Secrets("ns").Get(PeersSecretName, metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(secret.Data))
+
+	// the peers must have a bootstrap secret and a name different from the local cluster
+	_, err = SyncPeers(context, "ns", []string{"site-c"})
+	assert.NotNil(t, err)
+	_, err = SyncPeers(context, "ns", []string{"ns"})
+	assert.NotNil(t, err)
+}
@@ -29,6 +29,7 @@ import (
 	rookv1alpha1 "github.com/rook/rook/pkg/apis/rook.io/v1alpha1"
 	rookv1alpha2 "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
 	"github.com/rook/rook/pkg/clusterd"
+	"github.com/rook/rook/pkg/operator/k8sutil"
 	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -38,6 +39,7 @@ import (
 const (
 	customResourceName       = "filesystem"
 	customResourceNamePlural = "filesystems"
+	filesystemFinalizer      = "filesystem.ceph.rook.io"
 )
 
 var logger = capnslog.NewPackageLogger("github.com/rook/rook", "op-file")
@@ -115,10 +117,22 @@ func (c *FilesystemController) onAdd(obj interface{}) {
 		return
 	}
 
+	if filesystem.DeletionTimestamp != nil {
+		if err := finalizeFilesystem(c.context, filesystem); err != nil {
+			logger.Errorf("failed to delete file system %s. %+v", filesystem.Name, err)
+		}
+		return
+	}
+
 	err = CreateFilesystem(c.context, *filesystem, c.rookImage, c.hostNetwork, c.filesystemOwners(filesystem))
 	if err != nil {
 		logger.Errorf("failed to create file system %s. %+v", filesystem.Name, err)
 	}
+
+	// the finalizer applies the deletion policy of the file system when its CRD is deleted
+	if err := addFilesystemFinalizer(c.context, filesystem); err != nil {
+		logger.Warningf("failed to add finalizer to file system %s. %+v", filesystem.Name, err)
+	}
 }
 
 func (c *FilesystemController) onUpdate(oldObj, newObj interface{}) {
@@ -140,6 +154,13 @@ func (c *FilesystemController) onUpdate(oldObj, newObj interface{}) {
 		return
 	}
 
+	if newFS.DeletionTimestamp != nil {
+		if err := finalizeFilesystem(c.context, newFS); err != nil {
+			logger.Errorf("failed to delete file system %s. %+v", newFS.Name, err)
+		}
+		return
+	}
+
 	if !filesystemChanged(oldFS.Spec, newFS.Spec) {
 		logger.Debugf("filesystem %s not updated", newFS.Name)
 		return
@@ -165,12 +186,75 @@ func (c *FilesystemController) onDelete(obj interface{}) {
 		return
 	}
 
+	// the file system was already finalized unless its CRD was deleted before the finalizer was added
+	if filesystem.DeletionTimestamp != nil {
+		return
+	}
 	err = DeleteFilesystem(c.context, *filesystem)
 	if err != nil {
 		logger.Errorf("failed to delete file system %s. %+v", filesystem.Name, err)
 	}
 }
 
+// finalizeFilesystem deletes the file system according to its deletion policy and removes the finalizer from its CRD.
+// The finalizer is kept while the file system is in use.
+func finalizeFilesystem(context *clusterd.Context, fs *cephv1alpha1.Filesystem) error {
+	// the file system is deleted with its cluster
+	if !pool.ClusterDeleted(context, fs.Namespace) {
+		if err := DeleteFilesystem(context, *fs); err != nil {
+			return err
+		}
+	}
+	return removeFilesystemFinalizer(context, fs)
+}
+
+// filesystemCRDFinalizer returns the finalizer of the file system CRDs in the namespace
+func filesystemCRDFinalizer(context *clusterd.Context, namespace string) *k8sutil.CRDFinalizer {
+	client := context.RookClientset.CephV1alpha1().Filesystems(namespace)
+	return &k8sutil.CRDFinalizer{
+		Name: filesystemFinalizer,
+		Kind: "file system",
+		Get: func(name string) (metav1.Object, error) {
+			return client.Get(name, metav1.GetOptions{})
+		},
+		List: func() ([]metav1.Object, error) {
+			filesystems, err := client.List(metav1.ListOptions{})
+			if err != nil {
+				return nil, err
+			}
+			var objs []metav1.Object
+			for i := range filesystems.Items {
+				objs = append(objs, &filesystems.Items[i])
+			}
+			return objs, nil
+		},
+		Update: func(obj metav1.Object) error {
+			_, err := client.Update(obj.(*cephv1alpha1.Filesystem))
+			return err
+		},
+	}
+}
+
+func addFilesystemFinalizer(context *clusterd.Context, fs *cephv1alpha1.Filesystem) error {
+	return filesystemCRDFinalizer(context, fs.Namespace).Add(fs.Name)
+}
+
+func removeFilesystemFinalizer(context *clusterd.Context, fs *cephv1alpha1.Filesystem) error {
+	return filesystemCRDFinalizer(context, fs.Namespace).Remove(fs.Name)
+}
+
+// RetryDeletions retries the deletion of the deleted file system CRDs in the namespace that were in use
+func RetryDeletions(context *clusterd.Context, namespace string) error {
+	return filesystemCRDFinalizer(context, namespace).RetryDeletions(func(obj metav1.Object) error {
+		return finalizeFilesystem(context, obj.(*cephv1alpha1.Filesystem))
+	})
+}
+
+// RemoveFinalizers removes the finalizers from the file system CRDs of a deleted cluster
+func RemoveFinalizers(context *clusterd.Context, namespace string) error {
+	return filesystemCRDFinalizer(context, namespace).RemoveAll()
+}
+
 func (c *FilesystemController) filesystemOwners(fs *cephv1alpha1.Filesystem) []metav1.OwnerReference {
 
 	// Only set the cluster crd as the owner of the filesystem resources.
@@ -76,18 +76,34 @@ func CreateFilesystem(context *clusterd.Context, fs cephv1alpha1.Filesystem, ver
 	return nil
 }
 
-// Delete the file system
+// Delete the file system. Nothing is deleted while persistent volumes mount the file system, as its mds serves their
+// mounts. The mds is then stopped, and the ceph file system and its pools are deleted if the deletion policy is Delete.
 func DeleteFilesystem(context *clusterd.Context, fs cephv1alpha1.Filesystem) error {
+	// the mds serves the mounts of the volumes even if the file system is retained, so it is kept until they are gone
+	volumes, err := pool.VolumesUsing(context, fs.Namespace, pool.VolumeFilesystemKey, fs.Name)
+	if err != nil {
+		return err
+	}
+	if len(volumes) > 0 {
+		return fmt.Errorf("file system %s cannot be deleted while it is used by persistent volumes %v", fs.Name, volumes)
+	}
+	deleteFS := pool.DeleteOnRemoval(fs.Spec.DeletionPolicy)
+
 	// Delete the mds deployment
 	k8sutil.DeleteDeployment(context.Clientset, fs.Namespace, instanceName(fs))
 
 	// Delete the keyring
 	// Delete the rgw keyring
-	err := context.Clientset.CoreV1().Secrets(fs.Namespace).Delete(instanceName(fs), &metav1.DeleteOptions{})
+	err = context.Clientset.CoreV1().Secrets(fs.Namespace).Delete(instanceName(fs), &metav1.DeleteOptions{})
 	if err != nil && !errors.IsNotFound(err) {
 		logger.Warningf("failed to delete mds secret. %+v", err)
 	}
 
+	if !deleteFS {
+		logger.Infof("retaining file system %s and its pools after the deletion of its CRD", fs.Name)
+		return nil
+	}
+
 	// Delete the ceph file system and pools
 	if err := cephmds.DeleteFilesystem(context, fs.Namespace, fs.Name); err != nil {
 		return fmt.Errorf("failed to delete file system %s: %+v", fs.Name, err)
@@ -198,6 +214,9 @@ func validateFilesystem(context *clusterd.Context, f cephv1alpha1.Filesystem) er
 	if f.Spec.MetadataServer.ActiveCount < 1 {
 		return fmt.Errorf("MetadataServer.ActiveCount must be at least 1")
 	}
+	if err := pool.ValidateDeletionPolicy(f.Spec.DeletionPolicy); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -30,6 +30,7 @@ import (
 	exectest "github.com/rook/rook/pkg/util/exec/test"
 	"github.com/stretchr/testify/assert"
 	"k8s.io/api/core/v1"
+	extensions "k8s.io/api/extensions/v1beta1"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -106,6 +107,64 @@ func TestStartMDS(t *testing.T) {
 	assert.Equal(t, "failed to create file system myfs: Cannot create multiple filesystems. Enable ROOK_ALLOW_MULTIPLE_FILESYSTEMS env variable to create more than one", err.Error())
 }
 
+func TestDeleteFilesystem(t *testing.T) {
+	var cephCommands []string
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName string, command string, outFileArg string, args ...string) (string, error) {
+			cephCommands = append(cephCommands, strings.Join(args, " "))
+			if args[0] == "fs" && args[1] == "get" {
+				return `{"id":1,"mdsmap":{"fs_name":"myfs","metadata_pool":1,"data_pools":[2]}}`, nil
+			}
+			if args[0] == "osd" && args[1] == "lspools" {
+				return `[{"poolnum":1,"poolname":"myfs-metadata"},{"poolnum":2,"poolname":"myfs-data0"}]`, nil
+			}
+			return "", nil
+		},
+	}
+	clientset := testop.New(3)
+	context := &clusterd.Context{Executor: executor, Clientset: clientset}
+	fs := cephv1alpha1.Filesystem{ObjectMeta: metav1.ObjectMeta{Name: "myfs", Namespace: "ns"}}
+
+	// the file system is retained by default
+	err := DeleteFilesystem(context, fs)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(cephCommands))
+
+	// the mds of a retained file system is kept while a volume mounts it
+	pv := &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: "mypv"},
+		Spec: v1.PersistentVolumeSpec{PersistentVolumeSource: v1.PersistentVolumeSource{FlexVolume: &v1.FlexVolumeSource{
+			Driver:  "ceph.rook.io/rook",
+			Options: map[string]string{"fsName": "myfs", "clusterNamespace": "ns"},
+		}}},
+	}
+	clientset.CoreV1().PersistentVolumes().Create(pv)
+	mds := &extensions.Deployment{ObjectMeta: metav1.ObjectMeta{Name: instanceName(fs), Namespace: "ns"}}
+	clientset.ExtensionsV1beta1().Deployments("ns").Create(mds)
+	err = DeleteFilesystem(context, fs)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "mypv")
+	_, err = clientset.ExtensionsV1beta1().Deployments("ns").Get(instanceName(fs), metav1.GetOptions{})
+	assert.Nil(t, err)
+
+	// the file system is not deleted while a volume mounts it
+	fs.Spec.DeletionPolicy = cephv1alpha1.DeletionPolicyDelete
+	err = DeleteFilesystem(context, fs)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "mypv")
+	assert.Equal(t, 0, len(cephCommands))
+
+	// the file system is deleted when the volume is gone
+	clientset.CoreV1().PersistentVolumes().Delete("mypv", &metav1.DeleteOptions{})
+	err = DeleteFilesystem(context, fs)
+	assert.Nil(t, err)
+	removed := false
+	for _, command := range cephCommands {
+		removed = removed || strings.HasPrefix(command, "fs rm myfs")
+	}
+	assert.True(t, removed)
+}
+
 func contains(arr []string, str string) bool {
 	for _, a := range arr {
 		if a == str {
@@ -28,6 +28,7 @@ import (
 	rookv1alpha2 "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
 	"github.com/rook/rook/pkg/clusterd"
 	"github.com/rook/rook/pkg/operator/ceph/pool"
+	"github.com/rook/rook/pkg/operator/k8sutil"
 	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -37,6 +38,7 @@ import (
 const (
 	customResourceName       = "objectstore"
 	customResourceNamePlural = "objectstores"
+	objectStoreFinalizer     = "objectstore.ceph.rook.io"
 )
 
 var logger = capnslog.NewPackageLogger("github.com/rook/rook", "op-object")
@@ -114,9 +116,21 @@ func (c *ObjectStoreController) onAdd(obj interface{}) {
 		return
 	}
 
+	if objectstore.DeletionTimestamp != nil {
+		if err := finalizeStore(c.context, objectstore); err != nil {
+			logger.Errorf("failed to delete object store %s. %+v", objectstore.Name, err)
+		}
+		return
+	}
+
 	if err = CreateStore(c.context, *objectstore, c.rookImage, c.hostNetwork, c.storeOwners(objectstore)); err != nil {
 		logger.Errorf("failed to create object store %s. %+v", objectstore.Name, err)
 	}
+
+	// the finalizer applies the deletion policy of the object store when its CRD is deleted
+	if err := addStoreFinalizer(c.context, objectstore); err != nil {
+		logger.Warningf("failed to add finalizer to object store %s. %+v", objectstore.Name, err)
+	}
 }
 
 func (c *ObjectStoreController) onUpdate(oldObj, newObj interface{}) {
@@ -139,6 +153,13 @@ func (c *ObjectStoreController) onUpdate(oldObj, newObj interface{}) {
 		return
 	}
 
+	if newStore.DeletionTimestamp != nil {
+		if err := finalizeStore(c.context, newStore); err != nil {
+			logger.Errorf("failed to delete object store %s. %+v", newStore.Name, err)
+		}
+		return
+	}
+
 	if !storeChanged(oldStore.Spec, newStore.Spec) {
 		logger.Debugf("object store %s did not change", newStore.Name)
 		return
@@ -162,11 +183,73 @@ func (c *ObjectStoreController) onDelete(obj interface{}) {
 		return
 	}
 
+	// the object store was already finalized unless its CRD was deleted before the finalizer was added
+	if objectstore.DeletionTimestamp != nil {
+		return
+	}
 	if err = DeleteStore(c.context, *objectstore); err != nil {
 		logger.Errorf("failed to delete object store %s. %+v", objectstore.Name, err)
 	}
 }
 
+// finalizeStore deletes the object store according to its deletion policy and removes the finalizer from its CRD
+func finalizeStore(context *clusterd.Context, store *cephv1alpha1.ObjectStore) error {
+	// the object store is deleted with its cluster
+	if !pool.ClusterDeleted(context, store.Namespace) {
+		if err := DeleteStore(context, *store); err != nil {
+			return err
+		}
+	}
+	return removeStoreFinalizer(context, store)
+}
+
+// storeCRDFinalizer returns the finalizer of the object store CRDs in the namespace
+func storeCRDFinalizer(context *clusterd.Context, namespace string) *k8sutil.CRDFinalizer {
+	client := context.RookClientset.CephV1alpha1().ObjectStores(namespace)
+	return &k8sutil.CRDFinalizer{
+		Name: objectStoreFinalizer,
+		Kind: "object store",
+		Get: func(name string) (metav1.Object, error) {
+			return client.Get(name, metav1.GetOptions{})
+		},
+		List: func() ([]metav1.Object, error) {
+			stores, err := client.List(metav1.ListOptions{})
+			if err != nil {
+				return nil, err
+			}
+			var objs []metav1.Object
+			for i := range stores.Items {
+				objs = append(objs, &stores.Items[i])
+			}
+			return objs, nil
+		},
+		Update: func(obj metav1.Object) error {
+			_, err := client.Update(obj.(*cephv1alpha1.ObjectStore))
+			return err
+		},
+	}
+}
+
+func addStoreFinalizer(context *clusterd.Context, store *cephv1alpha1.ObjectStore) error {
+	return storeCRDFinalizer(context, store.Namespace).Add(store.Name)
+}
+
+func removeStoreFinalizer(context *clusterd.Context, store *cephv1alpha1.ObjectStore) error {
+	return storeCRDFinalizer(context, store.Namespace).Remove(store.Name)
+}
+
+// RetryDeletions retries the deletion of the deleted object store CRDs in the namespace whose deletion failed
+func RetryDeletions(context *clusterd.Context, namespace string) error {
+	return storeCRDFinalizer(context, namespace).RetryDeletions(func(obj metav1.Object) error {
+		return finalizeStore(context, obj.(*cephv1alpha1.ObjectStore))
+	})
+}
+
+// RemoveFinalizers removes the finalizers from the object store CRDs of a deleted cluster
+func RemoveFinalizers(context *clusterd.Context, namespace string) error {
+	return storeCRDFinalizer(context, namespace).RemoveAll()
+}
+
 func (c *ObjectStoreController) storeOwners(store *cephv1alpha1.ObjectStore) []metav1.OwnerReference {
 	// Only set the cluster crd as the owner of the object store resources.
 	// If the object store crd is deleted, the operator will explicitly remove the object store resources.
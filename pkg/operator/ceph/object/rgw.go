@@ -134,7 +134,8 @@ func startRGWPods(context *clusterd.Context, store cephv1alpha1.ObjectStore, ver
 }
 
 // Delete the object store.
-// WARNING: This is a very destructive action that deletes all metadata and data pools.
+// WARNING: This is a very destructive action that deletes all metadata and data pools if the deletion policy is Delete.
+// Otherwise the realm and pools are retained after the rgw pods are stopped.
 func DeleteStore(context *clusterd.Context, store cephv1alpha1.ObjectStore) error {
 	// check if the object store  exists
 	exists, err := storeExists(context, store)
@@ -174,6 +175,11 @@ func DeleteStore(context *clusterd.Context, store cephv1alpha1.ObjectStore) erro
 		logger.Warningf("failed to delete rgw secret. %+v", err)
 	}
 
+	if !pool.DeleteOnRemoval(store.Spec.DeletionPolicy) {
+		logger.Infof("retaining the realm and pools of object store %s after the deletion of its CRD", store.Name)
+		return nil
+	}
+
 	// Delete the realm and pools
 	objContext := cephrgw.NewContext(context, store.Name, store.Namespace)
 	err = cephrgw.DeleteObjectStore(objContext)
@@ -447,6 +453,9 @@ func validateStore(context *clusterd.Context, s cephv1alpha1.ObjectStore) error
 	if err := pool.ValidatePoolSpec(context, s.Namespace, &s.Spec.DataPool); err != nil {
 		return fmt.Errorf("invalid data pool spec. %+v", err)
 	}
+	if err := pool.ValidateDeletionPolicy(s.Spec.DeletionPolicy); err != nil {
+		return err
+	}
 
 	return nil
 }
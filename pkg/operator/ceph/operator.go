@@ -73,8 +73,8 @@ type Operator struct {
 func New(context *clusterd.Context, volumeAttachmentWrapper attachment.Attachment, rookImage string) *Operator {
 	clusterController := cluster.NewClusterController(context, rookImage, volumeAttachmentWrapper)
 
-	schemes := []opkit.CustomResource{cluster.ClusterResource, pool.PoolResource, object.ObjectStoreResource,
-		file.FilesystemResource, attachment.VolumeResource}
+	schemes := []opkit.CustomResource{cluster.ClusterResource, pool.PoolResource, pool.ErasureCodeProfileResource,
+		object.ObjectStoreResource, file.FilesystemResource, attachment.VolumeResource}
 	return &Operator{
 		context:           context,
 		clusterController: clusterController,
@@ -0,0 +1,159 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pool
+
+import (
+	"fmt"
+
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/daemon/ceph/model"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+const (
+	// AdoptAnnotation on a pool CRD takes over the existing pool with the same name rather than creating the pool
+	AdoptAnnotation = "ceph.rook.io/adopt"
+	// RetiredAnnotation marks the tombstone CRD of an adopted pool whose CRD was deleted while the pool was retained.
+	// The operator ignores the tombstone, which keeps the pool from being adopted again.
+	RetiredAnnotation = "ceph.rook.io/retired"
+)
+
+// the pools of these applications are managed by the file system and object store CRDs or by ceph itself
+var unadoptedApplications = []string{"cephfs", "rgw", "mgr", "mgr_devicehealth"}
+
+func isAdopted(p *cephv1alpha1.Pool) bool {
+	return p.Annotations[AdoptAnnotation] == "true"
+}
+
+func isRetired(p *cephv1alpha1.Pool) bool {
+	return p.Annotations[RetiredAnnotation] == "true"
+}
+
+// retirePool replaces the deleted CRD of a retained adopted pool with a tombstone CRD, so that the pool is not adopted
+// again. Deleting the tombstone lets the pool be adopted again.
+func retirePool(context *clusterd.Context, p *cephv1alpha1.Pool) error {
+	tombstone := &cephv1alpha1.Pool{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        p.Name,
+			Namespace:   p.Namespace,
+			Annotations: map[string]string{RetiredAnnotation: "true"},
+		},
+	}
+	logger.Infof("retiring adopted pool %s", p.Name)
+	if _, err := context.RookClientset.CephV1alpha1().Pools(p.Namespace).Create(tombstone); err != nil && !errors.IsAlreadyExists(err) {
+		return fmt.Errorf("failed to create the tombstone of pool %s. %+v", p.Name, err)
+	}
+	return nil
+}
+
+// existingPoolSpec returns the spec of the existing pool as it is in ceph, or nil if the pool does not exist. The
+// erasure code settings and placement of the CRD are kept if the pool has the same erasure code profile or the same
+// data and coding chunks since they are not known from the pool.
+func existingPoolSpec(context *clusterd.Context, p *cephv1alpha1.Pool) (*cephv1alpha1.PoolSpec, error) {
+	pools, err := ceph.GetPools(context, p.Namespace)
+	if err != nil {
+		return nil, err
+	}
+	for _, pool := range pools {
+		if pool.Name != p.Name {
+			continue
+		}
+		spec := ModelToSpec(pool)
+		ec := p.Spec.ErasureCode()
+		sameProfile := ec != nil && ec.Profile != "" && ec.Profile == pool.ErasureCodedConfig.ProfileName
+		sameChunks := ec != nil && spec.ErasureCoded.DataChunks == ec.DataChunks && spec.ErasureCoded.CodingChunks == ec.CodingChunks
+		if spec.ErasureCode() != nil && (sameProfile || sameChunks) {
+			spec.ErasureCoded = p.Spec.ErasureCoded
+			spec.FailureDomain = p.Spec.FailureDomain
+			spec.CrushRoot = p.Spec.CrushRoot
+			spec.DeviceClass = p.Spec.DeviceClass
+		}
+		return &spec, nil
+	}
+	return nil, nil
+}
+
+// adoptPools creates pool CRDs with the adopt annotation for the existing pools of the cluster that are not backed by
+// a CRD, so that the pool controller takes them over. The pools of file systems and object stores are not adopted, and
+// neither are the retired pools since their tombstone CRDs are kept.
+func adoptPools(context *clusterd.Context, namespace string, excluded []string) ([]string, error) {
+	crds, err := context.RookClientset.CephV1alpha1().Pools(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pools. %+v", err)
+	}
+	managed := map[string]bool{}
+	for _, p := range crds.Items {
+		managed[p.Name] = true
+	}
+
+	pools, err := ceph.GetPools(context, namespace)
+	if err != nil {
+		return nil, err
+	}
+	applications, err := ceph.GetPoolApplications(context, namespace)
+	if err != nil {
+		return nil, err
+	}
+
+	var adopted []string
+	for _, pool := range pools {
+		if managed[pool.Name] || contains(excluded, pool.Name) || adoptionExcludedApplication(applications[pool.Name]) {
+			continue
+		}
+		if errs := validation.IsDNS1123Subdomain(pool.Name); len(errs) > 0 {
+			logger.Warningf("not adopting pool %s since its name is not a valid CRD name. %v", pool.Name, errs)
+			continue
+		}
+
+		p := &cephv1alpha1.Pool{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        pool.Name,
+				Namespace:   namespace,
+				Annotations: map[string]string{AdoptAnnotation: "true"},
+			},
+			Spec: ModelToSpec(pool),
+		}
+		if pool.Type == model.ErasureCoded {
+			// the failure domain and crush root of an erasure coded pool are only known from its profile
+			p.Spec = cephv1alpha1.PoolSpec{ErasureCoded: cephv1alpha1.ErasureCodedSpec{Profile: pool.ErasureCodedConfig.ProfileName}}
+		}
+		if apps := applications[pool.Name]; len(apps) == 1 {
+			p.Spec.Application = apps[0]
+		}
+		logger.Infof("adopting pool %s", pool.Name)
+		if _, err := context.RookClientset.CephV1alpha1().Pools(namespace).Create(p); err != nil {
+			if !errors.IsAlreadyExists(err) {
+				logger.Warningf("failed to create the CRD of pool %s. %+v", pool.Name, err)
+			}
+			continue
+		}
+		adopted = append(adopted, pool.Name)
+	}
+	return adopted, nil
+}
+
+func adoptionExcludedApplication(applications []string) bool {
+	for _, app := range applications {
+		if contains(unadoptedApplications, app) {
+			return true
+		}
+	}
+	return false
+}
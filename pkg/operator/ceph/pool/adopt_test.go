@@ -0,0 +1,176 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pool
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	rookfake "github.com/rook/rook/pkg/client/clientset/versioned/fake"
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	testclient "k8s.io/client-go/testing"
+)
+
+func adoptionExecutor(commands *[]string) *exectest.MockExecutor {
+	return &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outputFile string, args ...string) (string, error) {
+			switch {
+			case args[0] == "osd" && args[1] == "lspools":
+				return `[{"poolnum":1,"poolname":"rbd"},{"poolnum":2,"poolname":"myfs-data0"},` +
+					`{"poolnum":3,"poolname":"managed"},{"poolnum":4,"poolname":"excluded"},{"poolnum":5,"poolname":"Bad_Name"},` +
+					`{"poolnum":6,"poolname":"ecpool"}]`, nil
+			case args[0] == "osd" && args[1] == "pool" && args[2] == "get" && args[3] == "ecpool":
+				return `{"pool":"ecpool","pool_id":6,"size":3,"erasure_code_profile":"myprofile"}{"pool":"ecpool","pg_num":64}`, nil
+			case args[0] == "osd" && args[1] == "pool" && args[2] == "get" && args[4] == "all":
+				return fmt.Sprintf(`{"pool":"%s","pool_id":1,"size":2}{"pool":"%s","pg_num":64}`, args[3], args[3]), nil
+			case args[0] == "osd" && args[1] == "pool" && args[2] == "get":
+				return fmt.Sprintf(`{"pool":"%s","pool_id":1,"size":2}`, args[3]), nil
+			case args[0] == "osd" && args[1] == "pool" && args[2] == "ls":
+				return `[{"pool_name":"rbd","application_metadata":{"rbd":{}}},` +
+					`{"pool_name":"myfs-data0","application_metadata":{"cephfs":{"data":"myfs"}}}]`, nil
+			case args[0] == "osd" && args[1] == "erasure-code-profile" && args[2] == "ls":
+				return `["default","myprofile"]`, nil
+			case args[0] == "osd" && args[1] == "erasure-code-profile" && args[2] == "get":
+				return `{"k":"2","m":"1","plugin":"jerasure","technique":"reed_sol_van","crush-failure-domain":"osd","crush-root":"default"}`, nil
+			}
+			if commands != nil {
+				*commands = append(*commands, strings.Join(args, " "))
+			}
+			return "", nil
+		},
+	}
+}
+
+func TestAdoptPools(t *testing.T) {
+	managed := &cephv1alpha1.Pool{ObjectMeta: metav1.ObjectMeta{Name: "managed", Namespace: "myns"}}
+	context := &clusterd.Context{
+		Executor:      adoptionExecutor(nil),
+		RookClientset: rookfake.NewSimpleClientset(managed),
+	}
+
+	// the pools with a CRD, the excluded pools and the pools of file systems are not adopted
+	adopted, err := adoptPools(context, "myns", []string{"excluded"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"rbd", "ecpool"}, adopted)
+
+	p, err := context.RookClientset.CephV1alpha1().Pools("myns").Get("rbd", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "true", p.Annotations[AdoptAnnotation])
+	assert.Equal(t, uint(2), p.Spec.Replicated.Size)
+	assert.Equal(t, "rbd", p.Spec.Application)
+	assert.Equal(t, cephv1alpha1.DeletionPolicy(""), p.Spec.DeletionPolicy)
+
+	// an erasure coded pool is adopted with its existing profile, which sets its chunks and placement
+	p, err = context.RookClientset.CephV1alpha1().Pools("myns").Get("ecpool", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, cephv1alpha1.ErasureCodedSpec{Profile: "myprofile"}, p.Spec.ErasureCoded)
+	assert.Equal(t, "", p.Spec.FailureDomain)
+	assert.Equal(t, "", p.Spec.CrushRoot)
+	assert.Nil(t, ValidatePool(context, p))
+
+	// the pools are only adopted once
+	adopted, err = adoptPools(context, "myns", []string{"excluded"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(adopted))
+}
+
+func TestCreateAdoptedPool(t *testing.T) {
+	var commands []string
+	context := &clusterd.Context{
+		Executor:      adoptionExecutor(&commands),
+		RookClientset: rookfake.NewSimpleClientset(),
+	}
+	p := &cephv1alpha1.Pool{
+		ObjectMeta: metav1.ObjectMeta{Name: "rbd", Namespace: "myns", Annotations: map[string]string{AdoptAnnotation: "true"}},
+		Spec:       cephv1alpha1.PoolSpec{Replicated: cephv1alpha1.ReplicatedSpec{Size: 3}},
+	}
+
+	// the existing pool is updated rather than created
+	err := createPool(context, p)
+	assert.Nil(t, err)
+	resized := false
+	for _, command := range commands {
+		assert.False(t, strings.HasPrefix(command, "osd pool create"), command)
+		resized = resized || strings.HasPrefix(command, "osd pool set rbd size 3")
+	}
+	assert.True(t, resized)
+}
+
+func TestCreateAdoptedErasureCodedPool(t *testing.T) {
+	var commands []string
+	context := &clusterd.Context{
+		Executor:      adoptionExecutor(&commands),
+		RookClientset: rookfake.NewSimpleClientset(),
+	}
+	p := &cephv1alpha1.Pool{
+		ObjectMeta: metav1.ObjectMeta{Name: "ecpool", Namespace: "myns", Annotations: map[string]string{AdoptAnnotation: "true"}},
+		Spec:       cephv1alpha1.PoolSpec{ErasureCoded: cephv1alpha1.ErasureCodedSpec{Profile: "myprofile"}},
+	}
+
+	// the existing profile of the pool is accepted and neither the pool nor a profile is created
+	err := createPool(context, p)
+	assert.Nil(t, err)
+	for _, command := range commands {
+		assert.False(t, strings.HasPrefix(command, "osd pool create"), command)
+		assert.False(t, strings.HasPrefix(command, "osd erasure-code-profile set"), command)
+	}
+
+	// the profile of the pool cannot be changed
+	p.Spec.ErasureCoded.Profile = "default"
+	err = createPool(context, p)
+	assert.NotNil(t, err)
+}
+
+func TestRetireAdoptedPool(t *testing.T) {
+	now := metav1.Now()
+	p := &cephv1alpha1.Pool{
+		ObjectMeta: metav1.ObjectMeta{Name: "rbd", Namespace: "myns", Finalizers: []string{poolFinalizer},
+			Annotations: map[string]string{AdoptAnnotation: "true"}, DeletionTimestamp: &now},
+		Spec: cephv1alpha1.PoolSpec{Replicated: cephv1alpha1.ReplicatedSpec{Size: 2}},
+	}
+	cluster := &cephv1alpha1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "mycluster", Namespace: "myns"}}
+	rookClientset := rookfake.NewSimpleClientset(p, cluster)
+	// the api server deletes the CRD when its last finalizer is removed
+	rookClientset.PrependReactor("update", "pools", func(action testclient.Action) (bool, runtime.Object, error) {
+		updated := action.(testclient.UpdateAction).GetObject().(*cephv1alpha1.Pool)
+		if updated.DeletionTimestamp == nil || len(updated.Finalizers) > 0 {
+			return false, nil, nil
+		}
+		err := rookClientset.CephV1alpha1().Pools(updated.Namespace).Delete(updated.Name, &metav1.DeleteOptions{})
+		return true, updated, err
+	})
+	context := &clusterd.Context{Executor: adoptionExecutor(nil), RookClientset: rookClientset}
+
+	// the retained pool is replaced by a tombstone
+	err := finalizePool(context, p)
+	assert.Nil(t, err)
+	tombstone, err := rookClientset.CephV1alpha1().Pools("myns").Get("rbd", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.True(t, isRetired(tombstone))
+	assert.False(t, isAdopted(tombstone))
+	assert.Equal(t, 0, len(tombstone.Finalizers))
+
+	// the retired pool is not adopted again
+	adopted, err := adoptPools(context, "myns", []string{"excluded"})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ecpool"}, adopted)
+}
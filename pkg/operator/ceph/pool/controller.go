@@ -20,6 +20,7 @@ package pool
 import (
 	"fmt"
 	"reflect"
+	"strings"
 
 	"github.com/coreos/pkg/capnslog"
 	opkit "github.com/rook/operator-kit"
@@ -110,9 +111,31 @@ func (c *PoolController) onAdd(obj interface{}) {
 		return
 	}
 
+	if pool.DeletionTimestamp != nil {
+		if err := finalizePool(c.context, pool); err != nil {
+			logger.Errorf("failed to delete pool %s. %+v", pool.Name, err)
+		}
+		return
+	}
+	if isRetired(pool) {
+		logger.Infof("ignoring retired pool %s", pool.Name)
+		return
+	}
+
 	err = createPool(c.context, pool)
 	if err != nil {
 		logger.Errorf("failed to create pool %s. %+v", pool.ObjectMeta.Name, err)
+		// the settings of an adopted pool may not be applicable to the existing pool
+		if r, ok := err.(*rejectedUpdateError); ok {
+			if err := setRejectedUpdate(c.context, pool, r.reason); err != nil {
+				logger.Warningf("failed to report the rejected update of pool %s. %+v", pool.Name, err)
+			}
+		}
+	}
+
+	// the finalizer applies the deletion policy of the pool when its CRD is deleted
+	if err := addPoolFinalizer(c.context, pool); err != nil {
+		logger.Warningf("failed to add finalizer to pool %s. %+v", pool.Name, err)
 	}
 }
 
@@ -135,12 +158,19 @@ func (c *PoolController) onUpdate(oldObj, newObj interface{}) {
 		return
 	}
 
-	if oldPool.Name != pool.Name {
-		logger.Errorf("failed to update pool %s. name update not allowed", pool.Name)
+	if pool.DeletionTimestamp != nil {
+		if err := finalizePool(c.context, pool); err != nil {
+			logger.Errorf("failed to delete pool %s. %+v", pool.Name, err)
+		}
 		return
 	}
-	if pool.Spec.ErasureCoded.CodingChunks != 0 && pool.Spec.ErasureCoded.DataChunks != 0 {
-		logger.Errorf("failed to update pool %s. erasurecoded update not allowed", pool.Name)
+
+	if isRetired(pool) {
+		logger.Debugf("ignoring retired pool %s", pool.Name)
+		return
+	}
+	if oldPool.Name != pool.Name {
+		logger.Errorf("failed to update pool %s. name update not allowed", pool.Name)
 		return
 	}
 	if !poolChanged(oldPool.Spec, pool.Spec) {
@@ -148,10 +178,16 @@ func (c *PoolController) onUpdate(oldObj, newObj interface{}) {
 		return
 	}
 
-	// if the pool is modified, allow the pool to be created if it wasn't already
 	logger.Infof("updating pool %s", pool.Name)
-	if err := createPool(c.context, pool); err != nil {
-		logger.Errorf("failed to create (modify) pool %s. %+v", pool.ObjectMeta.Name, err)
+	rejected := ""
+	if err := updatePool(c.context, &oldPool.Spec, pool); err != nil {
+		logger.Errorf("failed to update pool %s. %+v", pool.ObjectMeta.Name, err)
+		if r, ok := err.(*rejectedUpdateError); ok {
+			rejected = r.reason
+		}
+	}
+	if err := setRejectedUpdate(c.context, pool, rejected); err != nil {
+		logger.Warningf("failed to report the rejected update of pool %s. %+v", pool.Name, err)
 	}
 }
 
@@ -160,6 +196,30 @@ func poolChanged(old, new cephv1alpha1.PoolSpec) bool {
 		logger.Infof("pool replication changed from %d to %d", old.Replicated.Size, new.Replicated.Size)
 		return true
 	}
+	if placementChanged(&old, &new) {
+		logger.Infof("pool placement changed")
+		return true
+	}
+	if old.ErasureCoded != new.ErasureCoded {
+		logger.Infof("pool erasure code settings changed")
+		return true
+	}
+	if old.PgNum != new.PgNum || old.TargetSizePercent != new.TargetSizePercent || old.TargetSizeBytes != new.TargetSizeBytes {
+		logger.Infof("pool placement group settings changed")
+		return true
+	}
+	if old.MinSize != new.MinSize || old.Application != new.Application || old.Quotas != new.Quotas || old.Compression != new.Compression {
+		logger.Infof("pool settings changed")
+		return true
+	}
+	if !reflect.DeepEqual(old.Mirroring, new.Mirroring) {
+		logger.Infof("pool mirroring changed")
+		return true
+	}
+	if old.Tier != new.Tier {
+		logger.Infof("pool cache tier changed")
+		return true
+	}
 	return false
 }
 
@@ -175,8 +235,15 @@ func (c *PoolController) onDelete(obj interface{}) {
 		return
 	}
 
-	if err := deletePool(c.context, pool); err != nil {
+	// the pool was already finalized unless its CRD was deleted before the finalizer was added
+	if pool.DeletionTimestamp != nil || isRetired(pool) {
+		return
+	}
+	users, err := deletePoolOnRemoval(c.context, pool)
+	if err != nil {
 		logger.Errorf("failed to delete pool %s. %+v", pool.ObjectMeta.Name, err)
+	} else if len(users) > 0 {
+		logger.Warningf("retaining pool %s since it is used by %s", pool.Name, strings.Join(users, ", "))
 	}
 }
 
@@ -187,12 +254,62 @@ func createPool(context *clusterd.Context, p *cephv1alpha1.Pool) error {
 		return fmt.Errorf("invalid pool %s arguments. %+v", p.Name, err)
 	}
 
+	if isAdopted(p) {
+		existing, err := existingPoolSpec(context, p)
+		if err != nil {
+			return fmt.Errorf("failed to get the existing pool %s. %+v", p.Name, err)
+		}
+		if existing != nil {
+			// take over the existing pool by applying the changes from its current settings
+			logger.Infof("adopting existing pool %s in namespace %s", p.Name, p.Namespace)
+			return updatePool(context, existing, p)
+		}
+	}
+
+	poolModel := p.Spec.ToModel(p.Name)
+	if poolModel.PgNum == 0 && (p.Spec.TargetSizePercent > 0 || p.Spec.TargetSizeBytes > 0) {
+		// create the pool with the placement groups for its target size rather than the default count
+		pgs, err := recommendedPGs(context, p.Namespace, &p.Spec)
+		if err != nil {
+			logger.Warningf("failed to compute the placement groups of pool %s. %+v", p.Name, err)
+		} else {
+			poolModel.PgNum = pgs
+		}
+	}
+
+	// tag the pool with its name if no application is set
+	appName := p.Spec.Application
+	if appName == "" {
+		appName = p.Name
+	}
+
 	// create the pool
 	logger.Infof("creating pool %s in namespace %s", p.Name, p.Namespace)
-	if err := ceph.CreatePoolWithProfile(context, p.Namespace, *p.Spec.ToModel(p.Name), p.Name); err != nil {
+	if err := ceph.CreatePoolWithProfile(context, p.Namespace, *poolModel, appName); err != nil {
 		return fmt.Errorf("failed to create pool %s. %+v", p.Name, err)
 	}
 
+	if _, err := applyPoolSettings(context, p); err != nil {
+		return fmt.Errorf("failed to apply the settings of pool %s. %+v", p.Name, err)
+	}
+
+	// the placement groups of an existing pool are increased toward the settings
+	if err := adjustPGs(context, p); err != nil {
+		logger.Warningf("failed to adjust the placement groups of pool %s. %+v", p.Name, err)
+	}
+
+	if p.Spec.Mirroring.Mode != "" {
+		if err := reconcileMirroring(context, p); err != nil {
+			return fmt.Errorf("failed to configure the mirroring of pool %s. %+v", p.Name, err)
+		}
+	}
+
+	if p.Spec.Tier.CachePool != "" {
+		if err := reconcileTier(context, p.Namespace, p.Name, &p.Spec.Tier); err != nil {
+			return fmt.Errorf("failed to configure the cache tier of pool %s. %+v", p.Name, err)
+		}
+	}
+
 	logger.Infof("created pool %s", p.Name)
 	return nil
 }
@@ -200,10 +317,24 @@ func createPool(context *clusterd.Context, p *cephv1alpha1.Pool) error {
 // Delete the pool
 func deletePool(context *clusterd.Context, p *cephv1alpha1.Pool) error {
 
+	// ceph does not delete a pool with cache tiers, the cache is flushed and removed first
+	if p.Spec.Tier.CachePool != "" {
+		if err := reconcileTier(context, p.Namespace, p.Name, &cephv1alpha1.TierSpec{}); err != nil {
+			return fmt.Errorf("failed to remove the cache tier of pool %s. %+v", p.Name, err)
+		}
+	}
+
 	if err := ceph.DeletePool(context, p.Namespace, p.Name); err != nil {
 		return fmt.Errorf("failed to delete pool '%s'. %+v", p.Name, err)
 	}
 
+	// the peers that are no longer used by any pool are removed from the rbd-mirror daemons
+	if p.Spec.Mirroring.Mode != "" {
+		if _, err := syncMirroringPeers(context, p.Namespace); err != nil {
+			logger.Warningf("failed to remove the mirroring peers of pool %s. %+v", p.Name, err)
+		}
+	}
+
 	return nil
 }
 
@@ -226,6 +357,7 @@ func ModelToSpec(pool model.Pool) cephv1alpha1.PoolSpec {
 	return cephv1alpha1.PoolSpec{
 		FailureDomain: pool.FailureDomain,
 		CrushRoot:     pool.CrushRoot,
+		DeviceClass:   pool.DeviceClass,
 		Replicated:    cephv1alpha1.ReplicatedSpec{Size: pool.ReplicatedConfig.Size},
 		ErasureCoded:  cephv1alpha1.ErasureCodedSpec{CodingChunks: ec.CodingChunkCount, DataChunks: ec.DataChunkCount, Algorithm: ec.Algorithm},
 	}
@@ -242,6 +374,15 @@ func ValidatePool(context *clusterd.Context, p *cephv1alpha1.Pool) error {
 	if err := ValidatePoolSpec(context, p.Namespace, &p.Spec); err != nil {
 		return err
 	}
+	if err := validateMirroring(&p.Spec); err != nil {
+		return err
+	}
+	if err := validateTier(&p.Spec, p.Name); err != nil {
+		return err
+	}
+	if err := ValidateDeletionPolicy(p.Spec.DeletionPolicy); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -252,6 +393,12 @@ func ValidatePoolSpec(context *clusterd.Context, namespace string, p *cephv1alph
 	if p.Replication() == nil && p.ErasureCode() == nil {
 		return fmt.Errorf("neither replication nor erasure code settings were specified")
 	}
+	if err := validatePoolSettings(p); err != nil {
+		return err
+	}
+	if err := validateErasureCodeProfileRef(context, namespace, p); err != nil {
+		return err
+	}
 
 	var crush ceph.CrushMap
 	var err error
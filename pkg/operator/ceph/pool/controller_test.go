@@ -141,17 +141,30 @@ func TestCreatePool(t *testing.T) {
 }
 
 func TestUpdatePool(t *testing.T) {
-	// the pool did not change for properties that are updatable
+	// the pool did not change
 	old := cephv1alpha1.PoolSpec{FailureDomain: "osd", ErasureCoded: cephv1alpha1.ErasureCodedSpec{CodingChunks: 2, DataChunks: 2}}
-	new := cephv1alpha1.PoolSpec{FailureDomain: "host", ErasureCoded: cephv1alpha1.ErasureCodedSpec{CodingChunks: 3, DataChunks: 3}}
+	new := old
 	changed := poolChanged(old, new)
 	assert.False(t, changed)
 
+	// the pool changed for the ec settings and failure domain, which are rejected when the pool is updated
+	new = cephv1alpha1.PoolSpec{FailureDomain: "host", ErasureCoded: cephv1alpha1.ErasureCodedSpec{CodingChunks: 3, DataChunks: 3}}
+	changed = poolChanged(old, new)
+	assert.True(t, changed)
+
 	// the pool changed for properties that are updatable
 	old = cephv1alpha1.PoolSpec{FailureDomain: "osd", Replicated: cephv1alpha1.ReplicatedSpec{Size: 1}}
 	new = cephv1alpha1.PoolSpec{FailureDomain: "osd", Replicated: cephv1alpha1.ReplicatedSpec{Size: 2}}
 	changed = poolChanged(old, new)
 	assert.True(t, changed)
+
+	// the pool changed for the quota and compression settings
+	new = cephv1alpha1.PoolSpec{FailureDomain: "osd", Replicated: cephv1alpha1.ReplicatedSpec{Size: 1}, Quotas: cephv1alpha1.QuotaSpec{MaxBytes: 1024}}
+	changed = poolChanged(old, new)
+	assert.True(t, changed)
+	new = cephv1alpha1.PoolSpec{FailureDomain: "osd", Replicated: cephv1alpha1.ReplicatedSpec{Size: 1}, Compression: cephv1alpha1.CompressionSpec{Mode: "force"}}
+	changed = poolChanged(old, new)
+	assert.True(t, changed)
 }
 
 func TestDeletePool(t *testing.T) {
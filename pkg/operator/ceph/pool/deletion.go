@@ -0,0 +1,201 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pool
+
+import (
+	"fmt"
+	"strings"
+
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	poolFinalizer = "pool.ceph.rook.io"
+
+	// VolumeFilesystemKey is the flex volume option of the file system a persistent volume mounts
+	VolumeFilesystemKey = "fsName"
+	volumePoolKey       = "pool"
+	// the volumes of storage classes created before the cluster namespace parameter reference the cluster by name
+	volumeClusterNamespaceKey = "clusterNamespace"
+	volumeClusterNameKey      = "clusterName"
+	volumeDriverVendorSuffix  = "rook.io"
+)
+
+// ValidateDeletionPolicy validates the deletion policy of a pool, file system or object store
+func ValidateDeletionPolicy(policy cephv1alpha1.DeletionPolicy) error {
+	if policy != "" && policy != cephv1alpha1.DeletionPolicyRetain && policy != cephv1alpha1.DeletionPolicyDelete {
+		return fmt.Errorf("unrecognized deletion policy %s", policy)
+	}
+	return nil
+}
+
+// DeleteOnRemoval returns whether the ceph resources are deleted with their CRD. They are retained by default.
+func DeleteOnRemoval(policy cephv1alpha1.DeletionPolicy) bool {
+	return policy == cephv1alpha1.DeletionPolicyDelete
+}
+
+// ClusterDeleted returns whether the cluster in the namespace is deleted, in which case the ceph resources are removed
+// with the cluster rather than with their CRDs
+func ClusterDeleted(context *clusterd.Context, namespace string) bool {
+	return !clusterExists(context, namespace)
+}
+
+// VolumesUsing returns the persistent volumes of the rook flex driver in the cluster whose option is set to the value
+func VolumesUsing(context *clusterd.Context, namespace, option, value string) ([]string, error) {
+	pvs, err := context.Clientset.CoreV1().PersistentVolumes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list persistent volumes. %+v", err)
+	}
+	var volumes []string
+	for _, pv := range pvs.Items {
+		flex := pv.Spec.FlexVolume
+		if flex == nil || flex.Options[option] != value {
+			continue
+		}
+		if vendor := strings.SplitN(flex.Driver, "/", 2)[0]; !strings.HasSuffix(vendor, volumeDriverVendorSuffix) {
+			continue
+		}
+		clusterNamespace := flex.Options[volumeClusterNamespaceKey]
+		if clusterNamespace == "" {
+			clusterNamespace = flex.Options[volumeClusterNameKey]
+		}
+		if clusterNamespace == namespace {
+			volumes = append(volumes, pv.Name)
+		}
+	}
+	return volumes, nil
+}
+
+// poolUsers returns the rbd images in the pool and the persistent volumes that reference it
+func poolUsers(context *clusterd.Context, namespace, poolName string) ([]string, error) {
+	images, err := ceph.ListImages(context, namespace, poolName)
+	if err != nil {
+		return nil, err
+	}
+	volumes, err := VolumesUsing(context, namespace, volumePoolKey, poolName)
+	if err != nil {
+		return nil, err
+	}
+
+	var users []string
+	for _, image := range images {
+		users = append(users, fmt.Sprintf("image %s", image.Name))
+	}
+	for _, volume := range volumes {
+		users = append(users, fmt.Sprintf("persistent volume %s", volume))
+	}
+	return users, nil
+}
+
+// deletePoolOnRemoval deletes the ceph pool of a deleted pool CRD if its deletion policy is Delete, unless rbd images
+// or persistent volumes still use the pool. It returns the users that prevent the deletion.
+func deletePoolOnRemoval(context *clusterd.Context, p *cephv1alpha1.Pool) ([]string, error) {
+	if !DeleteOnRemoval(p.Spec.DeletionPolicy) {
+		logger.Infof("retaining ceph pool %s after the deletion of its CRD", p.Name)
+		return nil, nil
+	}
+	exists, err := poolExists(context, p)
+	if err != nil || !exists {
+		return nil, err
+	}
+	users, err := poolUsers(context, p.Namespace, p.Name)
+	if err != nil || len(users) > 0 {
+		return users, err
+	}
+	return nil, deletePool(context, p)
+}
+
+// finalizePool deletes the ceph pool according to the deletion policy and removes the finalizer from the pool CRD. The
+// finalizer is kept while the pool is in use and the deletion is retried by the pool monitor. A retained adopted pool
+// is retired with a tombstone CRD.
+func finalizePool(context *clusterd.Context, p *cephv1alpha1.Pool) error {
+	if ClusterDeleted(context, p.Namespace) {
+		// the pool is deleted with its cluster
+		return removePoolFinalizer(context, p)
+	}
+	users, err := deletePoolOnRemoval(context, p)
+	if err != nil {
+		return err
+	}
+	if len(users) > 0 {
+		message := fmt.Sprintf("pool %s cannot be deleted while it is used by %s", p.Name, strings.Join(users, ", "))
+		if p.Status != nil && p.Status.Message == message {
+			return nil
+		}
+		logger.Warning(message)
+		status := &cephv1alpha1.PoolStatus{}
+		if p.Status != nil {
+			*status = *p.Status
+		}
+		status.Message = message
+		return updatePoolStatus(context, p, status)
+	}
+	if err := removePoolFinalizer(context, p); err != nil {
+		return err
+	}
+	if isAdopted(p) && !DeleteOnRemoval(p.Spec.DeletionPolicy) {
+		return retirePool(context, p)
+	}
+	return nil
+}
+
+// poolCRDFinalizer returns the finalizer of the pool CRDs in the namespace
+func poolCRDFinalizer(context *clusterd.Context, namespace string) *k8sutil.CRDFinalizer {
+	client := context.RookClientset.CephV1alpha1().Pools(namespace)
+	return &k8sutil.CRDFinalizer{
+		Name: poolFinalizer,
+		Kind: "pool",
+		Get: func(name string) (metav1.Object, error) {
+			return client.Get(name, metav1.GetOptions{})
+		},
+		List: func() ([]metav1.Object, error) {
+			pools, err := client.List(metav1.ListOptions{})
+			if err != nil {
+				return nil, err
+			}
+			var objs []metav1.Object
+			for i := range pools.Items {
+				objs = append(objs, &pools.Items[i])
+			}
+			return objs, nil
+		},
+		Update: func(obj metav1.Object) error {
+			_, err := client.Update(obj.(*cephv1alpha1.Pool))
+			return err
+		},
+	}
+}
+
+func addPoolFinalizer(context *clusterd.Context, p *cephv1alpha1.Pool) error {
+	return poolCRDFinalizer(context, p.Namespace).Add(p.Name)
+}
+
+func removePoolFinalizer(context *clusterd.Context, p *cephv1alpha1.Pool) error {
+	return poolCRDFinalizer(context, p.Namespace).Remove(p.Name)
+}
+
+// RemoveFinalizers removes the finalizers from the pool and erasure code profile CRDs of a deleted cluster so that
+// they do not block the deletion of the namespace after the operator stopped watching them
+func RemoveFinalizers(context *clusterd.Context, namespace string) error {
+	if err := poolCRDFinalizer(context, namespace).RemoveAll(); err != nil {
+		return err
+	}
+	return erasureCodeProfileCRDFinalizer(context, namespace).RemoveAll()
+}
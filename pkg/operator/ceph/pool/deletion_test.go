@@ -0,0 +1,150 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pool
+
+import (
+	"testing"
+
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	rookfake "github.com/rook/rook/pkg/client/clientset/versioned/fake"
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func flexVolume(name, driver string, options map[string]string) *v1.PersistentVolume {
+	return &v1.PersistentVolume{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: v1.PersistentVolumeSpec{
+			PersistentVolumeSource: v1.PersistentVolumeSource{
+				FlexVolume: &v1.FlexVolumeSource{Driver: driver, Options: options},
+			},
+		},
+	}
+}
+
+func TestValidateDeletionPolicy(t *testing.T) {
+	assert.Nil(t, ValidateDeletionPolicy(""))
+	assert.Nil(t, ValidateDeletionPolicy(cephv1alpha1.DeletionPolicyRetain))
+	assert.Nil(t, ValidateDeletionPolicy(cephv1alpha1.DeletionPolicyDelete))
+	assert.NotNil(t, ValidateDeletionPolicy("Orphan"))
+
+	assert.False(t, DeleteOnRemoval(""))
+	assert.False(t, DeleteOnRemoval(cephv1alpha1.DeletionPolicyRetain))
+	assert.True(t, DeleteOnRemoval(cephv1alpha1.DeletionPolicyDelete))
+}
+
+func TestVolumesUsing(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		flexVolume("pv1", "ceph.rook.io/rook-ceph-system", map[string]string{"pool": "mypool", "clusterNamespace": "myns"}),
+		flexVolume("pv2", "rook.io/rook", map[string]string{"fsName": "myfs", "clusterName": "myns"}),
+		flexVolume("pv3", "ceph.rook.io/rook-ceph-system", map[string]string{"pool": "mypool", "clusterNamespace": "otherns"}),
+		flexVolume("pv4", "example.com/nfs", map[string]string{"pool": "mypool", "clusterNamespace": "myns"}),
+		&v1.PersistentVolume{ObjectMeta: metav1.ObjectMeta{Name: "pv5"}},
+	)
+	context := &clusterd.Context{Clientset: clientset}
+
+	volumes, err := VolumesUsing(context, "myns", "pool", "mypool")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"pv1"}, volumes)
+
+	// the volumes of legacy storage classes reference the cluster by name
+	volumes, err = VolumesUsing(context, "myns", VolumeFilesystemKey, "myfs")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"pv2"}, volumes)
+
+	volumes, err = VolumesUsing(context, "myns", "pool", "otherpool")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(volumes))
+}
+
+func TestFinalizePool(t *testing.T) {
+	deleted := false
+	images := `[{"image":"myimage","size":1048576,"format":2}]`
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outputFile string, args ...string) (string, error) {
+			switch {
+			case args[0] == "osd" && args[1] == "lspools":
+				return `[{"poolnum":1,"poolname":"mypool"}]`, nil
+			case args[0] == "osd" && args[1] == "pool" && args[2] == "get":
+				return `{"pool":"mypool","pool_id":1,"size":1}`, nil
+			case args[0] == "osd" && args[1] == "pool" && args[2] == "delete":
+				deleted = true
+			}
+			return "", nil
+		},
+		MockExecuteCommandWithOutput: func(debug bool, actionName, command string, args ...string) (string, error) {
+			if command == "rbd" && args[0] == "ls" {
+				return images, nil
+			}
+			return "", nil
+		},
+	}
+	p := &cephv1alpha1.Pool{
+		ObjectMeta: metav1.ObjectMeta{Name: "mypool", Namespace: "myns", Finalizers: []string{poolFinalizer}},
+		Spec:       cephv1alpha1.PoolSpec{DeletionPolicy: cephv1alpha1.DeletionPolicyDelete},
+	}
+	cluster := &cephv1alpha1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "mycluster", Namespace: "myns"}}
+	context := &clusterd.Context{
+		Executor:      executor,
+		Clientset:     fake.NewSimpleClientset(),
+		RookClientset: rookfake.NewSimpleClientset(p, cluster),
+	}
+
+	// the pool is kept with the finalizer while it has images
+	err := finalizePool(context, p)
+	assert.Nil(t, err)
+	assert.False(t, deleted)
+	latest, _ := context.RookClientset.CephV1alpha1().Pools("myns").Get("mypool", metav1.GetOptions{})
+	assert.Equal(t, []string{poolFinalizer}, latest.Finalizers)
+	assert.Equal(t, "pool mypool cannot be deleted while it is used by image myimage", latest.Status.Message)
+
+	// the pool is deleted with the finalizer when the images are gone
+	images = `[]`
+	err = finalizePool(context, latest)
+	assert.Nil(t, err)
+	assert.True(t, deleted)
+	latest, _ = context.RookClientset.CephV1alpha1().Pools("myns").Get("mypool", metav1.GetOptions{})
+	assert.Equal(t, 0, len(latest.Finalizers))
+
+	// the pool is retained by default
+	deleted = false
+	p.Spec.DeletionPolicy = ""
+	latest.Finalizers = []string{poolFinalizer}
+	context.RookClientset.CephV1alpha1().Pools("myns").Update(latest)
+	err = finalizePool(context, p)
+	assert.Nil(t, err)
+	assert.False(t, deleted)
+	latest, _ = context.RookClientset.CephV1alpha1().Pools("myns").Get("mypool", metav1.GetOptions{})
+	assert.Equal(t, 0, len(latest.Finalizers))
+}
+
+func TestRemoveFinalizers(t *testing.T) {
+	p := &cephv1alpha1.Pool{ObjectMeta: metav1.ObjectMeta{Name: "mypool", Namespace: "myns", Finalizers: []string{poolFinalizer}}}
+	profile := &cephv1alpha1.ErasureCodeProfile{ObjectMeta: metav1.ObjectMeta{Name: "myprofile", Namespace: "myns",
+		Finalizers: []string{ecProfileFinalizer}}}
+	context := &clusterd.Context{RookClientset: rookfake.NewSimpleClientset(p, profile)}
+
+	err := RemoveFinalizers(context, "myns")
+	assert.Nil(t, err)
+	latest, _ := context.RookClientset.CephV1alpha1().Pools("myns").Get("mypool", metav1.GetOptions{})
+	assert.Equal(t, 0, len(latest.Finalizers))
+	latestProfile, _ := context.RookClientset.CephV1alpha1().ErasureCodeProfiles("myns").Get("myprofile", metav1.GetOptions{})
+	assert.Equal(t, 0, len(latestProfile.Finalizers))
+}
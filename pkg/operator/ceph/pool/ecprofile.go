@@ -0,0 +1,399 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pool
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	opkit "github.com/rook/operator-kit"
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const (
+	ecProfileResourceName       = "erasurecodeprofile"
+	ecProfileResourceNamePlural = "erasurecodeprofiles"
+	ecProfileFinalizer          = "erasurecodeprofile.ceph.rook.io"
+)
+
+var (
+	ecPlugins = []string{"jerasure", "isa", "lrc", "shec"}
+	// the profile keys that are set from the fields of the spec rather than the plugin parameters
+	ecProfileKeys = []string{"k", "m", "plugin", "technique", "crush-failure-domain", "crush-root", "crush-device-class", "stripe_unit"}
+)
+
+// ErasureCodeProfileResource represents the ErasureCodeProfile custom resource object
+var ErasureCodeProfileResource = opkit.CustomResource{
+	Name:    ecProfileResourceName,
+	Plural:  ecProfileResourceNamePlural,
+	Group:   cephv1alpha1.CustomResourceGroup,
+	Version: cephv1alpha1.Version,
+	Scope:   apiextensionsv1beta1.NamespaceScoped,
+	Kind:    reflect.TypeOf(cephv1alpha1.ErasureCodeProfile{}).Name(),
+}
+
+// ErasureCodeProfileController represents a controller object for erasure code profile custom resources
+type ErasureCodeProfileController struct {
+	context *clusterd.Context
+}
+
+// NewErasureCodeProfileController creates a controller for watching erasure code profile custom resources
+func NewErasureCodeProfileController(context *clusterd.Context) *ErasureCodeProfileController {
+	return &ErasureCodeProfileController{context: context}
+}
+
+// StartWatch watches for instances of ErasureCodeProfile custom resources and acts on them
+func (c *ErasureCodeProfileController) StartWatch(namespace string, stopCh chan struct{}) error {
+	resourceHandlerFuncs := cache.ResourceEventHandlerFuncs{
+		AddFunc:    c.onAdd,
+		UpdateFunc: c.onUpdate,
+	}
+
+	logger.Infof("start watching erasure code profile resources in namespace %s", namespace)
+	watcher := opkit.NewWatcher(ErasureCodeProfileResource, namespace, resourceHandlerFuncs, c.context.RookClientset.CephV1alpha1().RESTClient())
+	go watcher.Watch(&cephv1alpha1.ErasureCodeProfile{}, stopCh)
+	return nil
+}
+
+func (c *ErasureCodeProfileController) onAdd(obj interface{}) {
+	profile := obj.(*cephv1alpha1.ErasureCodeProfile).DeepCopy()
+	if profile.DeletionTimestamp != nil {
+		c.onUpdate(obj, obj)
+		return
+	}
+
+	// the finalizer is added before the profile is created, so that a profile created in ceph is always deleted with its CRD
+	if err := erasureCodeProfileCRDFinalizer(c.context, profile.Namespace).Add(profile.Name); err != nil {
+		logger.Errorf("failed to create erasure code profile %s. %+v", profile.Name, err)
+		return
+	}
+
+	message := ""
+	if err := setErasureCodeProfile(c.context, profile); err != nil {
+		logger.Errorf("failed to create erasure code profile %s. %+v", profile.Name, err)
+		message = err.Error()
+	}
+	if err := updateErasureCodeProfileStatus(c.context, profile, message); err != nil {
+		logger.Warningf("failed to update erasure code profile %s. %+v", profile.Name, err)
+	}
+}
+
+func (c *ErasureCodeProfileController) onUpdate(oldObj, newObj interface{}) {
+	old := oldObj.(*cephv1alpha1.ErasureCodeProfile)
+	profile := newObj.(*cephv1alpha1.ErasureCodeProfile).DeepCopy()
+
+	if profile.DeletionTimestamp != nil {
+		if err := finalizeErasureCodeProfile(c.context, profile); err != nil {
+			logger.Errorf("failed to delete erasure code profile %s. %+v", profile.Name, err)
+		}
+		return
+	}
+	if reflect.DeepEqual(old.Spec, profile.Spec) {
+		return
+	}
+
+	logger.Infof("updating erasure code profile %s", profile.Name)
+	message := ""
+	if err := setErasureCodeProfile(c.context, profile); err != nil {
+		logger.Errorf("failed to update erasure code profile %s. %+v", profile.Name, err)
+		message = err.Error()
+	}
+	if err := updateErasureCodeProfileStatus(c.context, profile, message); err != nil {
+		logger.Warningf("failed to update erasure code profile %s. %+v", profile.Name, err)
+	}
+}
+
+// setErasureCodeProfile creates the erasure code profile, or changes the existing profile if no pools use it
+func setErasureCodeProfile(context *clusterd.Context, p *cephv1alpha1.ErasureCodeProfile) error {
+	if err := validateErasureCodeProfile(&p.Spec); err != nil {
+		return fmt.Errorf("invalid erasure code profile %s. %+v", p.Name, err)
+	}
+	pairs, err := erasureCodeProfilePairs(context, p.Namespace, &p.Spec)
+	if err != nil {
+		return err
+	}
+
+	exists, err := erasureCodeProfileExists(context, p.Namespace, p.Name)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		logger.Infof("creating erasure code profile %s with %v", p.Name, pairs)
+		return ceph.SetErasureCodeProfile(context, p.Namespace, p.Name, pairs, false)
+	}
+
+	current, err := ceph.GetErasureCodeProfile(context, p.Namespace, p.Name)
+	if err != nil {
+		return err
+	}
+	if profileMatches(current, pairs) {
+		return nil
+	}
+	pools, err := erasureCodeProfilePools(context, p.Namespace, p.Name)
+	if err != nil {
+		return err
+	}
+	if len(pools) > 0 {
+		return fmt.Errorf("erasure code profile %s cannot be changed while it is used by pools %v", p.Name, pools)
+	}
+	logger.Infof("changing erasure code profile %s to %v", p.Name, pairs)
+	return ceph.SetErasureCodeProfile(context, p.Namespace, p.Name, pairs, true)
+}
+
+// validateErasureCodeProfile validates the chunks, the plugin and the plugin parameters of the profile
+func validateErasureCodeProfile(spec *cephv1alpha1.ErasureCodeProfileSpec) error {
+	if spec.DataChunks < 2 {
+		return fmt.Errorf("at least 2 data chunks are required")
+	}
+	if spec.CodingChunks < 1 {
+		return fmt.Errorf("at least 1 coding chunk is required")
+	}
+	if spec.Plugin != "" && !contains(ecPlugins, spec.Plugin) {
+		return fmt.Errorf("unrecognized erasure code plugin %s", spec.Plugin)
+	}
+	for key := range spec.Parameters {
+		if contains(ecProfileKeys, key) {
+			return fmt.Errorf("parameter %s must be set with the settings of the profile", key)
+		}
+	}
+	if spec.Plugin == "lrc" {
+		l, ok := spec.Parameters["l"]
+		if !ok {
+			return fmt.Errorf("the lrc plugin requires the locality parameter l")
+		}
+		var locality uint
+		if _, err := fmt.Sscanf(l, "%d", &locality); err != nil || locality == 0 || (spec.DataChunks+spec.CodingChunks)%locality != 0 {
+			return fmt.Errorf("the locality %s must divide the %d data and coding chunks", l, spec.DataChunks+spec.CodingChunks)
+		}
+	}
+	return nil
+}
+
+// erasureCodeProfilePairs returns the key=value pairs of the profile, sorted by key. The plugin and technique of the
+// default profile are used if no plugin is set.
+func erasureCodeProfilePairs(context *clusterd.Context, namespace string, spec *cephv1alpha1.ErasureCodeProfileSpec) ([]string, error) {
+	settings := map[string]string{
+		"k":         fmt.Sprintf("%d", spec.DataChunks),
+		"m":         fmt.Sprintf("%d", spec.CodingChunks),
+		"plugin":    spec.Plugin,
+		"technique": spec.Technique,
+	}
+	if spec.Plugin == "" {
+		defaultProfile, err := ceph.GetErasureCodeProfileDetails(context, namespace, "default")
+		if err != nil {
+			return nil, fmt.Errorf("failed to look up default erasure code profile: %+v", err)
+		}
+		settings["plugin"] = defaultProfile.Plugin
+		if spec.Technique == "" {
+			settings["technique"] = defaultProfile.Technique
+		}
+	}
+	settings["crush-failure-domain"] = spec.FailureDomain
+	settings["crush-root"] = spec.CrushRoot
+	settings["crush-device-class"] = spec.DeviceClass
+	settings["stripe_unit"] = spec.StripeUnit
+	for key, value := range spec.Parameters {
+		settings[key] = value
+	}
+
+	var pairs []string
+	for key, value := range settings {
+		if value != "" {
+			pairs = append(pairs, fmt.Sprintf("%s=%s", key, value))
+		}
+	}
+	sort.Strings(pairs)
+	return pairs, nil
+}
+
+// profileMatches returns whether the settings of the existing profile have the values of the pairs. The settings of the
+// profile that are not in the pairs are the defaults of the plugin.
+func profileMatches(current map[string]string, pairs []string) bool {
+	for _, pair := range pairs {
+		kv := strings.SplitN(pair, "=", 2)
+		if current[kv[0]] != kv[1] {
+			return false
+		}
+	}
+	return true
+}
+
+func erasureCodeProfileExists(context *clusterd.Context, namespace, name string) (bool, error) {
+	profiles, err := ceph.ListErasureCodeProfiles(context, namespace)
+	if err != nil {
+		return false, err
+	}
+	return contains(profiles, name), nil
+}
+
+// erasureCodeProfilePools returns the names of the pools that use the erasure code profile
+func erasureCodeProfilePools(context *clusterd.Context, namespace, name string) ([]string, error) {
+	summaries, err := ceph.ListPoolSummaries(context, namespace)
+	if err != nil {
+		return nil, err
+	}
+	var pools []string
+	for _, summary := range summaries {
+		details, err := ceph.GetPoolDetails(context, namespace, summary.Name)
+		if err != nil {
+			return nil, err
+		}
+		if details.ErasureCodeProfile == name {
+			pools = append(pools, summary.Name)
+		}
+	}
+	return pools, nil
+}
+
+// finalizeErasureCodeProfile deletes the erasure code profile and removes the finalizer from its CRD, unless pools
+// still use the profile. The deletion is retried by the pool monitor.
+func finalizeErasureCodeProfile(context *clusterd.Context, p *cephv1alpha1.ErasureCodeProfile) error {
+	pools, err := erasureCodeProfilePools(context, p.Namespace, p.Name)
+	if err != nil {
+		if !clusterExists(context, p.Namespace) {
+			// the profile was deleted with its cluster
+			return removeErasureCodeProfileFinalizer(context, p)
+		}
+		return err
+	}
+	if len(pools) > 0 {
+		message := fmt.Sprintf("erasure code profile %s cannot be deleted while it is used by pools %v", p.Name, pools)
+		if p.Status == nil || p.Status.Message != message {
+			logger.Warning(message)
+			return updateErasureCodeProfileStatus(context, p, message)
+		}
+		return nil
+	}
+
+	exists, err := erasureCodeProfileExists(context, p.Namespace, p.Name)
+	if err != nil {
+		return err
+	}
+	if exists {
+		logger.Infof("deleting erasure code profile %s", p.Name)
+		if err := ceph.DeleteErasureCodeProfile(context, p.Namespace, p.Name); err != nil {
+			return err
+		}
+	}
+	return removeErasureCodeProfileFinalizer(context, p)
+}
+
+// finalizeDeletedErasureCodeProfiles retries the deletion of the erasure code profiles that were in use
+func finalizeDeletedErasureCodeProfiles(context *clusterd.Context, namespace string) error {
+	return erasureCodeProfileCRDFinalizer(context, namespace).RetryDeletions(func(obj metav1.Object) error {
+		return finalizeErasureCodeProfile(context, obj.(*cephv1alpha1.ErasureCodeProfile))
+	})
+}
+
+func clusterExists(context *clusterd.Context, namespace string) bool {
+	clusters, err := context.RookClientset.CephV1alpha1().Clusters(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return true
+	}
+	for _, cluster := range clusters.Items {
+		if cluster.DeletionTimestamp == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// updateErasureCodeProfileStatus reports the pools using the profile and the message
+func updateErasureCodeProfileStatus(context *clusterd.Context, p *cephv1alpha1.ErasureCodeProfile, message string) error {
+	latest, err := context.RookClientset.CephV1alpha1().ErasureCodeProfiles(p.Namespace).Get(p.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	status := &cephv1alpha1.ErasureCodeProfileStatus{Message: message}
+	if pools, err := erasureCodeProfilePools(context, p.Namespace, p.Name); err == nil {
+		status.Pools = pools
+	}
+	latest.Status = status
+	if _, err := context.RookClientset.CephV1alpha1().ErasureCodeProfiles(p.Namespace).Update(latest); err != nil {
+		return fmt.Errorf("failed to update erasure code profile %s: %+v", p.Name, err)
+	}
+	return nil
+}
+
+// erasureCodeProfileCRDFinalizer returns the finalizer of the erasure code profile CRDs in the namespace
+func erasureCodeProfileCRDFinalizer(context *clusterd.Context, namespace string) *k8sutil.CRDFinalizer {
+	client := context.RookClientset.CephV1alpha1().ErasureCodeProfiles(namespace)
+	return &k8sutil.CRDFinalizer{
+		Name: ecProfileFinalizer,
+		Kind: "erasure code profile",
+		Get: func(name string) (metav1.Object, error) {
+			return client.Get(name, metav1.GetOptions{})
+		},
+		List: func() ([]metav1.Object, error) {
+			profiles, err := client.List(metav1.ListOptions{})
+			if err != nil {
+				return nil, err
+			}
+			var objs []metav1.Object
+			for i := range profiles.Items {
+				objs = append(objs, &profiles.Items[i])
+			}
+			return objs, nil
+		},
+		Update: func(obj metav1.Object) error {
+			_, err := client.Update(obj.(*cephv1alpha1.ErasureCodeProfile))
+			return err
+		},
+	}
+}
+
+func removeErasureCodeProfileFinalizer(context *clusterd.Context, p *cephv1alpha1.ErasureCodeProfile) error {
+	return erasureCodeProfileCRDFinalizer(context, p.Namespace).Remove(p.Name)
+}
+
+// validateErasureCodeProfileRef validates the erasure code profile the pool references. The profile is created from its
+// CRD if the pool is created before the profile.
+func validateErasureCodeProfileRef(context *clusterd.Context, namespace string, p *cephv1alpha1.PoolSpec) error {
+	ec := p.ErasureCode()
+	if ec == nil || ec.Profile == "" {
+		return nil
+	}
+	if ec.DataChunks > 0 || ec.CodingChunks > 0 {
+		return fmt.Errorf("the data and coding chunks cannot be set with erasure code profile %s", ec.Profile)
+	}
+	if p.FailureDomain != "" || p.CrushRoot != "" || p.DeviceClass != "" {
+		return fmt.Errorf("the failure domain, crush root and device class are set by erasure code profile %s", ec.Profile)
+	}
+
+	exists, err := erasureCodeProfileExists(context, namespace, ec.Profile)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+	profile, err := context.RookClientset.CephV1alpha1().ErasureCodeProfiles(namespace).Get(ec.Profile, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("erasure code profile %s not found. %+v", ec.Profile, err)
+	}
+	if err := erasureCodeProfileCRDFinalizer(context, namespace).Add(profile.Name); err != nil {
+		return err
+	}
+	return setErasureCodeProfile(context, profile)
+}
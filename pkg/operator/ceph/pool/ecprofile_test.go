@@ -0,0 +1,187 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pool
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	rookfake "github.com/rook/rook/pkg/client/clientset/versioned/fake"
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ecProfileExecutor returns an executor for a cluster with the profiles and the pools using the profiles. The commands
+// changing the profiles are recorded.
+func ecProfileExecutor(profiles map[string]string, poolProfiles map[string]string, commands *[]string) *exectest.MockExecutor {
+	return &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outputFile string, args ...string) (string, error) {
+			switch {
+			case args[0] == "osd" && args[1] == "erasure-code-profile" && args[2] == "ls":
+				var names []string
+				for name := range profiles {
+					names = append(names, fmt.Sprintf(`"%s"`, name))
+				}
+				return "[" + strings.Join(names, ",") + "]", nil
+			case args[0] == "osd" && args[1] == "erasure-code-profile" && args[2] == "get":
+				return profiles[args[3]], nil
+			case args[0] == "osd" && args[1] == "erasure-code-profile":
+				*commands = append(*commands, exectest.CephCommand(args[2:]...))
+				return "", nil
+			case args[0] == "osd" && args[1] == "lspools":
+				var pools []string
+				for name := range poolProfiles {
+					pools = append(pools, fmt.Sprintf(`{"poolname":"%s","poolnum":1}`, name))
+				}
+				return "[" + strings.Join(pools, ",") + "]", nil
+			case args[0] == "osd" && args[1] == "pool" && args[2] == "get":
+				return fmt.Sprintf(`{"pool":"%s","erasure_code_profile":"%s"}`, args[3], poolProfiles[args[3]]), nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+}
+
+func TestValidateErasureCodeProfile(t *testing.T) {
+	spec := &cephv1alpha1.ErasureCodeProfileSpec{DataChunks: 4, CodingChunks: 2}
+	assert.Nil(t, validateErasureCodeProfile(spec))
+
+	spec.DataChunks = 1
+	assert.NotNil(t, validateErasureCodeProfile(spec))
+	spec.DataChunks = 4
+	spec.CodingChunks = 0
+	assert.NotNil(t, validateErasureCodeProfile(spec))
+	spec.CodingChunks = 2
+
+	spec.Plugin = "unknown"
+	assert.NotNil(t, validateErasureCodeProfile(spec))
+	// the clay plugin is not in the ceph releases that rook runs
+	spec.Plugin = "clay"
+	assert.NotNil(t, validateErasureCodeProfile(spec))
+
+	// the lrc plugin requires a locality that divides the chunks
+	spec.Plugin = "lrc"
+	assert.NotNil(t, validateErasureCodeProfile(spec))
+	spec.Parameters = map[string]string{"l": "4"}
+	assert.NotNil(t, validateErasureCodeProfile(spec))
+	spec.Parameters = map[string]string{"l": "3"}
+	assert.Nil(t, validateErasureCodeProfile(spec))
+
+	// the parameters cannot override the settings of the profile
+	spec.Parameters = map[string]string{"l": "3", "k": "8"}
+	assert.NotNil(t, validateErasureCodeProfile(spec))
+}
+
+func TestSetErasureCodeProfile(t *testing.T) {
+	var commands []string
+	profiles := map[string]string{"default": `{"k":"2","m":"1","plugin":"jerasure","technique":"reed_sol_van"}`}
+	poolProfiles := map[string]string{}
+	p := &cephv1alpha1.ErasureCodeProfile{ObjectMeta: metav1.ObjectMeta{Name: "myprofile", Namespace: "myns"},
+		Spec: cephv1alpha1.ErasureCodeProfileSpec{DataChunks: 4, CodingChunks: 2, FailureDomain: "rack"}}
+	context := &clusterd.Context{Executor: ecProfileExecutor(profiles, poolProfiles, &commands)}
+
+	// the profile is created with the plugin of the default profile
+	err := setErasureCodeProfile(context, p)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"set myprofile crush-failure-domain=rack k=4 m=2 plugin=jerasure technique=reed_sol_van"}, commands)
+
+	// the profile is not changed if its settings match
+	commands = nil
+	profiles["myprofile"] = `{"crush-failure-domain":"rack","k":"4","m":"2","plugin":"jerasure","technique":"reed_sol_van","w":"8"}`
+	err = setErasureCodeProfile(context, p)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(commands))
+
+	// the profile is changed if no pools use it
+	p.Spec.CodingChunks = 3
+	err = setErasureCodeProfile(context, p)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"set myprofile crush-failure-domain=rack k=4 m=3 plugin=jerasure technique=reed_sol_van --force"}, commands)
+
+	// the profile cannot be changed while pools use it
+	commands = nil
+	poolProfiles["mypool"] = "myprofile"
+	err = setErasureCodeProfile(context, p)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "used by pools [mypool]")
+	assert.Equal(t, 0, len(commands))
+}
+
+func TestFinalizeErasureCodeProfile(t *testing.T) {
+	var commands []string
+	profiles := map[string]string{"myprofile": `{"k":"4","m":"2","plugin":"jerasure"}`}
+	poolProfiles := map[string]string{"mypool": "myprofile"}
+	p := &cephv1alpha1.ErasureCodeProfile{ObjectMeta: metav1.ObjectMeta{Name: "myprofile", Namespace: "myns",
+		Finalizers: []string{ecProfileFinalizer}}}
+	cluster := &cephv1alpha1.Cluster{ObjectMeta: metav1.ObjectMeta{Name: "mycluster", Namespace: "myns"}}
+	context := &clusterd.Context{
+		Executor:      ecProfileExecutor(profiles, poolProfiles, &commands),
+		RookClientset: rookfake.NewSimpleClientset(p, cluster),
+	}
+
+	// the profile is kept while pools use it
+	err := finalizeErasureCodeProfile(context, p)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(commands))
+	latest, _ := context.RookClientset.CephV1alpha1().ErasureCodeProfiles("myns").Get("myprofile", metav1.GetOptions{})
+	assert.Equal(t, []string{ecProfileFinalizer}, latest.Finalizers)
+	assert.Equal(t, []string{"mypool"}, latest.Status.Pools)
+	assert.Contains(t, latest.Status.Message, "cannot be deleted")
+
+	// the profile is deleted with the finalizer when the pools are gone
+	delete(poolProfiles, "mypool")
+	err = finalizeErasureCodeProfile(context, latest)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"rm myprofile"}, commands)
+	latest, _ = context.RookClientset.CephV1alpha1().ErasureCodeProfiles("myns").Get("myprofile", metav1.GetOptions{})
+	assert.Equal(t, 0, len(latest.Finalizers))
+}
+
+func TestValidateErasureCodeProfileRef(t *testing.T) {
+	var commands []string
+	profiles := map[string]string{}
+	profile := &cephv1alpha1.ErasureCodeProfile{ObjectMeta: metav1.ObjectMeta{Name: "myprofile", Namespace: "myns"},
+		Spec: cephv1alpha1.ErasureCodeProfileSpec{DataChunks: 2, CodingChunks: 1, Plugin: "isa"}}
+	context := &clusterd.Context{
+		Executor:      ecProfileExecutor(profiles, map[string]string{}, &commands),
+		RookClientset: rookfake.NewSimpleClientset(profile),
+	}
+	spec := &cephv1alpha1.PoolSpec{}
+	spec.ErasureCoded.Profile = "myprofile"
+
+	// the profile is created from its crd if it was not created yet, after the finalizer is added to the crd
+	err := validateErasureCodeProfileRef(context, "myns", spec)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"set myprofile k=2 m=1 plugin=isa"}, commands)
+	latest, err := context.RookClientset.CephV1alpha1().ErasureCodeProfiles("myns").Get("myprofile", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{ecProfileFinalizer}, latest.Finalizers)
+
+	// the settings of the profile cannot be set on the pool
+	spec.FailureDomain = "host"
+	assert.NotNil(t, validateErasureCodeProfileRef(context, "myns", spec))
+	spec.FailureDomain = ""
+	spec.ErasureCoded.DataChunks = 2
+	assert.NotNil(t, validateErasureCodeProfileRef(context, "myns", spec))
+
+	// the profile must exist
+	spec.ErasureCoded = cephv1alpha1.ErasureCodedSpec{Profile: "otherprofile"}
+	assert.NotNil(t, validateErasureCodeProfileRef(context, "myns", spec))
+}
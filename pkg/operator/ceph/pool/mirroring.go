@@ -0,0 +1,177 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pool
+
+import (
+	"fmt"
+	"sort"
+
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/ceph/cluster/rbd"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var mirroringModes = []string{"pool", "image"}
+
+// validateMirroring validates the mirroring mode and the peers of the pool. Only replicated pools can be mirrored.
+func validateMirroring(p *cephv1alpha1.PoolSpec) error {
+	m := p.Mirroring
+	if m.Mode == "" {
+		if len(m.Peers) > 0 {
+			return fmt.Errorf("mirroring peers require a mirroring mode")
+		}
+		return nil
+	}
+	if !contains(mirroringModes, m.Mode) {
+		return fmt.Errorf("unrecognized mirroring mode %s", m.Mode)
+	}
+	if p.ErasureCode() != nil {
+		return fmt.Errorf("erasure coded pools cannot be mirrored")
+	}
+	peers := map[string]bool{}
+	for _, peer := range m.Peers {
+		if peer.SecretName == "" {
+			return fmt.Errorf("the secret name of a mirroring peer is required")
+		}
+		if peers[peer.SecretName] {
+			return fmt.Errorf("duplicate mirroring peer %s", peer.SecretName)
+		}
+		peers[peer.SecretName] = true
+	}
+	return nil
+}
+
+// reconcileMirroring enables the mirroring of the pool in its mode and adds or removes the peers of the pool, or
+// disables the mirroring if no mode is set
+func reconcileMirroring(context *clusterd.Context, p *cephv1alpha1.Pool) error {
+	info, err := ceph.GetMirrorPoolInfo(context, p.Namespace, p.Name)
+	if err != nil {
+		return err
+	}
+
+	mode := p.Spec.Mirroring.Mode
+	if mode == "" {
+		if info.Mode == ceph.MirroringModeDisabled {
+			return nil
+		}
+		// the peers must be removed before the mirroring is disabled
+		for _, peer := range info.Peers {
+			if err := ceph.RemoveMirrorPeer(context, p.Namespace, p.Name, peer.UUID); err != nil {
+				return err
+			}
+		}
+		logger.Infof("disabling mirroring of pool %s", p.Name)
+		if err := ceph.DisableMirroring(context, p.Namespace, p.Name); err != nil {
+			return err
+		}
+		_, err := syncMirroringPeers(context, p.Namespace)
+		return err
+	}
+
+	// the peer clusters connect to this cluster with the bootstrap credentials
+	if err := rbd.CreateBootstrapSecret(context, p.Namespace); err != nil {
+		return fmt.Errorf("failed to create the rbd-mirror bootstrap secret. %+v", err)
+	}
+	if info.Mode != mode {
+		logger.Infof("enabling %s mirroring of pool %s", mode, p.Name)
+		if err := ceph.EnableMirroring(context, p.Namespace, p.Name, mode); err != nil {
+			return err
+		}
+	}
+
+	clients, err := syncMirroringPeers(context, p.Namespace)
+	if err != nil {
+		return err
+	}
+	current := map[string]bool{}
+	for _, peer := range info.Peers {
+		if !hasMirroringPeer(&p.Spec, peer.ClusterName) {
+			logger.Infof("removing mirroring peer %s from pool %s", peer.ClusterName, p.Name)
+			if err := ceph.RemoveMirrorPeer(context, p.Namespace, p.Name, peer.UUID); err != nil {
+				return err
+			}
+			continue
+		}
+		current[peer.ClusterName] = true
+	}
+	for _, peer := range p.Spec.Mirroring.Peers {
+		if current[peer.SecretName] {
+			continue
+		}
+		logger.Infof("adding mirroring peer %s to pool %s", peer.SecretName, p.Name)
+		if err := ceph.AddMirrorPeer(context, p.Namespace, p.Name, clients[peer.SecretName], peer.SecretName); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncMirroringPeers writes the files of the peers of all the mirrored pools in the namespace to the secret mounted by
+// the rbd-mirror daemons. The peers of the deleted pools are left out. Returns the client name of each peer.
+func syncMirroringPeers(context *clusterd.Context, namespace string) (map[string]string, error) {
+	pools, err := context.RookClientset.CephV1alpha1().Pools(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pools. %+v", err)
+	}
+	names := map[string]bool{}
+	for _, pool := range pools.Items {
+		if pool.Spec.Mirroring.Mode == "" || pool.DeletionTimestamp != nil {
+			continue
+		}
+		for _, peer := range pool.Spec.Mirroring.Peers {
+			names[peer.SecretName] = true
+		}
+	}
+	var peers []string
+	for name := range names {
+		peers = append(peers, name)
+	}
+	sort.Strings(peers)
+	return rbd.SyncPeers(context, namespace, peers)
+}
+
+// mirroringStatus returns the health of the mirroring of the pool, or nil if the pool is not mirrored
+func mirroringStatus(context *clusterd.Context, p *cephv1alpha1.Pool) (*cephv1alpha1.MirroringStatus, error) {
+	if p.Spec.Mirroring.Mode == "" {
+		return nil, nil
+	}
+	info, err := ceph.GetMirrorPoolInfo(context, p.Namespace, p.Name)
+	if err != nil {
+		return nil, err
+	}
+	status := &cephv1alpha1.MirroringStatus{}
+	for _, peer := range info.Peers {
+		status.Peers = append(status.Peers, peer.ClusterName)
+	}
+	mirrorStatus, err := ceph.GetMirrorPoolStatus(context, p.Namespace, p.Name)
+	if err != nil {
+		return nil, err
+	}
+	status.Health = mirrorStatus.Summary.Health
+	status.States = mirrorStatus.Summary.States
+	return status, nil
+}
+
+func hasMirroringPeer(p *cephv1alpha1.PoolSpec, name string) bool {
+	for _, peer := range p.Mirroring.Peers {
+		if peer.SecretName == name {
+			return true
+		}
+	}
+	return false
+}
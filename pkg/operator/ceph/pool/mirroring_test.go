@@ -0,0 +1,123 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pool
+
+import (
+	"fmt"
+	"testing"
+
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	rookfake "github.com/rook/rook/pkg/client/clientset/versioned/fake"
+	"github.com/rook/rook/pkg/clusterd"
+	opmon "github.com/rook/rook/pkg/operator/ceph/cluster/mon"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestValidateMirroring(t *testing.T) {
+	p := &cephv1alpha1.PoolSpec{Replicated: cephv1alpha1.ReplicatedSpec{Size: 3}}
+	assert.Nil(t, validateMirroring(p))
+
+	p.Mirroring.Peers = []cephv1alpha1.MirroringPeerSpec{{SecretName: "site-b"}}
+	assert.NotNil(t, validateMirroring(p))
+	p.Mirroring.Mode = "image"
+	assert.Nil(t, validateMirroring(p))
+	p.Mirroring.Mode = "all"
+	assert.NotNil(t, validateMirroring(p))
+	p.Mirroring.Mode = "pool"
+	p.Mirroring.Peers = append(p.Mirroring.Peers, cephv1alpha1.MirroringPeerSpec{SecretName: "site-b"})
+	assert.NotNil(t, validateMirroring(p))
+
+	// erasure coded pools cannot be mirrored
+	p.Mirroring.Peers = nil
+	p.Replicated.Size = 0
+	p.ErasureCoded = cephv1alpha1.ErasureCodedSpec{DataChunks: 2, CodingChunks: 1}
+	assert.NotNil(t, validateMirroring(p))
+}
+
+func TestReconcileMirroring(t *testing.T) {
+	var commands []string
+	info := `{"mode":"disabled"}`
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outputFile string, args ...string) (string, error) {
+			if args[0] == "auth" {
+				return `{"key":"peerkey"}`, nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+		MockExecuteCommandWithOutput: func(debug bool, actionName, command string, args ...string) (string, error) {
+			if command == "rbd" && args[2] == "info" {
+				return info, nil
+			}
+			commands = append(commands, exectest.CephCommand(args...))
+			return "", nil
+		},
+	}
+	p := &cephv1alpha1.Pool{ObjectMeta: metav1.ObjectMeta{Name: "mypool", Namespace: "ns"}}
+	p.Spec.Replicated.Size = 3
+	p.Spec.Mirroring = cephv1alpha1.MirroringSpec{Mode: "pool", Peers: []cephv1alpha1.MirroringPeerSpec{{SecretName: "site-b"}}}
+	context := &clusterd.Context{
+		Executor: executor,
+		Clientset: fake.NewSimpleClientset(
+			&v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "rook-ceph-mon", Namespace: "ns"}},
+			&v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: opmon.EndpointConfigMapName, Namespace: "ns"},
+				Data: map[string]string{opmon.EndpointDataKey: "rook-ceph-mon0=10.0.0.1:6790"}},
+			&v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "site-b", Namespace: "ns"},
+				Data: map[string][]byte{"monHost": []byte("10.1.0.1:6790"), "user": []byte("rbd-mirror-peer"), "key": []byte("key")}}),
+		RookClientset: rookfake.NewSimpleClientset(p),
+	}
+
+	// the mirroring is enabled and the peer is added
+	err := reconcileMirroring(context, p)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"mirror pool enable mypool pool", "mirror pool peer add mypool client.rbd-mirror-peer@site-b"}, commands)
+
+	// the peers that are no longer in the spec are removed
+	commands = nil
+	info = `{"mode":"pool","peers":[{"uuid":"1234","cluster_name":"site-b"},{"uuid":"5678","cluster_name":"site-c"}]}`
+	err = reconcileMirroring(context, p)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"mirror pool peer remove mypool 5678"}, commands)
+
+	// the peers are removed before the mirroring is disabled
+	commands = nil
+	p.Spec.Mirroring = cephv1alpha1.MirroringSpec{}
+	err = reconcileMirroring(context, p)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"mirror pool peer remove mypool 1234", "mirror pool peer remove mypool 5678", "mirror pool disable mypool"}, commands)
+}
+
+func TestSyncMirroringPeers(t *testing.T) {
+	now := metav1.Now()
+	mirrored := &cephv1alpha1.Pool{ObjectMeta: metav1.ObjectMeta{Name: "mypool", Namespace: "ns"}}
+	mirrored.Spec.Mirroring = cephv1alpha1.MirroringSpec{Mode: "pool", Peers: []cephv1alpha1.MirroringPeerSpec{{SecretName: "site-b"}}}
+	deleted := &cephv1alpha1.Pool{ObjectMeta: metav1.ObjectMeta{Name: "oldpool", Namespace: "ns", DeletionTimestamp: &now}}
+	deleted.Spec.Mirroring = cephv1alpha1.MirroringSpec{Mode: "pool", Peers: []cephv1alpha1.MirroringPeerSpec{{SecretName: "site-c"}}}
+	context := &clusterd.Context{
+		Clientset: fake.NewSimpleClientset(
+			&v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "site-b", Namespace: "ns"},
+				Data: map[string][]byte{"monHost": []byte("10.1.0.1:6790"), "user": []byte("rbd-mirror-peer"), "key": []byte("key")}}),
+		RookClientset: rookfake.NewSimpleClientset(mirrored, deleted),
+	}
+
+	// the peers of the deleted pool are left out, so its missing bootstrap secret is not required
+	clients, err := syncMirroringPeers(context, "ns")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"site-b": "client.rbd-mirror-peer"}, clients)
+}
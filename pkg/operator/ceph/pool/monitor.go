@@ -0,0 +1,200 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pool
+
+import (
+	"fmt"
+	"time"
+
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
+	"github.com/rook/rook/pkg/operator/k8sutil"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	statusUpdateRetries = 5
+)
+
+var (
+	poolCheckInterval = 10 * time.Minute
+)
+
+// PoolMonitor periodically resets the settings of the pools in a namespace that were changed outside of their pool
+// CRDs, reports their usage in their status, retries the
+// deletion of the pools and of the CRDs built on them that were in use and adopts the pools without a CRD if enabled
+// in the cluster CRD
+type PoolMonitor struct {
+	context   *clusterd.Context
+	namespace string
+	// the deletions of the CRDs built on the pools, such as file systems, that are retried along with the pools
+	deletionRetries []DeletionRetry
+}
+
+// DeletionRetry retries the deletion of the deleted CRDs of a kind in the namespace that are kept by their finalizer
+type DeletionRetry func(context *clusterd.Context, namespace string) error
+
+// NewPoolMonitor creates a pool monitor for the pools in the namespace, which also retries the given deletions
+func NewPoolMonitor(context *clusterd.Context, namespace string, deletionRetries ...DeletionRetry) *PoolMonitor {
+	return &PoolMonitor{context: context, namespace: namespace, deletionRetries: deletionRetries}
+}
+
+// Run checks the pools periodically until the stop channel is closed
+func (m *PoolMonitor) Run(stopCh chan struct{}) {
+	k8sutil.RunMonitor("pool monitor", m.namespace, stopCh, func() time.Duration { return poolCheckInterval }, func() {
+		if err := m.checkPools(); err != nil {
+			logger.Warningf("failed to check pools in namespace %s. %+v", m.namespace, err)
+		}
+	})
+}
+
+func (m *PoolMonitor) checkPools() error {
+	for _, retry := range m.deletionRetries {
+		if err := retry(m.context, m.namespace); err != nil {
+			logger.Warningf("failed to retry deletions in namespace %s. %+v", m.namespace, err)
+		}
+	}
+	if err := finalizeDeletedErasureCodeProfiles(m.context, m.namespace); err != nil {
+		logger.Warningf("failed to check erasure code profiles in namespace %s. %+v", m.namespace, err)
+	}
+
+	if adoption := m.poolAdoption(); adoption != nil && adoption.Enabled {
+		adopted, err := adoptPools(m.context, m.namespace, adoption.ExcludedPools)
+		if err != nil {
+			logger.Warningf("failed to adopt pools in namespace %s. %+v", m.namespace, err)
+		} else if len(adopted) > 0 {
+			logger.Infof("created CRDs for existing pools %v", adopted)
+		}
+	}
+
+	pools, err := m.context.RookClientset.CephV1alpha1().Pools(m.namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to list pools. %+v", err)
+	}
+	if len(pools.Items) == 0 {
+		return nil
+	}
+	stats, err := ceph.GetPoolStats(m.context, m.namespace)
+	if err != nil {
+		return err
+	}
+
+	for i := range pools.Items {
+		p := &pools.Items[i]
+		if p.DeletionTimestamp != nil {
+			// retry the deletion of the pools that were in use
+			if err := finalizePool(m.context, p); err != nil {
+				logger.Warningf("failed to delete pool %s. %+v", p.Name, err)
+			}
+			continue
+		}
+		if isRetired(p) {
+			continue
+		}
+		status := &cephv1alpha1.PoolStatus{}
+		if p.Status != nil {
+			// the rejected update is only cleared when the pool crd is changed
+			status.RejectedUpdate = p.Status.RejectedUpdate
+		}
+		corrected, err := applyPoolSettings(m.context, p)
+		if err != nil {
+			logger.Warningf("failed to apply the settings of pool %s. %+v", p.Name, err)
+			status.Message = err.Error()
+		} else if len(corrected) > 0 {
+			logger.Warningf("reset properties %v of pool %s that were changed outside of the pool CRD", corrected, p.Name)
+		}
+		status.CorrectedProperties = corrected
+
+		// the mirroring is reapplied to refresh the mon endpoints in the bootstrap secret as well
+		if p.Spec.Mirroring.Mode != "" {
+			if err := reconcileMirroring(m.context, p); err != nil {
+				logger.Warningf("failed to configure the mirroring of pool %s. %+v", p.Name, err)
+				status.Message = err.Error()
+			}
+		}
+		// the cache tier and the settings of the cache pool are also reapplied, and the removal of the cache pools left
+		// in the proxy mode while they are flushed is retried
+		if p.Spec.Tier.CachePool != "" {
+			if err := reconcileTier(m.context, p.Namespace, p.Name, &p.Spec.Tier); err != nil {
+				logger.Warningf("failed to configure the cache tier of pool %s. %+v", p.Name, err)
+				status.Message = err.Error()
+			}
+		} else if err := retryTierRemoval(m.context, p.Namespace, p.Name); err != nil {
+			logger.Warningf("failed to remove the cache tier of pool %s. %+v", p.Name, err)
+			status.Message = err.Error()
+		}
+		mirroring, err := mirroringStatus(m.context, p)
+		if err != nil {
+			logger.Warningf("failed to get the mirroring status of pool %s. %+v", p.Name, err)
+		}
+		status.Mirroring = mirroring
+
+		for _, s := range stats.Pools {
+			if s.Name == p.Name {
+				status.BytesUsed = uint64(s.Stats.BytesUsed)
+				status.Objects = uint64(s.Stats.Objects)
+				break
+			}
+		}
+		if err := updatePoolStatus(m.context, p, status); err != nil {
+			logger.Warningf("failed to update the status of pool %s. %+v", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// poolAdoption returns the pool adoption settings of the cluster in the namespace, or nil if there is no cluster
+func (m *PoolMonitor) poolAdoption() *cephv1alpha1.PoolAdoptionSpec {
+	clusters, err := m.context.RookClientset.CephV1alpha1().Clusters(m.namespace).List(metav1.ListOptions{})
+	if err != nil {
+		logger.Warningf("failed to list clusters in namespace %s. %+v", m.namespace, err)
+		return nil
+	}
+	for _, c := range clusters.Items {
+		if c.DeletionTimestamp == nil {
+			return &c.Spec.PoolAdoption
+		}
+	}
+	return nil
+}
+
+// updatePoolStatus sets the status of the latest pool CRD, retrying if the pool CRD is changed at the same time so
+// the changes to its spec are not overwritten
+func updatePoolStatus(context *clusterd.Context, p *cephv1alpha1.Pool, status *cephv1alpha1.PoolStatus) error {
+	updateTime := metav1.NewTime(time.Now())
+	status.UpdateTime = &updateTime
+
+	var err error
+	for i := 0; i < statusUpdateRetries; i++ {
+		var latest *cephv1alpha1.Pool
+		latest, err = context.RookClientset.CephV1alpha1().Pools(p.Namespace).Get(p.Name, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("failed to get pool %s prior to updating its status: %+v", p.Name, err)
+		}
+		latest.Status = status
+		if _, err = context.RookClientset.CephV1alpha1().Pools(p.Namespace).Update(latest); err == nil || !errors.IsConflict(err) {
+			break
+		}
+		logger.Infof("conflict updating the status of pool %s, will retry. %+v", p.Name, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update pool %s status: %+v", p.Name, err)
+	}
+	p.Status = status
+	return nil
+}
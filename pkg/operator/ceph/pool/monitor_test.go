@@ -0,0 +1,78 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pool
+
+import (
+	"fmt"
+	"testing"
+
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	rookfake "github.com/rook/rook/pkg/client/clientset/versioned/fake"
+	"github.com/rook/rook/pkg/clusterd"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	testclient "k8s.io/client-go/testing"
+)
+
+func TestCheckPools(t *testing.T) {
+	var set []string
+	details := `{"pool":"mypool","size":3}{"pool":"mypool","min_size":2}`
+	p := &cephv1alpha1.Pool{ObjectMeta: metav1.ObjectMeta{Name: "mypool", Namespace: "myns"}}
+	p.Spec.Replicated.Size = 3
+	p.Spec.MinSize = 1
+	rookClientset := rookfake.NewSimpleClientset(p)
+	context := &clusterd.Context{Executor: settingsExecutor(details, "", &set), RookClientset: rookClientset}
+
+	// the changed min size is reset and the usage is reported
+	m := NewPoolMonitor(context, "myns")
+	err := m.checkPools()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"min_size=1"}, set)
+	updated, err := rookClientset.CephV1alpha1().Pools("myns").Get("mypool", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.NotNil(t, updated.Status)
+	assert.Equal(t, []string{"min_size"}, updated.Status.CorrectedProperties)
+	assert.Equal(t, uint64(1024), updated.Status.BytesUsed)
+	assert.Equal(t, uint64(3), updated.Status.Objects)
+	assert.NotNil(t, updated.Status.UpdateTime)
+
+	// the status is set on the latest pool CRD if it was changed while the pools were checked
+	updated.Status = nil
+	_, err = rookClientset.CephV1alpha1().Pools("myns").Update(updated)
+	assert.Nil(t, err)
+	conflicts := 0
+	rookClientset.PrependReactor("update", "pools", func(action testclient.Action) (bool, runtime.Object, error) {
+		if conflicts > 0 {
+			return false, nil, nil
+		}
+		conflicts++
+		changed := updated.DeepCopy()
+		changed.Spec.MinSize = 2
+		_, err := rookClientset.CephV1alpha1().Pools("myns").Update(changed)
+		assert.Nil(t, err)
+		return true, nil, errors.NewConflict(schema.GroupResource{Resource: "pools"}, "mypool", fmt.Errorf("mock conflict"))
+	})
+	err = m.checkPools()
+	assert.Nil(t, err)
+	assert.Equal(t, 1, conflicts)
+	updated, err = rookClientset.CephV1alpha1().Pools("myns").Get("mypool", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, uint(2), updated.Spec.MinSize)
+	assert.NotNil(t, updated.Status)
+}
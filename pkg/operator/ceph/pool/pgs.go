@@ -0,0 +1,224 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pool
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// the number of placement groups per OSD that the pools of the cluster are sized for
+	targetPGsPerOSD = 100
+	// the most placement groups per OSD that are added in one step, as the mons refuse to split more at once
+	maxPGSplitsPerOSD  = 32
+	minPGs             = 8
+	pgAutoscalerModule = "pg_autoscaler"
+)
+
+var (
+	pgCheckInterval = 10 * time.Minute
+)
+
+// PGAdvisor keeps the placement groups of the pools in a namespace at the count set in the pool or recommended for the
+// target size of the pool
+type PGAdvisor struct {
+	context   *clusterd.Context
+	namespace string
+}
+
+// NewPGAdvisor creates a placement group advisor for the pools in the namespace
+func NewPGAdvisor(context *clusterd.Context, namespace string) *PGAdvisor {
+	return &PGAdvisor{context: context, namespace: namespace}
+}
+
+// Run checks the placement groups of the pools periodically until the stop channel is closed
+func (a *PGAdvisor) Run(stopCh chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			logger.Infof("stopping pg advisor in namespace %s", a.namespace)
+			return
+		case <-time.After(pgCheckInterval):
+			pools, err := a.context.RookClientset.CephV1alpha1().Pools(a.namespace).List(metav1.ListOptions{})
+			if err != nil {
+				logger.Warningf("failed to list pools in namespace %s. %+v", a.namespace, err)
+				continue
+			}
+			for i := range pools.Items {
+				if pools.Items[i].DeletionTimestamp != nil || isRetired(&pools.Items[i]) {
+					// the pool is kept by its finalizer until it can be deleted, and a retired pool is not managed
+					continue
+				}
+				if err := adjustPGs(a.context, &pools.Items[i]); err != nil {
+					logger.Warningf("failed to adjust the placement groups of pool %s. %+v", pools.Items[i].Name, err)
+				}
+			}
+		}
+	}
+}
+
+// adjustPGs increases the placement groups of the pool one step toward the count set in the pool or recommended for
+// its target size. The pg_autoscaler mgr module sizes the pool instead if it is available and no count is set.
+func adjustPGs(context *clusterd.Context, p *cephv1alpha1.Pool) error {
+	spec := &p.Spec
+	if spec.PgNum == 0 && spec.TargetSizePercent == 0 && spec.TargetSizeBytes == 0 {
+		return nil
+	}
+
+	autoscaler, err := ceph.MgrModuleAvailable(context, p.Namespace, pgAutoscalerModule)
+	if err != nil {
+		return err
+	}
+	if autoscaler {
+		if spec.PgNum == 0 {
+			return delegateToAutoscaler(context, p)
+		}
+		// the count set in the pool is not changed by the autoscaler
+		if err := ceph.SetPoolProperty(context, p.Namespace, p.Name, "pg_autoscale_mode", "off"); err != nil {
+			return err
+		}
+	}
+
+	details, err := ceph.GetPoolDetails(context, p.Namespace, p.Name)
+	if err != nil {
+		return err
+	}
+	target := spec.PgNum
+	if target == 0 {
+		if target, err = recommendedPGs(context, p.Namespace, spec); err != nil {
+			return err
+		}
+	}
+	if target <= details.PgNum {
+		if spec.PgNum > 0 && target < details.PgNum {
+			logger.Warningf("pool %s has %d placement groups, which cannot be decreased to %d", p.Name, details.PgNum, target)
+		}
+		return nil
+	}
+
+	// wait for the data movement of the previous step to complete
+	if err := ceph.IsClusterClean(context, p.Namespace); err != nil {
+		logger.Infof("not increasing the placement groups of pool %s while the cluster is not clean", p.Name)
+		return nil
+	}
+
+	status, err := ceph.Status(context, p.Namespace)
+	if err != nil {
+		return err
+	}
+	next := nextPGStep(details.PgNum, target, status.OsdMap.OsdMap.NumInOsd)
+	logger.Infof("increasing the placement groups of pool %s from %d to %d (target %d)", p.Name, details.PgNum, next, target)
+	if err := ceph.SetPoolProperty(context, p.Namespace, p.Name, "pg_num", strconv.Itoa(next)); err != nil {
+		return err
+	}
+	return ceph.SetPoolProperty(context, p.Namespace, p.Name, "pgp_num", strconv.Itoa(next))
+}
+
+// delegateToAutoscaler lets the pg_autoscaler mgr module size the pool for its target size
+func delegateToAutoscaler(context *clusterd.Context, p *cephv1alpha1.Pool) error {
+	if err := ceph.MgrEnableModule(context, p.Namespace, pgAutoscalerModule, false); err != nil {
+		return err
+	}
+	if err := ceph.SetPoolProperty(context, p.Namespace, p.Name, "pg_autoscale_mode", "on"); err != nil {
+		return err
+	}
+	if p.Spec.TargetSizePercent > 0 {
+		ratio := strconv.FormatFloat(float64(p.Spec.TargetSizePercent)/100, 'f', -1, 64)
+		return ceph.SetPoolProperty(context, p.Namespace, p.Name, "target_size_ratio", ratio)
+	}
+	return ceph.SetPoolProperty(context, p.Namespace, p.Name, "target_size_bytes", strconv.FormatUint(p.Spec.TargetSizeBytes, 10))
+}
+
+// recommendedPGs returns the placement groups recommended for the target size of the pool given the OSDs in the cluster
+func recommendedPGs(context *clusterd.Context, namespace string, spec *cephv1alpha1.PoolSpec) (int, error) {
+	status, err := ceph.Status(context, namespace)
+	if err != nil {
+		return 0, err
+	}
+	osds := status.OsdMap.OsdMap.NumInOsd
+	if osds == 0 {
+		return 0, fmt.Errorf("no osds are in the cluster")
+	}
+
+	if ec := spec.ErasureCode(); ec != nil && ec.Profile != "" {
+		// the chunks of the pool are defined by the erasure code profile it references
+		profile, err := ceph.GetErasureCodeProfileDetails(context, namespace, ec.Profile)
+		if err != nil {
+			return 0, err
+		}
+		resolved := *spec
+		resolved.ErasureCoded.DataChunks = profile.DataChunkCount
+		resolved.ErasureCoded.CodingChunks = profile.CodingChunkCount
+		spec = &resolved
+	}
+	width, rawFactor := poolWidth(spec)
+	share := float64(spec.TargetSizePercent) / 100
+	if spec.TargetSizePercent == 0 && status.PgMap.TotalBytes > 0 {
+		// the share of the raw capacity of the cluster that the target bytes will use
+		share = float64(spec.TargetSizeBytes) * rawFactor / float64(status.PgMap.TotalBytes)
+	}
+	return recommendedPGCount(osds, width, math.Min(share, 1)), nil
+}
+
+// poolWidth returns the number of OSDs each object of the pool is stored on and the raw bytes used per byte stored
+func poolWidth(spec *cephv1alpha1.PoolSpec) (int, float64) {
+	if ec := spec.ErasureCode(); ec != nil && ec.DataChunks > 0 {
+		width := ec.DataChunks + ec.CodingChunks
+		return int(width), float64(width) / float64(ec.DataChunks)
+	}
+	if r := spec.Replication(); r != nil {
+		return int(r.Size), float64(r.Size)
+	}
+	return 1, 1
+}
+
+// recommendedPGCount returns the placement group count for a pool using the given share of the OSDs, rounded to a power
+// of two. The lower power of two is used if it is within 25% of the exact count.
+func recommendedPGCount(osds, width int, share float64) int {
+	exact := float64(targetPGsPerOSD*osds) * share / float64(width)
+	pgs := minPGs
+	for float64(pgs) < exact {
+		pgs *= 2
+	}
+	if pgs > minPGs && float64(pgs/2) >= exact*0.75 {
+		pgs /= 2
+	}
+	return pgs
+}
+
+// nextPGStep returns the next placement group count toward the target, at most doubling the current count so that only
+// part of the data moves at a time. At most maxPGSplitsPerOSD placement groups per OSD are added in one step.
+func nextPGStep(current, target, osds int) int {
+	if current <= 0 {
+		return target
+	}
+	next := current * 2
+	if maxStep := osds * maxPGSplitsPerOSD; maxStep > 0 && next-current > maxStep {
+		next = current + maxStep
+	}
+	if next > target {
+		next = target
+	}
+	return next
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pool
+
+import (
+	"fmt"
+	"testing"
+
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRecommendedPGCount(t *testing.T) {
+	// 10 osds for a replicated pool of size 3 with all the data: 333 rounded down to 256
+	assert.Equal(t, 256, recommendedPGCount(10, 3, 1))
+	// 20% of 10 osds for the same pool: 66 rounded down to 64
+	assert.Equal(t, 64, recommendedPGCount(10, 3, 0.2))
+	// a small share never goes below the minimum
+	assert.Equal(t, minPGs, recommendedPGCount(3, 3, 0.01))
+	// an erasure coded pool of 4+2 on 12 osds with half the data: 100 rounded up to 128
+	assert.Equal(t, 128, recommendedPGCount(12, 6, 0.5))
+}
+
+func TestNextPGStep(t *testing.T) {
+	assert.Equal(t, 16, nextPGStep(8, 128, 10))
+	assert.Equal(t, 128, nextPGStep(100, 128, 10))
+	assert.Equal(t, 64, nextPGStep(0, 64, 10))
+
+	// the step is capped by the number of osds
+	assert.Equal(t, 1024+3*maxPGSplitsPerOSD, nextPGStep(1024, 4096, 3))
+	assert.Equal(t, 4096, nextPGStep(4000, 4096, 3))
+	assert.Equal(t, 2048, nextPGStep(1024, 4096, 0))
+}
+
+func TestPoolWidth(t *testing.T) {
+	spec := &cephv1alpha1.PoolSpec{Replicated: cephv1alpha1.ReplicatedSpec{Size: 3}}
+	width, factor := poolWidth(spec)
+	assert.Equal(t, 3, width)
+	assert.Equal(t, float64(3), factor)
+
+	spec = &cephv1alpha1.PoolSpec{ErasureCoded: cephv1alpha1.ErasureCodedSpec{DataChunks: 4, CodingChunks: 2}}
+	width, factor = poolWidth(spec)
+	assert.Equal(t, 6, width)
+	assert.Equal(t, 1.5, factor)
+}
+
+func TestAdjustPGs(t *testing.T) {
+	modules := `{"enabled_modules":["status"],"disabled_modules":["influx"]}`
+	pgNum := 8
+	clean := true
+	var set []string
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outputFile string, args ...string) (string, error) {
+			switch {
+			case args[0] == "mgr" && args[1] == "module" && args[2] == "ls":
+				return modules, nil
+			case args[0] == "mgr" && args[1] == "module" && args[2] == "enable":
+				set = append(set, "enable "+args[3])
+				return "", nil
+			case args[0] == "osd" && args[1] == "pool" && args[2] == "get":
+				return fmt.Sprintf(`{"pool":"mypool","size":3}{"pool":"mypool","pg_num":%d}`, pgNum), nil
+			case args[0] == "osd" && args[1] == "pool" && args[2] == "set":
+				set = append(set, args[4]+"="+args[5])
+				return "", nil
+			case args[0] == "status":
+				state := "active+clean"
+				if !clean {
+					state = "active+remapped"
+				}
+				return fmt.Sprintf(`{"osdmap":{"osdmap":{"num_osds":10,"num_in_osds":10}},
+					"pgmap":{"num_pgs":8,"bytes_total":1000000,"pgs_by_state":[{"state_name":"%s","count":8}]}}`, state), nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+	p := &cephv1alpha1.Pool{ObjectMeta: metav1.ObjectMeta{Name: "mypool", Namespace: "myns"}}
+	p.Spec.Replicated.Size = 3
+
+	// nothing is changed without pg settings
+	err := adjustPGs(context, p)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(set))
+
+	// the pg count is doubled toward the target size without the autoscaler
+	p.Spec.TargetSizePercent = 100
+	err = adjustPGs(context, p)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"pg_num=16", "pgp_num=16"}, set)
+
+	// the pg count is not increased while the cluster is not clean
+	set = nil
+	clean = false
+	err = adjustPGs(context, p)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(set))
+
+	// the pg count is not decreased
+	clean = true
+	pgNum = 512
+	p.Spec.PgNum = 64
+	err = adjustPGs(context, p)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(set))
+
+	// the autoscaler sizes the pool for its target size when it is available
+	modules = `{"enabled_modules":["status"],"disabled_modules":[{"name":"pg_autoscaler","can_run":true}]}`
+	p.Spec.PgNum = 0
+	p.Spec.TargetSizePercent = 20
+	err = adjustPGs(context, p)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"enable pg_autoscaler", "pg_autoscale_mode=on", "target_size_ratio=0.2"}, set)
+
+	// the autoscaler is turned off for a pool with a pg count
+	set = nil
+	pgNum = 32
+	p.Spec.PgNum = 64
+	err = adjustPGs(context, p)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"pg_autoscale_mode=off", "pg_num=64", "pgp_num=64"}, set)
+}
@@ -0,0 +1,182 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pool
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
+)
+
+const (
+	quotaMaxBytes   = "max_bytes"
+	quotaMaxObjects = "max_objects"
+	compressionNone = "none"
+)
+
+var (
+	compressionModes      = []string{compressionNone, "passive", "aggressive", "force"}
+	compressionAlgorithms = []string{"snappy", "zlib", "zstd", "lz4"}
+)
+
+// applyPoolSettings sets the min size, compression and quotas of the pool where they differ from the pool CRD and
+// returns the properties that were changed. Settings that are not set in the pool CRD are left as they are.
+func applyPoolSettings(context *clusterd.Context, p *cephv1alpha1.Pool) ([]string, error) {
+	details, err := ceph.GetPoolDetails(context, p.Namespace, p.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	changed, err := setPoolProperties(context, p.Namespace, p.Name, poolProperties(&p.Spec), currentPoolProperties(details))
+	if err != nil {
+		return changed, err
+	}
+
+	quotas := p.Spec.Quotas
+	if quotas.MaxBytes == 0 && quotas.MaxObjects == 0 {
+		return changed, nil
+	}
+	quota, err := ceph.GetPoolQuota(context, p.Namespace, p.Name)
+	if err != nil {
+		return changed, err
+	}
+	if quotas.MaxBytes > 0 && quotas.MaxBytes != quota.MaxBytes {
+		if err := ceph.SetPoolQuota(context, p.Namespace, p.Name, quotaMaxBytes, quotas.MaxBytes); err != nil {
+			return changed, err
+		}
+		changed = append(changed, quotaMaxBytes)
+	}
+	if quotas.MaxObjects > 0 && quotas.MaxObjects != quota.MaxObjects {
+		if err := ceph.SetPoolQuota(context, p.Namespace, p.Name, quotaMaxObjects, quotas.MaxObjects); err != nil {
+			return changed, err
+		}
+		changed = append(changed, quotaMaxObjects)
+	}
+	return changed, nil
+}
+
+// setPoolProperties sets the desired properties of the pool that differ from their current values and returns the
+// properties that were changed
+func setPoolProperties(context *clusterd.Context, namespace, poolName string, desired, current map[string]string) ([]string, error) {
+	var names []string
+	for name := range desired {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var changed []string
+	for _, name := range names {
+		if current[name] == desired[name] {
+			continue
+		}
+		logger.Infof("setting property %s of pool %s from %q to %q", name, poolName, current[name], desired[name])
+		if err := ceph.SetPoolProperty(context, namespace, poolName, name, desired[name]); err != nil {
+			return changed, err
+		}
+		changed = append(changed, name)
+	}
+	return changed, nil
+}
+
+// resetRemovedSettings removes the quotas and turns off the compression of the pool when they are removed from the
+// pool CRD
+func resetRemovedSettings(context *clusterd.Context, p *cephv1alpha1.Pool, old *cephv1alpha1.PoolSpec) error {
+	if old.Quotas.MaxBytes > 0 && p.Spec.Quotas.MaxBytes == 0 {
+		if err := ceph.SetPoolQuota(context, p.Namespace, p.Name, quotaMaxBytes, 0); err != nil {
+			return err
+		}
+	}
+	if old.Quotas.MaxObjects > 0 && p.Spec.Quotas.MaxObjects == 0 {
+		if err := ceph.SetPoolQuota(context, p.Namespace, p.Name, quotaMaxObjects, 0); err != nil {
+			return err
+		}
+	}
+	if old.Compression.Mode != "" && p.Spec.Compression.Mode == "" {
+		if err := ceph.SetPoolProperty(context, p.Namespace, p.Name, "compression_mode", compressionNone); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// poolProperties returns the ceph pool properties for the settings that are set in the pool CRD
+func poolProperties(spec *cephv1alpha1.PoolSpec) map[string]string {
+	properties := map[string]string{}
+	if spec.MinSize > 0 {
+		properties["min_size"] = strconv.FormatUint(uint64(spec.MinSize), 10)
+	}
+	if spec.Compression.Mode != "" {
+		properties["compression_mode"] = spec.Compression.Mode
+	}
+	if spec.Compression.Algorithm != "" {
+		properties["compression_algorithm"] = spec.Compression.Algorithm
+	}
+	if spec.Compression.RequiredRatioPercent > 0 {
+		properties["compression_required_ratio"] = percentRatio(spec.Compression.RequiredRatioPercent)
+	}
+	return properties
+}
+
+func currentPoolProperties(details ceph.CephStoragePoolDetails) map[string]string {
+	properties := map[string]string{
+		"min_size":              strconv.FormatUint(uint64(details.MinSize), 10),
+		"compression_mode":      details.CompressionMode,
+		"compression_algorithm": details.CompressionAlgorithm,
+	}
+	if details.CompressionRequiredRatio > 0 {
+		properties["compression_required_ratio"] = strconv.FormatFloat(details.CompressionRequiredRatio, 'f', -1, 64)
+	}
+	return properties
+}
+
+func percentRatio(percent int) string {
+	return strconv.FormatFloat(float64(percent)/100, 'f', -1, 64)
+}
+
+// validatePoolSettings validates the min size, compression and application settings of the pool
+func validatePoolSettings(p *cephv1alpha1.PoolSpec) error {
+	if p.MinSize > 0 {
+		if r := p.Replication(); r != nil && p.MinSize > r.Size {
+			return fmt.Errorf("min size %d is larger than the replica size %d", p.MinSize, r.Size)
+		}
+		if ec := p.ErasureCode(); ec != nil && ec.Profile == "" && (p.MinSize < ec.DataChunks || p.MinSize > ec.DataChunks+ec.CodingChunks) {
+			return fmt.Errorf("min size %d must be between the data chunks %d and the total chunks %d",
+				p.MinSize, ec.DataChunks, ec.DataChunks+ec.CodingChunks)
+		}
+	}
+	if p.Compression.Mode != "" && !contains(compressionModes, p.Compression.Mode) {
+		return fmt.Errorf("unrecognized compression mode %s", p.Compression.Mode)
+	}
+	if p.Compression.Algorithm != "" && !contains(compressionAlgorithms, p.Compression.Algorithm) {
+		return fmt.Errorf("unrecognized compression algorithm %s", p.Compression.Algorithm)
+	}
+	if p.Compression.RequiredRatioPercent < 0 || p.Compression.RequiredRatioPercent > 100 {
+		return fmt.Errorf("compression required ratio percent %d must be between 0 and 100", p.Compression.RequiredRatioPercent)
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
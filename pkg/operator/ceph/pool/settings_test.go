@@ -0,0 +1,113 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pool
+
+import (
+	"fmt"
+	"testing"
+
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func settingsExecutor(details, quota string, set *[]string) *exectest.MockExecutor {
+	return &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outputFile string, args ...string) (string, error) {
+			switch {
+			case args[0] == "osd" && args[1] == "pool" && args[2] == "get":
+				return details, nil
+			case args[0] == "osd" && args[1] == "pool" && args[2] == "get-quota":
+				return quota, nil
+			case args[0] == "osd" && args[1] == "pool" && (args[2] == "set" || args[2] == "set-quota"):
+				*set = append(*set, args[4]+"="+args[5])
+				return "", nil
+			case args[0] == "osd" && args[1] == "pool" && args[2] == "ls":
+				return `[{"pool_name":"mypool","pool":1,"tiers":[],"tier_of":-1,"read_tier":-1,"write_tier":-1,"cache_mode":"none"}]`, nil
+			case args[0] == "df" && args[1] == "detail":
+				return `{"pools":[{"name":"mypool","id":1,"stats":{"bytes_used":1024,"objects":3}}]}`, nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+}
+
+func TestApplyPoolSettings(t *testing.T) {
+	var set []string
+	details := `{"pool":"mypool","size":3}{"pool":"mypool","min_size":2}{"pool":"mypool","compression_mode":"passive"}`
+	quota := `{"pool_name":"mypool","pool_id":1,"quota_max_objects":0,"quota_max_bytes":1000}`
+	context := &clusterd.Context{Executor: settingsExecutor(details, quota, &set)}
+	p := &cephv1alpha1.Pool{ObjectMeta: metav1.ObjectMeta{Name: "mypool", Namespace: "myns"}}
+	p.Spec.Replicated.Size = 3
+
+	// nothing is changed without settings
+	changed, err := applyPoolSettings(context, p)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(changed))
+
+	// only the properties that differ are set
+	p.Spec.MinSize = 2
+	p.Spec.Compression = cephv1alpha1.CompressionSpec{Mode: "aggressive", Algorithm: "snappy", RequiredRatioPercent: 80}
+	p.Spec.Quotas = cephv1alpha1.QuotaSpec{MaxBytes: 1000, MaxObjects: 50}
+	changed, err = applyPoolSettings(context, p)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"compression_algorithm", "compression_mode", "compression_required_ratio", "max_objects"}, changed)
+	assert.Equal(t, []string{"compression_algorithm=snappy", "compression_mode=aggressive", "compression_required_ratio=0.8",
+		"max_objects=50"}, set)
+}
+
+func TestResetRemovedSettings(t *testing.T) {
+	var set []string
+	context := &clusterd.Context{Executor: settingsExecutor("", "", &set)}
+	p := &cephv1alpha1.Pool{ObjectMeta: metav1.ObjectMeta{Name: "mypool", Namespace: "myns"}}
+	p.Spec.Quotas.MaxObjects = 10
+	old := p.Spec
+	old.Quotas.MaxBytes = 1000
+	old.Compression.Mode = "force"
+
+	err := resetRemovedSettings(context, p, &old)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"max_bytes=0", "compression_mode=none"}, set)
+}
+
+func TestValidatePoolSettings(t *testing.T) {
+	spec := &cephv1alpha1.PoolSpec{Replicated: cephv1alpha1.ReplicatedSpec{Size: 3}, MinSize: 2}
+	assert.Nil(t, validatePoolSettings(spec))
+
+	// the min size cannot be larger than the replica size
+	spec.MinSize = 4
+	assert.NotNil(t, validatePoolSettings(spec))
+
+	// the min size of an ec pool must be between the data chunks and all the chunks
+	spec = &cephv1alpha1.PoolSpec{ErasureCoded: cephv1alpha1.ErasureCodedSpec{DataChunks: 2, CodingChunks: 1}, MinSize: 1}
+	assert.NotNil(t, validatePoolSettings(spec))
+	spec.MinSize = 3
+	assert.Nil(t, validatePoolSettings(spec))
+
+	// the compression settings must be known to ceph
+	spec.Compression = cephv1alpha1.CompressionSpec{Mode: "passive", Algorithm: "zstd", RequiredRatioPercent: 90}
+	assert.Nil(t, validatePoolSettings(spec))
+	spec.Compression.Mode = "always"
+	assert.NotNil(t, validatePoolSettings(spec))
+	spec.Compression.Mode = "force"
+	spec.Compression.Algorithm = "gzip"
+	assert.NotNil(t, validatePoolSettings(spec))
+	spec.Compression.Algorithm = "lz4"
+	spec.Compression.RequiredRatioPercent = 120
+	assert.NotNil(t, validatePoolSettings(spec))
+}
@@ -0,0 +1,332 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pool
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
+)
+
+const (
+	defaultCacheMode  = "writeback"
+	defaultHitSetType = "bloom"
+	// the I/O is proxied to the pool while its cache is flushed
+	flushCacheMode = "proxy"
+)
+
+var (
+	cacheModes  = []string{defaultCacheMode, "readproxy", ceph.CacheModeReadOnly}
+	hitSetTypes = []string{defaultHitSetType, "explicit_hash", "explicit_object"}
+	// the ceph defaults of the cache settings that are restored when the settings are removed from the pool CRD. The hit
+	// sets are left as they are since the cache agent requires them.
+	defaultTierProperties = map[string]string{
+		"target_max_bytes":         "0",
+		"target_max_objects":       "0",
+		"cache_target_dirty_ratio": "0.4",
+		"cache_target_full_ratio":  "0.8",
+	}
+
+	// the cache pools whose dirty objects are being flushed in the background
+	cacheFlushes   = map[string]bool{}
+	cacheFlushLock sync.Mutex
+)
+
+// validateTier validates the cache tier settings of the pool
+func validateTier(p *cephv1alpha1.PoolSpec, poolName string) error {
+	t := p.Tier
+	if t.CachePool == "" {
+		if t != (cephv1alpha1.TierSpec{}) {
+			return fmt.Errorf("the cache tier settings require a cache pool")
+		}
+		return nil
+	}
+	if t.CachePool == poolName {
+		return fmt.Errorf("pool %s cannot be its own cache tier", poolName)
+	}
+	if t.CacheMode != "" && !contains(cacheModes, t.CacheMode) {
+		return fmt.Errorf("unrecognized cache mode %s", t.CacheMode)
+	}
+	if t.HitSet.Type != "" && !contains(hitSetTypes, t.HitSet.Type) {
+		return fmt.Errorf("unrecognized hit set type %s", t.HitSet.Type)
+	}
+	if t.HitSet.Count < 0 || t.HitSet.PeriodSeconds < 0 {
+		return fmt.Errorf("the hit set count and period cannot be negative")
+	}
+	for _, percent := range []int{t.DirtyRatioPercent, t.FullRatioPercent} {
+		if percent < 0 || percent > 100 {
+			return fmt.Errorf("cache ratio percent %d must be between 0 and 100", percent)
+		}
+	}
+	if t.FullRatioPercent > 0 && t.DirtyRatioPercent > t.FullRatioPercent {
+		return fmt.Errorf("the dirty ratio percent %d cannot be larger than the full ratio percent %d", t.DirtyRatioPercent, t.FullRatioPercent)
+	}
+	return nil
+}
+
+// reconcileTier adds the cache pool as the tier and overlay of the pool with the cache settings, and removes the cache
+// pools that are no longer in the settings. There is no cache tier if no cache pool is set.
+func reconcileTier(context *clusterd.Context, namespace, poolName string, tier *cephv1alpha1.TierSpec) error {
+	pools, err := ceph.ListPoolDetails(context, namespace)
+	if err != nil {
+		return err
+	}
+	base := poolTierByName(pools, poolName)
+	if base == nil {
+		if tier.CachePool == "" {
+			return nil
+		}
+		return fmt.Errorf("pool %s not found", poolName)
+	}
+
+	// the other cache pools are removed first since the pool has a single overlay
+	for _, id := range base.Tiers {
+		cache := poolTierByID(pools, id)
+		if cache == nil || cache.Name == tier.CachePool {
+			continue
+		}
+		if err := removeTier(context, namespace, base, cache); err != nil {
+			return err
+		}
+	}
+	if tier.CachePool == "" {
+		return nil
+	}
+
+	cache := poolTierByName(pools, tier.CachePool)
+	if cache == nil {
+		return fmt.Errorf("cache pool %s not found", tier.CachePool)
+	}
+	if cache.TierOf != base.Number {
+		if cache.TierOf >= 0 {
+			return fmt.Errorf("pool %s is already the cache tier of another pool", cache.Name)
+		}
+		logger.Infof("adding cache pool %s as a tier of pool %s", cache.Name, poolName)
+		if err := ceph.AddTier(context, namespace, poolName, cache.Name); err != nil {
+			return err
+		}
+		cache.CacheMode = ceph.CacheModeNone
+	}
+
+	mode := tier.CacheMode
+	if mode == "" {
+		mode = defaultCacheMode
+	}
+	if cache.CacheMode != mode {
+		logger.Infof("setting cache mode of pool %s from %s to %s", cache.Name, cache.CacheMode, mode)
+		if err := ceph.SetCacheMode(context, namespace, cache.Name, mode); err != nil {
+			return err
+		}
+	}
+
+	// the cache settings are applied before the client I/O is directed to the cache pool
+	details, err := ceph.GetPoolDetails(context, namespace, cache.Name)
+	if err != nil {
+		return err
+	}
+	if _, err := setPoolProperties(context, namespace, cache.Name, tierProperties(tier), currentTierProperties(details)); err != nil {
+		return fmt.Errorf("failed to apply the settings of cache pool %s. %+v", cache.Name, err)
+	}
+
+	if base.ReadTier != cache.Number || base.WriteTier != cache.Number {
+		logger.Infof("setting cache pool %s as the overlay of pool %s", cache.Name, poolName)
+		if err := ceph.SetTierOverlay(context, namespace, poolName, cache.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// retryTierRemoval removes the cache pools of the pool that were left in the proxy mode while they were flushed
+func retryTierRemoval(context *clusterd.Context, namespace, poolName string) error {
+	pools, err := ceph.ListPoolDetails(context, namespace)
+	if err != nil {
+		return err
+	}
+	base := poolTierByName(pools, poolName)
+	if base == nil {
+		return nil
+	}
+	for _, id := range base.Tiers {
+		cache := poolTierByID(pools, id)
+		if cache == nil || cache.CacheMode != flushCacheMode {
+			continue
+		}
+		if err := removeTier(context, namespace, base, cache); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resetRemovedTierSettings restores the ceph defaults of the cache settings that were removed from the pool CRD while the
+// cache pool stayed the same
+func resetRemovedTierSettings(context *clusterd.Context, namespace string, old, new *cephv1alpha1.TierSpec) error {
+	if old.CachePool == "" || old.CachePool != new.CachePool {
+		return nil
+	}
+	current := tierProperties(new)
+	for name := range tierProperties(old) {
+		value, ok := defaultTierProperties[name]
+		if _, set := current[name]; set || !ok {
+			continue
+		}
+		logger.Infof("resetting property %s of cache pool %s to %s", name, new.CachePool, value)
+		if err := ceph.SetPoolProperty(context, namespace, new.CachePool, name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeTier removes the cache pool from the tiers of the pool. A writeback or readproxy cache is switched to the proxy
+// mode, where the writes go to the pool, and the overlay is only removed once the dirty objects of the cache are flushed
+// to the pool so that no writes are lost. Until then the cache is flushed in the background and the removal is retried
+// by the pool monitor.
+func removeTier(context *clusterd.Context, namespace string, base, cache *ceph.CephStoragePoolListDetails) error {
+	logger.Infof("removing cache pool %s from the tiers of pool %s", cache.Name, base.Name)
+	if cache.CacheMode != ceph.CacheModeReadOnly && cache.CacheMode != ceph.CacheModeNone {
+		if cache.CacheMode != flushCacheMode {
+			if err := ceph.SetCacheMode(context, namespace, cache.Name, flushCacheMode); err != nil {
+				return err
+			}
+		}
+		flushed, err := flushCache(context, namespace, cache.Name)
+		if err != nil {
+			return err
+		}
+		if !flushed {
+			return fmt.Errorf("waiting for the flush of cache pool %s before removing it from the tiers of pool %s", cache.Name, base.Name)
+		}
+	}
+
+	if base.ReadTier == cache.Number || base.WriteTier == cache.Number {
+		if err := ceph.RemoveTierOverlay(context, namespace, base.Name); err != nil {
+			return err
+		}
+		base.ReadTier = -1
+		base.WriteTier = -1
+	}
+	if cache.CacheMode == ceph.CacheModeReadOnly {
+		if err := ceph.SetCacheMode(context, namespace, cache.Name, ceph.CacheModeNone); err != nil {
+			return err
+		}
+	}
+	return ceph.RemoveTier(context, namespace, base.Name, cache.Name)
+}
+
+// flushCache returns whether the cache pool has no dirty objects left. Otherwise the cache is flushed in the background,
+// since the flush of a large cache takes long.
+func flushCache(context *clusterd.Context, namespace, cachePool string) (bool, error) {
+	stats, err := ceph.GetPoolStats(context, namespace)
+	if err != nil {
+		return false, err
+	}
+	dirty := -1.0
+	for _, s := range stats.Pools {
+		if s.Name == cachePool {
+			dirty = s.Stats.DirtyObjects
+			break
+		}
+	}
+	if dirty < 0 {
+		return false, fmt.Errorf("cache pool %s not found in the pool stats", cachePool)
+	}
+	if dirty == 0 {
+		return true, nil
+	}
+
+	cacheFlushLock.Lock()
+	defer cacheFlushLock.Unlock()
+	key := namespace + "/" + cachePool
+	if cacheFlushes[key] {
+		logger.Infof("flushing %.0f dirty objects of cache pool %s", dirty, cachePool)
+		return false, nil
+	}
+	cacheFlushes[key] = true
+	logger.Infof("starting to flush %.0f dirty objects of cache pool %s", dirty, cachePool)
+	go func() {
+		if err := ceph.FlushCachePool(context, namespace, cachePool); err != nil {
+			logger.Warningf("%+v", err)
+		}
+		cacheFlushLock.Lock()
+		defer cacheFlushLock.Unlock()
+		delete(cacheFlushes, key)
+	}()
+	return false, nil
+}
+
+// tierProperties returns the ceph properties of the cache pool for the cache settings that are set. The hit sets are
+// always enabled since the cache agent requires them.
+func tierProperties(tier *cephv1alpha1.TierSpec) map[string]string {
+	properties := map[string]string{"hit_set_type": tier.HitSet.Type}
+	if tier.HitSet.Type == "" {
+		properties["hit_set_type"] = defaultHitSetType
+	}
+	if tier.HitSet.Count > 0 {
+		properties["hit_set_count"] = strconv.Itoa(tier.HitSet.Count)
+	}
+	if tier.HitSet.PeriodSeconds > 0 {
+		properties["hit_set_period"] = strconv.Itoa(tier.HitSet.PeriodSeconds)
+	}
+	if tier.TargetMaxBytes > 0 {
+		properties["target_max_bytes"] = strconv.FormatUint(tier.TargetMaxBytes, 10)
+	}
+	if tier.TargetMaxObjects > 0 {
+		properties["target_max_objects"] = strconv.FormatUint(tier.TargetMaxObjects, 10)
+	}
+	if tier.DirtyRatioPercent > 0 {
+		properties["cache_target_dirty_ratio"] = percentRatio(tier.DirtyRatioPercent)
+	}
+	if tier.FullRatioPercent > 0 {
+		properties["cache_target_full_ratio"] = percentRatio(tier.FullRatioPercent)
+	}
+	return properties
+}
+
+func currentTierProperties(details ceph.CephStoragePoolDetails) map[string]string {
+	return map[string]string{
+		"hit_set_type":             details.HitSetType,
+		"hit_set_count":            strconv.Itoa(details.HitSetCount),
+		"hit_set_period":           strconv.Itoa(details.HitSetPeriod),
+		"target_max_bytes":         strconv.FormatUint(details.TargetMaxBytes, 10),
+		"target_max_objects":       strconv.FormatUint(details.TargetMaxObjects, 10),
+		"cache_target_dirty_ratio": strconv.FormatFloat(details.CacheTargetDirtyRatio, 'f', -1, 64),
+		"cache_target_full_ratio":  strconv.FormatFloat(details.CacheTargetFullRatio, 'f', -1, 64),
+	}
+}
+
+func poolTierByName(pools []ceph.CephStoragePoolListDetails, name string) *ceph.CephStoragePoolListDetails {
+	for i := range pools {
+		if pools[i].Name == name {
+			return &pools[i]
+		}
+	}
+	return nil
+}
+
+func poolTierByID(pools []ceph.CephStoragePoolListDetails, id int) *ceph.CephStoragePoolListDetails {
+	for i := range pools {
+		if pools[i].Number == id {
+			return &pools[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pool
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateTier(t *testing.T) {
+	p := &cephv1alpha1.PoolSpec{ErasureCoded: cephv1alpha1.ErasureCodedSpec{DataChunks: 2, CodingChunks: 1}}
+	assert.Nil(t, validateTier(p, "ecpool"))
+
+	p.Tier.CacheMode = "writeback"
+	assert.NotNil(t, validateTier(p, "ecpool"))
+	p.Tier.CachePool = "ecpool"
+	assert.NotNil(t, validateTier(p, "ecpool"))
+	p.Tier.CachePool = "cache"
+	assert.Nil(t, validateTier(p, "ecpool"))
+
+	p.Tier.CacheMode = "forward"
+	assert.NotNil(t, validateTier(p, "ecpool"))
+	p.Tier.CacheMode = "readproxy"
+	p.Tier.HitSet = cephv1alpha1.HitSetSpec{Type: "cuckoo"}
+	assert.NotNil(t, validateTier(p, "ecpool"))
+	p.Tier.HitSet = cephv1alpha1.HitSetSpec{Type: "explicit_hash", Count: 12, PeriodSeconds: 14400}
+	assert.Nil(t, validateTier(p, "ecpool"))
+
+	p.Tier.DirtyRatioPercent = 101
+	assert.NotNil(t, validateTier(p, "ecpool"))
+	p.Tier.DirtyRatioPercent = 80
+	p.Tier.FullRatioPercent = 60
+	assert.NotNil(t, validateTier(p, "ecpool"))
+	p.Tier.DirtyRatioPercent = 40
+	assert.Nil(t, validateTier(p, "ecpool"))
+}
+
+func TestReconcileTier(t *testing.T) {
+	var lock sync.Mutex
+	var commands []string
+	record := func(command string, args []string) {
+		lock.Lock()
+		defer lock.Unlock()
+		commands = append(commands, command+" "+exectest.CephCommand(args...))
+	}
+	dirty := 0
+	tiers := `[{"pool_name":"ecpool","pool":1,"tiers":[],"tier_of":-1,"read_tier":-1,"write_tier":-1,"cache_mode":"none"},` +
+		`{"pool_name":"cache","pool":2,"tiers":[],"tier_of":-1,"read_tier":-1,"write_tier":-1,"cache_mode":"none"}]`
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outputFile string, args ...string) (string, error) {
+			switch {
+			case args[0] == "osd" && args[1] == "pool" && args[2] == "ls":
+				return tiers, nil
+			case args[0] == "osd" && args[1] == "pool" && args[2] == "get":
+				return `{"pool":"cache","hit_set_type":"bloom"}{"pool":"cache","hit_set_count":12}`, nil
+			case args[0] == "df":
+				lock.Lock()
+				defer lock.Unlock()
+				return fmt.Sprintf(`{"pools":[{"name":"ecpool","id":1,"stats":{"dirty":0}},{"name":"cache","id":2,"stats":{"dirty":%d}}]}`, dirty), nil
+			case args[0] == "osd" && (args[1] == "tier" || args[2] == "set"):
+				record(command, args)
+				return "", nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+		MockExecuteCommandWithOutput: func(debug bool, actionName, command string, args ...string) (string, error) {
+			record(command, args)
+			lock.Lock()
+			defer lock.Unlock()
+			dirty = 0
+			return "", nil
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+	tier := &cephv1alpha1.TierSpec{CachePool: "cache", HitSet: cephv1alpha1.HitSetSpec{Count: 12}, TargetMaxBytes: 1000, DirtyRatioPercent: 40}
+
+	// the cache settings are applied before the overlay is set
+	err := reconcileTier(context, "ns", "ecpool", tier)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		"ceph osd tier add ecpool cache",
+		"ceph osd tier cache-mode cache writeback",
+		"ceph osd pool set cache cache_target_dirty_ratio 0.4",
+		"ceph osd pool set cache target_max_bytes 1000",
+		"ceph osd tier set-overlay ecpool cache",
+	}, commands)
+
+	// nothing is changed when the tier is configured
+	commands = nil
+	tiers = `[{"pool_name":"ecpool","pool":1,"tiers":[2],"tier_of":-1,"read_tier":2,"write_tier":2,"cache_mode":"none"},` +
+		`{"pool_name":"cache","pool":2,"tiers":[],"tier_of":1,"read_tier":-1,"write_tier":-1,"cache_mode":"writeback"}]`
+	tier.TargetMaxBytes = 0
+	tier.DirtyRatioPercent = 0
+	err = reconcileTier(context, "ns", "ecpool", tier)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(commands))
+
+	// the dirty objects of the cache are flushed in the background before the overlay and the tier are removed
+	dirty = 5
+	err = reconcileTier(context, "ns", "ecpool", &cephv1alpha1.TierSpec{})
+	assert.NotNil(t, err)
+	for i := 0; i < 100 && cacheFlushing("ns", "cache"); i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.False(t, cacheFlushing("ns", "cache"))
+	assert.Equal(t, []string{"ceph osd tier cache-mode cache proxy", "rados -p cache cache-flush-evict-all"}, commands)
+
+	// the tier is removed once the cache has no dirty objects
+	commands = nil
+	tiers = `[{"pool_name":"ecpool","pool":1,"tiers":[2],"tier_of":-1,"read_tier":2,"write_tier":2,"cache_mode":"none"},` +
+		`{"pool_name":"cache","pool":2,"tiers":[],"tier_of":1,"read_tier":-1,"write_tier":-1,"cache_mode":"proxy"}]`
+	err = reconcileTier(context, "ns", "ecpool", &cephv1alpha1.TierSpec{})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ceph osd tier remove-overlay ecpool", "ceph osd tier remove ecpool cache"}, commands)
+
+	// the tier of a missing pool cannot be configured but there is nothing to remove
+	err = reconcileTier(context, "ns", "mypool", tier)
+	assert.NotNil(t, err)
+	err = reconcileTier(context, "ns", "mypool", &cephv1alpha1.TierSpec{})
+	assert.Nil(t, err)
+
+	// only the cache pools left in the proxy mode are removed when the removal is retried
+	commands = nil
+	tiers = `[{"pool_name":"ecpool","pool":1,"tiers":[2],"tier_of":-1,"read_tier":2,"write_tier":2,"cache_mode":"none"},` +
+		`{"pool_name":"cache","pool":2,"tiers":[],"tier_of":1,"read_tier":-1,"write_tier":-1,"cache_mode":"writeback"}]`
+	err = retryTierRemoval(context, "ns", "ecpool")
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(commands))
+	tiers = `[{"pool_name":"ecpool","pool":1,"tiers":[2],"tier_of":-1,"read_tier":2,"write_tier":2,"cache_mode":"none"},` +
+		`{"pool_name":"cache","pool":2,"tiers":[],"tier_of":1,"read_tier":-1,"write_tier":-1,"cache_mode":"proxy"}]`
+	err = retryTierRemoval(context, "ns", "ecpool")
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ceph osd tier remove-overlay ecpool", "ceph osd tier remove ecpool cache"}, commands)
+}
+
+func cacheFlushing(namespace, cachePool string) bool {
+	cacheFlushLock.Lock()
+	defer cacheFlushLock.Unlock()
+	return cacheFlushes[namespace+"/"+cachePool]
+}
+
+func TestResetRemovedTierSettings(t *testing.T) {
+	var set []string
+	context := &clusterd.Context{Executor: settingsExecutor("", "", &set)}
+	old := &cephv1alpha1.TierSpec{CachePool: "cache", HitSet: cephv1alpha1.HitSetSpec{Count: 12}, TargetMaxBytes: 1000,
+		DirtyRatioPercent: 30, FullRatioPercent: 70}
+
+	// the removed cache settings are reset to the ceph defaults, but not the hit sets
+	tier := &cephv1alpha1.TierSpec{CachePool: "cache", FullRatioPercent: 70}
+	err := resetRemovedTierSettings(context, "ns", old, tier)
+	assert.Nil(t, err)
+	sort.Strings(set)
+	assert.Equal(t, []string{"cache_target_dirty_ratio=0.4", "target_max_bytes=0"}, set)
+
+	// nothing is reset when the cache pool changes
+	set = nil
+	err = resetRemovedTierSettings(context, "ns", old, &cephv1alpha1.TierSpec{CachePool: "other"})
+	assert.Nil(t, err)
+	assert.Equal(t, 0, len(set))
+}
@@ -0,0 +1,198 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pool
+
+import (
+	"fmt"
+	"strconv"
+
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/clusterd"
+	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// rejectedUpdateError is returned for the changes of the pool CRD that cannot be applied to an existing pool
+type rejectedUpdateError struct {
+	reason string
+}
+
+func (e *rejectedUpdateError) Error() string {
+	return e.reason
+}
+
+// updatePool applies the changes of the pool CRD to the existing pool, or creates the pool if it does not exist yet
+func updatePool(context *clusterd.Context, old *cephv1alpha1.PoolSpec, p *cephv1alpha1.Pool) error {
+	exists, err := poolExists(context, p)
+	if err != nil {
+		return fmt.Errorf("failed to check if pool %s exists. %+v", p.Name, err)
+	}
+	if !exists {
+		// allow the pool to be created if it wasn't already
+		return createPool(context, p)
+	}
+
+	if err := ValidatePool(context, p); err != nil {
+		return fmt.Errorf("invalid pool %s arguments. %+v", p.Name, err)
+	}
+	details, err := ceph.GetPoolDetails(context, p.Namespace, p.Name)
+	if err != nil {
+		return err
+	}
+	if err := validatePoolUpdate(context, p, details); err != nil {
+		return err
+	}
+
+	if r := p.Spec.Replication(); r != nil {
+		if details.Size != r.Size {
+			if err := setPoolSize(context, p, details.Size); err != nil {
+				return err
+			}
+		}
+		// the rule is compared with the placement in ceph rather than the old spec, so a rule changed outside of the
+		// pool CRD or a change that failed earlier is also applied
+		if err := ceph.SetPoolCrushRule(context, p.Namespace, ceph.ModelPoolToCephPool(*p.Spec.ToModel(p.Name))); err != nil {
+			return fmt.Errorf("failed to change the crush rule of pool %s. %+v", p.Name, err)
+		}
+	}
+
+	// the pool is tagged with its name when no application is set
+	oldApp, newApp := old.Application, p.Spec.Application
+	if oldApp == "" {
+		oldApp = p.Name
+	}
+	if newApp == "" {
+		newApp = p.Name
+	}
+	if newApp != oldApp {
+		if err := ceph.GivePoolAppTag(context, p.Namespace, p.Name, newApp); err != nil {
+			return err
+		}
+		if err := ceph.DisablePoolAppTag(context, p.Namespace, p.Name, oldApp); err != nil {
+			return err
+		}
+	}
+	if _, err := applyPoolSettings(context, p); err != nil {
+		return fmt.Errorf("failed to apply the settings of pool %s. %+v", p.Name, err)
+	}
+	if err := resetRemovedSettings(context, p, old); err != nil {
+		return fmt.Errorf("failed to reset the removed settings of pool %s. %+v", p.Name, err)
+	}
+	if err := adjustPGs(context, p); err != nil {
+		logger.Warningf("failed to adjust the placement groups of pool %s. %+v", p.Name, err)
+	}
+	if old.Mirroring.Mode != "" || p.Spec.Mirroring.Mode != "" {
+		if err := reconcileMirroring(context, p); err != nil {
+			return fmt.Errorf("failed to configure the mirroring of pool %s. %+v", p.Name, err)
+		}
+	}
+	if old.Tier.CachePool != "" || p.Spec.Tier.CachePool != "" {
+		if err := reconcileTier(context, p.Namespace, p.Name, &p.Spec.Tier); err != nil {
+			return fmt.Errorf("failed to configure the cache tier of pool %s. %+v", p.Name, err)
+		}
+		if err := resetRemovedTierSettings(context, p.Namespace, &old.Tier, &p.Spec.Tier); err != nil {
+			return fmt.Errorf("failed to reset the removed cache settings of pool %s. %+v", p.Name, err)
+		}
+	}
+
+	logger.Infof("updated pool %s", p.Name)
+	return nil
+}
+
+// validatePoolUpdate rejects the settings of the pool CRD that cannot be applied to the existing pool in ceph. The type
+// of a pool and the erasure code profile of an erasure coded pool are fixed when the pool is created.
+func validatePoolUpdate(context *clusterd.Context, p *cephv1alpha1.Pool, details ceph.CephStoragePoolDetails) error {
+	ec := p.Spec.ErasureCode()
+	if (ec == nil) != (details.ErasureCodeProfile == "") {
+		return &rejectedUpdateError{reason: "a pool cannot be changed between replicated and erasure coded"}
+	}
+	if ec == nil {
+		return nil
+	}
+	if ec.Profile != "" {
+		if ec.Profile != details.ErasureCodeProfile {
+			return &rejectedUpdateError{reason: fmt.Sprintf("the erasure code profile of a pool cannot be changed from %s to %s",
+				details.ErasureCodeProfile, ec.Profile)}
+		}
+		return nil
+	}
+
+	profile, err := ceph.GetErasureCodeProfileDetails(context, p.Namespace, details.ErasureCodeProfile)
+	if err != nil {
+		return fmt.Errorf("failed to get the erasure code profile of pool %s. %+v", p.Name, err)
+	}
+	if profile.DataChunkCount != ec.DataChunks || profile.CodingChunkCount != ec.CodingChunks {
+		return &rejectedUpdateError{reason: fmt.Sprintf("the erasure code chunks of a pool cannot be changed from k=%d,m=%d to k=%d,m=%d",
+			profile.DataChunkCount, profile.CodingChunkCount, ec.DataChunks, ec.CodingChunks)}
+	}
+	// ceph sets the default failure domain and crush root in the profile when they are not set in the pool CRD
+	failureDomain, crushRoot := p.Spec.FailureDomain, p.Spec.CrushRoot
+	if failureDomain == "" {
+		failureDomain = "host"
+	}
+	if crushRoot == "" {
+		crushRoot = "default"
+	}
+	if profile.FailureDomain != failureDomain || profile.CrushRoot != crushRoot || profile.DeviceClass != p.Spec.DeviceClass {
+		return &rejectedUpdateError{reason: "the failure domain, crush root and device class of an erasure coded pool cannot be changed"}
+	}
+	return nil
+}
+
+func placementChanged(old, new *cephv1alpha1.PoolSpec) bool {
+	return old.FailureDomain != new.FailureDomain || old.CrushRoot != new.CrushRoot || old.DeviceClass != new.DeviceClass
+}
+
+// setPoolSize changes the replica size of the pool and its min size, which is ceph's default for the size if not set.
+// The min size is lowered first when the size decreases since it cannot be larger than the size.
+func setPoolSize(context *clusterd.Context, p *cephv1alpha1.Pool, currentSize uint) error {
+	size := p.Spec.Replicated.Size
+	minSize := p.Spec.MinSize
+	if minSize == 0 {
+		minSize = size - size/2
+	}
+
+	logger.Infof("changing the size of pool %s from %d to %d with min size %d", p.Name, currentSize, size, minSize)
+	properties := []string{"size", "min_size"}
+	values := map[string]string{"size": strconv.FormatUint(uint64(size), 10), "min_size": strconv.FormatUint(uint64(minSize), 10)}
+	if size < currentSize {
+		properties = []string{"min_size", "size"}
+	}
+	for _, name := range properties {
+		if err := ceph.SetPoolProperty(context, p.Namespace, p.Name, name, values[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setRejectedUpdate reports in the pool status why the last change of the pool CRD was rejected, or clears the
+// reason after a change was applied
+func setRejectedUpdate(context *clusterd.Context, p *cephv1alpha1.Pool, reason string) error {
+	pool, err := context.RookClientset.CephV1alpha1().Pools(p.Namespace).Get(p.Name, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+	status := &cephv1alpha1.PoolStatus{}
+	if pool.Status != nil {
+		if pool.Status.RejectedUpdate == reason {
+			return nil
+		}
+		status = pool.Status.DeepCopy()
+	}
+	status.RejectedUpdate = reason
+	return updatePoolStatus(context, pool, status)
+}
@@ -0,0 +1,167 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package pool
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	rookfake "github.com/rook/rook/pkg/client/clientset/versioned/fake"
+	"github.com/rook/rook/pkg/clusterd"
+	ceph "github.com/rook/rook/pkg/daemon/ceph/client"
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestValidatePoolUpdate(t *testing.T) {
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outputFile string, args ...string) (string, error) {
+			if args[1] == "erasure-code-profile" && args[2] == "get" && args[3] == "mypool_ecprofile" {
+				return `{"k":"2","m":"1","plugin":"jerasure","technique":"reed_sol_van","crush-failure-domain":"host","crush-root":"default"}`, nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+	replicated := ceph.CephStoragePoolDetails{Name: "mypool", Size: 3}
+	ec := ceph.CephStoragePoolDetails{Name: "mypool", ErasureCodeProfile: "mypool_ecprofile"}
+	p := &cephv1alpha1.Pool{ObjectMeta: metav1.ObjectMeta{Name: "mypool", Namespace: "myns"}}
+
+	// the size and placement of a replicated pool can be changed
+	p.Spec = cephv1alpha1.PoolSpec{Replicated: cephv1alpha1.ReplicatedSpec{Size: 2}, FailureDomain: "osd"}
+	assert.Nil(t, validatePoolUpdate(context, p, replicated))
+
+	// the type of a pool cannot be changed
+	err := validatePoolUpdate(context, p, ec)
+	assert.NotNil(t, err)
+	_, ok := err.(*rejectedUpdateError)
+	assert.True(t, ok)
+	p.Spec = cephv1alpha1.PoolSpec{ErasureCoded: cephv1alpha1.ErasureCodedSpec{DataChunks: 2, CodingChunks: 1}}
+	assert.NotNil(t, validatePoolUpdate(context, p, replicated))
+
+	// the settings of an ec pool that match its profile in ceph are accepted, with the ceph defaults for the placement
+	assert.Nil(t, validatePoolUpdate(context, p, ec))
+	p.Spec.FailureDomain = "host"
+	p.Spec.Quotas.MaxObjects = 10
+	assert.Nil(t, validatePoolUpdate(context, p, ec))
+
+	// the ec settings and placement of an ec pool cannot be changed
+	p.Spec.ErasureCoded.DataChunks = 4
+	err = validatePoolUpdate(context, p, ec)
+	assert.NotNil(t, err)
+	_, ok = err.(*rejectedUpdateError)
+	assert.True(t, ok)
+	p.Spec.ErasureCoded.DataChunks = 2
+	p.Spec.DeviceClass = "ssd"
+	assert.NotNil(t, validatePoolUpdate(context, p, ec))
+
+	// a pool cannot be switched to another profile
+	p.Spec = cephv1alpha1.PoolSpec{ErasureCoded: cephv1alpha1.ErasureCodedSpec{Profile: "myprofile"}}
+	assert.NotNil(t, validatePoolUpdate(context, p, ec))
+	p.Spec.ErasureCoded.Profile = "mypool_ecprofile"
+	assert.Nil(t, validatePoolUpdate(context, p, ec))
+}
+
+func TestUpdatePoolSizeAndPlacement(t *testing.T) {
+	var commands []string
+	properties := map[string]string{"size": "3", "min_size": "2", "crush_rule": "mypool"}
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutputFile: func(debug bool, actionName, command, outputFile string, args ...string) (string, error) {
+			switch {
+			case args[1] == "lspools":
+				return `[{"poolnum":1,"poolname":"mypool"}]`, nil
+			case args[1] == "pool" && args[2] == "get":
+				return fmt.Sprintf(`{"pool":"mypool","pool_id":1,"size":%s}{"pool":"mypool","min_size":%s}{"pool":"mypool","crush_rule":"%s"}`,
+					properties["size"], properties["min_size"], properties["crush_rule"]), nil
+			case args[1] == "crush" && args[2] == "dump":
+				return `{"rules":[
+					{"rule_name":"mypool","steps":[{"op":"take","item_name":"default"},{"op":"chooseleaf_firstn","type":"host"},{"op":"emit"}]},
+					{"rule_name":"other","steps":[{"op":"take","item_name":"default~ssd"},{"op":"chooseleaf_firstn","type":"host"},{"op":"emit"}]}]}`, nil
+			case args[1] == "pool" && args[2] == "set":
+				commands = append(commands, args[4]+"="+args[5])
+				properties[args[4]] = args[5]
+				return "", nil
+			case args[1] == "crush" && args[2] == "rule":
+				commands = append(commands, exectest.CephCommand(args[3:]...))
+				return "", nil
+			case args[1] == "pool" && args[2] == "application":
+				commands = append(commands, strings.Join(args[2:6], " "))
+				return "", nil
+			}
+			return "", fmt.Errorf("unexpected ceph command '%v'", args)
+		},
+	}
+	context := &clusterd.Context{Executor: executor}
+	p := &cephv1alpha1.Pool{ObjectMeta: metav1.ObjectMeta{Name: "mypool", Namespace: "myns"}}
+	p.Spec.Replicated.Size = 3
+	old := p.Spec
+
+	// the min size is lowered before the size, and the pool is switched to a new rule for the failure domain
+	p.Spec.Replicated.Size = 1
+	p.Spec.FailureDomain = "osd"
+	err := updatePool(context, &old, p)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"min_size=1", "size=1", "create-simple mypool_default_osd default osd", "crush_rule=mypool_default_osd",
+		"rm mypool"}, commands)
+
+	// the min size is raised after the size
+	commands = nil
+	properties["crush_rule"] = "mypool"
+	p.Spec.Replicated.Size = 5
+	p.Spec.FailureDomain = old.FailureDomain
+	p.Spec.MinSize = 3
+	err = updatePool(context, &old, p)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"size=5", "min_size=3"}, commands)
+
+	// the rule is switched if it does not place the data as set in the pool even though the placement did not change
+	commands = nil
+	properties["crush_rule"] = "other"
+	old = p.Spec
+	err = updatePool(context, &old, p)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"create-simple mypool_default_host default host", "crush_rule=mypool_default_host"}, commands)
+
+	// the application of the pool is replaced
+	commands = nil
+	properties["crush_rule"] = "mypool"
+	p.Spec.Application = "rbd"
+	err = updatePool(context, &old, p)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"application enable mypool rbd", "application disable mypool mypool"}, commands)
+}
+
+func TestSetRejectedUpdate(t *testing.T) {
+	p := &cephv1alpha1.Pool{ObjectMeta: metav1.ObjectMeta{Name: "mypool", Namespace: "myns"}}
+	rookClientset := rookfake.NewSimpleClientset(p)
+	context := &clusterd.Context{RookClientset: rookClientset}
+
+	err := setRejectedUpdate(context, p, "no way")
+	assert.Nil(t, err)
+	updated, err := rookClientset.CephV1alpha1().Pools("myns").Get("mypool", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "no way", updated.Status.RejectedUpdate)
+
+	// the reason is cleared after a change was applied
+	err = setRejectedUpdate(context, p, "")
+	assert.Nil(t, err)
+	updated, err = rookClientset.CephV1alpha1().Pools("myns").Get("mypool", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "", updated.Status.RejectedUpdate)
+}
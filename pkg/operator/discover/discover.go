@@ -18,12 +18,13 @@ limitations under the License.
 package discover
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
+	"reflect"
 	"regexp"
 
 	"github.com/coreos/pkg/capnslog"
+	opkit "github.com/rook/operator-kit"
 	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
 	"github.com/rook/rook/pkg/clusterd"
 	discoverDaemon "github.com/rook/rook/pkg/daemon/discover"
@@ -33,6 +34,7 @@ import (
 	"k8s.io/api/core/v1"
 	extensions "k8s.io/api/extensions/v1beta1"
 	"k8s.io/api/rbac/v1beta1"
+	apiextensionsv1beta1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1beta1"
 	kserrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
@@ -46,12 +48,27 @@ const (
 
 var logger = capnslog.NewPackageLogger("github.com/rook/rook", "op-discover")
 
+// DeviceInventoryResource represents the DeviceInventory custom resource object
+var DeviceInventoryResource = opkit.CustomResource{
+	Name:    "deviceinventory",
+	Plural:  "deviceinventories",
+	Group:   rookalpha.CustomResourceGroup,
+	Version: rookalpha.Version,
+	Scope:   apiextensionsv1beta1.NamespaceScoped,
+	Kind:    reflect.TypeOf(rookalpha.DeviceInventory{}).Name(),
+}
+
 var accessRules = []v1beta1.PolicyRule{
 	{
 		APIGroups: []string{""},
 		Resources: []string{"configmaps"},
 		Verbs:     []string{"get", "list", "update", "create", "delete"},
 	},
+	{
+		APIGroups: []string{rookalpha.CustomResourceGroup},
+		Resources: []string{"deviceinventories"},
+		Verbs:     []string{"get", "list", "update", "create"},
+	},
 }
 
 // Discover reference to be deployed
@@ -82,6 +99,9 @@ func (d *Discover) Start(namespace, discoverImage string) error {
 }
 
 func (d *Discover) createDiscoverDaemonSet(namespace, discoverImage string) error {
+	// the pod runs on every node with the host network, so it is not privileged. smartctl only needs raw I/O to send the
+	// SMART commands to the SATA and SAS devices mounted from the host. NVMe devices would need the admin capability and
+	// do not report their health.
 	privileged := false
 	ds := &extensions.DaemonSet{
 		ObjectMeta: metav1.ObjectMeta{
@@ -106,6 +126,9 @@ func (d *Discover) createDiscoverDaemonSet(namespace, discoverImage string) erro
 							Args:  []string{"discover"},
 							SecurityContext: &v1.SecurityContext{
 								Privileged: &privileged,
+								Capabilities: &v1.Capabilities{
+									Add: []v1.Capability{"SYS_RAWIO"},
+								},
 							},
 							VolumeMounts: []v1.VolumeMount{
 								{
@@ -156,7 +179,9 @@ func (d *Discover) createDiscoverDaemonSet(namespace, discoverImage string) erro
 							},
 						},
 					},
-					HostNetwork: false,
+					// udev only sends the events of the devices added and removed to the network namespace of the host
+					HostNetwork: true,
+					DNSPolicy:   v1.DNSClusterFirstWithHostNet,
 				},
 			},
 		},
@@ -191,78 +216,162 @@ func (d *Discover) createDiscoverDaemonSet(namespace, discoverImage string) erro
 
 }
 
-func ListDevices(context *clusterd.Context, namespace, nodeName string) (map[string][]sys.LocalDisk, error) {
-	var devices map[string][]sys.LocalDisk
+// ListInventories returns the device inventories of the nodes by node name, or only the inventory of the given node
+func ListInventories(context *clusterd.Context, namespace, nodeName string) (map[string]*rookalpha.DeviceInventory, error) {
 	listOpts := metav1.ListOptions{LabelSelector: fmt.Sprintf("%s=%s", k8sutil.AppAttr, discoverDaemon.AppName)}
-	cms, err := context.Clientset.CoreV1().ConfigMaps(namespace).List(listOpts)
+	if len(nodeName) > 0 {
+		listOpts.LabelSelector += fmt.Sprintf(",%s=%s", discoverDaemon.NodeAttr, nodeName)
+	}
+	list, err := context.RookClientset.RookV1alpha2().DeviceInventories(namespace).List(listOpts)
 	if err != nil {
-		return devices, fmt.Errorf("failed to list device configmaps: %+v", err)
+		return nil, fmt.Errorf("failed to list device inventories: %+v", err)
 	}
-	devices = make(map[string][]sys.LocalDisk, len(cms.Items))
-	for _, cm := range cms.Items {
-		node := cm.ObjectMeta.Labels[discoverDaemon.NodeAttr]
-		if len(nodeName) > 0 && node != nodeName {
+	inventories := make(map[string]*rookalpha.DeviceInventory, len(list.Items))
+	for i := range list.Items {
+		node := list.Items[i].Spec.NodeName
+		if len(node) == 0 || (len(nodeName) > 0 && node != nodeName) {
 			continue
 		}
-		deviceJson := cm.Data[discoverDaemon.LocalDiskCMData]
-		logger.Debugf("node %s, device %s", node, deviceJson)
+		inventories[node] = &list.Items[i]
+	}
+	return inventories, nil
+}
 
-		if len(node) == 0 || len(deviceJson) == 0 {
-			continue
-		}
-		var d []sys.LocalDisk
-		err = json.Unmarshal([]byte(deviceJson), &d)
-		if err != nil {
-			logger.Warningf("failed to unmarshal %s", deviceJson)
-			continue
+// ListDevices returns the disks discovered on the nodes by node name, or only the disks of the given node
+func ListDevices(context *clusterd.Context, namespace, nodeName string) (map[string][]sys.LocalDisk, error) {
+	inventories, err := ListInventories(context, namespace, nodeName)
+	if err != nil {
+		return nil, err
+	}
+	devices := make(map[string][]sys.LocalDisk, len(inventories))
+	for node, inventory := range inventories {
+		disks := make([]sys.LocalDisk, len(inventory.Spec.Devices))
+		for i := range inventory.Spec.Devices {
+			disks[i] = discoverDaemon.ToLocalDisk(&inventory.Spec.Devices[i])
 		}
-		devices[node] = d
+		devices[node] = disks
 	}
 	logger.Debugf("devices %+v", devices)
 	return devices, nil
 }
 
-func GetAvailableDevices(context *clusterd.Context, nodeName, clusterName string, devices []rookalpha.Device, filter string, useAllDevices bool) ([]rookalpha.Device, error) {
+// SetDeviceOwners records in the device inventory of the node which OSDs of the cluster use each device. The devices
+// of the cluster that are no longer used by any OSD are released.
+func SetDeviceOwners(context *clusterd.Context, nodeName, clusterName string, osdsByDevice map[string][]int) error {
+	namespace := os.Getenv(k8sutil.PodNamespaceEnvVar)
+	inventories := context.RookClientset.RookV1alpha2().DeviceInventories(namespace)
+	inventory, err := inventories.Get(nodeName, metav1.GetOptions{})
+	if err != nil {
+		if kserrors.IsNotFound(err) {
+			logger.Infof("no device inventory for node %s", nodeName)
+			return nil
+		}
+		return fmt.Errorf("failed to get device inventory of node %s: %+v", nodeName, err)
+	}
+
+	changed := false
+	for i := range inventory.Spec.Devices {
+		device := &inventory.Spec.Devices[i]
+		osds, used := osdsByDevice[device.Name]
+		if used {
+			owner := &rookalpha.DeviceOwner{ClusterName: clusterName, OSDIDs: osds}
+			if !reflect.DeepEqual(owner, device.Owner) {
+				if device.Owner != nil && device.Owner.ClusterName != clusterName {
+					logger.Warningf("device %s on node %s is owned by cluster %s but is used by cluster %s", device.Name, nodeName, device.Owner.ClusterName, clusterName)
+				}
+				device.Owner = owner
+				changed = true
+			}
+		} else if device.Owner != nil && device.Owner.ClusterName == clusterName {
+			device.Owner = nil
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+
+	if _, err := inventories.Update(inventory); err != nil {
+		return fmt.Errorf("failed to update the device owners of node %s: %+v", nodeName, err)
+	}
+	return nil
+}
+
+// GetAvailableDevices returns the devices of the node to use for the cluster: the given devices if any, otherwise the
+// devices matching the filter and the device selector
+func GetAvailableDevices(context *clusterd.Context, nodeName, clusterName string, devices []rookalpha.Device, filter string, useAllDevices bool,
+	selector *rookalpha.DeviceSelector) ([]rookalpha.Device, error) {
 	results := []rookalpha.Device{}
-	if len(devices) == 0 && len(filter) == 0 && !useAllDevices {
+	if len(devices) == 0 && len(filter) == 0 && !useAllDevices && selector == nil {
 		return results, nil
 	}
 	namespace := os.Getenv(k8sutil.PodNamespaceEnvVar)
-	allDevices, err := ListDevices(context, namespace, nodeName)
+	inventories, err := ListInventories(context, namespace, nodeName)
 	if err != nil {
 		return results, err
 	}
-	nodeDevices, ok := allDevices[nodeName]
+	inventory, ok := inventories[nodeName]
 	if !ok {
 		return results, fmt.Errorf("node %s has no devices", nodeName)
 	}
+
+	// the devices used by another cluster cannot be used by this cluster
+	var nodeDevices []sys.LocalDisk
+	for i := range inventory.Spec.Devices {
+		device := &inventory.Spec.Devices[i]
+		if device.Owner != nil && device.Owner.ClusterName != clusterName {
+			logger.Infof("skipping device %s on node %s that is used by cluster %s", device.Name, nodeName, device.Owner.ClusterName)
+			continue
+		}
+		nodeDevices = append(nodeDevices, discoverDaemon.ToLocalDisk(device))
+	}
+
 	if len(devices) > 0 {
 		for i := range devices {
 			for j := range nodeDevices {
-				if devices[i].Name == nodeDevices[j].Name {
-					results = append(results, devices[i])
+				if matchesDevice(devices[i], &nodeDevices[j]) {
+					d := devices[i]
+					d.Name = nodeDevices[j].Name
+					if d.FullPath == "" {
+						d.FullPath = clusterd.GetPersistentDeviceID(&nodeDevices[j])
+					}
+					results = append(results, d)
 				}
 			}
 		}
-	} else if len(filter) >= 0 {
+	} else {
+		// an empty filter matches all the devices
 		for i := range nodeDevices {
-			//TODO support filter based on other keys
 			matched, err := regexp.Match(filter, []byte(nodeDevices[i].Name))
-			if err == nil && matched {
-				d := rookalpha.Device{
-					Name: nodeDevices[i].Name,
-				}
-				results = append(results, d)
+			if err != nil || !matched {
+				continue
 			}
-		}
-	} else if useAllDevices {
-		for i := range nodeDevices {
-			d := rookalpha.Device{
-				Name: nodeDevices[i].Name,
+			matched, err = clusterd.MatchesDeviceSelector(&nodeDevices[i], selector)
+			if err != nil {
+				return results, fmt.Errorf("failed to select devices on node %s. %+v", nodeName, err)
+			}
+			if matched {
+				results = append(results, toDevice(&nodeDevices[i]))
 			}
-			results = append(results, d)
 		}
 	}
 
 	return results, nil
 }
+
+// matchesDevice checks whether the device from the storage spec refers to the discovered disk, preferring the
+// persistent path of the device if one was given
+func matchesDevice(device rookalpha.Device, disk *sys.LocalDisk) bool {
+	if device.FullPath != "" {
+		return clusterd.MatchesDevice(disk, device.FullPath)
+	}
+	return clusterd.MatchesDevice(disk, device.Name)
+}
+
+// toDevice converts a discovered disk to a device, identified by its persistent path if it has one
+func toDevice(disk *sys.LocalDisk) rookalpha.Device {
+	return rookalpha.Device{
+		Name:     disk.Name,
+		FullPath: clusterd.GetPersistentDeviceID(disk),
+	}
+}
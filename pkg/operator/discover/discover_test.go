@@ -18,14 +18,17 @@ limitations under the License.
 package discover
 
 import (
+	"encoding/json"
 	"os"
 	"testing"
 
 	rookalpha "github.com/rook/rook/pkg/apis/rook.io/v1alpha2"
+	rookfake "github.com/rook/rook/pkg/client/clientset/versioned/fake"
 	"github.com/rook/rook/pkg/clusterd"
 	discoverDaemon "github.com/rook/rook/pkg/daemon/discover"
 	"github.com/rook/rook/pkg/operator/k8sutil"
 	"github.com/rook/rook/pkg/operator/test"
+	"github.com/rook/rook/pkg/util/sys"
 
 	"github.com/stretchr/testify/assert"
 
@@ -62,6 +65,8 @@ func TestStartDiscoveryDaemonset(t *testing.T) {
 	assert.Equal(t, namespace, agentDS.Namespace)
 	assert.Equal(t, "rook-discover", agentDS.Name)
 	assert.False(t, *agentDS.Spec.Template.Spec.Containers[0].SecurityContext.Privileged)
+	assert.Equal(t, []v1.Capability{"SYS_RAWIO"}, agentDS.Spec.Template.Spec.Containers[0].SecurityContext.Capabilities.Add)
+	assert.True(t, agentDS.Spec.Template.Spec.HostNetwork)
 	volumes := agentDS.Spec.Template.Spec.Volumes
 	assert.Equal(t, 3, len(volumes))
 	volumeMounts := agentDS.Spec.Template.Spec.Containers[0].VolumeMounts
@@ -84,23 +89,27 @@ func TestGetAvailableDevices(t *testing.T) {
 	os.Setenv(k8sutil.PodNameEnvVar, "rook-operator")
 	defer os.Unsetenv(k8sutil.PodNameEnvVar)
 
-	data := make(map[string]string, 1)
-	data[discoverDaemon.LocalDiskCMData] = `[{"name":"sdd","parent":"","hasChildren":false,"devLinks":"/dev/disk/by-id/scsi-36001405f826bd553d8c4dbf9f41c18be    /dev/disk/by-id/wwn-0x6001405f826bd553d8c4dbf9f41c18be /dev/disk/by-path/ip-127.0.0.1:3260-iscsi-iqn.2016-06.world.srv:storage.target01-lun-1","size":10737418240,"uuid":"","serial":"36001405f826bd553d8c4dbf9f41c18be","type":"disk","rotational":true,"readOnly":false,"ownPartition":true,"filesystem":"","vendor":"LIO-ORG","model":"disk02","wwn":"0x6001405f826bd553","wwnVendorExtension":"0x6001405f826bd553d8c4dbf9f41c18be","empty":true},{"name":"sdb","parent":"","hasChildren":false,"devLinks":"/dev/disk/by-id/scsi-3600140577f462d9908b409d94114e042   /dev/disk/by-id/wwn-0x600140577f462d9908b409d94114e042 /dev/disk/by-path/ip-127.0.0.1:3260-iscsi-iqn.2016-06.world.srv:storage.target01-lun-3","size":5368709120,"uuid":"","serial":"3600140577f462d9908b409d94114e042","type":"disk","rotational":true,"readOnly":false,"ownPartition":false,"filesystem":"","vendor":"LIO-ORG","model":"disk04","wwn":"0x600140577f462d99","wwnVendorExtension":"0x600140577f462d9908b409d94114e042","empty":true},{"name":"sdc","parent":"","hasChildren":false,"devLinks":"/dev/disk/by-id/scsi-3600140568c0bd28d4ee43769387c9f02    /dev/disk/by-id/wwn-0x600140568c0bd28d4ee43769387c9f02 /dev/disk/by-path/ip-127.0.0.1:3260-iscsi-iqn.2016-06.world.srv:storage.target01-lun-2","size":5368709120,"uuid":"","serial":"3600140568c0bd28d4ee43769387c9f02","type":"disk","rotational":true,"readOnly":false,"ownPartition":true,"filesystem":"","vendor":"LIO-ORG","model":"disk03","wwn":"0x600140568c0bd28d","wwnVendorExtension":"0x600140568c0bd28d4ee43769387c9f02","empty":true},{"name":"sda","parent":"","hasChildren":false,"devLinks":"/dev/disk/by-id/scsi-36001405fc00c75fb4c243aa9d61987bd    /dev/disk/by-id/wwn-0x6001405fc00c75fb4c243aa9d61987bd /dev/disk/by-path/ip-127.0.0.1:3260-iscsi-iqn.2016-06.world.srv:storage.target01-lun-0","size":10737418240,"uuid":"","serial":"36001405fc00c75fb4c243aa9d61987bd","type":"disk","rotational":true,"readOnly":false,"ownPartition":false,"filesystem":"","vendor":"LIO-ORG","model":"disk01","wwn":"0x6001405fc00c75fb","wwnVendorExtension":"0x6001405fc00c75fb4c243aa9d61987bd","empty":true},{"name":"nvme0n1","parent":"","hasChildren":false,"devLinks":"/dev/disk/by-id/nvme-eui.002538c5710091a7","size":512110190592,"uuid":"","serial":"","type":"disk","rotational":false,"readOnly":false,"ownPartition":false,"filesystem":"","vendor":"","model":"","wwn":"","wwnVendorExtension":"","empty":true}]`
-	cm := &v1.ConfigMap{
+	devicesJSON := `[{"name":"sdd","parent":"","hasChildren":false,"devLinks":"/dev/disk/by-id/scsi-36001405f826bd553d8c4dbf9f41c18be    /dev/disk/by-id/wwn-0x6001405f826bd553d8c4dbf9f41c18be /dev/disk/by-path/ip-127.0.0.1:3260-iscsi-iqn.2016-06.world.srv:storage.target01-lun-1","size":10737418240,"uuid":"","serial":"36001405f826bd553d8c4dbf9f41c18be","type":"disk","rotational":true,"readOnly":false,"ownPartition":true,"filesystem":"","vendor":"LIO-ORG","model":"disk02","wwn":"0x6001405f826bd553","wwnVendorExtension":"0x6001405f826bd553d8c4dbf9f41c18be","empty":true},{"name":"sdb","parent":"","hasChildren":false,"devLinks":"/dev/disk/by-id/scsi-3600140577f462d9908b409d94114e042   /dev/disk/by-id/wwn-0x600140577f462d9908b409d94114e042 /dev/disk/by-path/ip-127.0.0.1:3260-iscsi-iqn.2016-06.world.srv:storage.target01-lun-3","size":5368709120,"uuid":"","serial":"3600140577f462d9908b409d94114e042","type":"disk","rotational":true,"readOnly":false,"ownPartition":false,"filesystem":"","vendor":"LIO-ORG","model":"disk04","wwn":"0x600140577f462d99","wwnVendorExtension":"0x600140577f462d9908b409d94114e042","empty":true},{"name":"sdc","parent":"","hasChildren":false,"devLinks":"/dev/disk/by-id/scsi-3600140568c0bd28d4ee43769387c9f02    /dev/disk/by-id/wwn-0x600140568c0bd28d4ee43769387c9f02 /dev/disk/by-path/ip-127.0.0.1:3260-iscsi-iqn.2016-06.world.srv:storage.target01-lun-2","size":5368709120,"uuid":"","serial":"3600140568c0bd28d4ee43769387c9f02","type":"disk","rotational":true,"readOnly":false,"ownPartition":true,"filesystem":"","vendor":"LIO-ORG","model":"disk03","wwn":"0x600140568c0bd28d","wwnVendorExtension":"0x600140568c0bd28d4ee43769387c9f02","empty":true},{"name":"sda","parent":"","hasChildren":false,"devLinks":"/dev/disk/by-id/scsi-36001405fc00c75fb4c243aa9d61987bd    /dev/disk/by-id/wwn-0x6001405fc00c75fb4c243aa9d61987bd /dev/disk/by-path/ip-127.0.0.1:3260-iscsi-iqn.2016-06.world.srv:storage.target01-lun-0","size":10737418240,"uuid":"","serial":"36001405fc00c75fb4c243aa9d61987bd","type":"disk","rotational":true,"readOnly":false,"ownPartition":false,"filesystem":"","vendor":"LIO-ORG","model":"disk01","wwn":"0x6001405fc00c75fb","wwnVendorExtension":"0x6001405fc00c75fb4c243aa9d61987bd","empty":true},{"name":"nvme0n1","parent":"","hasChildren":false,"devLinks":"/dev/disk/by-id/nvme-eui.002538c5710091a7","size":512110190592,"uuid":"","serial":"","type":"disk","rotational":false,"readOnly":false,"ownPartition":false,"filesystem":"","vendor":"","model":"","wwn":"","wwnVendorExtension":"","empty":true}]`
+	var disks []sys.LocalDisk
+	assert.Nil(t, json.Unmarshal([]byte(devicesJSON), &disks))
+	inventory := &rookalpha.DeviceInventory{
 		ObjectMeta: metav1.ObjectMeta{
-			Name:      "local-device-" + nodeName,
+			Name:      nodeName,
 			Namespace: ns,
 			Labels: map[string]string{
 				k8sutil.AppAttr:         discoverDaemon.AppName,
 				discoverDaemon.NodeAttr: nodeName,
 			},
 		},
-		Data: data,
+		Spec: rookalpha.DeviceInventorySpec{NodeName: nodeName},
 	}
-	_, err := clientset.CoreV1().ConfigMaps(ns).Create(cm)
-	assert.Nil(t, err)
+	for i := range disks {
+		inventory.Spec.Devices = append(inventory.Spec.Devices, discoverDaemon.ToDiscoveredDevice(&disks[i]))
+	}
+	rookClientset := rookfake.NewSimpleClientset(inventory)
 	context := &clusterd.Context{
-		Clientset: clientset,
+		Clientset:     clientset,
+		RookClientset: rookClientset,
 	}
 	d := []rookalpha.Device{
 		{
@@ -115,13 +124,93 @@ func TestGetAvailableDevices(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(nodeDevices))
 
-	devices, err := GetAvailableDevices(context, nodeName, ns, d, "^sd.", false)
+	devices, err := GetAvailableDevices(context, nodeName, ns, d, "^sd.", false, nil)
 	assert.Nil(t, err)
 	assert.Equal(t, 1, len(devices))
-	devices, err = GetAvailableDevices(context, nodeName, ns, nil, "^sd.", false)
+	assert.Equal(t, "sdc", devices[0].Name)
+	assert.Equal(t, "/dev/disk/by-id/scsi-3600140568c0bd28d4ee43769387c9f02", devices[0].FullPath)
+
+	// devices can be specified by their persistent paths or their wwn
+	d = []rookalpha.Device{
+		{FullPath: "/dev/disk/by-id/wwn-0x600140577f462d9908b409d94114e042"},
+		{FullPath: "/dev/disk/by-path/ip-127.0.0.1:3260-iscsi-iqn.2016-06.world.srv:storage.target01-lun-0"},
+		{FullPath: "0x6001405f826bd553"},
+		{FullPath: "/dev/disk/by-id/wwn-0x0000000000000000"},
+	}
+	devices, err = GetAvailableDevices(context, nodeName, ns, d, "", false, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, len(devices))
+	assert.Equal(t, "sdb", devices[0].Name)
+	assert.Equal(t, "/dev/disk/by-id/wwn-0x600140577f462d9908b409d94114e042", devices[0].FullPath)
+	assert.Equal(t, "sda", devices[1].Name)
+	assert.Equal(t, "sdd", devices[2].Name)
+	assert.Equal(t, "0x6001405f826bd553", devices[2].FullPath)
+
+	devices, err = GetAvailableDevices(context, nodeName, ns, nil, "^sd.", false, nil)
 	assert.Nil(t, err)
 	assert.Equal(t, 4, len(devices))
-	devices, err = GetAvailableDevices(context, nodeName, ns, nil, "", true)
+	devices, err = GetAvailableDevices(context, nodeName, ns, nil, "", true, nil)
 	assert.Nil(t, err)
 	assert.Equal(t, 5, len(devices))
+
+	// the devices can be selected by their properties, with or without a filter
+	nonRotational := false
+	devices, err = GetAvailableDevices(context, nodeName, ns, nil, "", false, &rookalpha.DeviceSelector{Rotational: &nonRotational})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(devices))
+	assert.Equal(t, "nvme0n1", devices[0].Name)
+	devices, err = GetAvailableDevices(context, nodeName, ns, nil, "^sd.", false, &rookalpha.DeviceSelector{MinSize: "10Gi", Model: "^disk0[12]$"})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(devices))
+	_, err = GetAvailableDevices(context, nodeName, ns, nil, "", true, &rookalpha.DeviceSelector{MaxSize: "huge"})
+	assert.NotNil(t, err)
+
+	// the devices used by another cluster are not available
+	assert.Nil(t, SetDeviceOwners(context, nodeName, "other-cluster", map[string][]int{"sda": {4}}))
+	devices, err = GetAvailableDevices(context, nodeName, ns, nil, "", true, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 4, len(devices))
+	devices, err = GetAvailableDevices(context, nodeName, "other-cluster", nil, "", true, nil)
+	assert.Nil(t, err)
+	assert.Equal(t, 5, len(devices))
+}
+
+func TestSetDeviceOwners(t *testing.T) {
+	os.Setenv(k8sutil.PodNamespaceEnvVar, "rook-system")
+	defer os.Unsetenv(k8sutil.PodNamespaceEnvVar)
+
+	inventory := &rookalpha.DeviceInventory{
+		ObjectMeta: metav1.ObjectMeta{Name: "node1", Namespace: "rook-system"},
+		Spec: rookalpha.DeviceInventorySpec{NodeName: "node1", Devices: []rookalpha.DiscoveredDevice{
+			{Name: "sda"}, {Name: "sdb"}, {Name: "sdc", Owner: &rookalpha.DeviceOwner{ClusterName: "other", OSDIDs: []int{7}}}}},
+	}
+	rookClientset := rookfake.NewSimpleClientset(inventory)
+	context := &clusterd.Context{RookClientset: rookClientset}
+
+	getOwners := func() []*rookalpha.DeviceOwner {
+		inventory, err := rookClientset.RookV1alpha2().DeviceInventories("rook-system").Get("node1", metav1.GetOptions{})
+		assert.Nil(t, err)
+		var owners []*rookalpha.DeviceOwner
+		for _, d := range inventory.Spec.Devices {
+			owners = append(owners, d.Owner)
+		}
+		return owners
+	}
+
+	// the osds of the cluster are recorded on their devices
+	assert.Nil(t, SetDeviceOwners(context, "node1", "rook", map[string][]int{"sda": {0, 1}, "sdb": {2}}))
+	owners := getOwners()
+	assert.Equal(t, &rookalpha.DeviceOwner{ClusterName: "rook", OSDIDs: []int{0, 1}}, owners[0])
+	assert.Equal(t, &rookalpha.DeviceOwner{ClusterName: "rook", OSDIDs: []int{2}}, owners[1])
+	assert.Equal(t, "other", owners[2].ClusterName)
+
+	// a device no longer used by the cluster is released, the devices of other clusters are kept
+	assert.Nil(t, SetDeviceOwners(context, "node1", "rook", map[string][]int{"sda": {0, 1}}))
+	owners = getOwners()
+	assert.NotNil(t, owners[0])
+	assert.Nil(t, owners[1])
+	assert.Equal(t, "other", owners[2].ClusterName)
+
+	// no inventory for the node
+	assert.Nil(t, SetDeviceOwners(context, "node2", "rook", nil))
 }
@@ -0,0 +1,73 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package k8sutil
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const eventSourceComponent = "rook-ceph-operator"
+
+// RaiseWarningEvent raises a warning event for the object, such as a cluster CRD. A warning raised again with the same
+// reason and message bumps the count of its event instead of creating another event, so the monitors can raise their
+// warnings on each check. Warnings with the same reason but other messages, such as for another device, keep their
+// own events.
+func RaiseWarningEvent(clientset kubernetes.Interface, object v1.ObjectReference, reason, message string) error {
+	now := metav1.Now()
+	events := clientset.CoreV1().Events(object.Namespace)
+	hash := fnv.New32a()
+	hash.Write([]byte(message))
+	name := fmt.Sprintf("%s.%s.%x", object.Name, strings.ToLower(reason), hash.Sum32())
+	event, err := events.Get(name, metav1.GetOptions{})
+	if err == nil {
+		event.InvolvedObject = object
+		event.LastTimestamp = now
+		event.Count++
+		if _, err := events.Update(event); err != nil {
+			return fmt.Errorf("failed to update event for %s %s. %+v", object.Kind, object.Name, err)
+		}
+		return nil
+	}
+	if !errors.IsNotFound(err) {
+		return fmt.Errorf("failed to get event for %s %s. %+v", object.Kind, object.Name, err)
+	}
+
+	event = &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: object.Namespace,
+		},
+		InvolvedObject: object,
+		Reason:         reason,
+		Message:        message,
+		Source:         v1.EventSource{Component: eventSourceComponent},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+		Type:           v1.EventTypeWarning,
+	}
+	if _, err := events.Create(event); err != nil {
+		return fmt.Errorf("failed to create event for %s %s. %+v", object.Kind, object.Name, err)
+	}
+	return nil
+}
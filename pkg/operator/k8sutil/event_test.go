@@ -0,0 +1,52 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package k8sutil
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestRaiseWarningEvent(t *testing.T) {
+	clientset := fake.NewSimpleClientset()
+	object := v1.ObjectReference{Kind: "Cluster", Name: "mycluster", Namespace: "ns"}
+
+	assert.Nil(t, RaiseWarningEvent(clientset, object, "CrushSettings", "first"))
+	events, err := clientset.CoreV1().Events("ns").List(metav1.ListOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(events.Items))
+	assert.True(t, strings.HasPrefix(events.Items[0].Name, "mycluster.crushsettings."))
+	assert.Equal(t, int32(1), events.Items[0].Count)
+	assert.Equal(t, v1.EventTypeWarning, events.Items[0].Type)
+
+	// the event is updated when the warning is raised again
+	assert.Nil(t, RaiseWarningEvent(clientset, object, "CrushSettings", "first"))
+	events, err = clientset.CoreV1().Events("ns").List(metav1.ListOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 1, len(events.Items))
+	assert.Equal(t, int32(2), events.Items[0].Count)
+
+	// another warning has its own event
+	assert.Nil(t, RaiseWarningEvent(clientset, object, "CrushSettings", "second"))
+	events, err = clientset.CoreV1().Events("ns").List(metav1.ListOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, len(events.Items))
+}
@@ -0,0 +1,112 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package k8sutil
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// CRDFinalizer adds and removes a finalizer on the CRDs of a kind in a namespace. The CRDs are read and written with
+// the typed client of their kind.
+type CRDFinalizer struct {
+	// The name of the finalizer, such as pool.ceph.rook.io
+	Name string
+	// The kind of the CRDs in the messages, such as pool
+	Kind   string
+	Get    func(name string) (metav1.Object, error)
+	List   func() ([]metav1.Object, error)
+	Update func(obj metav1.Object) error
+}
+
+// Add adds the finalizer to the latest version of the CRD
+func (f *CRDFinalizer) Add(name string) error {
+	obj, err := f.Get(name)
+	if err != nil {
+		return err
+	}
+	for _, finalizer := range obj.GetFinalizers() {
+		if finalizer == f.Name {
+			return nil
+		}
+	}
+	obj.SetFinalizers(append(obj.GetFinalizers(), f.Name))
+	if err := f.Update(obj); err != nil {
+		return fmt.Errorf("failed to add finalizer to %s %s. %+v", f.Kind, name, err)
+	}
+	return nil
+}
+
+// Remove removes the finalizer from the latest version of the CRD. There is nothing to remove if the CRD is gone.
+func (f *CRDFinalizer) Remove(name string) error {
+	obj, err := f.Get(name)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil
+		}
+		return err
+	}
+	var remaining []string
+	for _, finalizer := range obj.GetFinalizers() {
+		if finalizer != f.Name {
+			remaining = append(remaining, finalizer)
+		}
+	}
+	if len(remaining) == len(obj.GetFinalizers()) {
+		return nil
+	}
+	obj.SetFinalizers(remaining)
+	if err := f.Update(obj); err != nil {
+		return fmt.Errorf("failed to remove finalizer from %s %s. %+v", f.Kind, name, err)
+	}
+	logger.Infof("removed finalizer from %s %s", f.Kind, name)
+	return nil
+}
+
+// RemoveAll removes the finalizer from all the CRDs, such as when their cluster is deleted and the operator stops
+// watching them
+func (f *CRDFinalizer) RemoveAll() error {
+	objs, err := f.List()
+	if err != nil {
+		return fmt.Errorf("failed to list %ss. %+v", f.Kind, err)
+	}
+	for _, obj := range objs {
+		if err := f.Remove(obj.GetName()); err != nil {
+			logger.Warningf("%+v", err)
+		}
+	}
+	return nil
+}
+
+// RetryDeletions calls finalize for each deleted CRD, whose deletion is blocked by its finalizer until finalize
+// succeeds
+func (f *CRDFinalizer) RetryDeletions(finalize func(obj metav1.Object) error) error {
+	objs, err := f.List()
+	if err != nil {
+		return fmt.Errorf("failed to list %ss. %+v", f.Kind, err)
+	}
+	for _, obj := range objs {
+		if obj.GetDeletionTimestamp() == nil {
+			continue
+		}
+		if err := finalize(obj); err != nil {
+			logger.Warningf("failed to delete %s %s. %+v", f.Kind, obj.GetName(), err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package k8sutil
+
+import (
+	"time"
+)
+
+// RunMonitor runs the check of a monitor each time the interval has passed, until the stop channel is closed. The
+// interval is read again before each wait so that it follows the settings of the monitor.
+func RunMonitor(name, namespace string, stopCh chan struct{}, interval func() time.Duration, check func()) {
+	for {
+		select {
+		case <-stopCh:
+			logger.Infof("stopping %s in namespace %s", name, namespace)
+			return
+		case <-time.After(interval()):
+			check()
+		}
+	}
+}
@@ -0,0 +1,37 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package test
+
+import (
+	"strings"
+)
+
+// CephCommand joins the args of a ceph, rados or rbd command passed to the mock executor, without the flags the ceph
+// client adds to find the cluster and to format the output. For example, "osd crush move node1 rack=rack1".
+func CephCommand(args ...string) string {
+	var command []string
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "--format":
+			// skip the format too
+			i++
+		case strings.HasPrefix(args[i], "--cluster="), strings.HasPrefix(args[i], "--conf="), strings.HasPrefix(args[i], "--keyring="):
+		default:
+			command = append(command, args[i])
+		}
+	}
+	return strings.Join(command, " ")
+}
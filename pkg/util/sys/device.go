@@ -33,6 +33,9 @@ const (
 	CryptType = "crypt"
 	sgdisk    = "sgdisk"
 	mountCmd  = "mount"
+
+	DiskByIDPath   = "/dev/disk/by-id/"
+	DiskByPathPath = "/dev/disk/by-path/"
 )
 
 type Partition struct {
@@ -76,8 +79,12 @@ type LocalDisk struct {
 	WWN string `json:"wwn"`
 	// WWNVendorExtension is the WWN_VENDOR_EXTENSION from udev info
 	WWNVendorExtension string `json:"wwnVendorExtension"`
+	// Transport is the transport of the device such as sata, sas, nvme or usb
+	Transport string `json:"transport"`
 	// Empty checks whether the device is completely empty
 	Empty bool `json:"empty"`
+	// Health is the SMART health of the device, if the device supports SMART
+	Health *DeviceHealth `json:"health,omitempty"`
 }
 
 func ListDevices(executor exec.Executor) ([]string, error) {
@@ -148,7 +155,7 @@ func GetDeviceProperties(device string, executor exec.Executor) (map[string]stri
 func GetDevicePropertiesFromPath(devicePath string, executor exec.Executor) (map[string]string, error) {
 	cmd := fmt.Sprintf("lsblk %s", devicePath)
 	output, err := executor.ExecuteCommandWithOutput(false, cmd, "lsblk", devicePath,
-		"--bytes", "--nodeps", "--pairs", "--output", "SIZE,ROTA,RO,TYPE,PKNAME")
+		"--bytes", "--nodeps", "--pairs", "--output", "SIZE,ROTA,RO,TYPE,PKNAME,TRAN")
 	if err != nil {
 		// try to get more information about the command error
 		cmdErr, ok := err.(*exec.CommandError)
@@ -201,6 +208,15 @@ func RemovePartitions(device string, executor exec.Executor) error {
 	return nil
 }
 
+// DeletePartition deletes the partition with the given number from the device, leaving the other partitions intact
+func DeletePartition(device string, number int, executor exec.Executor) error {
+	cmd := fmt.Sprintf("delete partition %d on %s", number, device)
+	if err := executor.ExecuteCommand(false, cmd, sgdisk, fmt.Sprintf("--delete=%d", number), "/dev/"+device); err != nil {
+		return fmt.Errorf("failed to delete partition %d on /dev/%s: %+v", number, device, err)
+	}
+	return nil
+}
+
 func CreatePartitions(device string, args []string, executor exec.Executor) error {
 	cmd := fmt.Sprintf("partition %s", device)
 	return executor.ExecuteCommand(false, cmd, sgdisk, args...)
@@ -0,0 +1,117 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package sys
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/rook/rook/pkg/util/exec"
+)
+
+// ATA SMART attributes reporting the health of a device
+const (
+	smartReallocatedSectorCount = 5
+	smartSSDLifeLeft            = 231
+	smartMediaWearoutIndicator  = 233
+	smartWearLevelingCount      = 177
+)
+
+// DeviceHealth is the SMART health of a device
+type DeviceHealth struct {
+	// Passed is whether the device passed its SMART overall health self-assessment
+	Passed bool `json:"passed"`
+	// ReallocatedSectors is the number of sectors that were remapped after read or write errors
+	ReallocatedSectors int `json:"reallocatedSectors"`
+	// WearLevelPercent is the percent of the rated endurance of an SSD that is used
+	WearLevelPercent int `json:"wearLevelPercent,omitempty"`
+	// Temperature is the current temperature of the device in Celsius
+	Temperature int `json:"temperature"`
+}
+
+type smartctlOutput struct {
+	SmartStatus *struct {
+		Passed bool `json:"passed"`
+	} `json:"smart_status"`
+	Temperature struct {
+		Current int `json:"current"`
+	} `json:"temperature"`
+	ATAAttributes struct {
+		Table []smartctlAttribute `json:"table"`
+	} `json:"ata_smart_attributes"`
+	NVMeHealth *struct {
+		PercentageUsed int `json:"percentage_used"`
+		MediaErrors    int `json:"media_errors"`
+	} `json:"nvme_smart_health_information_log"`
+	SCSIGrownDefects int `json:"scsi_grown_defect_list"`
+}
+
+type smartctlAttribute struct {
+	ID    int `json:"id"`
+	Value int `json:"value"`
+	Raw   struct {
+		Value int `json:"value"`
+	} `json:"raw"`
+}
+
+// GetDeviceHealth returns the SMART health of a device reported by smartctl
+func GetDeviceHealth(device string, executor exec.Executor) (*DeviceHealth, error) {
+	cmd := fmt.Sprintf("smartctl %s", device)
+	output, err := executor.ExecuteCommandWithOutput(false, cmd, "smartctl", "--json", "--all", "/dev/"+device)
+	// smartctl exits with a non-zero status when the device reports problems, the output is still valid then
+	if output == "" {
+		if err != nil {
+			return nil, fmt.Errorf("failed to get smart data of device %s. %+v", device, err)
+		}
+		return nil, fmt.Errorf("no smart data for device %s", device)
+	}
+
+	return ParseDeviceHealth(output)
+}
+
+// ParseDeviceHealth parses the json output of smartctl
+func ParseDeviceHealth(output string) (*DeviceHealth, error) {
+	var result smartctlOutput
+	if err := json.Unmarshal([]byte(output), &result); err != nil {
+		return nil, fmt.Errorf("failed to parse smart data. %+v", err)
+	}
+	if result.SmartStatus == nil {
+		return nil, fmt.Errorf("smart is not available")
+	}
+
+	health := &DeviceHealth{
+		Passed:             result.SmartStatus.Passed,
+		Temperature:        result.Temperature.Current,
+		ReallocatedSectors: result.SCSIGrownDefects,
+	}
+	if result.NVMeHealth != nil {
+		health.WearLevelPercent = result.NVMeHealth.PercentageUsed
+		health.ReallocatedSectors = result.NVMeHealth.MediaErrors
+	}
+	for _, attr := range result.ATAAttributes.Table {
+		switch attr.ID {
+		case smartReallocatedSectorCount:
+			health.ReallocatedSectors = attr.Raw.Value
+		case smartWearLevelingCount, smartMediaWearoutIndicator, smartSSDLifeLeft:
+			// the normalized value counts down from 100 as the endurance is used
+			if attr.Value <= 100 {
+				health.WearLevelPercent = 100 - attr.Value
+			}
+		}
+	}
+
+	return health, nil
+}
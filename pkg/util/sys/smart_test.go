@@ -0,0 +1,71 @@
+/*
+Copyright 2018 The Rook Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package sys
+
+import (
+	"fmt"
+	"testing"
+
+	exectest "github.com/rook/rook/pkg/util/exec/test"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseDeviceHealth(t *testing.T) {
+	// ata hdd
+	health, err := ParseDeviceHealth(`{"smart_status":{"passed":true},"temperature":{"current":34},
+		"ata_smart_attributes":{"table":[{"id":5,"value":100,"raw":{"value":8}},{"id":194,"value":66,"raw":{"value":34}}]}}`)
+	assert.Nil(t, err)
+	assert.Equal(t, DeviceHealth{Passed: true, ReallocatedSectors: 8, Temperature: 34}, *health)
+
+	// ata ssd
+	health, err = ParseDeviceHealth(`{"smart_status":{"passed":false},"temperature":{"current":41},
+		"ata_smart_attributes":{"table":[{"id":5,"value":100,"raw":{"value":0}},{"id":177,"value":85,"raw":{"value":412}}]}}`)
+	assert.Nil(t, err)
+	assert.Equal(t, DeviceHealth{Passed: false, WearLevelPercent: 15, Temperature: 41}, *health)
+
+	// nvme
+	health, err = ParseDeviceHealth(`{"smart_status":{"passed":true},"temperature":{"current":38},
+		"nvme_smart_health_information_log":{"percentage_used":3,"media_errors":1}}`)
+	assert.Nil(t, err)
+	assert.Equal(t, DeviceHealth{Passed: true, ReallocatedSectors: 1, WearLevelPercent: 3, Temperature: 38}, *health)
+
+	// smart not supported
+	_, err = ParseDeviceHealth(`{"device":{"name":"/dev/sda"}}`)
+	assert.NotNil(t, err)
+	_, err = ParseDeviceHealth(`not json`)
+	assert.NotNil(t, err)
+}
+
+func TestGetDeviceHealth(t *testing.T) {
+	executor := &exectest.MockExecutor{
+		MockExecuteCommandWithOutput: func(debug bool, actionName string, command string, args ...string) (string, error) {
+			assert.Equal(t, "smartctl", command)
+			assert.Equal(t, "/dev/sda", args[len(args)-1])
+			// smartctl sets a status bit when the device is failing
+			return `{"smart_status":{"passed":false},"temperature":{"current":50}}`, fmt.Errorf("exit status 8")
+		},
+	}
+	health, err := GetDeviceHealth("sda", executor)
+	assert.Nil(t, err)
+	assert.False(t, health.Passed)
+	assert.Equal(t, 50, health.Temperature)
+
+	executor.MockExecuteCommandWithOutput = func(debug bool, actionName string, command string, args ...string) (string, error) {
+		return "", fmt.Errorf("not found")
+	}
+	_, err = GetDeviceHealth("sda", executor)
+	assert.NotNil(t, err)
+}
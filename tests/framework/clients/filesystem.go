@@ -48,6 +48,7 @@ metadata:
   name: %s
   namespace: %s
 spec:
+  deletionPolicy: Delete
   metadataPool:
     replicated:
       size: 1
@@ -17,6 +17,7 @@ limitations under the License.
 package clients
 
 import (
+	"encoding/json"
 	"fmt"
 	"strconv"
 
@@ -104,3 +105,47 @@ func (p *PoolOperation) CephPoolExists(namespace, name string) (bool, error) {
 	}
 	return false, nil
 }
+
+func (p *PoolOperation) GetMirrorPoolInfo(namespace, name string) (*client.MirrorPoolInfo, error) {
+	context := p.k8sh.MakeContext()
+	info, err := client.GetMirrorPoolInfo(context, namespace, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pool %s mirroring info: %+v", name, err)
+	}
+	return info, nil
+}
+
+// WriteMirroredImage creates an image with the journaling feature replayed by rbd-mirror, enables its mirroring and
+// writes data to it through the journal
+func (p *PoolOperation) WriteMirroredImage(namespace, poolName, imageName string) error {
+	context := p.k8sh.MakeContext()
+	image := fmt.Sprintf("%s/%s", poolName, imageName)
+	commands := [][]string{
+		{"create", image, "--size", "64", "--image-feature", "layering,exclusive-lock,journaling"},
+		{"mirror", "image", "enable", image},
+		{"bench", image, "--io-type", "write", "--io-size", "4096", "--io-total", "4M"},
+	}
+	for _, args := range commands {
+		if output, err := client.ExecuteRBDCommandNoFormat(context, namespace, args); err != nil {
+			return fmt.Errorf("failed to run rbd %v: %+v. %s", args, err, string(output))
+		}
+	}
+	return nil
+}
+
+// GetMirrorImageStatus returns the mirroring state of the image, such as up+replaying, and its description
+func (p *PoolOperation) GetMirrorImageStatus(namespace, poolName, imageName string) (string, string, error) {
+	context := p.k8sh.MakeContext()
+	output, err := client.ExecuteRBDCommand(context, namespace, []string{"mirror", "image", "status", fmt.Sprintf("%s/%s", poolName, imageName)})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get image %s mirroring status: %+v", imageName, err)
+	}
+	var status struct {
+		State       string `json:"state"`
+		Description string `json:"description"`
+	}
+	if err := json.Unmarshal(output, &status); err != nil {
+		return "", "", fmt.Errorf("failed to unmarshal image %s mirroring status: %+v. %s", imageName, err, string(output))
+	}
+	return status.State, status.Description, nil
+}
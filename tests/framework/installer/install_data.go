@@ -88,6 +88,34 @@ spec:
 ---
 apiVersion: apiextensions.k8s.io/v1beta1
 kind: CustomResourceDefinition
+metadata:
+  name: erasurecodeprofiles.ceph.rook.io
+spec:
+  group: ceph.rook.io
+  names:
+    kind: ErasureCodeProfile
+    listKind: ErasureCodeProfileList
+    plural: erasurecodeprofiles
+    singular: erasurecodeprofile
+  scope: Namespaced
+  version: v1alpha1
+---
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
+metadata:
+  name: deviceinventories.rook.io
+spec:
+  group: rook.io
+  names:
+    kind: DeviceInventory
+    listKind: DeviceInventoryList
+    plural: deviceinventories
+    singular: deviceinventory
+  scope: Namespaced
+  version: v1alpha2
+---
+apiVersion: apiextensions.k8s.io/v1beta1
+kind: CustomResourceDefinition
 metadata:
   name: volumes.rook.io
 spec:
@@ -149,6 +177,17 @@ rules:
   - create
   - update
   - delete
+- apiGroups:
+  - batch
+  resources:
+  - jobs
+  verbs:
+  - get
+  - list
+  - watch
+  - create
+  - update
+  - delete
 - apiGroups:
   - rbac.authorization.k8s.io
   resources:
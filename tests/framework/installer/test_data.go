@@ -15,6 +15,7 @@ metadata:
   name: ` + poolName + `
   namespace: ` + namespace + `
 spec:
+  deletionPolicy: Delete
   replicated:
     size: ` + replicaSize
 }
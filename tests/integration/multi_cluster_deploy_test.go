@@ -18,9 +18,12 @@ package integration
 
 import (
 	"fmt"
+	"strings"
 	"testing"
 	"time"
 
+	cephv1alpha1 "github.com/rook/rook/pkg/apis/ceph.rook.io/v1alpha1"
+	"github.com/rook/rook/pkg/operator/ceph/cluster/rbd"
 	"github.com/rook/rook/tests/framework/clients"
 	"github.com/rook/rook/tests/framework/contracts"
 	"github.com/rook/rook/tests/framework/installer"
@@ -28,6 +31,8 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // *************************************************************
@@ -45,6 +50,8 @@ import (
 // - Create a file system via the CRD
 // Object
 // - Create the object store via the CRD
+// RBD mirroring
+// - Mirror a pool of the first cluster into the second cluster and replay a journaled image
 // *************************************************************
 func TestMultiClusterDeploySuite(t *testing.T) {
 	s := new(MultiClusterDeploySuite)
@@ -124,6 +131,102 @@ func (mrc *MultiClusterDeploySuite) TestObjectStoreOnMultiRookCluster() {
 	runObjectE2ETestLite(mrc.helper2, mrc.k8sh, mrc.Suite, mrc.namespace2, "default-c2", 1)
 }
 
+//Test the mirroring of a pool from the first cluster into the second cluster
+func (mrc *MultiClusterDeploySuite) TestRBDMirroringBetweenRookClusters() {
+	poolName := "multi-cluster-mirror"
+	logger.Infof("mirroring pool %s from cluster %s to cluster %s", poolName, mrc.namespace1, mrc.namespace2)
+
+	// the second cluster runs an rbd-mirror daemon to replay the images of the first cluster
+	cluster, err := mrc.k8sh.RookClientset.CephV1alpha1().Clusters(mrc.namespace2).Get(mrc.namespace2, metav1.GetOptions{})
+	require.Nil(mrc.T(), err)
+	cluster.Spec.RBDMirroring.Workers = 1
+	_, err = mrc.k8sh.RookClientset.CephV1alpha1().Clusters(mrc.namespace2).Update(cluster)
+	require.Nil(mrc.T(), err)
+	require.Nil(mrc.T(), mrc.k8sh.WaitForPodCount("app=rook-ceph-rbd-mirror", mrc.namespace2, 1))
+
+	// mirror the pool in both clusters
+	for _, namespace := range []string{mrc.namespace1, mrc.namespace2} {
+		pool := &cephv1alpha1.Pool{
+			ObjectMeta: metav1.ObjectMeta{Name: poolName, Namespace: namespace},
+			Spec: cephv1alpha1.PoolSpec{
+				Replicated: cephv1alpha1.ReplicatedSpec{Size: 1},
+				Mirroring:  cephv1alpha1.MirroringSpec{Mode: "image"},
+			},
+		}
+		_, err := mrc.k8sh.RookClientset.CephV1alpha1().Pools(namespace).Create(pool)
+		require.Nil(mrc.T(), err)
+	}
+	defer func() {
+		for _, namespace := range []string{mrc.namespace1, mrc.namespace2} {
+			if err := mrc.k8sh.RookClientset.CephV1alpha1().Pools(namespace).Delete(poolName, &metav1.DeleteOptions{}); err != nil {
+				logger.Warningf("failed to delete pool %s in %s. %+v", poolName, namespace, err)
+			}
+		}
+	}()
+
+	// copy the bootstrap secret of the first cluster to the second cluster as the peer
+	var bootstrap *v1.Secret
+	for i := 0; i < utils.RetryLoop; i++ {
+		bootstrap, err = mrc.k8sh.Clientset.CoreV1().Secrets(mrc.namespace1).Get(rbd.BootstrapSecretName, metav1.GetOptions{})
+		if err == nil {
+			break
+		}
+		logger.Infof("waiting for the bootstrap secret of cluster %s", mrc.namespace1)
+		time.Sleep(utils.RetryInterval * time.Second)
+	}
+	require.Nil(mrc.T(), err)
+	peer := &v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: mrc.namespace1, Namespace: mrc.namespace2}, Data: bootstrap.Data}
+	_, err = mrc.k8sh.Clientset.CoreV1().Secrets(mrc.namespace2).Create(peer)
+	require.Nil(mrc.T(), err)
+	defer mrc.k8sh.Clientset.CoreV1().Secrets(mrc.namespace2).Delete(peer.Name, &metav1.DeleteOptions{})
+
+	pool, err := mrc.k8sh.RookClientset.CephV1alpha1().Pools(mrc.namespace2).Get(poolName, metav1.GetOptions{})
+	require.Nil(mrc.T(), err)
+	pool.Spec.Mirroring.Peers = []cephv1alpha1.MirroringPeerSpec{{SecretName: mrc.namespace1}}
+	_, err = mrc.k8sh.RookClientset.CephV1alpha1().Pools(mrc.namespace2).Update(pool)
+	require.Nil(mrc.T(), err)
+
+	// the peer is added to the pool of the second cluster
+	added := false
+	for i := 0; i < utils.RetryLoop && !added; i++ {
+		info, err := mrc.helper2.PoolClient.GetMirrorPoolInfo(mrc.namespace2, poolName)
+		if err != nil {
+			logger.Warningf("failed to get the mirroring of pool %s. %+v", poolName, err)
+		} else {
+			assert.Equal(mrc.T(), "image", info.Mode)
+			for _, p := range info.Peers {
+				if p.ClusterName == mrc.namespace1 {
+					added = true
+				}
+			}
+		}
+		if !added {
+			logger.Infof("waiting for peer %s of pool %s", mrc.namespace1, poolName)
+			time.Sleep(utils.RetryInterval * time.Second)
+		}
+	}
+	require.True(mrc.T(), added)
+
+	// an image written in the first cluster is replayed into the second cluster
+	imageName := "mirrored-image"
+	require.Nil(mrc.T(), mrc.helper1.PoolClient.WriteMirroredImage(mrc.namespace1, poolName, imageName))
+	replayed := false
+	for i := 0; i < utils.RetryLoop && !replayed; i++ {
+		state, description, err := mrc.helper2.PoolClient.GetMirrorImageStatus(mrc.namespace2, poolName, imageName)
+		if err != nil {
+			logger.Infof("waiting for image %s in cluster %s. %+v", imageName, mrc.namespace2, err)
+		} else {
+			// the replay is complete when no journal entries of the first cluster are left
+			replayed = state == "up+replaying" && strings.Contains(description, "entries_behind_master=0")
+			logger.Infof("image %s in cluster %s is %s: %s", imageName, mrc.namespace2, state, description)
+		}
+		if !replayed {
+			time.Sleep(utils.RetryInterval * time.Second)
+		}
+	}
+	assert.True(mrc.T(), replayed)
+}
+
 //MCTestOperations struct for handling panic and test suite tear down
 type MCTestOperations struct {
 	installer   *installer.InstallHelper
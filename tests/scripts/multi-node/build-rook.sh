@@ -28,7 +28,7 @@ function purge_rook_pods {
   kubectl delete storageclass rook-ceph-block || true
   kubectl delete -f kube-registry.yaml || true
   kubectl delete -n rook-ceph cluster rook-ceph || true
-  kubectl delete crd clusters.ceph.rook.io pools.ceph.rook.io objectstores.ceph.rook.io filesystems.ceph.rook.io volumes.rook.io || true
+  kubectl delete crd clusters.ceph.rook.io pools.ceph.rook.io objectstores.ceph.rook.io filesystems.ceph.rook.io volumes.rook.io deviceinventories.rook.io || true
   kubectl delete -n rook-ceph-system daemonset rook-ceph-agent || true
   kubectl delete -f operator.yaml || true
   kubectl delete clusterroles rook-ceph-agent || true